@@ -2,25 +2,27 @@ package app
 
 import (
 	"encoding/json"
-	"fmt"
 	"net/http"
+	"sync/atomic"
 	"time"
 
 	appconfig "payment-service/app/app_config"
+	"payment-service/app/clock"
+	"payment-service/app/encryption"
 	"payment-service/app/logger"
+	"payment-service/app/metrics"
+	"payment-service/app/tracing"
+	"payment-service/errors"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	_ "github.com/lib/pq"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
 const DBDriverPostgres = "postgres"
 
-var myApp *application
-
-type application struct {
+type Application struct {
 	id            string
 	env           string
 	router        *chi.Mux
@@ -30,6 +32,13 @@ type application struct {
 	dbConnections map[string]dbConnection
 	config        *viper.Viper
 	logger        *logger.Logger
+	keyring       *encryption.Keyring
+	clock         clock.Clock
+	workers       []*registeredWorker
+	shuttingDown  atomic.Bool
+	// undrained is set when requests or workers were still running at the
+	// end of the shutdown timeout, so Clean leaves the database open.
+	undrained bool
 }
 
 type dbConfig struct {
@@ -52,79 +61,113 @@ type dbConnection struct {
 }
 
 type httpServer struct {
-	host     string
-	port     string
-	cors     bool
-	httpLogs bool
+	host            string
+	port            string
+	cors            bool
+	httpLogs        bool
+	shutdownTimeout time.Duration
 }
 
-func App() *application {
-	if myApp == nil {
-		return newApp()
-	}
-	return myApp
+// New returns the application configured from the .env file and the
+// environment, with its database connections open.
+func New() *Application {
+	app := &Application{}
+	return app.readConfig().setup()
 }
 
-func newApp() *application {
-	myApp = &application{}
-	myApp.configure()
-	return myApp
+// NewWithConfig returns the application configured from config instead of
+// the .env file and the environment, for tests. Only the databases under
+// config's db.* keys are connected.
+func NewWithConfig(config *viper.Viper) *Application {
+	app := &Application{config: config}
+	return app.setup()
 }
 
-func (app *application) Env() string {
+func (app *Application) Env() string {
 	return app.env
 }
 
-func (app *application) Id() string {
+func (app *Application) Id() string {
 	return app.id
 }
-func (app *application) Debug() *logger.Debug {
+func (app *Application) Debug() *logger.Debug {
 	return app.debug
 }
-func (app *application) Router() *chi.Mux {
+func (app *Application) Router() *chi.Mux {
 	return app.router
 }
 
-func (app *application) configure() *application {
-	app.readConfig().
-		setupLogger().
+func (app *Application) setup() *Application {
+	app.clock = clock.System()
+	app.setupLogger().
 		setConfig().
+		setupEncryption().
+		setupTracing().
 		setupDbConnections().
+		setupMetrics().
 		setupRouter()
 	return app
 }
 
-func (app *application) setupLogger() *application {
-	logger := logger.GetLogger()
-	app.logger = logger
+// setupLogger configures the application logger from app.log_* settings.
+// Sampling defaults to 100 identical entries per second, then every 100th.
+func (app *Application) setupLogger() *Application {
+	config := app.Config()
+	debug := &logger.Debug{
+		Id:                 config.GetString("app.id"),
+		Enabled:            true,
+		Level:              config.GetString("app.log_level"),
+		Format:             config.GetString("app.log_format"),
+		SamplingInitial:    100,
+		SamplingThereafter: 100,
+	}
+	if debug.Format == "" {
+		debug.Format = logger.LogFormatConsole
+	}
+	if config.IsSet("app.log_sampling_initial") {
+		debug.SamplingInitial = config.GetInt("app.log_sampling_initial")
+	}
+	if config.IsSet("app.log_sampling_thereafter") {
+		debug.SamplingThereafter = config.GetInt("app.log_sampling_thereafter")
+	}
+	app.logger = logger.NewLogger(debug)
 	return app
 }
 
-func (app *application) Logger() *logger.Logger {
+func (app *Application) Logger() *logger.Logger {
 	return app.logger
 }
 
-func (app *application) setupRouter() *application {
+func (app *Application) setupRouter() *Application {
+	trustedProxies, err := ParseTrustedProxies(app.Config().GetString("app.trusted_proxies"))
+	if err != nil {
+		app.Logger().Panic("invalid app.trusted_proxies: ", err)
+	}
+
 	r := chi.NewRouter()
 
+	r.Use(tracing.HttpMiddleware)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(errorDocs(app.Config().GetString("errors.docs_url")))
+	r.Use(errorLog(app.Logger()))
+	r.Use(RealIp(trustedProxies))
+	r.Use(metrics.HttpMiddleware)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.NoCache)
 	r.Use(middleware.Timeout(30 * time.Second))
-
-	l := logrus.New()
-	l.Formatter = &logrus.JSONFormatter{
-		// disable, as we set our own
-		DisableTimestamp: true,
-	}
-	r.Use(logger.NewStructuredLogger(l))
+	r.Use(logger.NewRequestLogger(app.Logger()))
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, &errors.NotFoundError{Message: "no route matches " + r.URL.Path})
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		WriteProblem(w, NewProblem(r, errors.CodeMethodNotAllowed, http.StatusMethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path))
+	})
 	app.router = r
 	return app
 
 }
 
-func (app *application) setConfig() *application {
+func (app *Application) setConfig() *Application {
 
 	app.Logger().Debug("setting config")
 
@@ -135,6 +178,11 @@ func (app *application) setConfig() *application {
 		port:     app.Config().GetString("app.port"),
 		cors:     app.Config().GetBool("app.cors"),
 		httpLogs: app.Config().GetBool("app.httpLogs"),
+
+		shutdownTimeout: app.Config().GetDuration("app.shutdown_timeout"),
+	}
+	if app.httpServer.shutdownTimeout <= 0 {
+		app.httpServer.shutdownTimeout = defaultShutdownTimeout
 	}
 
 	app.debug = app.Logger().Config
@@ -146,7 +194,6 @@ func (app *application) setConfig() *application {
 		app.Logger().Error(err)
 	}
 
-	fmt.Println(string(configJson))
 	err = json.Unmarshal(configJson, &dbConfiguration)
 	if err != nil {
 		app.Logger().Error(err)
@@ -161,34 +208,45 @@ func (app *application) setConfig() *application {
 	return app
 }
 
-func (app *application) Config() *viper.Viper {
+func (app *Application) setupEncryption() *Application {
+	keyring, err := encryption.LoadKeyring(app.Config())
+	if err != nil {
+		app.Logger().Panic("invalid encryption config: ", err)
+	}
+	if !keyring.Enabled() {
+		app.Logger().Warn("no encryption master key configured, payloads are stored in plaintext")
+	}
+	app.keyring = keyring
+	return app
+}
+
+func (app *Application) Keyring() *encryption.Keyring {
+	return app.keyring
+}
+
+func (app *Application) Config() *viper.Viper {
 	return app.config
 }
 
-var readConfig = false
+// Clock is the clock services tell the time with.
+func (app *Application) Clock() clock.Clock {
+	return app.clock
+}
 
-func (app *application) readConfig() *application {
+func (app *Application) readConfig() *Application {
 	app.config = appconfig.ReadConfig()
 	return app
 }
 
-func (app *application) SetRoutes(routes []Route) *application {
+func (app *Application) SetRoutes(routes []Route) *Application {
 	r := app.router
 	for _, route := range routes {
+		if route.Middlewares != nil {
+			r.With(*route.Middlewares...).MethodFunc(route.Method, route.Pattern, route.HandlerFunc)
+			continue
+		}
 		r.MethodFunc(route.Method, route.Pattern, route.HandlerFunc)
 	}
 	return app
 
 }
-
-func (app *application) StartServer() {
-
-	// print app name
-	app.Logger().Infof("Starting project %s", app.id)
-
-	app.Logger().Infof("server started http://%s:%s", app.httpServer.host, app.httpServer.port)
-	err := http.ListenAndServe("0.0.0.0:"+app.httpServer.port, app.router)
-	if err != nil {
-		app.Logger().Panic(err)
-	}
-}
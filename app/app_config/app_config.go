@@ -24,12 +24,72 @@ func ReadConfig() *viper.Viper {
 	v.BindEnv("app.host", "APP_HOST")
 	v.BindEnv("app.port", "APP_PORT")
 	v.BindEnv("app.httplogs", "APP_HTTPLOGS")
+	v.BindEnv("app.shutdown_timeout", "APP_SHUTDOWN_TIMEOUT")
+	v.BindEnv("app.trusted_proxies", "APP_TRUSTED_PROXIES")
+	v.BindEnv("app.log_level", "APP_LOG_LEVEL")
+	v.BindEnv("app.log_format", "APP_LOG_FORMAT")
+	v.BindEnv("app.log_sampling_initial", "APP_LOG_SAMPLING_INITIAL")
+	v.BindEnv("app.log_sampling_thereafter", "APP_LOG_SAMPLING_THEREAFTER")
+	v.BindEnv("errors.docs_url", "ERRORS_DOCS_URL")
 	v.BindEnv("db.postgres.dsn", "DB_POSTGRES_DSN")
+	v.BindEnv("migrations.dir", "MIGRATIONS_DIR")
+	v.BindEnv("migrations.allow_pending", "MIGRATIONS_ALLOW_PENDING")
 	v.BindEnv("payment.stripe_secret_key", "STRIPE_SECRET_KEY")
 	v.BindEnv("payment.stripe_endpoint_secret", "STRIPE_ENDPOINT_SECRET")
 	v.BindEnv("payment.authorize_login_id", "AUTHORIZE_LOGIN_ID")
 	v.BindEnv("payment.authorize_transaction_key", "AUTHORIZE_TRANSACTION_KEY")
 	v.BindEnv("payment.authorize_net_webhook_signature_key", "AUTHORIZE_NET_WEBHOOK_SIGNATURE_KEY")
+	v.BindEnv("payment.authorize_fee_percent", "AUTHORIZE_FEE_PERCENT")
+	v.BindEnv("payment.authorize_fee_fixed", "AUTHORIZE_FEE_FIXED")
+	v.BindEnv("payment.authorize_settlement_currency", "AUTHORIZE_SETTLEMENT_CURRENCY")
+	v.BindEnv("payment.stripe_timeout", "STRIPE_TIMEOUT")
+	v.BindEnv("payment.authorize_timeout", "AUTHORIZE_TIMEOUT")
+	v.BindEnv("payment.stripe_retry_max_attempts", "STRIPE_RETRY_MAX_ATTEMPTS")
+	v.BindEnv("payment.stripe_retry_base_delay", "STRIPE_RETRY_BASE_DELAY")
+	v.BindEnv("payment.stripe_retry_max_delay", "STRIPE_RETRY_MAX_DELAY")
+	v.BindEnv("payment.authorize_retry_max_attempts", "AUTHORIZE_RETRY_MAX_ATTEMPTS")
+	v.BindEnv("payment.authorize_retry_base_delay", "AUTHORIZE_RETRY_BASE_DELAY")
+	v.BindEnv("payment.authorize_retry_max_delay", "AUTHORIZE_RETRY_MAX_DELAY")
+	v.BindEnv("payment.stripe_currencies", "STRIPE_CURRENCIES")
+	v.BindEnv("payment.authorize_currencies", "AUTHORIZE_CURRENCIES")
+	v.BindEnv("payment.stripe_card_deposits", "STRIPE_CARD_DEPOSITS")
+	v.BindEnv("payment.stripe_base_url", "STRIPE_BASE_URL")
+	v.BindEnv("payment.authorize_base_url", "AUTHORIZE_BASE_URL")
+	v.BindEnv("routing.bin_countries_file", "ROUTING_BIN_COUNTRIES_FILE")
+	v.BindEnv("routing.approval_rate_window", "ROUTING_APPROVAL_RATE_WINDOW")
+	v.BindEnv("routing.approval_rate_min_samples", "ROUTING_APPROVAL_RATE_MIN_SAMPLES")
+	v.BindEnv("circuit_breaker.window", "CIRCUIT_BREAKER_WINDOW")
+	v.BindEnv("circuit_breaker.minimum_calls", "CIRCUIT_BREAKER_MINIMUM_CALLS")
+	v.BindEnv("circuit_breaker.failure_rate", "CIRCUIT_BREAKER_FAILURE_RATE")
+	v.BindEnv("circuit_breaker.slow_call_duration", "CIRCUIT_BREAKER_SLOW_CALL_DURATION")
+	v.BindEnv("circuit_breaker.slow_call_rate", "CIRCUIT_BREAKER_SLOW_CALL_RATE")
+	v.BindEnv("circuit_breaker.cool_down", "CIRCUIT_BREAKER_COOL_DOWN")
+	v.BindEnv("circuit_breaker.half_open_calls", "CIRCUIT_BREAKER_HALF_OPEN_CALLS")
+	v.BindEnv("auth.require_signature", "AUTH_REQUIRE_SIGNATURE")
+	v.BindEnv("auth.signature_tolerance", "AUTH_SIGNATURE_TOLERANCE")
+	v.BindEnv("ratelimit.disabled", "RATE_LIMIT_DISABLED")
+	v.BindEnv("ratelimit.store", "RATE_LIMIT_STORE")
+	v.BindEnv("ratelimit.payments.per_minute", "RATE_LIMIT_PAYMENTS_PER_MINUTE")
+	v.BindEnv("ratelimit.payments.burst", "RATE_LIMIT_PAYMENTS_BURST")
+	v.BindEnv("ratelimit.read.per_minute", "RATE_LIMIT_READ_PER_MINUTE")
+	v.BindEnv("ratelimit.read.burst", "RATE_LIMIT_READ_BURST")
+	v.BindEnv("ratelimit.admin.per_minute", "RATE_LIMIT_ADMIN_PER_MINUTE")
+	v.BindEnv("ratelimit.admin.burst", "RATE_LIMIT_ADMIN_BURST")
+	v.BindEnv("ratelimit.webhooks.per_minute", "RATE_LIMIT_WEBHOOKS_PER_MINUTE")
+	v.BindEnv("ratelimit.webhooks.burst", "RATE_LIMIT_WEBHOOKS_BURST")
+	v.BindEnv("ratelimit.clients.per_minute", "RATE_LIMIT_CLIENTS_PER_MINUTE")
+	v.BindEnv("ratelimit.clients.burst", "RATE_LIMIT_CLIENTS_BURST")
+	v.BindEnv("encryption.master_keys", "ENCRYPTION_MASTER_KEYS")
+	v.BindEnv("encryption.master_key_file", "ENCRYPTION_MASTER_KEY_FILE")
+	v.BindEnv("encryption.active_key_id", "ENCRYPTION_ACTIVE_KEY_ID")
+	v.BindEnv("encryption.reencrypt_interval", "ENCRYPTION_REENCRYPT_INTERVAL")
+	v.BindEnv("alerts.webhook_url", "ALERTS_WEBHOOK_URL")
+	v.BindEnv("tracing.exporter", "OTEL_TRACES_EXPORTER")
+	v.BindEnv("tracing.service_name", "OTEL_SERVICE_NAME")
+	v.BindEnv("tracing.sample_ratio", "OTEL_TRACES_SAMPLER_ARG")
+	v.BindEnv("tracing.otlp_endpoint", "OTEL_EXPORTER_OTLP_ENDPOINT")
+	v.BindEnv("tracing.otlp_traces_endpoint", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	v.BindEnv("tracing.otlp_headers", "OTEL_EXPORTER_OTLP_HEADERS")
 	v.Set("db.postgres.driver", "postgres")
 	v.Set("db.postgres.name", "postgres")
 
@@ -3,9 +3,10 @@ package app
 import (
 	"errors"
 	_ "github.com/lib/pq"
+	"gorm.io/gorm"
 )
 
-func (app *application) GetDbConnectionByName(connName string) (dbConnection, error) {
+func (app *Application) GetDbConnectionByName(connName string) (dbConnection, error) {
 
 	errMsg := "connection is not defined, connection name: " + connName
 
@@ -18,7 +19,7 @@ func (app *application) GetDbConnectionByName(connName string) (dbConnection, er
 	return dbConnection{}, errors.New(errMsg)
 }
 
-func (app *application) setupDbConnections() *application {
+func (app *Application) setupDbConnections() *Application {
 
 	app.Logger().Debug("setup DB Connections")
 
@@ -41,25 +42,36 @@ func (app *application) setupDbConnections() *application {
 	return app
 }
 
-func (app *application) Clean() *application {
+func (app *Application) Clean() *Application {
 
 	app.Logger().Debug("clean before shutdown")
 
-	app.CloseConnections()
+	if app.undrained {
+		app.Logger().Warn("requests or workers are still running, leaving database connections to close on exit")
+	} else {
+		app.CloseConnections()
+	}
+	app.shutdownTracing()
 
 	return app
 }
 
-func (app *application) CloseConnections() *application {
+func (app *Application) CloseConnections() *Application {
 
 	app.Logger().Debugf("CloseDbConnections")
 
+	for name, dbConnection := range app.dbConnections {
+		if err := closeDbConnection(dbConnection); err != nil {
+			app.Logger().Errorf("failed to close db connection %s: %s", name, err)
+		}
+	}
+
 	dbConnections := make(map[string]dbConnection)
 	app.dbConnections = dbConnections
 	return app
 }
 
-func (app *application) createDbConnection(dbConfig dbConfig) (interface{}, error) {
+func (app *Application) createDbConnection(dbConfig dbConfig) (interface{}, error) {
 
 	switch dbConfig.Driver {
 
@@ -69,3 +81,15 @@ func (app *application) createDbConnection(dbConfig dbConfig) (interface{}, erro
 
 	return nil, errors.New("Can't handle connection for driver [" + dbConfig.Driver + "] of connection [" + dbConfig.Name + "]")
 }
+
+func closeDbConnection(dbConnection dbConnection) error {
+	switch conn := dbConnection.connection.(type) {
+	case *gorm.DB:
+		sqlDB, err := conn.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.Close()
+	}
+	return nil
+}
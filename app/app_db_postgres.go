@@ -1,15 +1,18 @@
 package app
 
 import (
+	"errors"
 	"time"
 
+	"payment-service/app/tracing"
+
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func (app *application) GetPgDbConnectionByName(connectionName string) (*gorm.DB, error) {
+func (app *Application) GetPgDbConnectionByName(connectionName string) (*gorm.DB, error) {
 	dbConn, err := app.GetDbConnectionByName(connectionName)
 
 	if err != nil {
@@ -21,13 +24,14 @@ func (app *application) GetPgDbConnectionByName(connectionName string) (*gorm.DB
 		errMsg := "connection error, connection name: " + connectionName
 
 		app.Logger().Error(errMsg)
+		return nil, errors.New(errMsg)
 	}
 
 	conn := dbConn.connection.(*gorm.DB)
 	return conn, nil
 }
 
-func (app *application) createPostgresDbConnection(dbConfig dbConfig) (*gorm.DB, error) {
+func (app *Application) createPostgresDbConnection(dbConfig dbConfig) (*gorm.DB, error) {
 	dsn, _ := pq.ParseURL(dbConfig.DSN)
 
 	app.Logger().Info("Connecting to Postgres db at ", dbConfig.Name)
@@ -40,6 +44,10 @@ func (app *application) createPostgresDbConnection(dbConfig dbConfig) (*gorm.DB,
 	}
 	app.Logger().Info("Connected to Postgres db successfully at ", dbConfig.Name)
 
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		app.Logger().Error("failed to register gorm tracing: ", err.Error())
+	}
+
 	return db, nil
 }
 
@@ -0,0 +1,125 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+// Health check statuses.
+const (
+	HealthOk     = "ok"
+	HealthFailed = "failed"
+)
+
+type HealthCheck struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+type HealthReport struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// Ready reports whether every check passed.
+func (self HealthReport) Ready() bool {
+	return self.Status == HealthOk
+}
+
+// Readiness checks that the server can serve traffic: it is not shutting
+// down, every database connection answers a ping, no migrations are pending
+// (unless migrations.allow_pending is set) and no background worker has
+// failed.
+func (app *Application) Readiness(ctx context.Context) HealthReport {
+	report := HealthReport{Status: HealthOk, Checks: make([]HealthCheck, 0)}
+	add := func(check HealthCheck) {
+		if check.Status != HealthOk {
+			report.Status = HealthFailed
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	shutdown := HealthCheck{Name: "shutdown", Status: HealthOk}
+	if app.IsShuttingDown() {
+		shutdown.Status = HealthFailed
+		shutdown.Detail = "draining requests"
+	}
+	add(shutdown)
+
+	names := make([]string, 0, len(app.dbConnections))
+	for name := range app.dbConnections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		connection := app.dbConnections[name]
+		add(timedCheck("db:"+name, func() (string, error) {
+			db, ok := connection.connection.(*gorm.DB)
+			if !ok {
+				return "", nil
+			}
+			sqlDB, err := db.DB()
+			if err != nil {
+				return "", err
+			}
+			pingCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+			return "", sqlDB.PingContext(pingCtx)
+		}))
+	}
+
+	add(timedCheck("migrations", func() (string, error) {
+		m, err := app.Migrator()
+		if err != nil {
+			return "", err
+		}
+		pending, err := m.Pending()
+		if err != nil {
+			return "", err
+		}
+		if len(pending) == 0 {
+			return "", nil
+		}
+		detail := strconv.Itoa(len(pending)) + " pending migrations"
+		if app.Config().GetBool("migrations.allow_pending") {
+			return detail + " (allowed)", nil
+		}
+		return "", errors.New(detail)
+	}))
+
+	for _, worker := range app.workers {
+		state, err := worker.getState()
+		check := HealthCheck{Name: "worker:" + worker.name, Status: HealthOk, Detail: state}
+		if state == workerFailed {
+			check.Status = HealthFailed
+			check.Detail = state + ": " + err
+		}
+		add(check)
+	}
+	return report
+}
+
+func timedCheck(name string, check func() (string, error)) HealthCheck {
+	start := time.Now()
+	detail, err := check()
+	result := HealthCheck{
+		Name:       name,
+		Status:     HealthOk,
+		Detail:     detail,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = HealthFailed
+		result.Detail = err.Error()
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"database/sql"
+	"sort"
+	"sync"
+
+	"payment-service/app/metrics"
+
+	"gorm.io/gorm"
+)
+
+// poolMetrics are registered once per process, like every metric, and
+// report the pools of every application set up since.
+var poolMetrics struct {
+	sync.Mutex
+	once sync.Once
+	apps []*Application
+}
+
+// setupMetrics exposes the connection pool stats of every gorm connection,
+// read on each scrape and labelled with the connection name.
+func (app *Application) setupMetrics() *Application {
+	poolMetrics.Lock()
+	poolMetrics.apps = append(poolMetrics.apps, app)
+	poolMetrics.Unlock()
+	poolMetrics.once.Do(registerPoolMetrics)
+	return app
+}
+
+func registerPoolMetrics() {
+	eachDbStats := func(fn func(db string, stats sql.DBStats)) {
+		poolMetrics.Lock()
+		apps := append([]*Application(nil), poolMetrics.apps...)
+		poolMetrics.Unlock()
+		for _, app := range apps {
+			app.eachDbStats(fn)
+		}
+	}
+	poolGauge := func(name string, help string, value func(stats sql.DBStats) float64) {
+		metrics.NewGaugeFunc(name, help, []string{"db"}, func(observe func(float64, ...string)) {
+			eachDbStats(func(db string, stats sql.DBStats) {
+				observe(value(stats), db)
+			})
+		})
+	}
+	poolCounter := func(name string, help string, value func(stats sql.DBStats) float64) {
+		metrics.NewCounterFunc(name, help, []string{"db"}, func(observe func(float64, ...string)) {
+			eachDbStats(func(db string, stats sql.DBStats) {
+				observe(value(stats), db)
+			})
+		})
+	}
+
+	poolGauge("db_pool_max_open_connections", "Maximum number of open connections to the database.",
+		func(stats sql.DBStats) float64 { return float64(stats.MaxOpenConnections) })
+	poolGauge("db_pool_open_connections", "Established connections, both in use and idle.",
+		func(stats sql.DBStats) float64 { return float64(stats.OpenConnections) })
+	poolGauge("db_pool_in_use_connections", "Connections currently in use.",
+		func(stats sql.DBStats) float64 { return float64(stats.InUse) })
+	poolGauge("db_pool_idle_connections", "Idle connections.",
+		func(stats sql.DBStats) float64 { return float64(stats.Idle) })
+	poolCounter("db_pool_wait_count_total", "Connections waited for.",
+		func(stats sql.DBStats) float64 { return float64(stats.WaitCount) })
+	poolCounter("db_pool_wait_duration_seconds_total", "Time blocked waiting for a new connection.",
+		func(stats sql.DBStats) float64 { return stats.WaitDuration.Seconds() })
+	poolCounter("db_pool_max_idle_closed_total", "Connections closed due to SetMaxIdleConns.",
+		func(stats sql.DBStats) float64 { return float64(stats.MaxIdleClosed) })
+	poolCounter("db_pool_max_idle_time_closed_total", "Connections closed due to SetConnMaxIdleTime.",
+		func(stats sql.DBStats) float64 { return float64(stats.MaxIdleTimeClosed) })
+	poolCounter("db_pool_max_lifetime_closed_total", "Connections closed due to SetConnMaxLifetime.",
+		func(stats sql.DBStats) float64 { return float64(stats.MaxLifetimeClosed) })
+}
+
+func (app *Application) eachDbStats(fn func(db string, stats sql.DBStats)) {
+	names := make([]string, 0, len(app.dbConnections))
+	for name := range app.dbConnections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		conn, ok := app.dbConnections[name].connection.(*gorm.DB)
+		if !ok {
+			continue
+		}
+		sqlDB, err := conn.DB()
+		if err != nil {
+			continue
+		}
+		fn(name, sqlDB.Stats())
+	}
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"errors"
+	"strconv"
+
+	"payment-service/app/migrator"
+)
+
+const defaultMigrationsDir = "./migrations"
+
+func (app *Application) MigrationsDir() string {
+	dir := app.Config().GetString("migrations.dir")
+	if dir == "" {
+		return defaultMigrationsDir
+	}
+	return dir
+}
+
+func (app *Application) Migrator() (*migrator.Migrator, error) {
+	db, err := app.GetPgDbConnectionByName(DBDriverPostgres)
+	if err != nil {
+		return nil, err
+	}
+	return migrator.New(db, app.MigrationsDir(), app.Clock()), nil
+}
+
+// CheckMigrations refuses to let the server start while migrations are
+// pending, unless migrations.allow_pending is set.
+func (app *Application) CheckMigrations() error {
+	m, err := app.Migrator()
+	if err != nil {
+		return err
+	}
+
+	pending, err := m.Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if app.Config().GetBool("migrations.allow_pending") {
+		app.Logger().Warnf("starting with %d pending migrations", len(pending))
+		return nil
+	}
+	return errors.New(strconv.Itoa(len(pending)) + " pending migrations, run `migrate up` before starting the server")
+}
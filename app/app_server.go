@@ -0,0 +1,149 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultShutdownTimeout = 30 * time.Second
+
+// Worker is a background job started with the server. It must return once
+// ctx is cancelled, which happens when the server begins shutting down.
+type Worker func(ctx context.Context)
+
+type registeredWorker struct {
+	name  string
+	run   Worker
+	mutex sync.Mutex
+	state string
+	err   string
+}
+
+// Worker states reported by the readiness check. A worker that returns
+// before shutdown is stopped, one that panics is failed.
+const (
+	workerPending = "pending"
+	workerRunning = "running"
+	workerStopped = "stopped"
+	workerFailed  = "failed"
+)
+
+func (app *Application) RegisterWorker(name string, worker Worker) *Application {
+	app.workers = append(app.workers, &registeredWorker{name: name, run: worker, state: workerPending})
+	return app
+}
+
+func (self *registeredWorker) setState(state string, err string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.state = state
+	self.err = err
+}
+
+func (self *registeredWorker) getState() (string, string) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.state, self.err
+}
+
+// runWorker runs worker until it returns. A panic is logged and marks the
+// worker failed instead of crashing the server, so readiness reports it.
+func (app *Application) runWorker(ctx context.Context, worker *registeredWorker) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			app.Logger().Errorf("worker %s panicked: %v", worker.name, recovered)
+			worker.setState(workerFailed, fmt.Sprint(recovered))
+		}
+	}()
+
+	worker.setState(workerRunning, "")
+	app.Logger().Infof("worker %s started", worker.name)
+	worker.run(ctx)
+	worker.setState(workerStopped, "")
+	app.Logger().Infof("worker %s stopped", worker.name)
+}
+
+// IsShuttingDown reports whether a termination signal has been received and
+// the server is draining in-flight requests.
+func (app *Application) IsShuttingDown() bool {
+	return app.shuttingDown.Load()
+}
+
+// StartServer serves HTTP until SIGINT or SIGTERM, then stops accepting
+// connections and waits up to app.shutdownTimeout for in-flight requests and
+// workers to finish. Database connections are closed by Clean, unless
+// requests or workers were still running when the timeout passed: closing
+// the database under them would fail their writes half way, so the
+// connections are left for the process exit to close.
+func (app *Application) StartServer() {
+
+	// print app name
+	app.Logger().Infof("Starting project %s", app.id)
+
+	server := &http.Server{
+		Addr:    "0.0.0.0:" + app.httpServer.port,
+		Handler: app.router,
+	}
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var workers sync.WaitGroup
+	for _, worker := range app.workers {
+		workers.Add(1)
+		go func(worker *registeredWorker) {
+			defer workers.Done()
+			app.runWorker(workersCtx, worker)
+		}(worker)
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		app.Logger().Infof("server started http://%s:%s", app.httpServer.host, app.httpServer.port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-serverErr:
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			app.Logger().Panic(err)
+		}
+		return
+	case sig := <-signals:
+		app.Logger().Infof("received %s, draining requests for up to %s", sig, app.httpServer.shutdownTimeout)
+	}
+
+	app.shuttingDown.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), app.httpServer.shutdownTimeout)
+	defer cancel()
+
+	stopWorkers()
+	if err := server.Shutdown(ctx); err != nil {
+		app.Logger().Error("server did not drain before the shutdown timeout: ", err.Error())
+		app.undrained = true
+	}
+
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-ctx.Done():
+		app.Logger().Error("workers did not stop before the shutdown timeout")
+		app.undrained = true
+	}
+
+	app.Logger().Info("server stopped")
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"payment-service/app/tracing"
+)
+
+const defaultOtlpEndpoint = "http://localhost:4318/v1/traces"
+
+// setupTracing configures the span exporter from the standard OTEL_*
+// variables. Tracing is off unless OTEL_TRACES_EXPORTER is stdout or otlp.
+func (app *Application) setupTracing() *Application {
+	config := tracing.Config{
+		Resource: tracing.Resource{
+			ServiceName: app.Config().GetString("tracing.service_name"),
+			Attributes: []tracing.Attribute{
+				tracing.String("deployment.environment", app.env),
+			},
+		},
+		SampleRatio: 1,
+		OnError: func(err error) {
+			app.Logger().Error("failed to export spans: ", err.Error())
+		},
+	}
+	if config.Resource.ServiceName == "" {
+		config.Resource.ServiceName = "payment-service"
+	}
+	if app.Config().IsSet("tracing.sample_ratio") {
+		config.SampleRatio = app.Config().GetFloat64("tracing.sample_ratio")
+	}
+
+	switch exporter := strings.ToLower(app.Config().GetString("tracing.exporter")); exporter {
+	case "", "none":
+		return app
+	case "stdout", "console":
+		config.Exporter = tracing.NewStdoutExporter()
+	case "otlp":
+		endpoint := app.Config().GetString("tracing.otlp_traces_endpoint")
+		if endpoint == "" && app.Config().GetString("tracing.otlp_endpoint") != "" {
+			endpoint = strings.TrimRight(app.Config().GetString("tracing.otlp_endpoint"), "/") + "/v1/traces"
+		}
+		if endpoint == "" {
+			endpoint = defaultOtlpEndpoint
+		}
+		config.Exporter = tracing.NewOtlpExporter(endpoint, parseOtlpHeaders(app.Config().GetString("tracing.otlp_headers")))
+	default:
+		app.Logger().Panic("unknown OTEL_TRACES_EXPORTER: ", exporter)
+	}
+
+	tracing.Setup(config)
+	app.Logger().Infof("tracing enabled, exporting %.0f%% of traces", config.SampleRatio*100)
+	return app
+}
+
+func (app *Application) shutdownTracing() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracing.Shutdown(ctx); err != nil {
+		app.Logger().Error("failed to flush spans: ", err.Error())
+	}
+}
+
+// parseOtlpHeaders parses OTEL_EXPORTER_OTLP_HEADERS, a comma separated
+// list of key=value pairs.
+func parseOtlpHeaders(value string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		key, headerValue, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(headerValue)
+	}
+	return headers
+}
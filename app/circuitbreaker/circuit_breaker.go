@@ -0,0 +1,228 @@
+// Package circuitbreaker stops calls to a dependency that keeps failing or
+// responding slowly, and lets a few trial calls through after a cool-down to
+// find out whether it has recovered.
+package circuitbreaker
+
+import (
+	"sync"
+	"time"
+)
+
+// State is the state of a breaker.
+type State string
+
+const (
+	// StateClosed lets every call through.
+	StateClosed State = "closed"
+	// StateOpen rejects every call until the cool-down has passed.
+	StateOpen State = "open"
+	// StateHalfOpen lets up to HalfOpenCalls trial calls through. The breaker
+	// closes when they all succeed and opens again on the first failure.
+	StateHalfOpen State = "half_open"
+)
+
+// Settings configure a breaker. Zero fields use DefaultSettings.
+type Settings struct {
+	// Window is the number of most recent calls the rates are computed over.
+	Window int
+	// MinimumCalls is the number of calls in the window before the breaker
+	// may trip, so a single early failure does not open it.
+	MinimumCalls int
+	// FailureRate opens the breaker when at least this fraction of the
+	// calls in the window failed.
+	FailureRate float64
+	// SlowCallDuration is the duration above which a call counts as slow,
+	// and SlowCallRate the fraction of slow calls that opens the breaker.
+	SlowCallDuration time.Duration
+	SlowCallRate     float64
+	// CoolDown is how long the breaker stays open before half-opening.
+	CoolDown time.Duration
+	// HalfOpenCalls is the number of trial calls let through when half-open.
+	HalfOpenCalls int
+}
+
+// DefaultSettings is used for the fields of Settings left at zero.
+var DefaultSettings = Settings{
+	Window:           20,
+	MinimumCalls:     10,
+	FailureRate:      0.5,
+	SlowCallDuration: 10 * time.Second,
+	SlowCallRate:     0.8,
+	CoolDown:         30 * time.Second,
+	HalfOpenCalls:    3,
+}
+
+func (self Settings) withDefaults() Settings {
+	if self.Window <= 0 {
+		self.Window = DefaultSettings.Window
+	}
+	if self.MinimumCalls <= 0 {
+		self.MinimumCalls = DefaultSettings.MinimumCalls
+	}
+	if self.MinimumCalls > self.Window {
+		self.MinimumCalls = self.Window
+	}
+	if self.FailureRate <= 0 || self.FailureRate > 1 {
+		self.FailureRate = DefaultSettings.FailureRate
+	}
+	if self.SlowCallDuration <= 0 {
+		self.SlowCallDuration = DefaultSettings.SlowCallDuration
+	}
+	if self.SlowCallRate <= 0 || self.SlowCallRate > 1 {
+		self.SlowCallRate = DefaultSettings.SlowCallRate
+	}
+	if self.CoolDown <= 0 {
+		self.CoolDown = DefaultSettings.CoolDown
+	}
+	if self.HalfOpenCalls <= 0 {
+		self.HalfOpenCalls = DefaultSettings.HalfOpenCalls
+	}
+	return self
+}
+
+type outcome struct {
+	failed bool
+	slow   bool
+}
+
+// Breaker is a count-based circuit breaker. It is safe for concurrent use.
+// Every call let through by Allow must be reported with Record, or with
+// Release when it was not made after all.
+type Breaker struct {
+	mutex         sync.Mutex
+	name          string
+	settings      Settings
+	state         State
+	openedAt      time.Time
+	outcomes      []outcome
+	next          int
+	trials        int
+	trialSuccess  int
+	onStateChange func(name string, from State, to State)
+	now           func() time.Time
+}
+
+// New returns a closed breaker. onStateChange, if not nil, is called with
+// the breaker's mutex held on every state change.
+func New(name string, settings Settings, onStateChange func(name string, from State, to State)) *Breaker {
+	return &Breaker{
+		name:          name,
+		settings:      settings.withDefaults(),
+		state:         StateClosed,
+		onStateChange: onStateChange,
+		now:           time.Now,
+	}
+}
+
+func (self *Breaker) Name() string {
+	return self.name
+}
+
+// State returns the current state. An open breaker whose cool-down has
+// passed reports half-open.
+func (self *Breaker) State() State {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.halfOpenIfCooledDown()
+	return self.state
+}
+
+// Allow reports whether a call may be made now.
+func (self *Breaker) Allow() bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.halfOpenIfCooledDown()
+
+	switch self.state {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		if self.trials >= self.settings.HalfOpenCalls {
+			return false
+		}
+		self.trials++
+	}
+	return true
+}
+
+// Release gives back a call let through by Allow that was not made.
+func (self *Breaker) Release() {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.state == StateHalfOpen && self.trials > 0 {
+		self.trials--
+	}
+}
+
+// Record reports the outcome of a call let through by Allow.
+func (self *Breaker) Record(failed bool, duration time.Duration) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	slow := duration >= self.settings.SlowCallDuration
+	switch self.state {
+	case StateHalfOpen:
+		if failed || slow {
+			self.transition(StateOpen)
+			return
+		}
+		self.trialSuccess++
+		if self.trialSuccess >= self.settings.HalfOpenCalls {
+			self.transition(StateClosed)
+		}
+	case StateClosed:
+		self.record(outcome{failed: failed, slow: slow})
+		if self.tripped() {
+			self.transition(StateOpen)
+		}
+	}
+}
+
+func (self *Breaker) record(call outcome) {
+	if len(self.outcomes) < self.settings.Window {
+		self.outcomes = append(self.outcomes, call)
+		return
+	}
+	self.outcomes[self.next] = call
+	self.next = (self.next + 1) % self.settings.Window
+}
+
+func (self *Breaker) tripped() bool {
+	if len(self.outcomes) < self.settings.MinimumCalls {
+		return false
+	}
+	var failed, slow int
+	for _, call := range self.outcomes {
+		if call.failed {
+			failed++
+		}
+		if call.slow {
+			slow++
+		}
+	}
+	calls := float64(len(self.outcomes))
+	return float64(failed)/calls >= self.settings.FailureRate || float64(slow)/calls >= self.settings.SlowCallRate
+}
+
+func (self *Breaker) halfOpenIfCooledDown() {
+	if self.state == StateOpen && self.now().Sub(self.openedAt) >= self.settings.CoolDown {
+		self.transition(StateHalfOpen)
+	}
+}
+
+func (self *Breaker) transition(to State) {
+	from := self.state
+	self.state = to
+	self.trials = 0
+	self.trialSuccess = 0
+	switch to {
+	case StateOpen:
+		self.openedAt = self.now()
+	case StateClosed:
+		self.outcomes = self.outcomes[:0]
+		self.next = 0
+	}
+	if self.onStateChange != nil {
+		self.onStateChange(self.name, from, to)
+	}
+}
@@ -0,0 +1,191 @@
+package circuitbreaker
+
+import (
+	"testing"
+	"time"
+
+	"payment-service/app/clock"
+)
+
+var testSettings = Settings{
+	Window:           10,
+	MinimumCalls:     4,
+	FailureRate:      0.5,
+	SlowCallDuration: time.Second,
+	SlowCallRate:     0.75,
+	CoolDown:         30 * time.Second,
+	HalfOpenCalls:    2,
+}
+
+// newTestBreaker returns a breaker on a fake clock that records its state
+// changes.
+func newTestBreaker(t *testing.T) (*Breaker, *clock.Fake, *[]State) {
+	t.Helper()
+	now := clock.NewFake(time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC))
+	changes := []State{}
+	breaker := New("stripe", testSettings, func(name string, from State, to State) {
+		if name != "stripe" {
+			t.Errorf("state change reported for %q", name)
+		}
+		changes = append(changes, to)
+	})
+	breaker.now = now.Now
+	return breaker, now, &changes
+}
+
+// call makes one call through breaker and reports whether it was let
+// through.
+func call(breaker *Breaker, failed bool, duration time.Duration) bool {
+	if !breaker.Allow() {
+		return false
+	}
+	breaker.Record(failed, duration)
+	return true
+}
+
+func TestBreakerOpensAtTheThreshold(t *testing.T) {
+	tests := []struct {
+		name string
+		// successes are made before calls.
+		successes int
+		calls     []bool
+		slow      bool
+		wantOpen  bool
+	}{
+		{"failures below the minimum calls", 0, []bool{true, true, true}, false, false},
+		{"failure rate reached", 0, []bool{false, true, false, true}, false, true},
+		{"failure rate not reached", 0, []bool{false, false, true, false, false}, false, false},
+		{"slow calls", 0, []bool{false, false, false, false}, true, true},
+		{"failures diluted by the window", testSettings.Window, []bool{true, true, true, true}, false, false},
+		{"failures filling half the window", testSettings.Window, []bool{true, true, true, true, true}, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			breaker, _, changes := newTestBreaker(t)
+			duration := 10 * time.Millisecond
+			if test.slow {
+				duration = 2 * time.Second
+			}
+			for i := 0; i < test.successes; i++ {
+				call(breaker, false, 0)
+			}
+			for i, failed := range test.calls {
+				if !call(breaker, failed, duration) {
+					t.Fatalf("call %d was rejected", i+1)
+				}
+			}
+
+			wantState, wantChanges := StateClosed, 0
+			if test.wantOpen {
+				wantState, wantChanges = StateOpen, 1
+			}
+			if breaker.State() != wantState || len(*changes) != wantChanges {
+				t.Errorf("state %s after changes %v, want %s", breaker.State(), *changes, wantState)
+			}
+			if test.wantOpen && breaker.Allow() {
+				t.Error("an open breaker let a call through")
+			}
+		})
+	}
+}
+
+func TestBreakerHalfOpensAfterTheCoolDown(t *testing.T) {
+	breaker, now, changes := newTestBreaker(t)
+	for i := 0; i < testSettings.MinimumCalls; i++ {
+		call(breaker, true, 0)
+	}
+
+	now.Advance(testSettings.CoolDown - time.Second)
+	if breaker.State() != StateOpen || breaker.Allow() {
+		t.Fatalf("breaker is %s before the cool-down has passed", breaker.State())
+	}
+
+	now.Advance(time.Second)
+	if breaker.State() != StateHalfOpen {
+		t.Fatalf("breaker is %s after the cool-down, want %s", breaker.State(), StateHalfOpen)
+	}
+
+	// Only HalfOpenCalls probes are let through at a time, and a released
+	// probe makes room for another.
+	if !breaker.Allow() || !breaker.Allow() {
+		t.Fatal("half-open breaker rejected a probe")
+	}
+	if breaker.Allow() {
+		t.Fatal("half-open breaker let more than HalfOpenCalls probes through")
+	}
+	breaker.Release()
+	if !breaker.Allow() {
+		t.Fatal("half-open breaker rejected a probe after one was released")
+	}
+
+	want := []State{StateOpen, StateHalfOpen}
+	if len(*changes) != len(want) || (*changes)[0] != want[0] || (*changes)[1] != want[1] {
+		t.Errorf("state changes %v, want %v", *changes, want)
+	}
+}
+
+func TestBreakerReopensOnAFailedProbe(t *testing.T) {
+	for _, slow := range []bool{false, true} {
+		breaker, now, _ := newTestBreaker(t)
+		for i := 0; i < testSettings.MinimumCalls; i++ {
+			call(breaker, true, 0)
+		}
+		now.Advance(testSettings.CoolDown)
+
+		breaker.Allow()
+		breaker.Allow()
+		breaker.Record(false, 0)
+		if slow {
+			breaker.Record(false, testSettings.SlowCallDuration)
+		} else {
+			breaker.Record(true, 0)
+		}
+		if breaker.State() != StateOpen || breaker.Allow() {
+			t.Errorf("slow %t: breaker is %s after a failed probe, want %s", slow, breaker.State(), StateOpen)
+		}
+
+		// The cool-down starts again from the failed probe.
+		now.Advance(testSettings.CoolDown - time.Second)
+		if breaker.State() != StateOpen {
+			t.Errorf("slow %t: breaker is %s before the new cool-down has passed", slow, breaker.State())
+		}
+	}
+}
+
+func TestBreakerResetsWhenProbesSucceed(t *testing.T) {
+	breaker, now, changes := newTestBreaker(t)
+	for i := 0; i < testSettings.MinimumCalls; i++ {
+		call(breaker, true, 0)
+	}
+	now.Advance(testSettings.CoolDown)
+
+	for i := 0; i < testSettings.HalfOpenCalls; i++ {
+		if !call(breaker, false, 0) {
+			t.Fatalf("probe %d was rejected", i+1)
+		}
+	}
+	if breaker.State() != StateClosed {
+		t.Fatalf("breaker is %s after every probe succeeded, want %s", breaker.State(), StateClosed)
+	}
+	want := []State{StateOpen, StateHalfOpen, StateClosed}
+	for i := range want {
+		if len(*changes) != len(want) || (*changes)[i] != want[i] {
+			t.Fatalf("state changes %v, want %v", *changes, want)
+		}
+	}
+
+	// The failures from before the breaker opened are forgotten: it takes
+	// MinimumCalls new calls to trip it again.
+	for i := 0; i < testSettings.MinimumCalls-1; i++ {
+		if !call(breaker, true, 0) {
+			t.Fatalf("call %d after closing was rejected", i+1)
+		}
+	}
+	if breaker.State() != StateClosed {
+		t.Fatalf("breaker is %s before MinimumCalls new calls", breaker.State())
+	}
+	call(breaker, true, 0)
+	if breaker.State() != StateOpen {
+		t.Errorf("breaker is %s after MinimumCalls failures, want %s", breaker.State(), StateOpen)
+	}
+}
@@ -0,0 +1,57 @@
+// Package clock tells services the time, so that time-dependent behaviour
+// such as expiry, signature skew and routing schedules can be tested at a
+// chosen time.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+// System returns the clock of the operating system.
+func System() Clock {
+	return systemClock{}
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Fake is a clock that only moves when it is set or advanced. It is safe
+// for concurrent use.
+type Fake struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// NewFake returns a fake clock at now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (self *Fake) Now() time.Time {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.now
+}
+
+// Set moves the clock to now.
+func (self *Fake) Set(now time.Time) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.now = now
+}
+
+// Advance moves the clock forward by d.
+func (self *Fake) Advance(d time.Duration) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.now = self.now.Add(d)
+}
@@ -1,12 +1,45 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
+	stderrors "errors"
+	"github.com/go-chi/chi/middleware"
 	"github.com/go-playground/validator/v10"
 	"net/http"
+	"payment-service/app/logger"
+	"payment-service/errors"
+	"strconv"
 )
 
+const defaultErrorDocsUrl = "/docs/errors"
+
+type docsUrlContextKey struct{}
+
+// errorDocs makes problems of the requests it serves link to docsUrl.
+func errorDocs(docsUrl string) func(http.Handler) http.Handler {
+	if docsUrl == "" {
+		docsUrl = defaultErrorDocsUrl
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), docsUrlContextKey{}, docsUrl)))
+		})
+	}
+}
+
+type errorLoggerContextKey struct{}
+
+// errorLog makes WriteError log the cause of the server errors it hides
+// from the client with l.
+func errorLog(l *logger.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), errorLoggerContextKey{}, l)))
+		})
+	}
+}
+
 type Controller struct {
 }
 
@@ -17,15 +50,6 @@ func Json(res http.ResponseWriter, payload interface{}, statusCode int) {
 	_, _ = res.Write(response)
 }
 
-func JsonError(res http.ResponseWriter, msg string, statusCode int, name ...string) {
-	response := map[string]interface{}{
-		"success": false,
-		"message": msg,
-	}
-
-	Json(res, response, statusCode)
-}
-
 type CustomHttpError struct {
 	StatusCode int
 	Message    string
@@ -33,8 +57,73 @@ type CustomHttpError struct {
 	Error      *error
 }
 
-func (c *Controller) JsonError(res http.ResponseWriter, msg string, statusCode int) {
-	JsonError(res, msg, statusCode)
+// Problem is an RFC 7807 problem details body. Code is the stable error code
+// and Type links to its documentation; the remaining fields are extensions
+// set for some codes only.
+type Problem struct {
+	Type        string             `json:"type"`
+	Title       string             `json:"title"`
+	Status      int                `json:"status"`
+	Detail      string             `json:"detail"`
+	Instance    string             `json:"instance"`
+	Code        string             `json:"code"`
+	RequestId   string             `json:"requestId,omitempty"`
+	FieldErrors []CustomFieldError `json:"fieldErrors,omitempty"`
+	DeclineCode string             `json:"declineCode,omitempty"`
+	Retryable   *bool              `json:"retryable,omitempty"`
+}
+
+// NewProblem returns the problem of a request with the given error code.
+// Its type is the code's entry on the error docs page (errors.docs_url).
+func NewProblem(r *http.Request, code string, status int, detail string) Problem {
+	docsUrl, _ := r.Context().Value(docsUrlContextKey{}).(string)
+	if docsUrl == "" {
+		docsUrl = defaultErrorDocsUrl
+	}
+	return Problem{
+		Type:      docsUrl + "#" + code,
+		Title:     errors.Title(code),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestId: middleware.GetReqID(r.Context()),
+	}
+}
+
+func WriteProblem(res http.ResponseWriter, problem Problem) {
+	response, _ := json.Marshal(problem)
+	res.Header().Set("Content-Type", "application/problem+json")
+	res.WriteHeader(problem.Status)
+	_, _ = res.Write(response)
+}
+
+// WriteError writes err as a problem, with the status code and error code
+// of its type. Server errors get the generic description of their code as
+// detail, so internal messages never reach the client; err is logged
+// instead.
+func WriteError(res http.ResponseWriter, r *http.Request, err error) {
+	code, status := errors.MapErrorToCode(err), errors.MapErrorToStatusCode(err)
+	detail := err.Error()
+	if status >= http.StatusInternalServerError {
+		detail = errors.Description(code)
+		if l, ok := r.Context().Value(errorLoggerContextKey{}).(*logger.Logger); ok {
+			l.FromContext(r.Context()).Error("request failed with ", code, ": ", err.Error())
+		}
+	}
+	problem := NewProblem(r, code, status, detail)
+	switch typed := err.(type) {
+	case *errors.ProviderDeclinedError:
+		problem.DeclineCode = typed.DeclineCode
+		problem.Retryable = &typed.Retryable
+	case *errors.RateLimitedError:
+		res.Header().Set("Retry-After", strconv.Itoa(int(typed.RetryAfter.Seconds())))
+	}
+	WriteProblem(res, problem)
+}
+
+func (c *Controller) JsonProblem(res http.ResponseWriter, r *http.Request, err error) {
+	WriteError(res, r, err)
 }
 
 func (c *Controller) Json(res http.ResponseWriter, payload interface{}, statusCode int) {
@@ -47,9 +136,11 @@ type CustomFieldError struct {
 	Tag   string `json:"tag"`
 }
 
-func (c *Controller) JsonValidationErrors(res http.ResponseWriter, err error) {
+// JsonValidationErrors writes a body that failed to decode or validate as a
+// validation_failed problem listing the failing fields.
+func (c *Controller) JsonValidationErrors(res http.ResponseWriter, r *http.Request, err error) {
 	var validationErrors validator.ValidationErrors
-	errors.As(err, &validationErrors)
+	stderrors.As(err, &validationErrors)
 
 	var fieldErrors = make([]CustomFieldError, 0)
 	if len(validationErrors) > 0 {
@@ -62,13 +153,7 @@ func (c *Controller) JsonValidationErrors(res http.ResponseWriter, err error) {
 		}
 	}
 
-	Json(res, map[string]interface{}{
-		"status":      http.StatusBadRequest,
-		"type":        "https://www.w3.org/Protocols/rfc2616/rfc2616-sec10.html",
-		"title":       "Validation Error",
-		"message":     err.Error(),
-		"errors":      err,
-		"fieldErrors": fieldErrors,
-	}, http.StatusBadRequest)
-
+	problem := NewProblem(r, errors.CodeValidationFailed, http.StatusBadRequest, err.Error())
+	problem.FieldErrors = fieldErrors
+	WriteProblem(res, problem)
 }
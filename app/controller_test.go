@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+
+	"payment-service/errors"
+)
+
+// serveError answers a request to path with err written as a problem,
+// behind the middlewares the app installs, and returns the response and its
+// decoded body.
+func serveError(t *testing.T, docsUrl string, path string, err error) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(errorDocs(docsUrl))
+	r.Get(path, func(w http.ResponseWriter, r *http.Request) {
+		WriteError(w, r, err)
+	})
+
+	res := httptest.NewRecorder()
+	r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+	var body map[string]interface{}
+	if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+		t.Fatalf("problem body %q: %v", res.Body.String(), err)
+	}
+	return res, body
+}
+
+func TestWriteErrorWritesAProblemForEachErrorType(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantCode   string
+		// wantDetail is the message for client errors; server errors hide it.
+		wantDetail string
+	}{
+		{&errors.ValidationError{Message: "amount is required"}, http.StatusBadRequest, errors.CodeValidationFailed, "amount is required"},
+		{&errors.InternalServerError{Message: "database is down"}, http.StatusInternalServerError, errors.CodeInternalError, errors.Description(errors.CodeInternalError)},
+		{&errors.TimeoutError{Message: "stripe timed out", Err: context.DeadlineExceeded}, http.StatusGatewayTimeout, errors.CodeProviderTimeout, errors.Description(errors.CodeProviderTimeout)},
+		{&errors.NotFoundError{Message: "transaction not found"}, http.StatusNotFound, errors.CodeNotFound, "transaction not found"},
+		{&errors.ConflictError{Message: "transactionId is taken"}, http.StatusConflict, errors.CodeConflict, "transactionId is taken"},
+		{&errors.ProviderDeclinedError{Message: "card declined", DeclineCode: "insufficient_funds"}, http.StatusPaymentRequired, errors.CodeProviderDeclined, "card declined"},
+		{&errors.ProviderUnavailableError{Message: "stripe is unavailable"}, http.StatusServiceUnavailable, errors.CodeProviderUnavailable, errors.Description(errors.CodeProviderUnavailable)},
+		{&errors.UnauthorizedError{Message: "unknown API key"}, http.StatusUnauthorized, errors.CodeUnauthorized, "unknown API key"},
+		{&errors.ForbiddenError{Message: "missing scope"}, http.StatusForbidden, errors.CodeForbidden, "missing scope"},
+		{&errors.RateLimitedError{Message: "slow down", RetryAfter: 30 * time.Second}, http.StatusTooManyRequests, errors.CodeRateLimited, "slow down"},
+		{fmt.Errorf("pq: connection refused"), http.StatusInternalServerError, errors.CodeInternalError, errors.Description(errors.CodeInternalError)},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%T", test.err), func(t *testing.T) {
+			res, body := serveError(t, "https://docs.example.com/errors", "/transactions/42", test.err)
+
+			if res.Code != test.wantStatus || res.Header().Get("Content-Type") != "application/problem+json" {
+				t.Errorf("got %d %s, want %d application/problem+json", res.Code, res.Header().Get("Content-Type"), test.wantStatus)
+			}
+			want := map[string]interface{}{
+				"type":     "https://docs.example.com/errors#" + test.wantCode,
+				"title":    errors.Title(test.wantCode),
+				"status":   float64(test.wantStatus),
+				"detail":   test.wantDetail,
+				"instance": "/transactions/42",
+				"code":     test.wantCode,
+			}
+			for key, value := range want {
+				if body[key] != value {
+					t.Errorf("%s = %v, want %v", key, body[key], value)
+				}
+			}
+			if requestId, _ := body["requestId"].(string); requestId == "" {
+				t.Error("problem has no requestId")
+			}
+			_, hasDeclineCode := body["declineCode"]
+			_, hasRetryable := body["retryable"]
+			if test.wantCode != errors.CodeProviderDeclined && (hasDeclineCode || hasRetryable) {
+				t.Errorf("problem has the decline extensions: %v", body)
+			}
+		})
+	}
+}
+
+func TestProblemTypesMatchTheStatusOfTheirErrors(t *testing.T) {
+	statuses := map[string]int{}
+	for _, problemType := range errors.ProblemTypes {
+		statuses[problemType.Code] = problemType.Status
+	}
+	for _, err := range []error{&errors.ValidationError{}, &errors.InternalServerError{}, &errors.TimeoutError{}, &errors.NotFoundError{},
+		&errors.ConflictError{}, &errors.ProviderDeclinedError{}, &errors.ProviderUnavailableError{}, &errors.UnauthorizedError{},
+		&errors.ForbiddenError{}, &errors.RateLimitedError{}} {
+		code := errors.MapErrorToCode(err)
+		if status, ok := statuses[code]; !ok || status != errors.MapErrorToStatusCode(err) {
+			t.Errorf("%T answers %d but its problem type %s documents %d", err, errors.MapErrorToStatusCode(err), code, status)
+		}
+	}
+}
+
+func TestProviderDeclinedProblemCarriesTheDeclineCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *errors.ProviderDeclinedError
+	}{
+		{"final decline", &errors.ProviderDeclinedError{Message: "Your card has insufficient funds.", DeclineCode: "insufficient_funds"}},
+		{"retryable decline", &errors.ProviderDeclinedError{Message: "An error occurred during processing", DeclineCode: "processing_error", Retryable: true}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, body := serveError(t, "", "/deposit", test.err)
+			if body["declineCode"] != test.err.DeclineCode || body["retryable"] != test.err.Retryable {
+				t.Errorf("declineCode %v and retryable %v, want %q and %t", body["declineCode"], body["retryable"], test.err.DeclineCode, test.err.Retryable)
+			}
+			if body["type"] != defaultErrorDocsUrl+"#"+errors.CodeProviderDeclined {
+				t.Errorf("type %v, want the default docs url", body["type"])
+			}
+		})
+	}
+}
+
+func TestRateLimitedProblemSetsRetryAfter(t *testing.T) {
+	res, _ := serveError(t, "", "/deposit", &errors.RateLimitedError{Message: "slow down", RetryAfter: 30 * time.Second})
+	if res.Header().Get("Retry-After") != "30" {
+		t.Errorf("Retry-After = %q, want 30", res.Header().Get("Retry-After"))
+	}
+}
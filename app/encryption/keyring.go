@@ -0,0 +1,206 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	valuePrefix = "enc:v1:"
+	keySize     = 32
+)
+
+// Keyring holds the master keys used to wrap per-row data keys. Data keys
+// encrypt the payload columns with AES-256-GCM; master keys only ever
+// encrypt data keys, so rotating a master key rewraps data keys without
+// touching the payloads. New data keys are wrapped with the active key.
+type Keyring struct {
+	keys        map[string][]byte
+	activeKeyId string
+}
+
+func NewKeyring(keys map[string][]byte, activeKeyId string) (*Keyring, error) {
+	for id, key := range keys {
+		if len(key) != keySize {
+			return nil, fmt.Errorf("master key %s must be %d bytes, got %d", id, keySize, len(key))
+		}
+	}
+	if len(keys) > 0 {
+		if _, ok := keys[activeKeyId]; !ok {
+			return nil, fmt.Errorf("active master key %q is not configured", activeKeyId)
+		}
+	}
+	return &Keyring{keys: keys, activeKeyId: activeKeyId}, nil
+}
+
+// LoadKeyring reads master keys from encryption.master_keys and the file at
+// encryption.master_key_file. Both use "<id>:<base64 key>" entries, comma or
+// newline separated. encryption.active_key_id picks the key for new data
+// keys and defaults to the first key listed.
+func LoadKeyring(config *viper.Viper) (*Keyring, error) {
+	entries := config.GetString("encryption.master_keys")
+	if path := config.GetString("encryption.master_key_file"); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read master key file: %w", err)
+		}
+		entries += "\n" + string(content)
+	}
+
+	keys := map[string][]byte{}
+	firstKeyId := ""
+	for _, entry := range strings.FieldsFunc(entries, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		id, encoded, found := strings.Cut(entry, ":")
+		if !found || id == "" {
+			return nil, errors.New("master keys must be formatted as <id>:<base64 key>")
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("master key %s is not valid base64: %w", id, err)
+		}
+		keys[id] = key
+		if firstKeyId == "" {
+			firstKeyId = id
+		}
+	}
+
+	activeKeyId := config.GetString("encryption.active_key_id")
+	if activeKeyId == "" {
+		activeKeyId = firstKeyId
+	}
+	return NewKeyring(keys, activeKeyId)
+}
+
+// GenerateMasterKey returns a new random master key, base64 encoded.
+func GenerateMasterKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Enabled reports whether any master key is configured. Without one,
+// payloads are stored in plaintext.
+func (self *Keyring) Enabled() bool {
+	return len(self.keys) > 0
+}
+
+func (self *Keyring) ActiveKeyId() string {
+	return self.activeKeyId
+}
+
+// NewDataKey generates a data key and returns it with its wrapped form and
+// the id of the master key that wrapped it.
+func (self *Keyring) NewDataKey() ([]byte, string, string, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, "", "", err
+	}
+	wrapped, keyId, err := self.WrapDataKey(dataKey)
+	return dataKey, wrapped, keyId, err
+}
+
+func (self *Keyring) WrapDataKey(dataKey []byte) (string, string, error) {
+	masterKey, ok := self.keys[self.activeKeyId]
+	if !ok {
+		return "", "", errors.New("no active master key configured")
+	}
+	sealed, err := seal(masterKey, dataKey, []byte(self.activeKeyId))
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), self.activeKeyId, nil
+}
+
+func (self *Keyring) UnwrapDataKey(keyId string, wrapped string) ([]byte, error) {
+	masterKey, ok := self.keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("master key %q is not configured", keyId)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("wrapped data key is not valid base64: %w", err)
+	}
+	return open(masterKey, sealed, []byte(keyId))
+}
+
+// IsEncrypted reports whether value was produced by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, valuePrefix)
+}
+
+// Encrypt encrypts plaintext with a data key as "enc:v1:<base64>".
+func Encrypt(dataKey []byte, plaintext string) (string, error) {
+	sealed, err := seal(dataKey, []byte(plaintext), nil)
+	if err != nil {
+		return "", err
+	}
+	return valuePrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt. Values without the prefix are returned as is,
+// so rows written before encryption was enabled stay readable.
+func Decrypt(dataKey []byte, value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, valuePrefix))
+	if err != nil {
+		return "", fmt.Errorf("encrypted value is not valid base64: %w", err)
+	}
+	plaintext, err := open(dataKey, sealed, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// seal encrypts with AES-GCM and prefixes the random nonce.
+func seal(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGcm(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key []byte, sealed []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGcm(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, errors.New("failed to decrypt: wrong key or corrupted value")
+	}
+	return plaintext, nil
+}
+
+func newGcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,192 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func testKey(seed byte) []byte {
+	return bytes.Repeat([]byte{seed}, keySize)
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	dataKey := testKey(1)
+	for _, plaintext := range []string{"", "sk_live_secret", `{"number":"4111111111111111"}`, "grüße 🔑", strings.Repeat("x", 1<<16)} {
+		encrypted, err := Encrypt(dataKey, plaintext)
+		if err != nil {
+			t.Fatalf("Encrypt(%.20q): %v", plaintext, err)
+		}
+		if !IsEncrypted(encrypted) || (plaintext != "" && strings.Contains(encrypted, plaintext)) {
+			t.Errorf("Encrypt(%.20q) = %.40q, want an opaque enc:v1: value", plaintext, encrypted)
+		}
+		again, _ := Encrypt(dataKey, plaintext)
+		if again == encrypted {
+			t.Errorf("Encrypt(%.20q) gave the same value twice, want a fresh nonce each time", plaintext)
+		}
+		decrypted, err := Decrypt(dataKey, encrypted)
+		if err != nil || decrypted != plaintext {
+			t.Errorf("Decrypt(Encrypt(%.20q)) = %.20q, %v", plaintext, decrypted, err)
+		}
+	}
+}
+
+func TestDecryptLeavesPlaintextAlone(t *testing.T) {
+	decrypted, err := Decrypt(testKey(1), `{"written":"before encryption"}`)
+	if err != nil || decrypted != `{"written":"before encryption"}` {
+		t.Errorf("Decrypt of a plaintext value = %q, %v, want it unchanged", decrypted, err)
+	}
+}
+
+func TestDecryptRejectsTamperedValues(t *testing.T) {
+	dataKey := testKey(1)
+	encrypted, err := Encrypt(dataKey, "sk_live_secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, valuePrefix))
+	flip := func(i int) string {
+		tampered := append([]byte(nil), sealed...)
+		tampered[i] ^= 0x01
+		return valuePrefix + base64.StdEncoding.EncodeToString(tampered)
+	}
+
+	tests := []struct {
+		name    string
+		dataKey []byte
+		value   string
+	}{
+		{"flipped ciphertext byte", dataKey, flip(len(sealed) / 2)},
+		{"flipped nonce byte", dataKey, flip(0)},
+		{"flipped tag byte", dataKey, flip(len(sealed) - 1)},
+		{"truncated", dataKey, valuePrefix + base64.StdEncoding.EncodeToString(sealed[:8])},
+		{"not base64", dataKey, valuePrefix + "not base64!"},
+		{"wrong data key", testKey(2), encrypted},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if decrypted, err := Decrypt(test.dataKey, test.value); err == nil {
+				t.Errorf("Decrypt = %q, want an error", decrypted)
+			}
+		})
+	}
+}
+
+func TestDataKeysStayReadableAfterRotation(t *testing.T) {
+	old, err := NewKeyring(map[string][]byte{"2026-01": testKey(1)}, "2026-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataKey, wrapped, keyId, err := old.NewDataKey()
+	if err != nil || keyId != "2026-01" {
+		t.Fatalf("NewDataKey wrapped with %q: %v", keyId, err)
+	}
+
+	rotated, err := NewKeyring(map[string][]byte{"2026-01": testKey(1), "2026-02": testKey(2)}, "2026-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unwrapped, err := rotated.UnwrapDataKey("2026-01", wrapped)
+	if err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Fatalf("unwrapping a data key under the old master key: %v", err)
+	}
+	rewrapped, newKeyId, err := rotated.WrapDataKey(unwrapped)
+	if err != nil || newKeyId != "2026-02" {
+		t.Fatalf("WrapDataKey wrapped with %q: %v", newKeyId, err)
+	}
+	if unwrapped, err := rotated.UnwrapDataKey("2026-02", rewrapped); err != nil || !bytes.Equal(unwrapped, dataKey) {
+		t.Errorf("unwrapping the rewrapped data key: %v", err)
+	}
+
+	// The key id is authenticated, so a wrapped key cannot be passed off as
+	// wrapped by another master key, even one with the same key bytes.
+	aliased, _ := NewKeyring(map[string][]byte{"2026-01": testKey(1), "alias": testKey(1)}, "2026-01")
+	if _, err := aliased.UnwrapDataKey("alias", wrapped); err == nil {
+		t.Error("unwrapping under another key id succeeded")
+	}
+	retired, _ := NewKeyring(map[string][]byte{"2026-02": testKey(2)}, "2026-02")
+	if _, err := retired.UnwrapDataKey("2026-01", wrapped); err == nil {
+		t.Error("unwrapping after the old master key was removed succeeded")
+	}
+	if _, err := rotated.UnwrapDataKey("2026-01", "AAAA"+wrapped[4:]); err == nil {
+		t.Error("unwrapping a tampered data key succeeded")
+	}
+}
+
+func TestNewKeyringRejectsInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		keys        map[string][]byte
+		activeKeyId string
+	}{
+		{"short key", map[string][]byte{"k": testKey(1)[:16]}, "k"},
+		{"unknown active key", map[string][]byte{"k": testKey(1)}, "other"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewKeyring(test.keys, test.activeKeyId); err == nil {
+				t.Error("NewKeyring succeeded, want an error")
+			}
+		})
+	}
+
+	disabled, err := NewKeyring(nil, "")
+	if err != nil || disabled.Enabled() {
+		t.Errorf("keyring without keys: enabled %t, %v", disabled.Enabled(), err)
+	}
+	if _, _, err := disabled.WrapDataKey(testKey(1)); err == nil {
+		t.Error("wrapping without a master key succeeded")
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	encode := func(seed byte) string {
+		return base64.StdEncoding.EncodeToString(testKey(seed))
+	}
+	file := filepath.Join(t.TempDir(), "master-keys")
+	if err := os.WriteFile(file, []byte("# rotated 2026-02\n2026-02:"+encode(2)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		settings    map[string]string
+		wantActive  string
+		wantEnabled bool
+		wantError   bool
+	}{
+		{"no keys", nil, "", false, false},
+		{"first key is active", map[string]string{"encryption.master_keys": "2026-01:" + encode(1) + ", 2026-02:" + encode(2)}, "2026-01", true, false},
+		{"active key set", map[string]string{"encryption.master_keys": "2026-01:" + encode(1), "encryption.master_key_file": file, "encryption.active_key_id": "2026-02"}, "2026-02", true, false},
+		{"key file only", map[string]string{"encryption.master_key_file": file}, "2026-02", true, false},
+		{"missing id", map[string]string{"encryption.master_keys": encode(1)}, "", false, true},
+		{"invalid base64", map[string]string{"encryption.master_keys": "2026-01:not base64!"}, "", false, true},
+		{"missing key file", map[string]string{"encryption.master_key_file": file + ".missing"}, "", false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			for key, value := range test.settings {
+				config.Set(key, value)
+			}
+			keyring, err := LoadKeyring(config)
+			if test.wantError {
+				if err == nil {
+					t.Error("LoadKeyring succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadKeyring: %v", err)
+			}
+			if keyring.Enabled() != test.wantEnabled || keyring.ActiveKeyId() != test.wantActive {
+				t.Errorf("enabled %t with active key %q, want %t and %q", keyring.Enabled(), keyring.ActiveKeyId(), test.wantEnabled, test.wantActive)
+			}
+		})
+	}
+}
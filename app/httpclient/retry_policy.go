@@ -0,0 +1,88 @@
+// Package httpclient is the HTTP client payment providers share. It retries
+// failed requests that are safe to repeat, with exponential backoff and
+// jitter, and honours Retry-After.
+package httpclient
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy says how often and how quickly a request is retried.
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt, so 1 disables retries.
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry; each further retry waits
+	// twice as long as the one before, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter is the fraction of each delay that is randomised: 0 waits the
+	// exact delay, 1 waits anywhere between zero and the delay.
+	Jitter float64
+	// ShouldRetryHeader names a response header in which the provider says
+	// whether the request may be retried ("true" or "false"). It overrides
+	// the status code classification, e.g. Stripe-Should-Retry.
+	ShouldRetryHeader string
+}
+
+// DefaultRetryPolicy is used for the fields of a policy left at zero.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+	Jitter:      0.5,
+}
+
+func (self RetryPolicy) withDefaults() RetryPolicy {
+	if self.MaxAttempts <= 0 {
+		self.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if self.BaseDelay <= 0 {
+		self.BaseDelay = DefaultRetryPolicy.BaseDelay
+	}
+	if self.MaxDelay <= 0 {
+		self.MaxDelay = DefaultRetryPolicy.MaxDelay
+	}
+	if self.MaxDelay < self.BaseDelay {
+		self.MaxDelay = self.BaseDelay
+	}
+	if self.Jitter <= 0 || self.Jitter > 1 {
+		self.Jitter = DefaultRetryPolicy.Jitter
+	}
+	return self
+}
+
+// Delay returns the wait after the given failed attempt, counting from 1.
+func (self RetryPolicy) Delay(attempt int) time.Duration {
+	policy := self.withDefaults()
+	delay := float64(policy.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if delay > float64(policy.MaxDelay) {
+		delay = float64(policy.MaxDelay)
+	}
+	delay -= delay * policy.Jitter * rand.Float64()
+	return time.Duration(delay)
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP
+// date. It returns zero when the header is missing or malformed.
+func retryAfter(response *http.Response) time.Duration {
+	if response == nil {
+		return 0
+	}
+	value := response.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
@@ -0,0 +1,213 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"payment-service/app/tracing"
+)
+
+// ErrorClass groups the outcome of one attempt.
+type ErrorClass string
+
+const (
+	// ClassNone is a response below 400.
+	ClassNone ErrorClass = "none"
+	// ClassNetwork is a request that got no response.
+	ClassNetwork ErrorClass = "network"
+	// ClassServer is a 5xx, 408 or 429 response: the provider could not
+	// handle the request now, but may later.
+	ClassServer ErrorClass = "server"
+	// ClassBusiness is any other 4xx response, such as a declined card or an
+	// invalid parameter. Repeating the request gives the same answer.
+	ClassBusiness ErrorClass = "business"
+)
+
+// Classify returns the class of an attempt's response or error.
+func Classify(response *http.Response, err error) ErrorClass {
+	if err != nil {
+		return ClassNetwork
+	}
+	switch {
+	case response.StatusCode >= http.StatusInternalServerError,
+		response.StatusCode == http.StatusRequestTimeout,
+		response.StatusCode == http.StatusTooManyRequests:
+		return ClassServer
+	case response.StatusCode >= http.StatusBadRequest:
+		return ClassBusiness
+	}
+	return ClassNone
+}
+
+// Retry describes a failed attempt that is about to be retried.
+type Retry struct {
+	Attempt    int
+	Class      ErrorClass
+	StatusCode int
+	Err        error
+	Delay      time.Duration
+}
+
+// NewClient returns a client whose requests are traced and retried by
+// policy. onRetry, if not nil, is called before each retry.
+func NewClient(policy RetryPolicy, onRetry func(*http.Request, Retry)) *http.Client {
+	return &http.Client{Transport: NewTransport(tracing.Transport(nil), policy, onRetry)}
+}
+
+// NewTransport retries requests made with base (http.DefaultTransport when
+// nil). A request is only repeated when that cannot charge or pay out twice:
+// it is idempotent (see Idempotent) or it never reached the provider.
+func NewTransport(base http.RoundTripper, policy RetryPolicy, onRetry func(*http.Request, Retry)) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base, policy: policy.withDefaults(), onRetry: onRetry}
+}
+
+type transport struct {
+	base    http.RoundTripper
+	policy  RetryPolicy
+	onRetry func(*http.Request, Retry)
+}
+
+func (self *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx := r.Context()
+	attemptRequest := r
+	for attempt := 1; ; attempt++ {
+		countAttempt(ctx)
+		response, err := self.base.RoundTrip(attemptRequest)
+
+		class := Classify(response, err)
+		if class == ClassNone || attempt >= self.policy.MaxAttempts || !self.retryable(r, class, response, err) {
+			return response, err
+		}
+
+		delay := self.policy.Delay(attempt)
+		if wait := retryAfter(response); wait > 0 {
+			if wait > self.policy.MaxDelay {
+				return response, err
+			}
+			if wait > delay {
+				delay = wait
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return response, err
+		}
+
+		next := r.Clone(ctx)
+		if r.Body != nil && r.Body != http.NoBody {
+			body, bodyErr := r.GetBody()
+			if bodyErr != nil {
+				return response, err
+			}
+			next.Body = body
+		}
+
+		retry := Retry{Attempt: attempt, Class: class, Err: err, Delay: delay}
+		if response != nil {
+			retry.StatusCode = response.StatusCode
+			io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+			response.Body.Close()
+		}
+		if self.onRetry != nil {
+			self.onRetry(r, retry)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		attemptRequest = next
+	}
+}
+
+func (self *transport) retryable(r *http.Request, class ErrorClass, response *http.Response, err error) bool {
+	if r.Context().Err() != nil {
+		return false
+	}
+	if r.Body != nil && r.Body != http.NoBody && r.GetBody == nil {
+		return false
+	}
+	if response != nil && self.policy.ShouldRetryHeader != "" {
+		switch response.Header.Get(self.policy.ShouldRetryHeader) {
+		case "true":
+			return Idempotent(r)
+		case "false":
+			return false
+		}
+	}
+	switch class {
+	case ClassNetwork:
+		return Idempotent(r) || notSent(err)
+	case ClassServer:
+		return Idempotent(r)
+	}
+	return false
+}
+
+// notSent reports whether err happened before any byte of the request was
+// written, so the provider cannot have acted on it.
+func notSent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// Idempotent reports whether r may be sent more than once: its method is
+// idempotent, it carries an Idempotency-Key, or its context was marked with
+// WithIdempotent.
+func Idempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	if r.Header.Get("Idempotency-Key") != "" {
+		return true
+	}
+	idempotent, _ := r.Context().Value(idempotentKey{}).(bool)
+	return idempotent
+}
+
+type idempotentKey struct{}
+
+// WithIdempotent marks requests made with ctx as safe to repeat, for APIs
+// that send read-only calls as POST.
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+type attemptsKey struct{}
+
+// WithAttempts returns ctx with a counter of the attempts made by requests
+// using it, read with Attempts.
+func WithAttempts(ctx context.Context) context.Context {
+	return context.WithValue(ctx, attemptsKey{}, new(int64))
+}
+
+// Attempts returns the number of attempts counted in ctx so far, or zero
+// when ctx has no counter.
+func Attempts(ctx context.Context) int {
+	counter, _ := ctx.Value(attemptsKey{}).(*int64)
+	if counter == nil {
+		return 0
+	}
+	return int(atomic.LoadInt64(counter))
+}
+
+func countAttempt(ctx context.Context) {
+	if counter, _ := ctx.Value(attemptsKey{}).(*int64); counter != nil {
+		atomic.AddInt64(counter, 1)
+	}
+}
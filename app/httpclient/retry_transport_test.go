@@ -0,0 +1,289 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fastPolicy retries quickly enough for tests.
+var fastPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Second, ShouldRetryHeader: "Stripe-Should-Retry"}
+
+// scriptedServer answers the n-th request with responses[n], repeating the
+// last one, and records the bodies it received.
+type scriptedServer struct {
+	*httptest.Server
+	mutex  sync.Mutex
+	bodies []string
+}
+
+type scriptedResponse struct {
+	status  int
+	headers map[string]string
+}
+
+func newScriptedServer(t *testing.T, responses ...scriptedResponse) *scriptedServer {
+	server := &scriptedServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		server.mutex.Lock()
+		server.bodies = append(server.bodies, string(body))
+		response := responses[len(responses)-1]
+		if len(server.bodies) <= len(responses) {
+			response = responses[len(server.bodies)-1]
+		}
+		server.mutex.Unlock()
+		for name, value := range response.headers {
+			w.Header().Set(name, value)
+		}
+		w.WriteHeader(response.status)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (self *scriptedServer) attempts() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return len(self.bodies)
+}
+
+func TestRetriesOnlyRequestsSafeToRepeat(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		idempotencyKey string
+		idempotent     bool
+		responses      []scriptedResponse
+		wantAttempts   int
+		wantStatus     int
+	}{
+		{"GET after a server error", http.MethodGet, "", false, []scriptedResponse{{status: 503}, {status: 200}}, 2, 200},
+		{"GET until attempts run out", http.MethodGet, "", false, []scriptedResponse{{status: 500}}, 3, 500},
+		{"GET after a 429", http.MethodGet, "", false, []scriptedResponse{{status: 429}, {status: 200}}, 2, 200},
+		{"POST with an idempotency key", http.MethodPost, "charge-1", false, []scriptedResponse{{status: 502}, {status: 201}}, 2, 201},
+		{"POST marked idempotent", http.MethodPost, "", true, []scriptedResponse{{status: 502}, {status: 200}}, 2, 200},
+		{"POST without an idempotency key", http.MethodPost, "", false, []scriptedResponse{{status: 502}, {status: 201}}, 1, 502},
+		{"business error", http.MethodPost, "charge-1", false, []scriptedResponse{{status: 402}, {status: 201}}, 1, 402},
+		{"success", http.MethodGet, "", false, []scriptedResponse{{status: 200}}, 1, 200},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newScriptedServer(t, test.responses...)
+			client := &http.Client{Transport: NewTransport(nil, fastPolicy, nil)}
+			ctx := WithAttempts(context.Background())
+			if test.idempotent {
+				ctx = WithIdempotent(ctx)
+			}
+			r, _ := http.NewRequestWithContext(ctx, test.method, server.URL, strings.NewReader("amount=1000"))
+			if test.idempotencyKey != "" {
+				r.Header.Set("Idempotency-Key", test.idempotencyKey)
+			}
+
+			response, err := client.Do(r)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			response.Body.Close()
+			if response.StatusCode != test.wantStatus || server.attempts() != test.wantAttempts || Attempts(ctx) != test.wantAttempts {
+				t.Errorf("got %d after %d attempts (%d counted), want %d after %d", response.StatusCode, server.attempts(), Attempts(ctx), test.wantStatus, test.wantAttempts)
+			}
+			for i, body := range server.bodies {
+				if body != "amount=1000" {
+					t.Errorf("attempt %d sent body %q", i+1, body)
+				}
+			}
+		})
+	}
+}
+
+func TestShouldRetryHeaderOverridesTheStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		shouldRetry    string
+		idempotencyKey string
+		wantAttempts   int
+	}{
+		{"false on a server error", 500, "false", "charge-1", 1},
+		{"true on a conflict", 409, "true", "charge-1", 2},
+		{"true without an idempotency key", 409, "true", "", 1},
+		{"unset on a conflict", 409, "", "charge-1", 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newScriptedServer(t, scriptedResponse{status: test.status, headers: map[string]string{"Stripe-Should-Retry": test.shouldRetry}}, scriptedResponse{status: 200})
+			client := &http.Client{Transport: NewTransport(nil, fastPolicy, nil)}
+			r, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("amount=1000"))
+			if test.idempotencyKey != "" {
+				r.Header.Set("Idempotency-Key", test.idempotencyKey)
+			}
+
+			response, err := client.Do(r)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			response.Body.Close()
+			if server.attempts() != test.wantAttempts {
+				t.Errorf("made %d attempts, want %d", server.attempts(), test.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name         string
+		retryAfter   string
+		wantAttempts int
+		// wantDelay is the least delay expected, zero for no retry.
+		wantDelay time.Duration
+	}{
+		{"in seconds", "1", 1, time.Second},
+		{"as a date", time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat), 1, 0},
+		{"beyond the max delay", "3", 1, 0},
+		{"malformed", "soon", 1, fastPolicy.BaseDelay / 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newScriptedServer(t, scriptedResponse{status: 503, headers: map[string]string{"Retry-After": test.retryAfter}}, scriptedResponse{status: 200})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// Cancelling in onRetry records the chosen delay without waiting
+			// it out.
+			var retries []Retry
+			client := &http.Client{Transport: NewTransport(nil, fastPolicy, func(r *http.Request, retry Retry) {
+				retries = append(retries, retry)
+				cancel()
+			})}
+			r, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+			response, err := client.Do(r)
+			if err == nil {
+				response.Body.Close()
+			}
+
+			if server.attempts() != test.wantAttempts {
+				t.Errorf("made %d attempts, want %d", server.attempts(), test.wantAttempts)
+			}
+			switch {
+			case test.wantDelay == 0 && len(retries) != 0:
+				t.Errorf("retried after %s, want the 503 returned", retries[0].Delay)
+			case test.wantDelay == 0 && (err != nil || response.StatusCode != 503):
+				t.Errorf("got %v, want the 503 returned", err)
+			case test.wantDelay > 0 && (len(retries) != 1 || retries[0].Delay < test.wantDelay || retries[0].Delay > 2*test.wantDelay):
+				t.Errorf("retries %+v, want one after about %s", retries, test.wantDelay)
+			case test.wantDelay > 0 && (retries[0].StatusCode != 503 || retries[0].Class != ClassServer):
+				t.Errorf("retry %+v, want it to report the 503", retries[0])
+			}
+		})
+	}
+}
+
+func TestRetryAfterIsWaitedFor(t *testing.T) {
+	server := newScriptedServer(t, scriptedResponse{status: 429, headers: map[string]string{"Retry-After": "1"}}, scriptedResponse{status: 200})
+	client := &http.Client{Transport: NewTransport(nil, fastPolicy, nil)}
+
+	start := time.Now()
+	response, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	response.Body.Close()
+	if elapsed := time.Since(start); response.StatusCode != 200 || elapsed < time.Second {
+		t.Errorf("got %d after %s, want 200 after waiting at least 1s", response.StatusCode, elapsed)
+	}
+}
+
+func TestDelayIsCapped(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: 0.5}
+	for attempt := 1; attempt <= 10; attempt++ {
+		want := 100 * time.Millisecond << (attempt - 1)
+		if want > time.Second {
+			want = time.Second
+		}
+		for i := 0; i < 20; i++ {
+			if delay := policy.Delay(attempt); delay > want || delay < want/2 {
+				t.Fatalf("Delay(%d) = %s, want between %s and %s", attempt, delay, want/2, want)
+			}
+		}
+	}
+}
+
+func TestDeadlineShorterThanTheDelayIsNotRetried(t *testing.T) {
+	server := newScriptedServer(t, scriptedResponse{status: 503, headers: map[string]string{"Retry-After": "1"}}, scriptedResponse{status: 200})
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	client := &http.Client{Transport: NewTransport(nil, fastPolicy, nil)}
+
+	r, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	response, err := client.Do(r)
+	if err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != 503 || server.attempts() != 1 {
+		t.Errorf("got %d after %d attempts, want the 503 returned at once", response.StatusCode, server.attempts())
+	}
+}
+
+func TestNetworkErrors(t *testing.T) {
+	// A closed server refuses connections, so requests fail while dialling
+	// before anything is sent.
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	// A server that drops the connection after reading the request may
+	// have acted on it.
+	var mutex sync.Mutex
+	dropped := 0
+	dropping := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		mutex.Lock()
+		dropped++
+		mutex.Unlock()
+		connection, _, _ := w.(http.Hijacker).Hijack()
+		connection.Close()
+	}))
+	defer dropping.Close()
+
+	tests := []struct {
+		name           string
+		url            string
+		method         string
+		idempotencyKey string
+		wantAttempts   int
+	}{
+		{"POST never sent", closed.URL, http.MethodPost, "", 3},
+		{"GET never sent", closed.URL, http.MethodGet, "", 3},
+		{"POST dropped after sending", dropping.URL, http.MethodPost, "", 1},
+		{"GET dropped after sending", dropping.URL, http.MethodGet, "", 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var classes []ErrorClass
+			client := &http.Client{Transport: NewTransport(&http.Transport{DisableKeepAlives: true}, fastPolicy, func(r *http.Request, retry Retry) {
+				classes = append(classes, retry.Class)
+			})}
+			ctx := WithAttempts(context.Background())
+			r, _ := http.NewRequestWithContext(ctx, test.method, test.url, strings.NewReader("amount=1000"))
+
+			if _, err := client.Do(r); err == nil {
+				t.Fatal("Do succeeded, want a network error")
+			}
+			if Attempts(ctx) != test.wantAttempts || len(classes) != test.wantAttempts-1 {
+				t.Errorf("made %d attempts, want %d", Attempts(ctx), test.wantAttempts)
+			}
+			for _, class := range classes {
+				if class != ClassNetwork {
+					t.Errorf("retried a %s error, want %s", class, ClassNetwork)
+				}
+			}
+		})
+	}
+}
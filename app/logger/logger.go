@@ -1,25 +1,41 @@
 package logger
 
 import (
-	"fmt"
+	"context"
 	"log"
-	"net/http"
 	"strings"
-	"time"
+
+	"payment-service/app/tracing"
 
 	"github.com/go-chi/chi/middleware"
-	"github.com/sirupsen/logrus"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-const LogFormatFriendly = "friendly"
+const (
+	LogFormatConsole = "console"
+	LogFormatJson    = "json"
+)
+
+// Field names added by FromContext.
+const (
+	FieldRequestId     = "request_id"
+	FieldTraceId       = "trace_id"
+	FieldTransactionId = "transaction_id"
+	FieldProvider      = "provider"
+	FieldMerchantId    = "merchant_id"
+)
 
 type Debug struct {
 	Id      string
 	Enabled bool
 	Level   string
 	Format  string
+	// SamplingInitial and SamplingThereafter limit identical messages per
+	// second: the first SamplingInitial are logged, then every
+	// SamplingThereafter-th. SamplingInitial 0 disables sampling.
+	SamplingInitial    int
+	SamplingThereafter int
 }
 
 type Logger struct {
@@ -27,21 +43,86 @@ type Logger struct {
 	logService *zap.SugaredLogger
 }
 
-func GetLogger() *Logger {
-	debugConfig := &Debug{
-		Id:      "payment-service",
-		Enabled: true,
-		Level:   "debug",
-		Format:  "friendly",
-	}
-	logger := &Logger{Config: debugConfig}
+// NewLogger builds a zap logger from config. Every encoding masks card data
+// and secrets (see redacting_encoder.go).
+func NewLogger(config *Debug) *Logger {
+	logger := &Logger{Config: config}
 	_ = logger.Setup()
 	return logger
 }
 
+// GetLogger returns a console logger at debug level, for code that runs
+// before the configuration is read.
+func GetLogger() *Logger {
+	return NewLogger(&Debug{
+		Id:                 "payment-service",
+		Enabled:            true,
+		Level:              "debug",
+		Format:             LogFormatConsole,
+		SamplingInitial:    100,
+		SamplingThereafter: 100,
+	})
+}
+
+// With returns a logger that adds the given key-value pairs to every entry.
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	return &Logger{Config: l.Config, logService: l.logService.With(keysAndValues...)}
+}
+
+// FromContext returns a logger carrying the request id and trace id of ctx
+// and the fields added with ContextWith, such as the transaction id,
+// provider and merchant.
+func (l *Logger) FromContext(ctx context.Context) *Logger {
+	if ctx == nil {
+		return l
+	}
+	fields := make([]interface{}, 0, 8)
+	if requestId := middleware.GetReqID(ctx); requestId != "" {
+		fields = append(fields, FieldRequestId, requestId)
+	}
+	if spanContext := tracing.SpanContextFromContext(ctx); spanContext.IsValid() {
+		fields = append(fields, FieldTraceId, spanContext.TraceID.String())
+	}
+	fields = append(fields, contextFields(ctx)...)
+	if len(fields) == 0 {
+		return l
+	}
+	return l.With(fields...)
+}
+
+type contextFieldsKey struct{}
+
+// ContextWith returns ctx with key-value pairs that FromContext adds to log
+// entries. Later values for the same key replace earlier ones.
+func ContextWith(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	existing := contextFields(ctx)
+	fields := make([]interface{}, 0, len(existing)+len(keysAndValues))
+	for i := 0; i+1 < len(existing); i += 2 {
+		if !hasKey(keysAndValues, existing[i]) {
+			fields = append(fields, existing[i], existing[i+1])
+		}
+	}
+	fields = append(fields, keysAndValues...)
+	return context.WithValue(ctx, contextFieldsKey{}, fields)
+}
+
+func contextFields(ctx context.Context) []interface{} {
+	fields, _ := ctx.Value(contextFieldsKey{}).([]interface{})
+	return fields
+}
+
+func hasKey(keysAndValues []interface{}, key interface{}) bool {
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		if keysAndValues[i] == key {
+			return true
+		}
+	}
+	return false
+}
+
 // Debug uses fmt.Sprint to construct and log a message.
 func (l *Logger) Debug(args ...interface{}) {
-	l.logService.Debug(args)
+	l.logService.Debug(args...)
 }
 
 // Info uses fmt.Sprint to construct and log a message.
@@ -59,14 +140,14 @@ func (l *Logger) Error(args ...interface{}) {
 	l.logService.Error(args...)
 }
 
-// Error uses fmt.Sprint to construct and log a message.
+// Panic uses fmt.Sprint to construct and log a message, then panics.
 func (l *Logger) Panic(args ...interface{}) {
 	l.logService.Panic(args...)
 }
 
-// Error uses fmt.Sprint to construct and log a message.
+// Fatal uses fmt.Sprint to construct and log a message, then exits.
 func (l *Logger) Fatal(args ...interface{}) {
-	l.logService.Fatal(args)
+	l.logService.Fatal(args...)
 }
 
 // Debugf uses fmt.Sprintf to log a templated message.
@@ -89,17 +170,27 @@ func (l *Logger) Errorf(template string, args ...interface{}) {
 	l.logService.Errorf(template, args...)
 }
 
-// Errorf uses fmt.Sprintf to log a templated message.
+// Panicf uses fmt.Sprintf to log a templated message, then panics.
 func (l *Logger) Panicf(template string, args ...interface{}) {
 	l.logService.Panicf(template, args...)
 }
 
-// Errorf uses fmt.Sprintf to log a templated message.
+// Fatalf uses fmt.Sprintf to log a templated message, then exits.
 func (l *Logger) Fatalf(template string, args ...interface{}) {
 	l.logService.Fatalf(template, args...)
 }
 
-func (l *Logger) setupFriendlyLogger() zap.Config {
+// Infow logs a message with additional key-value pairs.
+func (l *Logger) Infow(msg string, keysAndValues ...interface{}) {
+	l.logService.Infow(msg, keysAndValues...)
+}
+
+// Errorw logs a message with additional key-value pairs.
+func (l *Logger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.logService.Errorw(msg, keysAndValues...)
+}
+
+func (l *Logger) zapConfig() zap.Config {
 	encodeConfig := zapcore.EncoderConfig{
 		TimeKey:        "ts",
 		LevelKey:       "level",
@@ -107,49 +198,59 @@ func (l *Logger) setupFriendlyLogger() zap.Config {
 		CallerKey:      "caller",
 		MessageKey:     "msg",
 		StacktraceKey:  "stacktrace",
-		LineEnding:     "\n\n",
-		EncodeLevel:    zapcore.LowercaseColorLevelEncoder,
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
 		EncodeTime:     zapcore.ISO8601TimeEncoder,
 		EncodeDuration: zapcore.SecondsDurationEncoder,
-		EncodeCaller:   zapcore.FullCallerEncoder,
+		EncodeCaller:   zapcore.ShortCallerEncoder,
+	}
+
+	encoding := RedactedJsonEncoding
+	if strings.ToLower(l.Config.Format) != LogFormatJson {
+		encoding = RedactedConsoleEncoding
+		encodeConfig.EncodeLevel = zapcore.LowercaseColorLevelEncoder
 	}
 
 	cfg := zap.Config{
-		Level:       zap.NewAtomicLevelAt(l.GetLogLevel()),
-		Development: true,
-		Sampling: &zap.SamplingConfig{
-			Initial:    100,
-			Thereafter: 100,
-		},
+		Level:            zap.NewAtomicLevelAt(l.GetLogLevel()),
+		Development:      encoding == RedactedConsoleEncoding,
 		InitialFields:    map[string]interface{}{},
-		Encoding:         "console",
+		Encoding:         encoding,
 		EncoderConfig:    encodeConfig,
 		OutputPaths:      []string{"stderr"},
 		ErrorOutputPaths: []string{"stderr"},
 	}
+	if l.Config.Id != "" && encoding == RedactedJsonEncoding {
+		cfg.InitialFields["service"] = l.Config.Id
+	}
+	if l.Config.SamplingInitial > 0 {
+		cfg.Sampling = &zap.SamplingConfig{
+			Initial:    l.Config.SamplingInitial,
+			Thereafter: l.Config.SamplingThereafter,
+		}
+	}
 	return cfg
 }
 
 func (l *Logger) Setup() error {
-
-	cfg := zap.Config{}
-	cfg = l.setupFriendlyLogger()
-
-	logger, err := cfg.Build()
+	logger, err := l.zapConfig().Build(zap.AddCallerSkip(1))
 	if err != nil {
 		log.Panic(err)
 		return err
 	}
 
-	defer logger.Sync()
-
 	l.logService = logger.Sugar()
 	return nil
 }
 
+// Sync flushes buffered log entries.
+func (l *Logger) Sync() error {
+	return l.logService.Sync()
+}
+
 func (l *Logger) GetLogLevel() zapcore.Level {
-	// set default to warn
-	logLevel := zap.WarnLevel
+	// set default to info
+	logLevel := zap.InfoLevel
 
 	// if logs disabled, set logLevel to error
 	if !l.IsLogEnabled() {
@@ -162,16 +263,12 @@ func (l *Logger) GetLogLevel() zapcore.Level {
 		switch configLevel {
 		case "debug":
 			logLevel = zap.DebugLevel
-			break
 		case "info":
 			logLevel = zap.InfoLevel
-			break
 		case "warn":
 			logLevel = zap.WarnLevel
-			break
 		case "error":
 			logLevel = zap.ErrorLevel
-			break
 		}
 	}
 
@@ -185,62 +282,3 @@ func (l *Logger) IsLogEnabled() bool {
 
 	return l.Config.Enabled
 }
-
-func NewStructuredLogger(logger *logrus.Logger) func(next http.Handler) http.Handler {
-	return middleware.RequestLogger(&StructuredLogger{logger})
-}
-
-// @todo replace logrus with zap
-type StructuredLogger struct {
-	Logger *logrus.Logger
-}
-
-func (l *StructuredLogger) NewLogEntry(r *http.Request) middleware.LogEntry {
-	entry := &StructuredLoggerEntry{Logger: logrus.NewEntry(l.Logger)}
-	logFields := logrus.Fields{}
-
-	logFields["ts"] = time.Now().UTC().Format(time.RFC1123)
-
-	if reqID := middleware.GetReqID(r.Context()); reqID != "" {
-		logFields["req_id"] = reqID
-	}
-
-	scheme := "http"
-	if r.TLS != nil {
-		scheme = "https"
-	}
-	logFields["http_scheme"] = scheme
-	logFields["http_proto"] = r.Proto
-	logFields["http_method"] = r.Method
-
-	logFields["remote_addr"] = r.RemoteAddr
-	logFields["user_agent"] = r.UserAgent()
-
-	logFields["uri"] = fmt.Sprintf("%s://%s%s", scheme, r.Host, r.RequestURI)
-
-	entry.Logger = entry.Logger.WithFields(logFields)
-
-	entry.Logger.Infoln("request started")
-
-	return entry
-}
-
-type StructuredLoggerEntry struct {
-	Logger logrus.FieldLogger
-}
-
-func (l *StructuredLoggerEntry) Write(status, bytes int, elapsed time.Duration) {
-	l.Logger = l.Logger.WithFields(logrus.Fields{
-		"resp_status": status, "resp_bytes_length": bytes,
-		"resp_elapsed_ms": float64(elapsed.Nanoseconds()) / 1000000.0,
-	})
-
-	l.Logger.Infoln("request complete")
-}
-
-func (l *StructuredLoggerEntry) Panic(v interface{}, stack []byte) {
-	l.Logger = l.Logger.WithFields(logrus.Fields{
-		"stack": string(stack),
-		"panic": fmt.Sprintf("%+v", v),
-	})
-}
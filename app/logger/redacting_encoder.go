@@ -0,0 +1,65 @@
+package logger
+
+import (
+	"payment-service/app/redaction"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// RedactedConsoleEncoding and RedactedJsonEncoding are the zap encoding
+// names of the console and JSON encoders that mask card data and secrets in
+// every log line.
+const (
+	RedactedConsoleEncoding = "redacted-console"
+	RedactedJsonEncoding    = "redacted-json"
+)
+
+func init() {
+	err := zap.RegisterEncoder(RedactedConsoleEncoding, func(config zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return NewRedactingEncoder(zapcore.NewConsoleEncoder(config)), nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	err = zap.RegisterEncoder(RedactedJsonEncoding, func(config zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return NewRedactingEncoder(zapcore.NewJSONEncoder(config)), nil
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// redactingEncoder runs redaction.RedactText over each encoded entry,
+// covering the message and every field.
+type redactingEncoder struct {
+	zapcore.Encoder
+	pool buffer.Pool
+}
+
+func NewRedactingEncoder(encoder zapcore.Encoder) zapcore.Encoder {
+	return &redactingEncoder{Encoder: encoder, pool: buffer.NewPool()}
+}
+
+func (self *redactingEncoder) Clone() zapcore.Encoder {
+	return &redactingEncoder{Encoder: self.Encoder.Clone(), pool: self.pool}
+}
+
+func (self *redactingEncoder) EncodeEntry(entry zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	encoded, err := self.Encoder.EncodeEntry(entry, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	line := encoded.String()
+	redacted := redaction.RedactText(line)
+	if redacted == line {
+		return encoded, nil
+	}
+	encoded.Free()
+
+	out := self.pool.Get()
+	out.AppendString(redacted)
+	return out, nil
+}
@@ -0,0 +1,58 @@
+package logger
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"payment-service/app/redaction"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// NewRequestLogger logs the start and completion of every request with l.
+// It must run after middleware.RequestID so entries carry the request id.
+func NewRequestLogger(l *Logger) func(next http.Handler) http.Handler {
+	return middleware.RequestLogger(&requestLogFormatter{logger: l})
+}
+
+type requestLogFormatter struct {
+	logger *Logger
+}
+
+func (self *requestLogFormatter) NewLogEntry(r *http.Request) middleware.LogEntry {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	entry := &requestLogEntry{logger: self.logger.FromContext(r.Context()).With(
+		"http_scheme", scheme,
+		"http_proto", r.Proto,
+		"http_method", r.Method,
+		"remote_addr", r.RemoteAddr,
+		"user_agent", r.UserAgent(),
+		"uri", redaction.RedactText(fmt.Sprintf("%s://%s%s", scheme, r.Host, r.RequestURI)),
+	)}
+	entry.logger.Info("request started")
+	return entry
+}
+
+type requestLogEntry struct {
+	logger *Logger
+}
+
+func (self *requestLogEntry) Write(status, bytes int, elapsed time.Duration) {
+	self.logger.Infow("request complete",
+		"resp_status", status,
+		"resp_bytes_length", bytes,
+		"resp_elapsed_ms", float64(elapsed.Nanoseconds())/1000000.0,
+	)
+}
+
+func (self *requestLogEntry) Panic(v interface{}, stack []byte) {
+	self.logger.Errorw("request panicked",
+		"panic", fmt.Sprintf("%+v", v),
+		"stack", string(stack),
+	)
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+)
+
+var httpRequests = NewCounterVec("http_requests_total",
+	"HTTP requests by method, route pattern and status code.",
+	"method", "route", "status")
+
+var httpRequestDuration = NewHistogramVec("http_request_duration_seconds",
+	"HTTP request latency by method and route pattern.",
+	DefaultBuckets, "method", "route")
+
+// HttpMiddleware records a request counter and latency histogram per route.
+// Routes are labelled with their chi pattern, and requests that match no
+// route with "unmatched", so the label stays bounded.
+func HttpMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		// chi.RouteContext panics outside a chi router, so the context is
+		// read directly.
+		if routeContext, _ := r.Context().Value(chi.RouteCtxKey).(*chi.Context); routeContext != nil && routeContext.RoutePattern() != "" {
+			route = routeContext.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		httpRequestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,392 @@
+// Package metrics is a small Prometheus client: counters, gauges and
+// histograms with labels, kept in a registry that is served in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are latency buckets in seconds, the same as the official
+// Prometheus client's defaults.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry served by Handler and used by the package level
+// constructors.
+var Default = NewRegistry()
+
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+type Registry struct {
+	mutex      sync.Mutex
+	collectors map[string]collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]collector)}
+}
+
+// register adds a metric family. Registering the same name twice is a
+// programming error and panics.
+func (self *Registry) register(c collector) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if _, ok := self.collectors[c.name()]; ok {
+		panic("metrics: " + c.name() + " is already registered")
+	}
+	self.collectors[c.name()] = c
+}
+
+// Write writes every metric family, sorted by name.
+func (self *Registry) Write(w *bufio.Writer) {
+	self.mutex.Lock()
+	names := make([]string, 0, len(self.collectors))
+	for name := range self.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	collectors := make([]collector, 0, len(names))
+	for _, name := range names {
+		collectors = append(collectors, self.collectors[name])
+	}
+	self.mutex.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+func (self *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		buffered := bufio.NewWriter(w)
+		self.Write(buffered)
+		buffered.Flush()
+	}
+}
+
+// Handler serves the Default registry.
+func Handler() http.HandlerFunc {
+	return Default.Handler()
+}
+
+// family holds what every metric family shares: its name, help text, type
+// and label names.
+type family struct {
+	metricName string
+	help       string
+	kind       string
+	labelNames []string
+}
+
+func (self *family) name() string {
+	return self.metricName
+}
+
+func (self *family) writeHeader(w *bufio.Writer) {
+	w.WriteString("# HELP " + self.metricName + " " + escapeHelp(self.help) + "\n")
+	w.WriteString("# TYPE " + self.metricName + " " + self.kind + "\n")
+}
+
+func (self *family) key(labelValues []string) string {
+	if len(labelValues) != len(self.labelNames) {
+		panic("metrics: " + self.metricName + " expects " + strconv.Itoa(len(self.labelNames)) + " label values")
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	mutex sync.Mutex
+	value float64
+}
+
+func (self *Counter) Inc() {
+	self.Add(1)
+}
+
+// Add increases the counter; negative values are ignored.
+func (self *Counter) Add(value float64) {
+	if value < 0 {
+		return
+	}
+	self.mutex.Lock()
+	self.value += value
+	self.mutex.Unlock()
+}
+
+func (self *Counter) get() float64 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.value
+}
+
+type CounterVec struct {
+	family
+	mutex    sync.Mutex
+	children map[string]*Counter
+	labels   map[string][]string
+}
+
+func NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+	vec := &CounterVec{
+		family:   family{metricName: name, help: help, kind: "counter", labelNames: labelNames},
+		children: make(map[string]*Counter),
+		labels:   make(map[string][]string),
+	}
+	Default.register(vec)
+	return vec
+}
+
+func (self *CounterVec) WithLabelValues(labelValues ...string) *Counter {
+	key := self.key(labelValues)
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	child, ok := self.children[key]
+	if !ok {
+		child = &Counter{}
+		self.children[key] = child
+		self.labels[key] = append([]string(nil), labelValues...)
+	}
+	return child
+}
+
+func (self *CounterVec) write(w *bufio.Writer) {
+	self.writeHeader(w)
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for _, key := range sortedKeys(self.labels) {
+		writeSample(w, self.metricName, self.labelNames, self.labels[key], "", "", self.children[key].get())
+	}
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	mutex sync.Mutex
+	value float64
+}
+
+func (self *Gauge) Set(value float64) {
+	self.mutex.Lock()
+	self.value = value
+	self.mutex.Unlock()
+}
+
+func (self *Gauge) Add(value float64) {
+	self.mutex.Lock()
+	self.value += value
+	self.mutex.Unlock()
+}
+
+func (self *Gauge) get() float64 {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return self.value
+}
+
+type GaugeVec struct {
+	family
+	mutex    sync.Mutex
+	children map[string]*Gauge
+	labels   map[string][]string
+}
+
+func NewGaugeVec(name string, help string, labelNames ...string) *GaugeVec {
+	vec := &GaugeVec{
+		family:   family{metricName: name, help: help, kind: "gauge", labelNames: labelNames},
+		children: make(map[string]*Gauge),
+		labels:   make(map[string][]string),
+	}
+	Default.register(vec)
+	return vec
+}
+
+func (self *GaugeVec) WithLabelValues(labelValues ...string) *Gauge {
+	key := self.key(labelValues)
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	child, ok := self.children[key]
+	if !ok {
+		child = &Gauge{}
+		self.children[key] = child
+		self.labels[key] = append([]string(nil), labelValues...)
+	}
+	return child
+}
+
+func (self *GaugeVec) write(w *bufio.Writer) {
+	self.writeHeader(w)
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for _, key := range sortedKeys(self.labels) {
+		writeSample(w, self.metricName, self.labelNames, self.labels[key], "", "", self.children[key].get())
+	}
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	mutex   sync.Mutex
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func (self *Histogram) Observe(value float64) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for i, bound := range self.buckets {
+		if value <= bound {
+			self.counts[i]++
+		}
+	}
+	self.count++
+	self.sum += value
+}
+
+type HistogramVec struct {
+	family
+	buckets  []float64
+	mutex    sync.Mutex
+	children map[string]*Histogram
+	labels   map[string][]string
+}
+
+func NewHistogramVec(name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	vec := &HistogramVec{
+		family:   family{metricName: name, help: help, kind: "histogram", labelNames: labelNames},
+		buckets:  sorted,
+		children: make(map[string]*Histogram),
+		labels:   make(map[string][]string),
+	}
+	Default.register(vec)
+	return vec
+}
+
+func (self *HistogramVec) WithLabelValues(labelValues ...string) *Histogram {
+	key := self.key(labelValues)
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	child, ok := self.children[key]
+	if !ok {
+		child = &Histogram{buckets: self.buckets, counts: make([]uint64, len(self.buckets))}
+		self.children[key] = child
+		self.labels[key] = append([]string(nil), labelValues...)
+	}
+	return child
+}
+
+func (self *HistogramVec) write(w *bufio.Writer) {
+	self.writeHeader(w)
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for _, key := range sortedKeys(self.labels) {
+		child := self.children[key]
+		labelValues := self.labels[key]
+
+		child.mutex.Lock()
+		for i, bound := range child.buckets {
+			writeSample(w, self.metricName+"_bucket", self.labelNames, labelValues, "le", formatFloat(bound), float64(child.counts[i]))
+		}
+		writeSample(w, self.metricName+"_bucket", self.labelNames, labelValues, "le", "+Inf", float64(child.count))
+		writeSample(w, self.metricName+"_sum", self.labelNames, labelValues, "", "", child.sum)
+		writeSample(w, self.metricName+"_count", self.labelNames, labelValues, "", "", float64(child.count))
+		child.mutex.Unlock()
+	}
+}
+
+// funcCollector reads its samples when scraped, for values that are owned
+// elsewhere such as connection pool stats.
+type funcCollector struct {
+	family
+	collect func(observe func(value float64, labelValues ...string))
+}
+
+// NewGaugeFunc registers a gauge whose samples are produced by collect on
+// every scrape. collect calls observe once per label combination.
+func NewGaugeFunc(name string, help string, labelNames []string, collect func(observe func(value float64, labelValues ...string))) {
+	Default.register(&funcCollector{
+		family:  family{metricName: name, help: help, kind: "gauge", labelNames: labelNames},
+		collect: collect,
+	})
+}
+
+// NewCounterFunc is NewGaugeFunc for values that only go up.
+func NewCounterFunc(name string, help string, labelNames []string, collect func(observe func(value float64, labelValues ...string))) {
+	Default.register(&funcCollector{
+		family:  family{metricName: name, help: help, kind: "counter", labelNames: labelNames},
+		collect: collect,
+	})
+}
+
+func (self *funcCollector) write(w *bufio.Writer) {
+	self.writeHeader(w)
+	self.collect(func(value float64, labelValues ...string) {
+		self.key(labelValues)
+		writeSample(w, self.metricName, self.labelNames, labelValues, "", "", value)
+	})
+}
+
+func writeSample(w *bufio.Writer, name string, labelNames []string, labelValues []string, extraName string, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labelNames) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, labelName := range labelNames {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(labelName + `="` + escapeLabel(labelValues[i]) + `"`)
+		}
+		if extraName != "" {
+			if len(labelNames) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraName + `="` + extraValue + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func escapeHelp(value string) string {
+	return helpEscaper.Replace(value)
+}
+
+func sortedKeys(labels map[string][]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,177 @@
+package metrics
+
+import (
+	"bufio"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+// scrape returns the exposition of the given collectors, in a registry of
+// their own.
+func scrape(collectors ...collector) string {
+	registry := NewRegistry()
+	for _, c := range collectors {
+		registry.register(c)
+	}
+	var out strings.Builder
+	buffered := bufio.NewWriter(&out)
+	registry.Write(buffered)
+	buffered.Flush()
+	return out.String()
+}
+
+func expectExposition(t *testing.T, got string, want string) {
+	t.Helper()
+	if got != want {
+		t.Errorf("exposition\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestCounterVecExposition(t *testing.T) {
+	counter := NewCounterVec("test_counter_total", "Requests by path.\nSecond line with a \\ backslash.", "path", "code")
+	counter.WithLabelValues("/b", "200").Add(2)
+	counter.WithLabelValues("/a", "500").Inc()
+	counter.WithLabelValues(`quote " back \ new`+"\n"+`line`, "200").Inc()
+	counter.WithLabelValues("/a", "500").Add(-5)
+
+	expectExposition(t, scrape(counter), `# HELP test_counter_total Requests by path.\nSecond line with a \\ backslash.
+# TYPE test_counter_total counter
+test_counter_total{path="/a",code="500"} 1
+test_counter_total{path="/b",code="200"} 2
+test_counter_total{path="quote \" back \\ new\nline",code="200"} 1
+`)
+}
+
+func TestGaugeVecExposition(t *testing.T) {
+	gauge := NewGaugeVec("test_gauge", "A gauge.", "state")
+	gauge.WithLabelValues("up").Set(1.5)
+	gauge.WithLabelValues("up").Add(-3)
+	gauge.WithLabelValues("inf").Set(math.Inf(1))
+	gauge.WithLabelValues("minus_inf").Set(math.Inf(-1))
+	gauge.WithLabelValues("nan").Set(math.NaN())
+	gauge.WithLabelValues("big").Set(1e21)
+
+	expectExposition(t, scrape(gauge), `# HELP test_gauge A gauge.
+# TYPE test_gauge gauge
+test_gauge{state="big"} 1e+21
+test_gauge{state="inf"} +Inf
+test_gauge{state="minus_inf"} -Inf
+test_gauge{state="nan"} NaN
+test_gauge{state="up"} -1.5
+`)
+}
+
+func TestHistogramVecExposition(t *testing.T) {
+	histogram := NewHistogramVec("test_duration_seconds", "Durations.", []float64{1, 0.25, 0.5}, "route")
+	for _, value := range []float64{0.1, 0.25, 0.3, 0.75, 4} {
+		histogram.WithLabelValues("/pay").Observe(value)
+	}
+	histogram.WithLabelValues("/empty")
+
+	expectExposition(t, scrape(histogram), `# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/empty",le="0.25"} 0
+test_duration_seconds_bucket{route="/empty",le="0.5"} 0
+test_duration_seconds_bucket{route="/empty",le="1"} 0
+test_duration_seconds_bucket{route="/empty",le="+Inf"} 0
+test_duration_seconds_sum{route="/empty"} 0
+test_duration_seconds_count{route="/empty"} 0
+test_duration_seconds_bucket{route="/pay",le="0.25"} 2
+test_duration_seconds_bucket{route="/pay",le="0.5"} 3
+test_duration_seconds_bucket{route="/pay",le="1"} 4
+test_duration_seconds_bucket{route="/pay",le="+Inf"} 5
+test_duration_seconds_sum{route="/pay"} 5.4
+test_duration_seconds_count{route="/pay"} 5
+`)
+}
+
+func TestHistogramWithoutLabels(t *testing.T) {
+	histogram := NewHistogramVec("test_unlabelled_seconds", "No labels.", []float64{1})
+	histogram.WithLabelValues().Observe(2)
+
+	expectExposition(t, scrape(histogram), `# HELP test_unlabelled_seconds No labels.
+# TYPE test_unlabelled_seconds histogram
+test_unlabelled_seconds_bucket{le="1"} 0
+test_unlabelled_seconds_bucket{le="+Inf"} 1
+test_unlabelled_seconds_sum 2
+test_unlabelled_seconds_count 1
+`)
+}
+
+func TestRegistrySortsFamiliesAndServesText(t *testing.T) {
+	registry := NewRegistry()
+	registry.register(&funcCollector{
+		family: family{metricName: "test_b_connections", help: "Open connections.", kind: "gauge", labelNames: []string{"db"}},
+		collect: func(observe func(value float64, labelValues ...string)) {
+			observe(3, "postgres")
+		},
+	})
+	registry.register(&funcCollector{
+		family: family{metricName: "test_a_queries_total", help: "Queries.", kind: "counter"},
+		collect: func(observe func(value float64, labelValues ...string)) {
+			observe(7)
+		},
+	})
+
+	recorder := httptest.NewRecorder()
+	registry.Handler()(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Content-Type %q, want the Prometheus text format", contentType)
+	}
+	expectExposition(t, recorder.Body.String(), `# HELP test_a_queries_total Queries.
+# TYPE test_a_queries_total counter
+test_a_queries_total 7
+# HELP test_b_connections Open connections.
+# TYPE test_b_connections gauge
+test_b_connections{db="postgres"} 3
+`)
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	registry := NewRegistry()
+	registry.register(&funcCollector{family: family{metricName: "test_twice"}})
+	defer func() {
+		if recover() == nil {
+			t.Error("registering test_twice again did not panic")
+		}
+	}()
+	registry.register(&funcCollector{family: family{metricName: "test_twice"}})
+}
+
+func TestWrongLabelCountPanics(t *testing.T) {
+	counter := NewCounterVec("test_label_count_total", "Labels.", "one", "two")
+	defer func() {
+		if recover() == nil {
+			t.Error("WithLabelValues with one of two labels did not panic")
+		}
+	}()
+	counter.WithLabelValues("only")
+}
+
+func TestHttpMiddlewareLabelsRoutes(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(HttpMiddleware)
+	router.Get("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/items/42", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+	HttpMiddleware(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/outside", nil))
+
+	exposition := scrape(httpRequests)
+	for _, sample := range []string{
+		`http_requests_total{method="GET",route="/items/{id}",status="418"} 1`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`http_requests_total{method="POST",route="unmatched",status="404"} 1`,
+	} {
+		if !strings.Contains(exposition, sample+"\n") {
+			t.Errorf("exposition has no %s:\n%s", sample, exposition)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"payment-service/app/clock"
+)
+
+const schemaMigrationsTable = "schema_migrations"
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is a versioned pair of up/down SQL scripts read from the
+// migrations directory, e.g. 000001_create_transactions.up.sql.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// AppliedMigration is a row of the schema_migrations table.
+type AppliedMigration struct {
+	Version   int64     `gorm:"primaryKey"`
+	Name      string    `gorm:"type:varchar(255);not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (AppliedMigration) TableName() string {
+	return schemaMigrationsTable
+}
+
+type MigrationStatus struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+}
+
+type Migrator struct {
+	db    *gorm.DB
+	dir   string
+	clock clock.Clock
+}
+
+func New(db *gorm.DB, dir string, clock clock.Clock) *Migrator {
+	return &Migrator{
+		db:    db,
+		dir:   dir,
+		clock: clock,
+	}
+}
+
+// Load reads every migration in the directory, ordered by version.
+func (self *Migrator) Load() ([]Migration, error) {
+	entries, err := os.ReadDir(self.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations directory %s: %w", self.dir, err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		matches := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			continue
+		}
+
+		version, _ := strconv.ParseInt(matches[1], 10, 64)
+		content, err := os.ReadFile(filepath.Join(self.dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = migration
+		} else if migration.Name != matches[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, migration.Name, matches[2])
+		}
+
+		if matches[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if strings.TrimSpace(migration.Up) == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// ensureTable creates schema_migrations. Only Up writes to the database;
+// every other call reads it and treats a missing table as nothing applied.
+func (self *Migrator) ensureTable() error {
+	return self.db.Exec(`CREATE TABLE IF NOT EXISTS ` + schemaMigrationsTable + ` (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`).Error
+}
+
+func (self *Migrator) tableExists() (bool, error) {
+	var exists bool
+	err := self.db.Raw("SELECT to_regclass(?) IS NOT NULL", schemaMigrationsTable).Scan(&exists).Error
+	return exists, err
+}
+
+// Applied returns the applied migrations keyed by version. It only reads:
+// before the first Up there is no schema_migrations table and nothing is
+// applied.
+func (self *Migrator) Applied() (map[int64]AppliedMigration, error) {
+	exists, err := self.tableExists()
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return map[int64]AppliedMigration{}, nil
+	}
+
+	var rows []AppliedMigration
+	if err := self.db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]AppliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+func (self *Migrator) Status() ([]MigrationStatus, error) {
+	migrations, err := self.Load()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := self.Applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if row, ok := applied[migration.Version]; ok {
+			appliedAt := row.AppliedAt
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (self *Migrator) Pending() ([]Migration, error) {
+	migrations, err := self.Load()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := self.Applied()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]Migration, 0)
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies pending migrations in version order, each in its own
+// transaction. steps <= 0 applies all of them.
+func (self *Migrator) Up(steps int) ([]Migration, error) {
+	if err := self.ensureTable(); err != nil {
+		return nil, err
+	}
+	pending, err := self.Pending()
+	if err != nil {
+		return nil, err
+	}
+	if steps > 0 && steps < len(pending) {
+		pending = pending[:steps]
+	}
+
+	done := make([]Migration, 0, len(pending))
+	for _, migration := range pending {
+		err := self.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.Up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&AppliedMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: self.clock.Now().UTC(),
+			}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down rolls back the most recently applied migrations, newest first.
+// steps <= 0 rolls back a single migration.
+func (self *Migrator) Down(steps int) ([]Migration, error) {
+	if steps <= 0 {
+		steps = 1
+	}
+
+	migrations, err := self.Load()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := self.Applied()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]Migration, 0, steps)
+	for i := len(migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if strings.TrimSpace(migration.Down) == "" {
+			return done, fmt.Errorf("migration %d_%s has no down script", migration.Version, migration.Name)
+		}
+
+		err := self.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec(migration.Down).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&AppliedMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("rollback of %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Create writes an empty up/down pair for the next version and returns the
+// paths of the new files.
+func Create(dir string, name string) (string, string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(name, "_")
+	name = strings.Trim(name, "_")
+	if name == "" {
+		return "", "", errors.New("migration name is required")
+	}
+
+	migrations, err := New(nil, dir, clock.System()).Load()
+	if err != nil {
+		return "", "", err
+	}
+	version := int64(1)
+	if len(migrations) > 0 {
+		version = migrations[len(migrations)-1].Version + 1
+	}
+
+	base := fmt.Sprintf("%06d_%s", version, name)
+	upPath := filepath.Join(dir, base+".up.sql")
+	downPath := filepath.Join(dir, base+".down.sql")
+
+	if err := os.WriteFile(upPath, []byte("-- "+base+" up\n"), 0644); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(downPath, []byte("-- "+base+" down\n"), 0644); err != nil {
+		return "", "", err
+	}
+	return upPath, downPath, nil
+}
@@ -0,0 +1,210 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"payment-service/app/clock"
+)
+
+// fakeDatabase answers the queries the migrator makes and records every
+// statement, so tests can check which ones write, and every time written.
+type fakeDatabase struct {
+	mutex      sync.Mutex
+	tableFound bool
+	statements []string
+	times      []time.Time
+}
+
+func (self *fakeDatabase) record(query string, args []driver.NamedValue) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.statements = append(self.statements, strings.Join(strings.Fields(query), " "))
+	for _, arg := range args {
+		if value, ok := arg.Value.(time.Time); ok {
+			self.times = append(self.times, value)
+		}
+	}
+}
+
+func (self *fakeDatabase) Open(name string) (driver.Conn, error) {
+	return &fakeConn{database: self}, nil
+}
+
+type fakeConn struct {
+	database *fakeDatabase
+}
+
+func (self *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, driver.ErrSkip
+}
+
+func (self *fakeConn) Close() error {
+	return nil
+}
+
+func (self *fakeConn) Begin() (driver.Tx, error) {
+	return self, nil
+}
+
+func (self *fakeConn) Commit() error {
+	return nil
+}
+
+func (self *fakeConn) Rollback() error {
+	return nil
+}
+
+func (self *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	self.database.record(query, args)
+	if strings.Contains(query, "CREATE TABLE IF NOT EXISTS "+schemaMigrationsTable) {
+		self.database.tableFound = true
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (self *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	self.database.record(query, args)
+	if strings.Contains(query, "to_regclass") {
+		return &fakeRows{columns: []string{"exists"}, values: [][]driver.Value{{self.database.tableFound}}}, nil
+	}
+	return &fakeRows{columns: []string{"version", "name", "applied_at"}}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (self *fakeRows) Columns() []string {
+	return self.columns
+}
+
+func (self *fakeRows) Close() error {
+	return nil
+}
+
+func (self *fakeRows) Next(dest []driver.Value) error {
+	if len(self.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, self.values[0])
+	self.values = self.values[1:]
+	return nil
+}
+
+var registerOnce sync.Once
+var fakeDatabases = map[string]*fakeDatabase{}
+
+// fakeDriver routes connections to the fakeDatabase named by the DSN.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return fakeDatabases[name].Open(name)
+}
+
+var testNow = time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+
+func newTestMigrator(t *testing.T, database *fakeDatabase) *Migrator {
+	t.Helper()
+	registerOnce.Do(func() { sql.Register("migrator-fake", fakeDriver{}) })
+	fakeDatabases[t.Name()] = database
+
+	sqlDb, err := sql.Open("migrator-fake", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDb.Close() })
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDb}), &gorm.Config{
+		Logger:                 logger.Discard,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"000001_create_things.up.sql":   "CREATE TABLE things (id INT);",
+		"000001_create_things.down.sql": "DROP TABLE things;",
+		"000002_add_name.up.sql":        "ALTER TABLE things ADD COLUMN name TEXT;",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return New(db, dir, clock.NewFake(testNow))
+}
+
+func (self *fakeDatabase) writes() []string {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	var writes []string
+	for _, statement := range self.statements {
+		if !strings.HasPrefix(statement, "SELECT") {
+			writes = append(writes, statement)
+		}
+	}
+	return writes
+}
+
+func TestPendingWithoutTableIsReadOnly(t *testing.T) {
+	database := &fakeDatabase{}
+	m := newTestMigrator(t, database)
+
+	pending, err := m.Pending()
+	if err != nil {
+		t.Fatalf("Pending: %v", err)
+	}
+	if len(pending) != 2 || pending[0].Version != 1 || pending[1].Version != 2 {
+		t.Errorf("pending %v, want both migrations", pending)
+	}
+	statuses, err := m.Status()
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	if len(statuses) != 2 || statuses[0].Applied || statuses[1].Applied {
+		t.Errorf("statuses %+v, want nothing applied", statuses)
+	}
+	if writes := database.writes(); len(writes) != 0 {
+		t.Errorf("read-only calls wrote %q", writes)
+	}
+	if database.tableFound {
+		t.Error("read-only calls created schema_migrations")
+	}
+}
+
+func TestUpCreatesTable(t *testing.T) {
+	database := &fakeDatabase{}
+	m := newTestMigrator(t, database)
+
+	done, err := m.Up(1)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if len(done) != 1 || done[0].Version != 1 {
+		t.Errorf("applied %v, want migration 1", done)
+	}
+	writes := database.writes()
+	if len(writes) < 3 || !strings.HasPrefix(writes[0], "CREATE TABLE IF NOT EXISTS schema_migrations") {
+		t.Fatalf("Up wrote %q, want schema_migrations created first", writes)
+	}
+	if writes[1] != "CREATE TABLE things (id INT);" || !strings.HasPrefix(writes[2], `INSERT INTO "schema_migrations"`) {
+		t.Errorf("Up wrote %q, want the migration and its schema_migrations row", writes[1:])
+	}
+	if len(database.times) != 1 || !database.times[0].Equal(testNow) {
+		t.Errorf("Up recorded the migration as applied at %v, want %s from the clock", database.times, testNow)
+	}
+}
@@ -0,0 +1,308 @@
+// Package redaction masks card data, bank account numbers and secrets in
+// payloads and log output before they leave the process or reach storage.
+//
+// Values are masked when they sit under a sensitive key (cvv, cardNumber,
+// expirationDate, accountNumber, client_secret, ...) in JSON, XML, form or
+// "key: value" text, after a CVV or expiry label in free text ("cvv 123",
+// "exp 12/25"), and wherever they can be recognised on their own:
+// Luhn-valid card numbers, valid IBANs and Stripe, webhook and API key
+// secrets. Expiry dates are only recognised under a key or label.
+package redaction
+
+import (
+	"encoding/json"
+	"math/big"
+	"payment-service/domain/cards"
+	"regexp"
+	"strings"
+)
+
+// Mask replaces a sensitive value. Card numbers and IBANs keep their last
+// four characters after it.
+const Mask = "****"
+
+var sensitiveKeys = map[string]bool{
+	"pan":               true,
+	"cardnumber":        true,
+	"creditcardnumber":  true,
+	"cvv":               true,
+	"cvv2":              true,
+	"cvc":               true,
+	"cvc2":              true,
+	"cardcode":          true,
+	"securitycode":      true,
+	"expirationdate":    true,
+	"expirydate":        true,
+	"expiry":            true,
+	"expdate":           true,
+	"expmonth":          true,
+	"expyear":           true,
+	"accountnumber":     true,
+	"bankaccountnumber": true,
+	"routingnumber":     true,
+	"iban":              true,
+	"transactionkey":    true,
+	"signaturekey":      true,
+	"apikey":            true,
+	"secretkey":         true,
+	"authorization":     true,
+	"xapikey":           true,
+	"xsignature":        true,
+}
+
+var (
+	// xmlElementPattern matches an opening tag and its text content.
+	xmlElementPattern = regexp.MustCompile(`<((?:[\w-]+:)?[\w-]+)((?:\s[^<>]*)?)>([^<]+)`)
+	// keyValuePattern matches "key": value, key=value and key: value pairs,
+	// including JSON embedded as an escaped string.
+	keyValuePattern = regexp.MustCompile(`(\\?"?)([\w.\-\[\]]+)(\\?"?\s*[:=]\s*)(\\"(?:[^"\\]|\\[^"])*\\"|"(?:[^"\\]|\\.)*"|[^\s,&;"}<>)\]]+)`)
+	// freeTextPattern matches a CVV or expiry date written after its label
+	// without a separator, as in "cvv 123" or "exp 12/25".
+	freeTextPattern = regexp.MustCompile(`(?i)\b(cvv2?|cvc2?|cvn|csc|card\s?code|security\s?code|exp(?:iry|iration|ires)?(?:\s?date)?|valid\s?(?:thru|through))(\s+)(\d{1,2}\s?/\s?\d{2,4}|\d{4}-\d{2}|\d{3,4})\b`)
+	secretPattern   = regexp.MustCompile(`\b((?:sk|rk)_(?:live|test)_|whsec_|psk_[0-9a-f]{8}_)[A-Za-z0-9+/=]{8,}`)
+	panPattern      = regexp.MustCompile(`\b[2-6](?:[ -]?\d){12,18}\b`)
+	ibanPattern     = regexp.MustCompile(`\b[A-Z]{2}\d{2}[A-Z0-9]{11,30}\b`)
+)
+
+// IsSensitiveKey reports whether values stored under key must be masked.
+// Keys are compared case-insensitively, ignoring separators, namespaces and
+// all but the last segment of form keys such as card[cvc].
+func IsSensitiveKey(key string) bool {
+	if i := strings.LastIndex(key, "["); i >= 0 {
+		key = strings.TrimSuffix(key[i+1:], "]")
+	}
+	if i := strings.LastIndex(key, ":"); i >= 0 {
+		key = key[i+1:]
+	}
+	key = strings.ToLower(key)
+	key = strings.NewReplacer("_", "", "-", "", ".", "").Replace(key)
+
+	if sensitiveKeys[key] {
+		return true
+	}
+	return strings.HasSuffix(key, "secret") || strings.HasSuffix(key, "password")
+}
+
+// Redact masks sensitive values in a stored payload. JSON documents are
+// walked structurally and keep their key order and value types; anything
+// else, including XML, is handled by RedactText.
+func Redact(payload string) string {
+	trimmed := strings.TrimLeft(payload, " \t\r\n\ufeff")
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)) {
+		return redactJson(trimmed)
+	}
+	return RedactText(payload)
+}
+
+// RedactText masks sensitive values in free text such as log lines, which
+// may embed XML, JSON, form data or Go struct dumps.
+func RedactText(text string) string {
+	text = redactXmlElements(text)
+	text = keyValuePattern.ReplaceAllStringFunc(text, func(match string) string {
+		parts := keyValuePattern.FindStringSubmatch(match)
+		if !IsSensitiveKey(parts[2]) {
+			// A quoted value may itself be a document, such as a
+			// request body in a log line.
+			if value := parts[4]; len(value) > 2 && value[0] == '"' {
+				return parts[1] + parts[2] + parts[3] + `"` + RedactText(value[1:len(value)-1]) + `"`
+			}
+			return match
+		}
+		return parts[1] + parts[2] + parts[3] + maskQuoted(parts[4])
+	})
+	text = freeTextPattern.ReplaceAllString(text, "${1}${2}"+Mask)
+	text = secretPattern.ReplaceAllString(text, "${1}"+Mask)
+	text = panPattern.ReplaceAllStringFunc(text, func(match string) string {
+		digits := strings.NewReplacer(" ", "", "-", "").Replace(match)
+		if !IsCardNumber(digits) {
+			return match
+		}
+		return MaskCardNumber(digits)
+	})
+	text = ibanPattern.ReplaceAllStringFunc(text, func(match string) string {
+		if !isIban(match) {
+			return match
+		}
+		return Mask + match[len(match)-4:]
+	})
+	return text
+}
+
+// MaskCardNumber keeps only the last four digits of a card number.
+func MaskCardNumber(number string) string {
+	if len(number) <= 4 {
+		return Mask
+	}
+	return Mask + number[len(number)-4:]
+}
+
+// IsCardNumber reports whether digits is a 12 to 19 digit Luhn-valid number.
+func IsCardNumber(digits string) bool {
+	return len(digits) >= 12 && len(digits) <= 19 && cards.IsLuhnValid(digits)
+}
+
+func redactXmlElements(text string) string {
+	matches := xmlElementPattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var out strings.Builder
+	last := 0
+	for _, match := range matches {
+		name := text[match[2]:match[3]]
+		content := text[match[6]:match[7]]
+		if !IsSensitiveKey(name) || strings.TrimSpace(content) == "" {
+			continue
+		}
+		out.WriteString(text[last:match[6]])
+		out.WriteString(Mask)
+		last = match[7]
+	}
+	out.WriteString(text[last:])
+	return out.String()
+}
+
+func maskQuoted(value string) string {
+	switch {
+	case strings.HasPrefix(value, `\"`):
+		return `\"` + Mask + `\"`
+	case strings.HasPrefix(value, `"`):
+		if value == `""` {
+			return value
+		}
+		return `"` + Mask + `"`
+	case value == "null":
+		return value
+	}
+	return Mask
+}
+
+// jsonRedactor copies a valid JSON document, replacing only the values it
+// masks, so keys keep their order and formatting is left alone. Strings
+// under a sensitive key become Mask, and numbers under one or that are card
+// numbers become 0, so every value keeps its type. Other strings go through
+// RedactText.
+type jsonRedactor struct {
+	in  string
+	pos int
+	out strings.Builder
+}
+
+func redactJson(payload string) string {
+	redactor := &jsonRedactor{in: payload}
+	redactor.value(false)
+	redactor.out.WriteString(redactor.in[redactor.pos:])
+	return redactor.out.String()
+}
+
+func (self *jsonRedactor) value(sensitive bool) {
+	self.space()
+	switch self.in[self.pos] {
+	case '{':
+		self.copy(1)
+		for self.space(); self.in[self.pos] != '}'; self.space() {
+			key := self.string()
+			self.out.WriteString(key)
+			var name string
+			_ = json.Unmarshal([]byte(key), &name)
+			self.space()
+			self.copy(1) // :
+			self.value(IsSensitiveKey(name))
+			self.space()
+			if self.in[self.pos] == ',' {
+				self.copy(1)
+			}
+		}
+		self.copy(1)
+	case '[':
+		self.copy(1)
+		for self.space(); self.in[self.pos] != ']'; self.space() {
+			self.value(false)
+			self.space()
+			if self.in[self.pos] == ',' {
+				self.copy(1)
+			}
+		}
+		self.copy(1)
+	case '"':
+		raw := self.string()
+		var text string
+		_ = json.Unmarshal([]byte(raw), &text)
+		switch {
+		case sensitive && text != "":
+			self.out.WriteString(`"` + Mask + `"`)
+		case RedactText(text) != text:
+			encoded, _ := json.Marshal(RedactText(text))
+			self.out.Write(encoded)
+		default:
+			self.out.WriteString(raw)
+		}
+	case 't', 'f', 'n':
+		end := self.pos
+		for end < len(self.in) && self.in[end] >= 'a' && self.in[end] <= 'z' {
+			end++
+		}
+		self.copy(end - self.pos)
+	default:
+		end := self.pos
+		for end < len(self.in) && strings.IndexByte("+-.0123456789eE", self.in[end]) >= 0 {
+			end++
+		}
+		number := self.in[self.pos:end]
+		self.pos = end
+		if sensitive || IsCardNumber(number) {
+			self.out.WriteString("0")
+		} else {
+			self.out.WriteString(number)
+		}
+	}
+}
+
+// string consumes the string token at the current position and returns it
+// as written, quotes and escapes included.
+func (self *jsonRedactor) string() string {
+	start := self.pos
+	for self.pos++; self.in[self.pos] != '"'; self.pos++ {
+		if self.in[self.pos] == '\\' {
+			self.pos++
+		}
+	}
+	self.pos++
+	return self.in[start:self.pos]
+}
+
+func (self *jsonRedactor) space() {
+	end := self.pos
+	for end < len(self.in) && strings.IndexByte(" \t\r\n", self.in[end]) >= 0 {
+		end++
+	}
+	self.copy(end - self.pos)
+}
+
+func (self *jsonRedactor) copy(n int) {
+	self.out.WriteString(self.in[self.pos : self.pos+n])
+	self.pos += n
+}
+
+func isIban(value string) bool {
+	rearranged := value[4:] + value[:4]
+
+	var numeric strings.Builder
+	for _, char := range rearranged {
+		switch {
+		case char >= '0' && char <= '9':
+			numeric.WriteRune(char)
+		case char >= 'A' && char <= 'Z':
+			numeric.WriteString(big.NewInt(int64(char-'A') + 10).String())
+		default:
+			return false
+		}
+	}
+
+	number, ok := new(big.Int).SetString(numeric.String(), 10)
+	if !ok {
+		return false
+	}
+	return new(big.Int).Mod(number, big.NewInt(97)).Int64() == 1
+}
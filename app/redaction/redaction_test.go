@@ -0,0 +1,113 @@
+package redaction
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{
+			name:    "json keeps key order and value types",
+			payload: `{"amount":1000,"card":{"number":"4111111111111111","exp_month":12,"exp_year":2030,"cvc":"123"},"currency":"usd","capture":true}`,
+			want:    `{"amount":1000,"card":{"number":"****1111","exp_month":0,"exp_year":0,"cvc":"****"},"currency":"usd","capture":true}`,
+		},
+		{
+			name:    "json keeps formatting, nulls and empty strings",
+			payload: "{\n  \"cardNumber\": null,\n  \"cvv\": \"\",\n  \"description\": \"order 42\"\n}",
+			want:    "{\n  \"cardNumber\": null,\n  \"cvv\": \"\",\n  \"description\": \"order 42\"\n}",
+		},
+		{
+			name:    "json walks arrays and objects under sensitive keys",
+			payload: `{"iban":{"value":"DE89370400440532013000"},"secrets":["sk_test_4eC39HqLyjWDarjtT1zdp7dc"]}`,
+			want:    `{"iban":{"value":"****3000"},"secrets":["sk_test_****"]}`,
+		},
+		{
+			name:    "json numbers that are card numbers",
+			payload: `[4111111111111111, 42]`,
+			want:    `[0, 42]`,
+		},
+		{
+			name:    "json strings embedding other formats",
+			payload: `{"note":"cvv 123, card 4242 4242 4242 4242"}`,
+			want:    `{"note":"cvv ****, card ****4242"}`,
+		},
+		{
+			name:    "xml",
+			payload: `<createTransactionRequest><merchantAuthentication><name>login</name><transactionKey>abc123</transactionKey></merchantAuthentication><creditCard><cardNumber>4111111111111111</cardNumber><expirationDate>2030-12</expirationDate><cardCode>987</cardCode></creditCard><amount>10.00</amount></createTransactionRequest>`,
+			want:    `<createTransactionRequest><merchantAuthentication><name>login</name><transactionKey>****</transactionKey></merchantAuthentication><creditCard><cardNumber>****</cardNumber><expirationDate>****</expirationDate><cardCode>****</cardCode></creditCard><amount>10.00</amount></createTransactionRequest>`,
+		},
+		{
+			name:    "form data",
+			payload: `amount=1000&card[number]=4111111111111111&card[cvc]=123&card[exp_month]=12&currency=usd`,
+			want:    `amount=1000&card[number]=****1111&card[cvc]=****&card[exp_month]=****&currency=usd`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Redact(test.payload); got != test.want {
+				t.Errorf("Redact(%s)\n got %s\nwant %s", test.payload, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRedactText(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"cvv after its label", "customer gave cvv 123 on the phone", "customer gave cvv **** on the phone"},
+		{"cvc2 in capitals", "CVC2 4321", "CVC2 ****"},
+		{"expiry with slash", "card exp 12/25 declined", "card exp **** declined"},
+		{"expiration date", "expiration date 2030-12", "expiration date ****"},
+		{"valid thru", "valid thru 01 / 27", "valid thru ****"},
+		{"key value pairs", "cvv: 123 expirationDate=1225 name: jane", "cvv: **** expirationDate=**** name: jane"},
+		{"card number with spaces", "paid with 4111 1111 1111 1111 today", "paid with ****1111 today"},
+		{"non-luhn number is kept", "order 4111111111111112", "order 4111111111111112"},
+		{"iban", "payout to GB82WEST12345698765432", "payout to ****5432"},
+		{"secrets", "key sk_live_abcdefgh12345678 and whsec_abcdefgh12345678", "key sk_live_**** and whsec_****"},
+		{"unrelated numbers are kept", "retrying 3 times after 500 ms, expected 2 items", "retrying 3 times after 500 ms, expected 2 items"},
+		{
+			"log line with a struct dump",
+			`payment intent created: &{Amount:1000 CreditCardNumber:4111111111111111 CVV:123 ExpirationDate:2030-12}`,
+			`payment intent created: &{Amount:1000 CreditCardNumber:**** CVV:**** ExpirationDate:****}`,
+		},
+		{
+			"log line with escaped json",
+			`request body: "{\"cardNumber\":\"4111111111111111\",\"amount\":10}"`,
+			`request body: "{\"cardNumber\":\"****\",\"amount\":10}"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := RedactText(test.text); got != test.want {
+				t.Errorf("RedactText(%q)\n got %q\nwant %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsSensitiveKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"cardNumber", true},
+		{"card_number", true},
+		{"card[cvc]", true},
+		{"anet:cardCode", true},
+		{"X-Api-Key", true},
+		{"client_secret", true},
+		{"db.password", true},
+		{"amount", false},
+		{"currency", false},
+	}
+	for _, test := range tests {
+		if got := IsSensitiveKey(test.key); got != test.want {
+			t.Errorf("IsSensitiveKey(%q) = %t, want %t", test.key, got, test.want)
+		}
+	}
+}
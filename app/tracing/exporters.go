@@ -0,0 +1,215 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StdoutExporter writes each batch of spans as one line of OTLP/JSON, the
+// format the collector's file exporter writes, for local debugging.
+type StdoutExporter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+func NewStdoutExporter() *StdoutExporter {
+	return &StdoutExporter{writer: os.Stdout}
+}
+
+func (self *StdoutExporter) ExportSpans(ctx context.Context, resource Resource, spans []SpanData) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return json.NewEncoder(self.writer).Encode(otlpRequest(resource, spans))
+}
+
+func (self *StdoutExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// OtlpExporter posts spans to an OpenTelemetry collector using OTLP/HTTP
+// with JSON encoding, e.g. http://localhost:4318/v1/traces.
+type OtlpExporter struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+func NewOtlpExporter(endpoint string, headers map[string]string) *OtlpExporter {
+	return &OtlpExporter{
+		endpoint: endpoint,
+		headers:  headers,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (self *OtlpExporter) ExportSpans(ctx context.Context, resource Resource, spans []SpanData) error {
+	body, err := json.Marshal(otlpRequest(resource, spans))
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, self.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range self.headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := self.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("otlp export failed: %w", err)
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("otlp export failed: collector returned %s", response.Status)
+	}
+	return nil
+}
+
+func (self *OtlpExporter) Shutdown(ctx context.Context) error {
+	self.client.CloseIdleConnections()
+	return nil
+}
+
+// The types below follow the OTLP protobuf JSON mapping: ids are hex
+// strings and 64-bit integers are decimal strings.
+
+type otlpAnyValue struct {
+	StringValue *string     `json:"stringValue,omitempty"`
+	BoolValue   *bool       `json:"boolValue,omitempty"`
+	IntValue    *string     `json:"intValue,omitempty"`
+	DoubleValue *otlpDouble `json:"doubleValue,omitempty"`
+}
+
+// otlpDouble encodes NaN and the infinities, which JSON numbers cannot
+// hold, as the strings the protobuf JSON mapping uses for them.
+type otlpDouble float64
+
+func (self otlpDouble) MarshalJSON() ([]byte, error) {
+	value := float64(self)
+	switch {
+	case math.IsNaN(value):
+		return []byte(`"NaN"`), nil
+	case math.IsInf(value, 1):
+		return []byte(`"Infinity"`), nil
+	case math.IsInf(value, -1):
+		return []byte(`"-Infinity"`), nil
+	}
+	return json.Marshal(value)
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpLink struct {
+	TraceId    string         `json:"traceId"`
+	SpanId     string         `json:"spanId"`
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceId           string         `json:"traceId"`
+	SpanId            string         `json:"spanId"`
+	ParentSpanId      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Links             []otlpLink     `json:"links,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpTraceRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func otlpRequest(resource Resource, spans []SpanData) otlpTraceRequest {
+	var resourceSpans otlpResourceSpans
+	resourceSpans.Resource.Attributes = otlpAttributes(append([]Attribute{String("service.name", resource.ServiceName)}, resource.Attributes...))
+
+	var scopeSpans otlpScopeSpans
+	scopeSpans.Scope.Name = "payment-service"
+	for _, span := range spans {
+		converted := otlpSpan{
+			TraceId:           span.SpanContext.TraceID.String(),
+			SpanId:            span.SpanContext.SpanID.String(),
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.Attributes),
+			Status:            otlpStatus{Code: span.StatusCode, Message: span.StatusMessage},
+		}
+		if span.ParentSpanID.IsValid() {
+			converted.ParentSpanId = span.ParentSpanID.String()
+		}
+		for _, link := range span.Links {
+			converted.Links = append(converted.Links, otlpLink{
+				TraceId:    link.SpanContext.TraceID.String(),
+				SpanId:     link.SpanContext.SpanID.String(),
+				Attributes: otlpAttributes(link.Attributes),
+			})
+		}
+		scopeSpans.Spans = append(scopeSpans.Spans, converted)
+	}
+	resourceSpans.ScopeSpans = []otlpScopeSpans{scopeSpans}
+	return otlpTraceRequest{ResourceSpans: []otlpResourceSpans{resourceSpans}}
+}
+
+func otlpAttributes(attributes []Attribute) []otlpKeyValue {
+	converted := make([]otlpKeyValue, 0, len(attributes))
+	for _, attribute := range attributes {
+		var value otlpAnyValue
+		switch typed := attribute.Value.(type) {
+		case string:
+			value.StringValue = &typed
+		case bool:
+			value.BoolValue = &typed
+		case int64:
+			formatted := strconv.FormatInt(typed, 10)
+			value.IntValue = &formatted
+		case float64:
+			double := otlpDouble(typed)
+			value.DoubleValue = &double
+		default:
+			formatted := fmt.Sprint(typed)
+			value.StringValue = &formatted
+		}
+		converted = append(converted, otlpKeyValue{Key: attribute.Key, Value: value})
+	}
+	return converted
+}
@@ -0,0 +1,422 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func mustTraceId(t *testing.T, value string) TraceID {
+	t.Helper()
+	var id TraceID
+	if _, err := hex.Decode(id[:], []byte(value)); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func mustSpanId(t *testing.T, value string) SpanID {
+	t.Helper()
+	var id SpanID
+	if _, err := hex.Decode(id[:], []byte(value)); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func testSpans(t *testing.T) (Resource, []SpanData) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	resource := Resource{ServiceName: "payment-service", Attributes: []Attribute{String("deployment.environment", "test")}}
+	return resource, []SpanData{
+		{
+			Name:         "POST /api/v1/deposit",
+			Kind:         SpanKindServer,
+			SpanContext:  SpanContext{TraceID: mustTraceId(t, testTraceId), SpanID: mustSpanId(t, testSpanId), Sampled: true},
+			ParentSpanID: mustSpanId(t, "b7ad6b7169203331"),
+			StartTime:    start,
+			EndTime:      start.Add(1500 * time.Millisecond),
+			Attributes: []Attribute{
+				String("http.route", "/api/v1/deposit"),
+				Int("http.response.status_code", 500),
+				Float64("payment.amount", 10.5),
+				Bool("payment.retried", true),
+			},
+			Links: []Link{{
+				SpanContext: SpanContext{TraceID: mustTraceId(t, "0af7651916cd43dd8448eb211c80319c"), SpanID: mustSpanId(t, "b9c7c989f97918e1")},
+				Attributes:  []Attribute{String("link.reason", "webhook")},
+			}},
+			StatusCode:    StatusError,
+			StatusMessage: "Internal Server Error",
+		},
+		{
+			Name:        "stripe.Charge",
+			Kind:        SpanKindClient,
+			SpanContext: SpanContext{TraceID: mustTraceId(t, testTraceId), SpanID: mustSpanId(t, "b7ad6b7169203331"), Sampled: true},
+			StartTime:   start,
+			EndTime:     start.Add(time.Millisecond),
+			Attributes: []Attribute{
+				Int64("payment.attempts", 9007199254740993),
+				Bool("payment.retried", false),
+				String("payment.note", ""),
+				Float64("payment.ratio", math.Inf(1)),
+				Float64("payment.rate", math.NaN()),
+			},
+		},
+	}
+}
+
+// otlpGolden is the OTLP/JSON body of testSpans: hex ids, 64-bit integers
+// as decimal strings, enums as numbers and non-finite doubles as strings.
+// TestOtlpGoldenFollowsTheSpec checks it against the OTLP specification.
+const otlpGolden = `{"resourceSpans":[{"resource":{"attributes":[` +
+	`{"key":"service.name","value":{"stringValue":"payment-service"}},` +
+	`{"key":"deployment.environment","value":{"stringValue":"test"}}]},` +
+	`"scopeSpans":[{"scope":{"name":"payment-service"},"spans":[` +
+	`{"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"00f067aa0ba902b7","parentSpanId":"b7ad6b7169203331",` +
+	`"name":"POST /api/v1/deposit","kind":2,"startTimeUnixNano":"1767323045000000000","endTimeUnixNano":"1767323046500000000",` +
+	`"attributes":[{"key":"http.route","value":{"stringValue":"/api/v1/deposit"}},` +
+	`{"key":"http.response.status_code","value":{"intValue":"500"}},` +
+	`{"key":"payment.amount","value":{"doubleValue":10.5}},` +
+	`{"key":"payment.retried","value":{"boolValue":true}}],` +
+	`"links":[{"traceId":"0af7651916cd43dd8448eb211c80319c","spanId":"b9c7c989f97918e1","attributes":[{"key":"link.reason","value":{"stringValue":"webhook"}}]}],` +
+	`"status":{"code":2,"message":"Internal Server Error"}},` +
+	`{"traceId":"4bf92f3577b34da6a3ce929d0e0e4736","spanId":"b7ad6b7169203331",` +
+	`"name":"stripe.Charge","kind":3,"startTimeUnixNano":"1767323045000000000","endTimeUnixNano":"1767323045001000000",` +
+	`"attributes":[{"key":"payment.attempts","value":{"intValue":"9007199254740993"}},` +
+	`{"key":"payment.retried","value":{"boolValue":false}},` +
+	`{"key":"payment.note","value":{"stringValue":""}},` +
+	`{"key":"payment.ratio","value":{"doubleValue":"Infinity"}},` +
+	`{"key":"payment.rate","value":{"doubleValue":"NaN"}}],` +
+	`"status":{}}]}]}]}`
+
+func TestOtlpRequestEncoding(t *testing.T) {
+	resource, spans := testSpans(t)
+	body, err := json.Marshal(otlpRequest(resource, spans))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != otlpGolden {
+		t.Errorf("OTLP body\n%s\nwant\n%s", body, otlpGolden)
+	}
+}
+
+// otlpFields are the JSON names of the fields of each OTLP message, from
+// opentelemetry-proto's collector/trace/v1, trace/v1, resource/v1 and
+// common/v1 definitions. The JSON mapping uses lowerCamelCase names.
+var otlpFields = map[string][]string{
+	"ExportTraceServiceRequest": {"resourceSpans"},
+	"ResourceSpans":             {"resource", "scopeSpans", "schemaUrl"},
+	"Resource":                  {"attributes", "droppedAttributesCount"},
+	"ScopeSpans":                {"scope", "spans", "schemaUrl"},
+	"InstrumentationScope":      {"name", "version", "attributes", "droppedAttributesCount"},
+	"Span": {"traceId", "spanId", "traceState", "parentSpanId", "flags", "name", "kind", "startTimeUnixNano",
+		"endTimeUnixNano", "attributes", "droppedAttributesCount", "events", "droppedEventsCount", "links",
+		"droppedLinksCount", "status"},
+	"Link":     {"traceId", "spanId", "traceState", "attributes", "droppedAttributesCount", "flags"},
+	"Status":   {"message", "code"},
+	"KeyValue": {"key", "value"},
+	"AnyValue": {"stringValue", "boolValue", "intValue", "doubleValue", "arrayValue", "kvlistValue", "bytesValue"},
+}
+
+// otlpChecker validates a decoded OTLP/JSON body against the message
+// definitions and the rules of the OTLP JSON encoding.
+type otlpChecker struct {
+	t *testing.T
+}
+
+func (self otlpChecker) message(path string, name string, value interface{}, required ...string) map[string]interface{} {
+	self.t.Helper()
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		self.t.Errorf("%s: %s is %T, want an object", path, name, value)
+		return map[string]interface{}{}
+	}
+	for field := range object {
+		known := false
+		for _, allowed := range otlpFields[name] {
+			known = known || field == allowed
+		}
+		if !known {
+			self.t.Errorf("%s: %s has no field %q", path, name, field)
+		}
+	}
+	for _, field := range required {
+		if _, ok := object[field]; !ok {
+			self.t.Errorf("%s: %s is missing %q", path, name, field)
+		}
+	}
+	return object
+}
+
+func (self otlpChecker) list(path string, value interface{}) []interface{} {
+	self.t.Helper()
+	if value == nil {
+		return nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		self.t.Errorf("%s is %T, want a list", path, value)
+	}
+	return list
+}
+
+// id checks a trace or span id: lower case hex, as the JSON encoding
+// requires instead of the protobuf mapping's base64, and not all zeros.
+func (self otlpChecker) id(path string, value interface{}, bytes int) {
+	self.t.Helper()
+	id, _ := value.(string)
+	decoded, err := hex.DecodeString(id)
+	if err != nil || len(decoded) != bytes || strings.ToLower(id) != id || strings.Trim(id, "0") == "" {
+		self.t.Errorf("%s = %v, want %d bytes of lower case hex", path, value, bytes)
+	}
+}
+
+// int64String checks a fixed64 or int64 field, which the JSON mapping
+// encodes as a decimal string.
+func (self otlpChecker) int64String(path string, value interface{}) int64 {
+	self.t.Helper()
+	text, _ := value.(string)
+	parsed, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		self.t.Errorf("%s = %v, want a 64-bit integer as a decimal string", path, value)
+	}
+	return parsed
+}
+
+// enum checks an enum field, which OTLP/JSON encodes as its number.
+func (self otlpChecker) enum(path string, value interface{}, max int64) {
+	self.t.Helper()
+	number, ok := value.(json.Number)
+	parsed, err := number.Int64()
+	if !ok || err != nil || parsed < 0 || parsed > max {
+		self.t.Errorf("%s = %v, want an enum number from 0 to %d", path, value, max)
+	}
+}
+
+func (self otlpChecker) attributes(path string, value interface{}) {
+	self.t.Helper()
+	for i, item := range self.list(path, value) {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		keyValue := self.message(itemPath, "KeyValue", item, "key", "value")
+		if key, _ := keyValue["key"].(string); key == "" {
+			self.t.Errorf("%s has no key", itemPath)
+		}
+		anyValue := self.message(itemPath+".value", "AnyValue", keyValue["value"])
+		if len(anyValue) != 1 {
+			self.t.Errorf("%s.value sets %d fields, want exactly one", itemPath, len(anyValue))
+		}
+		for field, value := range anyValue {
+			valuePath := itemPath + ".value." + field
+			switch field {
+			case "stringValue":
+				if _, ok := value.(string); !ok {
+					self.t.Errorf("%s = %v, want a string", valuePath, value)
+				}
+			case "boolValue":
+				if _, ok := value.(bool); !ok {
+					self.t.Errorf("%s = %v, want a bool", valuePath, value)
+				}
+			case "intValue":
+				self.int64String(valuePath, value)
+			case "doubleValue":
+				switch double := value.(type) {
+				case json.Number:
+				case string:
+					if double != "NaN" && double != "Infinity" && double != "-Infinity" {
+						self.t.Errorf("%s = %q, want a number, NaN, Infinity or -Infinity", valuePath, double)
+					}
+				default:
+					self.t.Errorf("%s = %v, want a number", valuePath, value)
+				}
+			}
+		}
+	}
+}
+
+func TestOtlpGoldenFollowsTheSpec(t *testing.T) {
+	check := otlpChecker{t: t}
+	decoder := json.NewDecoder(strings.NewReader(otlpGolden))
+	decoder.UseNumber()
+	var body interface{}
+	if err := decoder.Decode(&body); err != nil {
+		t.Fatalf("otlpGolden is not JSON: %v", err)
+	}
+
+	request := check.message("body", "ExportTraceServiceRequest", body, "resourceSpans")
+	spans := 0
+	for i, item := range check.list("resourceSpans", request["resourceSpans"]) {
+		path := fmt.Sprintf("resourceSpans[%d]", i)
+		resourceSpans := check.message(path, "ResourceSpans", item, "resource", "scopeSpans")
+		resource := check.message(path+".resource", "Resource", resourceSpans["resource"])
+		check.attributes(path+".resource.attributes", resource["attributes"])
+		serviceName := false
+		for _, attribute := range check.list(path+".resource.attributes", resource["attributes"]) {
+			keyValue, _ := attribute.(map[string]interface{})
+			serviceName = serviceName || keyValue["key"] == "service.name"
+		}
+		if !serviceName {
+			t.Errorf("%s.resource has no service.name, which the semantic conventions require", path)
+		}
+
+		for j, item := range check.list(path+".scopeSpans", resourceSpans["scopeSpans"]) {
+			scopePath := fmt.Sprintf("%s.scopeSpans[%d]", path, j)
+			scopeSpans := check.message(scopePath, "ScopeSpans", item, "scope", "spans")
+			check.message(scopePath+".scope", "InstrumentationScope", scopeSpans["scope"], "name")
+
+			for k, item := range check.list(scopePath+".spans", scopeSpans["spans"]) {
+				spanPath := fmt.Sprintf("%s.spans[%d]", scopePath, k)
+				span := check.message(spanPath, "Span", item, "traceId", "spanId", "name", "kind", "startTimeUnixNano", "endTimeUnixNano")
+				spans++
+				check.id(spanPath+".traceId", span["traceId"], 16)
+				check.id(spanPath+".spanId", span["spanId"], 8)
+				if parent, ok := span["parentSpanId"]; ok {
+					check.id(spanPath+".parentSpanId", parent, 8)
+				}
+				check.enum(spanPath+".kind", span["kind"], 5)
+				start := check.int64String(spanPath+".startTimeUnixNano", span["startTimeUnixNano"])
+				if end := check.int64String(spanPath+".endTimeUnixNano", span["endTimeUnixNano"]); end < start {
+					t.Errorf("%s ends before it starts", spanPath)
+				}
+				check.attributes(spanPath+".attributes", span["attributes"])
+				for l, item := range check.list(spanPath+".links", span["links"]) {
+					linkPath := fmt.Sprintf("%s.links[%d]", spanPath, l)
+					link := check.message(linkPath, "Link", item, "traceId", "spanId")
+					check.id(linkPath+".traceId", link["traceId"], 16)
+					check.id(linkPath+".spanId", link["spanId"], 8)
+					check.attributes(linkPath+".attributes", link["attributes"])
+				}
+				status := check.message(spanPath+".status", "Status", span["status"])
+				if code, ok := status["code"]; ok {
+					check.enum(spanPath+".status.code", code, 2)
+				}
+			}
+		}
+	}
+	if spans != 2 {
+		t.Errorf("otlpGolden holds %d spans, want 2", spans)
+	}
+}
+
+func TestOtlpExporterPostsJson(t *testing.T) {
+	var request *http.Request
+	var body []byte
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer collector.Close()
+
+	exporter := NewOtlpExporter(collector.URL+"/v1/traces", map[string]string{"Authorization": "Bearer token"})
+	resource, spans := testSpans(t)
+	if err := exporter.ExportSpans(context.Background(), resource, spans); err != nil {
+		t.Fatalf("ExportSpans: %v", err)
+	}
+	if request.Method != http.MethodPost || request.URL.Path != "/v1/traces" {
+		t.Errorf("exported with %s %s, want POST /v1/traces", request.Method, request.URL.Path)
+	}
+	if request.Header.Get("Content-Type") != "application/json" || request.Header.Get("Authorization") != "Bearer token" {
+		t.Errorf("exported with headers %v", request.Header)
+	}
+	if string(body) != otlpGolden {
+		t.Errorf("exported body\n%s\nwant\n%s", body, otlpGolden)
+	}
+}
+
+func TestOtlpExporterReportsCollectorErrors(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+
+	resource, spans := testSpans(t)
+	err := NewOtlpExporter(collector.URL, nil).ExportSpans(context.Background(), resource, spans)
+	if err == nil || err.Error() != "otlp export failed: collector returned 503 Service Unavailable" {
+		t.Errorf("ExportSpans returned %v, want the collector's status", err)
+	}
+}
+
+func TestStdoutExporterWritesOtlpJsonLines(t *testing.T) {
+	var out bytes.Buffer
+	exporter := &StdoutExporter{writer: &out}
+	resource, spans := testSpans(t)
+	for i := 0; i < 2; i++ {
+		if err := exporter.ExportSpans(context.Background(), resource, spans); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if want := otlpGolden + "\n" + otlpGolden + "\n"; out.String() != want {
+		t.Errorf("wrote\n%s\nwant a line of\n%s\nper batch", out.String(), otlpGolden)
+	}
+}
+
+// recordingExporter keeps the spans it is given.
+type recordingExporter struct {
+	mutex sync.Mutex
+	spans []SpanData
+}
+
+func (self *recordingExporter) ExportSpans(ctx context.Context, resource Resource, spans []SpanData) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.spans = append(self.spans, spans...)
+	return nil
+}
+
+func (self *recordingExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func TestSetupExportsSampledSpans(t *testing.T) {
+	exporter := &recordingExporter{}
+	var exportErrors []error
+	Setup(Config{Exporter: exporter, SampleRatio: 1, OnError: func(err error) { exportErrors = append(exportErrors, err) }})
+
+	ctx, parent := Start(context.Background(), "parent", WithKind(SpanKindServer))
+	_, child := Start(ctx, "child", WithAttributes(String("key", "value")))
+	child.RecordError(errors.New("boom"))
+	child.End()
+	parent.End()
+
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-"+testTraceId+"-"+testSpanId+"-00")
+	_, unsampled := Start(Extract(context.Background(), header), "unsampled")
+	unsampled.End()
+
+	if err := Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	exporter.mutex.Lock()
+	defer exporter.mutex.Unlock()
+	if len(exporter.spans) != 2 {
+		t.Fatalf("exported %d spans, want the parent and child only", len(exporter.spans))
+	}
+	exportedChild, exportedParent := exporter.spans[0], exporter.spans[1]
+	if exportedChild.Name != "child" || exportedParent.Name != "parent" {
+		t.Fatalf("exported %s and %s, want child and parent", exportedChild.Name, exportedParent.Name)
+	}
+	if exportedChild.ParentSpanID != exportedParent.SpanContext.SpanID || exportedChild.SpanContext.TraceID != exportedParent.SpanContext.TraceID {
+		t.Error("child is not linked to its parent")
+	}
+	if exportedChild.StatusCode != StatusError || exportedChild.StatusMessage != "boom" {
+		t.Errorf("child status %d %q, want the recorded error", exportedChild.StatusCode, exportedChild.StatusMessage)
+	}
+	if exportedParent.Kind != SpanKindServer || exportedChild.Kind != SpanKindInternal {
+		t.Errorf("span kinds %d and %d, want server and internal", exportedParent.Kind, exportedChild.Kind)
+	}
+	if len(exportErrors) != 0 {
+		t.Errorf("export errors %v", exportErrors)
+	}
+}
@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+const gormSpanKey = "tracing:span"
+
+// GormPlugin records a client span per gorm query, as a child of the span
+// in the statement's context (db.WithContext). Queries without a traced
+// context are not recorded, so background jobs do not produce one-span
+// traces. Statements are recorded with placeholders, never with values.
+type GormPlugin struct{}
+
+func (self GormPlugin) Name() string {
+	return "tracing"
+}
+
+func (self GormPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	register := []struct {
+		operation string
+		before    func(name string, fn func(*gorm.DB)) error
+		after     func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", callbacks.Create().Before("gorm:create").Register, callbacks.Create().After("gorm:create").Register},
+		{"query", callbacks.Query().Before("gorm:query").Register, callbacks.Query().After("gorm:query").Register},
+		{"update", callbacks.Update().Before("gorm:update").Register, callbacks.Update().After("gorm:update").Register},
+		{"delete", callbacks.Delete().Before("gorm:delete").Register, callbacks.Delete().After("gorm:delete").Register},
+		{"row", callbacks.Row().Before("gorm:row").Register, callbacks.Row().After("gorm:row").Register},
+		{"raw", callbacks.Raw().Before("gorm:raw").Register, callbacks.Raw().After("gorm:raw").Register},
+	}
+	for _, callback := range register {
+		if err := callback.before("tracing:before_"+callback.operation, startGormSpan(callback.operation)); err != nil {
+			return err
+		}
+		if err := callback.after("tracing:after_"+callback.operation, endGormSpan); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func startGormSpan(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil || !SpanContextFromContext(ctx).IsValid() {
+			return
+		}
+		_, span := Start(ctx, "db."+operation, WithKind(SpanKindClient), WithAttributes(
+			String("db.system", "postgresql"),
+			String("db.operation.name", operation),
+		))
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+func endGormSpan(db *gorm.DB) {
+	value, ok := db.InstanceGet(gormSpanKey)
+	if !ok {
+		return
+	}
+	span, _ := value.(*Span)
+	if span == nil {
+		return
+	}
+	defer span.End()
+
+	if db.Statement.Table != "" {
+		span.SetName("db." + spanOperation(span) + " " + db.Statement.Table)
+		span.SetAttributes(String("db.collection.name", db.Statement.Table))
+	}
+	span.SetAttributes(
+		String("db.query.text", db.Statement.SQL.String()),
+		Int64("db.response.rows_affected", db.Statement.RowsAffected),
+	)
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+	}
+}
+
+func spanOperation(span *Span) string {
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+	for _, attribute := range span.data.Attributes {
+		if attribute.Key == "db.operation.name" {
+			operation, _ := attribute.Value.(string)
+			return operation
+		}
+	}
+	return ""
+}
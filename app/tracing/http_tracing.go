@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+)
+
+const TraceIdHeader = "X-Trace-Id"
+
+// requestIdHeader is the header middleware.RequestID reads.
+const requestIdHeader = "X-Request-Id"
+
+// HttpMiddleware starts a server span per request, continuing the caller's
+// trace when it sends a traceparent header. It must run before
+// middleware.RequestID: requests without an X-Request-Id get the trace id
+// as their request id, so log lines and traces share one identifier.
+func HttpMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := Extract(r.Context(), r.Header)
+		ctx, span := Start(ctx, r.Method, WithKind(SpanKindServer), WithAttributes(
+			String("http.request.method", r.Method),
+			String("url.path", r.URL.Path),
+		))
+		defer span.End()
+
+		traceId := span.SpanContext().TraceID.String()
+		if r.Header.Get(requestIdHeader) == "" {
+			r.Header.Set(requestIdHeader, traceId)
+		}
+		w.Header().Set(TraceIdHeader, traceId)
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		// chi.RouteContext panics outside a chi router, so the context is
+		// read directly.
+		if routeContext, _ := r.Context().Value(chi.RouteCtxKey).(*chi.Context); routeContext != nil && routeContext.RoutePattern() != "" {
+			span.SetName(r.Method + " " + routeContext.RoutePattern())
+			span.SetAttributes(String("http.route", routeContext.RoutePattern()))
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(
+			Int("http.response.status_code", status),
+			String("http.request_id", r.Header.Get(requestIdHeader)),
+		)
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(StatusError, http.StatusText(status))
+		}
+	})
+}
+
+// Transport traces outgoing requests made with base (http.DefaultTransport
+// when nil) and sends the traceparent header along.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (self *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx, span := Start(r.Context(), "HTTP "+r.Method, WithKind(SpanKindClient), WithAttributes(
+		String("http.request.method", r.Method),
+		String("server.address", r.URL.Hostname()),
+		String("url.path", r.URL.Path),
+	))
+	defer span.End()
+
+	r = r.Clone(ctx)
+	Inject(ctx, r.Header)
+	response, err := self.base.RoundTrip(r)
+	if err != nil {
+		span.RecordError(err)
+		return response, err
+	}
+	span.SetAttributes(Int("http.response.status_code", response.StatusCode))
+	if response.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(StatusError, response.Status)
+	}
+	return response, nil
+}
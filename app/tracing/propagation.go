@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+const TraceparentHeader = "traceparent"
+
+// Traceparent formats a span context as a W3C traceparent value, or returns
+// an empty string for an invalid context.
+func Traceparent(spanContext SpanContext) string {
+	if !spanContext.IsValid() {
+		return ""
+	}
+	flags := "00"
+	if spanContext.Sampled {
+		flags = "01"
+	}
+	return "00-" + spanContext.TraceID.String() + "-" + spanContext.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses a W3C traceparent value. It returns false for
+// malformed values, including upper case hex, and for the all-zero ids and
+// version ff the spec forbids.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || !isLowerHex(parts[0]) || parts[0] == "ff" {
+		return SpanContext{}, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return SpanContext{}, false
+	}
+
+	var spanContext SpanContext
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	if !isLowerHex(parts[1]) || !isLowerHex(parts[2]) || !isLowerHex(parts[3]) {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(spanContext.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(spanContext.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, false
+	}
+	spanContext.Sampled = flags[0]&1 == 1
+	return spanContext, spanContext.IsValid()
+}
+
+// Extract returns ctx with the remote parent carried by the traceparent
+// header, if any.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	spanContext, ok := ParseTraceparent(header.Get(TraceparentHeader))
+	if !ok {
+		return ctx
+	}
+	return ContextWithRemoteSpanContext(ctx, spanContext)
+}
+
+// Inject sets the traceparent header for the span in ctx.
+func Inject(ctx context.Context, header http.Header) {
+	if traceparent := Traceparent(SpanContextFromContext(ctx)); traceparent != "" {
+		header.Set(TraceparentHeader, traceparent)
+	}
+}
+
+func isLowerHex(value string) bool {
+	for _, char := range value {
+		if (char < '0' || char > '9') && (char < 'a' || char > 'f') {
+			return false
+		}
+	}
+	return true
+}
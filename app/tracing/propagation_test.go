@@ -0,0 +1,141 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	testTraceId = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanId  = "00f067aa0ba902b7"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		ok      bool
+		sampled bool
+	}{
+		{"sampled", "00-" + testTraceId + "-" + testSpanId + "-01", true, true},
+		{"not sampled", "00-" + testTraceId + "-" + testSpanId + "-00", true, false},
+		{"other flags", "00-" + testTraceId + "-" + testSpanId + "-09", true, true},
+		{"surrounding spaces", "  00-" + testTraceId + "-" + testSpanId + "-01 ", true, true},
+		{"future version with more fields", "cc-" + testTraceId + "-" + testSpanId + "-01-what-the-future-holds", true, true},
+		{"version 00 with more fields", "00-" + testTraceId + "-" + testSpanId + "-01-extra", false, false},
+		{"version ff", "ff-" + testTraceId + "-" + testSpanId + "-01", false, false},
+		{"version not hex", "zz-" + testTraceId + "-" + testSpanId + "-01", false, false},
+		{"upper case trace id", "00-4BF92F3577B34DA6A3CE929D0E0E4736-" + testSpanId + "-01", false, false},
+		{"all-zero trace id", "00-00000000000000000000000000000000-" + testSpanId + "-01", false, false},
+		{"all-zero span id", "00-" + testTraceId + "-0000000000000000-01", false, false},
+		{"short trace id", "00-" + testTraceId[1:] + "-" + testSpanId + "-01", false, false},
+		{"short span id", "00-" + testTraceId + "-" + testSpanId[1:] + "-01", false, false},
+		{"long flags", "00-" + testTraceId + "-" + testSpanId + "-001", false, false},
+		{"flags not hex", "00-" + testTraceId + "-" + testSpanId + "-0g", false, false},
+		{"missing fields", "00-" + testTraceId + "-" + testSpanId, false, false},
+		{"empty", "", false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			spanContext, ok := ParseTraceparent(test.value)
+			if ok != test.ok {
+				t.Fatalf("ParseTraceparent(%q) ok = %t, want %t", test.value, ok, test.ok)
+			}
+			if !ok {
+				return
+			}
+			if spanContext.TraceID.String() != testTraceId || spanContext.SpanID.String() != testSpanId {
+				t.Errorf("parsed ids %s/%s, want %s/%s", spanContext.TraceID, spanContext.SpanID, testTraceId, testSpanId)
+			}
+			if spanContext.Sampled != test.sampled {
+				t.Errorf("sampled %t, want %t", spanContext.Sampled, test.sampled)
+			}
+		})
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	for _, value := range []string{
+		"00-" + testTraceId + "-" + testSpanId + "-01",
+		"00-" + testTraceId + "-" + testSpanId + "-00",
+	} {
+		spanContext, ok := ParseTraceparent(value)
+		if !ok {
+			t.Fatalf("ParseTraceparent(%q) failed", value)
+		}
+		if formatted := Traceparent(spanContext); formatted != value {
+			t.Errorf("Traceparent(ParseTraceparent(%q)) = %q", value, formatted)
+		}
+	}
+	if formatted := Traceparent(SpanContext{}); formatted != "" {
+		t.Errorf("Traceparent of an invalid context = %q, want empty", formatted)
+	}
+}
+
+func TestExtractContinuesRemoteTrace(t *testing.T) {
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-"+testTraceId+"-"+testSpanId+"-01")
+	ctx, span := Start(Extract(context.Background(), header), "child")
+	defer span.End()
+
+	child := span.SpanContext()
+	if child.TraceID.String() != testTraceId || !child.Sampled {
+		t.Errorf("child span is in trace %s sampled %t, want %s sampled", child.TraceID, child.Sampled, testTraceId)
+	}
+	if child.SpanID.String() == testSpanId {
+		t.Error("child span reuses the remote span id")
+	}
+
+	injected := http.Header{}
+	Inject(ctx, injected)
+	if want := "00-" + testTraceId + "-" + child.SpanID.String() + "-01"; injected.Get(TraceparentHeader) != want {
+		t.Errorf("injected traceparent %q, want %q", injected.Get(TraceparentHeader), want)
+	}
+}
+
+func TestExtractIgnoresMalformedHeader(t *testing.T) {
+	header := http.Header{}
+	header.Set(TraceparentHeader, "00-"+testTraceId+"-0000000000000000-01")
+	ctx := Extract(context.Background(), header)
+	if SpanContextFromContext(ctx).IsValid() {
+		t.Error("malformed traceparent became the parent")
+	}
+
+	injected := http.Header{}
+	Inject(ctx, injected)
+	if value := injected.Get(TraceparentHeader); value != "" {
+		t.Errorf("injected %q without a span", value)
+	}
+}
+
+func TestTransportAndMiddlewarePropagateTrace(t *testing.T) {
+	var serverSpan SpanContext
+	var serverRequestId string
+	server := httptest.NewServer(HttpMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverSpan = SpanContextFromContext(r.Context())
+		serverRequestId = r.Header.Get(requestIdHeader)
+	})))
+	defer server.Close()
+
+	ctx, span := Start(context.Background(), "caller")
+	defer span.End()
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	response, err := (&http.Client{Transport: Transport(nil)}).Do(request)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	response.Body.Close()
+
+	traceId := span.SpanContext().TraceID.String()
+	if serverSpan.TraceID.String() != traceId {
+		t.Errorf("server span is in trace %s, want the caller's %s", serverSpan.TraceID, traceId)
+	}
+	if response.Header.Get(TraceIdHeader) != traceId {
+		t.Errorf("%s header %q, want %s", TraceIdHeader, response.Header.Get(TraceIdHeader), traceId)
+	}
+	if serverRequestId != traceId {
+		t.Errorf("request without an id got request id %q, want the trace id %s", serverRequestId, traceId)
+	}
+}
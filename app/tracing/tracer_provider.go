@@ -0,0 +1,184 @@
+package tracing
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultQueueSize     = 2048
+	defaultBatchSize     = 512
+	defaultFlushInterval = 5 * time.Second
+)
+
+// Exporter sends finished spans to a backend.
+type Exporter interface {
+	ExportSpans(ctx context.Context, resource Resource, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+// Resource describes the process emitting the spans.
+type Resource struct {
+	ServiceName string
+	Attributes  []Attribute
+}
+
+type Config struct {
+	Resource Resource
+	Exporter Exporter
+	// SampleRatio is the share of new traces that are recorded. Traces
+	// started by a caller follow the caller's sampling decision.
+	SampleRatio float64
+	// OnError is called when a batch cannot be exported or spans are dropped.
+	OnError func(err error)
+}
+
+// tracerProvider batches finished spans and exports them in the background.
+type tracerProvider struct {
+	config  Config
+	queue   chan SpanData
+	done    chan struct{}
+	dropped atomic.Int64
+	// mutex guards closed, so spans are never sent on the closed queue.
+	mutex  sync.RWMutex
+	closed bool
+}
+
+var current atomic.Pointer[tracerProvider]
+var noop = &tracerProvider{}
+
+func provider() *tracerProvider {
+	if p := current.Load(); p != nil {
+		return p
+	}
+	return noop
+}
+
+// Setup starts exporting spans with config and replaces the previous setup.
+// Without an exporter, spans are still created and propagated but not
+// recorded.
+func Setup(config Config) {
+	if config.Exporter == nil {
+		current.Store(nil)
+		return
+	}
+	p := &tracerProvider{
+		config: config,
+		queue:  make(chan SpanData, defaultQueueSize),
+		done:   make(chan struct{}),
+	}
+	go p.run()
+	if previous := current.Swap(p); previous != nil {
+		previous.shutdown(context.Background())
+	}
+}
+
+// Shutdown exports the queued spans and stops the exporter.
+func Shutdown(ctx context.Context) error {
+	p := current.Swap(nil)
+	if p == nil {
+		return nil
+	}
+	return p.shutdown(ctx)
+}
+
+func (self *tracerProvider) enabled() bool {
+	return self.config.Exporter != nil
+}
+
+func (self *tracerProvider) sample(id TraceID) bool {
+	if !self.enabled() {
+		return false
+	}
+	return traceIdRatio(id) < self.config.SampleRatio
+}
+
+func (self *tracerProvider) export(span SpanData) {
+	if !self.enabled() {
+		return
+	}
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+	if self.closed {
+		return
+	}
+	select {
+	case self.queue <- span:
+	default:
+		self.dropped.Add(1)
+	}
+}
+
+func (self *tracerProvider) run() {
+	defer close(self.done)
+	ticker := time.NewTicker(defaultFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, defaultBatchSize)
+	send := func() {
+		if dropped := self.dropped.Swap(0); dropped > 0 {
+			self.reportError(&droppedSpansError{count: dropped})
+		}
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := self.config.Exporter.ExportSpans(ctx, self.config.Resource, batch)
+		cancel()
+		if err != nil {
+			self.reportError(err)
+		}
+		batch = make([]SpanData, 0, defaultBatchSize)
+	}
+
+	for {
+		select {
+		case span, ok := <-self.queue:
+			if !ok {
+				send()
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= defaultBatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		}
+	}
+}
+
+func (self *tracerProvider) shutdown(ctx context.Context) error {
+	self.mutex.Lock()
+	if self.closed {
+		self.mutex.Unlock()
+		return nil
+	}
+	self.closed = true
+	close(self.queue)
+	self.mutex.Unlock()
+
+	select {
+	case <-self.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return self.config.Exporter.Shutdown(ctx)
+}
+
+func (self *tracerProvider) reportError(err error) {
+	if self.config.OnError != nil {
+		self.config.OnError(err)
+	}
+}
+
+type droppedSpansError struct {
+	count int64
+}
+
+func (self *droppedSpansError) Error() string {
+	return "span queue full, dropped " + strconv.FormatInt(self.count, 10) + " spans"
+}
@@ -0,0 +1,305 @@
+// Package tracing records OpenTelemetry compatible spans. Trace context is
+// propagated with the W3C traceparent header and finished spans are sent to
+// the configured exporter (stdout or an OTLP/HTTP collector).
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (self TraceID) String() string {
+	return hex.EncodeToString(self[:])
+}
+
+func (self TraceID) IsValid() bool {
+	return self != TraceID{}
+}
+
+func (self SpanID) String() string {
+	return hex.EncodeToString(self[:])
+}
+
+func (self SpanID) IsValid() bool {
+	return self != SpanID{}
+}
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+	Remote  bool
+}
+
+func (self SpanContext) IsValid() bool {
+	return self.TraceID.IsValid() && self.SpanID.IsValid()
+}
+
+type SpanKind int
+
+// Span kinds, numbered as in OTLP.
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+	SpanKindProducer SpanKind = 4
+	SpanKindConsumer SpanKind = 5
+)
+
+type StatusCode int
+
+// Span status codes, numbered as in OTLP.
+const (
+	StatusUnset StatusCode = 0
+	StatusOk    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attribute is a span attribute. Value is a string, bool, int64 or float64.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func String(key string, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: int64(value)}
+}
+
+func Int64(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+func Float64(key string, value float64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Link points from a span to a span of another trace, for example from a
+// webhook to the request that created the transaction it confirms.
+type Link struct {
+	SpanContext SpanContext
+	Attributes  []Attribute
+}
+
+// SpanData is a finished span as handed to exporters.
+type SpanData struct {
+	Name          string
+	Kind          SpanKind
+	SpanContext   SpanContext
+	ParentSpanID  SpanID
+	StartTime     time.Time
+	EndTime       time.Time
+	Attributes    []Attribute
+	Links         []Link
+	StatusCode    StatusCode
+	StatusMessage string
+}
+
+// Span is an operation in progress. A nil *Span is valid and ignores every
+// call, so callers never need to check whether tracing is enabled.
+type Span struct {
+	mutex    sync.Mutex
+	data     SpanData
+	ended    bool
+	recorded bool
+}
+
+func (self *Span) SpanContext() SpanContext {
+	if self == nil {
+		return SpanContext{}
+	}
+	return self.data.SpanContext
+}
+
+func (self *Span) IsRecording() bool {
+	return self != nil && self.recorded
+}
+
+func (self *Span) SetName(name string) {
+	if !self.IsRecording() {
+		return
+	}
+	self.mutex.Lock()
+	self.data.Name = name
+	self.mutex.Unlock()
+}
+
+func (self *Span) SetAttributes(attributes ...Attribute) {
+	if !self.IsRecording() {
+		return
+	}
+	self.mutex.Lock()
+	self.data.Attributes = append(self.data.Attributes, attributes...)
+	self.mutex.Unlock()
+}
+
+func (self *Span) AddLink(link Link) {
+	if !self.IsRecording() || !link.SpanContext.IsValid() {
+		return
+	}
+	self.mutex.Lock()
+	self.data.Links = append(self.data.Links, link)
+	self.mutex.Unlock()
+}
+
+func (self *Span) SetStatus(code StatusCode, message string) {
+	if !self.IsRecording() {
+		return
+	}
+	self.mutex.Lock()
+	self.data.StatusCode = code
+	self.data.StatusMessage = message
+	self.mutex.Unlock()
+}
+
+// RecordError marks the span as failed with err. A nil error is ignored.
+func (self *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	self.SetStatus(StatusError, err.Error())
+}
+
+// End finishes the span and queues it for export. Only the first call has
+// an effect.
+func (self *Span) End() {
+	if !self.IsRecording() {
+		return
+	}
+	self.mutex.Lock()
+	if self.ended {
+		self.mutex.Unlock()
+		return
+	}
+	self.ended = true
+	self.data.EndTime = time.Now()
+	data := self.data
+	self.mutex.Unlock()
+
+	provider().export(data)
+}
+
+type spanConfig struct {
+	kind       SpanKind
+	attributes []Attribute
+}
+
+type SpanOption func(config *spanConfig)
+
+func WithKind(kind SpanKind) SpanOption {
+	return func(config *spanConfig) {
+		config.kind = kind
+	}
+}
+
+func WithAttributes(attributes ...Attribute) SpanOption {
+	return func(config *spanConfig) {
+		config.attributes = append(config.attributes, attributes...)
+	}
+}
+
+type spanContextKey struct{}
+
+// Start starts a span as a child of the span in ctx and returns a context
+// carrying the new span. The span must be ended with End.
+func Start(ctx context.Context, name string, options ...SpanOption) (context.Context, *Span) {
+	config := spanConfig{kind: SpanKindInternal}
+	for _, option := range options {
+		option(&config)
+	}
+
+	parent := SpanContextFromContext(ctx)
+
+	current := provider()
+	spanContext := SpanContext{SpanID: newSpanId()}
+	if parent.IsValid() {
+		spanContext.TraceID = parent.TraceID
+		spanContext.Sampled = parent.Sampled
+	} else {
+		spanContext.TraceID = newTraceId()
+		spanContext.Sampled = current.sample(spanContext.TraceID)
+	}
+
+	span := &Span{
+		recorded: current.enabled() && spanContext.Sampled,
+		data: SpanData{
+			Name:        name,
+			Kind:        config.kind,
+			SpanContext: spanContext,
+			StartTime:   time.Now(),
+			Attributes:  config.attributes,
+		},
+	}
+	if parent.IsValid() {
+		span.data.ParentSpanID = parent.SpanID
+	}
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// SpanFromContext returns the span in ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// SpanContextFromContext returns the context of the span in ctx, or of the
+// remote parent extracted from an incoming request.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if ctx == nil {
+		return SpanContext{}
+	}
+	if span := SpanFromContext(ctx); span != nil {
+		return span.SpanContext()
+	}
+	remote, _ := ctx.Value(remoteContextKey{}).(SpanContext)
+	return remote
+}
+
+type remoteContextKey struct{}
+
+// ContextWithRemoteSpanContext makes a span context received from another
+// process the parent of spans started from the returned context.
+func ContextWithRemoteSpanContext(ctx context.Context, spanContext SpanContext) context.Context {
+	spanContext.Remote = true
+	return context.WithValue(ctx, remoteContextKey{}, spanContext)
+}
+
+func newTraceId() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanId() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// traceIdRatio maps a trace id to [0, 1) for ratio sampling, so every
+// service sampling the same trace makes the same decision.
+func traceIdRatio(id TraceID) float64 {
+	return float64(binary.BigEndian.Uint64(id[8:])>>11) / float64(uint64(1)<<53)
+}
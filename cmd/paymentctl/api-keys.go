@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+func runApiKey(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		return fail(errors.New("api-key takes one of create, list or revoke"))
+	}
+
+	flags, dryRun := newFlagSet("api-key " + args[0])
+	name := flags.String("name", "", "name of the key (create)")
+	scopes := flags.String("scopes", "", "comma-separated scopes: deposit,withdraw,refund,read,admin (create)")
+	requireSignature := flags.Bool("require-signature", false, "require HMAC-signed requests for this key (create)")
+	merchant := flags.Uint("merchant", 0, "merchant id the key acts for; 0 creates or lists platform-wide (create, list)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	apiKeys := deps().ApiKeyService
+	switch args[0] {
+	case "create":
+		if *dryRun {
+			return printJson(map[string]interface{}{"dryRun": true, "name": *name, "scopes": strings.Split(*scopes, ",")})
+		}
+		created, err := apiKeys.CreateApiKey(ctx, *name, strings.Split(*scopes, ","), *requireSignature, optionalId(*merchant))
+		if err != nil {
+			return fail(err)
+		}
+		return printJson(created)
+	case "list":
+		list, err := apiKeys.ListApiKeys(ctx, optionalId(*merchant))
+		if err != nil {
+			return fail(err)
+		}
+		return printJson(list)
+	case "revoke":
+		if flags.NArg() != 1 {
+			return fail(errors.New("revoke takes exactly one api key id"))
+		}
+		id, err := strconv.ParseUint(flags.Arg(0), 10, 64)
+		if err != nil {
+			return fail(errors.New("invalid api key id"))
+		}
+		if *dryRun {
+			return printJson(map[string]interface{}{"dryRun": true, "id": id})
+		}
+		revoked, err := apiKeys.RevokeApiKey(ctx, nil, uint(id))
+		if err != nil {
+			return fail(err)
+		}
+		if revoked == nil {
+			return fail(errors.New("api key not found"))
+		}
+		return printJson(revoked)
+	default:
+		return fail(errors.New("api-key takes one of create, list or revoke"))
+	}
+}
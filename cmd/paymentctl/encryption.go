@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"payment-service/app/encryption"
+)
+
+func runEncryption(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		return fail(errors.New("encryption takes one of rotate or generate-key"))
+	}
+
+	flags, dryRun := newFlagSet("encryption " + args[0])
+	batch := flags.Int("batch", 100, "rows re-encrypted per query (rotate)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	switch args[0] {
+	case "rotate":
+		report, err := deps().EncryptionService.Reencrypt(ctx, *batch, *dryRun)
+		if err != nil {
+			return fail(err)
+		}
+		return printJson(report)
+	case "generate-key":
+		key, err := encryption.GenerateMasterKey()
+		if err != nil {
+			return fail(err)
+		}
+		return printJson(map[string]string{"key": key})
+	default:
+		return fail(errors.New("encryption takes one of rotate or generate-key"))
+	}
+}
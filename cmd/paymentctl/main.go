@@ -0,0 +1,198 @@
+// Command paymentctl runs operational tasks against the payment service
+// database and providers, using the same configuration as the server.
+// Every command prints JSON to stdout (export prints CSV) and accepts
+// -dry-run; read-only commands ignore it.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"payment-service/app"
+	"payment-service/container"
+	"payment-service/domain/types"
+)
+
+const usage = `usage: paymentctl <command> [flags] [args]
+
+commands:
+  lookup [-merchant ID] <id>           show a transaction by id, transaction id, payment id or charge id
+  resync [-dry-run] [-force] [-merchant ID] <id>...  refresh transaction status from the provider
+  refund [-dry-run] [-amount N] [-merchant ID] <id>  refund a succeeded deposit (full amount by default)
+  replay -provider P [-dry-run] [-merchant ID] <file>  replay a stored webhook body ("-" reads stdin)
+  reconcile [-dry-run] [-force] [filters]  resync every transaction matching the filters
+                                       (only pending ones without -status)
+  export [-out file] [filters]         export transactions as CSV
+  api-key create -name N -scopes S [-require-signature] [-merchant ID]
+  api-key list [-merchant ID]
+  api-key revoke <id>
+  encryption rotate [-dry-run] [-batch N]  move stored payloads under the active master key
+  encryption generate-key              print a new base64 master key
+  merchant create -name N [-credentials file] [fee flags]
+  merchant update [-name N] [-credentials file] [fee flags] <id>
+  merchant list
+  merchant disable|enable <id>
+
+filters: -from, -to (RFC3339 or YYYY-MM-DD), -status, -gateway, -merchant, -limit
+fee flags: -authorize-fee-percent, -authorize-fee-fixed, -authorize-settlement-currency
+-credentials reads a JSON object of merchant credentials ("-" reads stdin)
+-merchant makes lookup, resync, refund and replay find the transactions of that
+merchant; they only find platform transactions without it
+-force lets resync and reconcile move mismatch, refunded and partially_refunded
+transactions to the provider's status; they are kept otherwise`
+
+// command runs one paymentctl command. ctx is cancelled on SIGINT or
+// SIGTERM, which aborts pending database queries and provider calls.
+type command func(ctx context.Context, args []string) int
+
+var commands = map[string]command{
+	"lookup":     runLookup,
+	"resync":     runResync,
+	"refund":     runRefund,
+	"replay":     runReplay,
+	"reconcile":  runReconcile,
+	"export":     runExport,
+	"api-key":    runApiKey,
+	"encryption": runEncryption,
+	"merchant":   runMerchant,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[2:])
+	stop()
+	if built != nil {
+		built.App.Clean()
+	}
+	os.Exit(code)
+}
+
+var (
+	buildOnce sync.Once
+	built     *container.Container
+)
+
+// deps builds the application and its services on first use, so that
+// commands like encryption generate-key run without a database. It exits
+// when they cannot be built.
+func deps() *container.Container {
+	buildOnce.Do(func() {
+		application := app.New()
+		c, err := container.New(application)
+		if err != nil {
+			application.Clean()
+			os.Exit(fail(err))
+		}
+		built = c
+	})
+	return built
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *bool) {
+	flags := flag.NewFlagSet("paymentctl "+name, flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report what would change without changing anything")
+	return flags, dryRun
+}
+
+func addForceFlag(flags *flag.FlagSet) *bool {
+	return flags.Bool("force", false, "also move mismatch, refunded and partially_refunded transactions to the provider's status")
+}
+
+// addMerchantFlag adds the -merchant flag of commands that look
+// transactions up by id. Lookups only see the transactions of that
+// merchant, or platform transactions without it.
+func addMerchantFlag(flags *flag.FlagSet) *uint {
+	return flags.Uint("merchant", 0, "merchant id the transactions belong to; 0 looks up platform transactions")
+}
+
+type filterFlags struct {
+	from     *string
+	to       *string
+	status   *string
+	gateway  *string
+	merchant *uint
+	limit    *int
+}
+
+func addFilterFlags(flags *flag.FlagSet, defaultFrom string) filterFlags {
+	return filterFlags{
+		from:     flags.String("from", defaultFrom, "only transactions created at or after this time"),
+		to:       flags.String("to", "", "only transactions created before this time"),
+		status:   flags.String("status", "", "only transactions with this status"),
+		gateway:  flags.String("gateway", "", "only transactions for this provider"),
+		merchant: flags.Uint("merchant", 0, "only transactions of this merchant id"),
+		limit:    flags.Int("limit", 0, "maximum number of transactions"),
+	}
+}
+
+func (self filterFlags) filter() (types.TransactionFilter, error) {
+	filter := types.TransactionFilter{
+		Status:      *self.status,
+		GatewayName: *self.gateway,
+		MerchantId:  optionalId(*self.merchant),
+		Limit:       *self.limit,
+	}
+
+	var err error
+	if filter.From, err = parseTime(*self.from); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseTime(*self.to); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// optionalId maps the 0 default of id flags to nil.
+func optionalId(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return &parsed, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid time %q, expected RFC3339 or YYYY-MM-DD", value)
+}
+
+func printJson(payload interface{}) int {
+	out, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return fail(err)
+	}
+	fmt.Println(string(out))
+	return 0
+}
+
+// fail prints the error as JSON so scripts can parse it and exits non-zero.
+func fail(err error) int {
+	out, _ := json.Marshal(map[string]string{"error": err.Error()})
+	fmt.Println(string(out))
+	return 1
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"strconv"
+
+	"payment-service/domain/types"
+)
+
+func runMerchant(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		return fail(errors.New("merchant takes one of create, update, list, disable or enable"))
+	}
+
+	flags, dryRun := newFlagSet("merchant " + args[0])
+	name := flags.String("name", "", "merchant name (create, update)")
+	credentialsFile := flags.String("credentials", "", "JSON file with provider credentials (create, update)")
+	feePercent := optionalFloatFlag(flags, "authorize-fee-percent", "Authorize.Net fee percentage (create, update)")
+	feeFixed := optionalFloatFlag(flags, "authorize-fee-fixed", "Authorize.Net fixed fee (create, update)")
+	settlementCurrency := flags.String("authorize-settlement-currency", "", "Authorize.Net settlement currency (create, update)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	params := types.MerchantParams{
+		Name:                *name,
+		AuthorizeFeePercent: feePercent.value,
+		AuthorizeFeeFixed:   feeFixed.value,
+	}
+	if *settlementCurrency != "" {
+		params.AuthorizeSettlementCurrency = settlementCurrency
+	}
+	if *credentialsFile != "" {
+		credentials, err := readCredentials(*credentialsFile)
+		if err != nil {
+			return fail(err)
+		}
+		params.Credentials = credentials
+	}
+
+	merchants := deps().MerchantService
+	switch args[0] {
+	case "create":
+		if *dryRun {
+			return printJson(map[string]interface{}{"dryRun": true, "name": *name})
+		}
+		created, err := merchants.CreateMerchant(ctx, params)
+		if err != nil {
+			return fail(err)
+		}
+		return printJson(created)
+	case "list":
+		list, err := merchants.ListMerchants(ctx)
+		if err != nil {
+			return fail(err)
+		}
+		return printJson(list)
+	case "update", "disable", "enable":
+		if flags.NArg() != 1 {
+			return fail(errors.New(args[0] + " takes exactly one merchant id"))
+		}
+		id, err := strconv.ParseUint(flags.Arg(0), 10, 64)
+		if err != nil {
+			return fail(errors.New("invalid merchant id"))
+		}
+		if *dryRun {
+			return printJson(map[string]interface{}{"dryRun": true, "id": id})
+		}
+
+		var merchant interface{}
+		switch args[0] {
+		case "update":
+			merchant, err = merchants.UpdateMerchant(ctx, uint(id), params)
+		default:
+			merchant, err = merchants.SetMerchantDisabled(ctx, uint(id), args[0] == "disable")
+		}
+		if err != nil {
+			return fail(err)
+		}
+		return printJson(merchant)
+	default:
+		return fail(errors.New("merchant takes one of create, update, list, disable or enable"))
+	}
+}
+
+func readCredentials(path string) (*types.MerchantCredentials, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var credentials types.MerchantCredentials
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return nil, errors.New("invalid credentials file: " + err.Error())
+	}
+	return &credentials, nil
+}
+
+// optionalFloat is a float flag that stays nil unless it is set.
+type optionalFloat struct {
+	value *float64
+}
+
+func optionalFloatFlag(flags *flag.FlagSet, name string, usage string) *optionalFloat {
+	flagValue := &optionalFloat{}
+	flags.Var(flagValue, name, usage)
+	return flagValue
+}
+
+func (self *optionalFloat) String() string {
+	if self == nil || self.value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*self.value, 'f', -1, 64)
+}
+
+func (self *optionalFloat) Set(value string) error {
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	self.value = &parsed
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+)
+
+func runReplay(ctx context.Context, args []string) int {
+	flags, dryRun := newFlagSet("replay")
+	provider := flags.String("provider", "", "provider that sent the webhook (stripe or authorize)")
+	merchant := addMerchantFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || *provider == "" {
+		return fail(errors.New("replay takes -provider and exactly one file"))
+	}
+
+	var payload []byte
+	var err error
+	if flags.Arg(0) == "-" {
+		payload, err = io.ReadAll(os.Stdin)
+	} else {
+		payload, err = os.ReadFile(flags.Arg(0))
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	transaction, err := deps().OperationsService.ReplayWebhook(ctx, *provider, optionalId(*merchant), payload, *dryRun)
+	if err != nil {
+		return fail(err)
+	}
+	return printJson(map[string]interface{}{
+		"dryRun":      *dryRun,
+		"transaction": transaction,
+	})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+
+	"payment-service/domain/services"
+	"payment-service/domain/types"
+)
+
+func runLookup(ctx context.Context, args []string) int {
+	flags, _ := newFlagSet("lookup")
+	merchant := addMerchantFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		return fail(errors.New("lookup takes exactly one id"))
+	}
+
+	transaction, err := deps().OperationsService.FindTransaction(ctx, optionalId(*merchant), flags.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+	return printJson(transaction)
+}
+
+func runResync(ctx context.Context, args []string) int {
+	flags, dryRun := newFlagSet("resync")
+	force := addForceFlag(flags)
+	merchant := addMerchantFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		return fail(errors.New("resync takes at least one id"))
+	}
+
+	operations := deps().OperationsService
+	results := make([]types.ResyncResult, 0, flags.NArg())
+	code := 0
+	for _, id := range flags.Args() {
+		transaction, err := operations.FindTransaction(ctx, optionalId(*merchant), id)
+		if err != nil {
+			results = append(results, types.ResyncResult{TransactionId: id, Error: err.Error()})
+			code = 1
+			continue
+		}
+
+		result, err := operations.ResyncTransaction(ctx, *transaction, *force, *dryRun)
+		if err != nil {
+			result.Error = err.Error()
+			code = 1
+		}
+		results = append(results, result)
+	}
+
+	printJson(results)
+	return code
+}
+
+func runRefund(ctx context.Context, args []string) int {
+	flags, dryRun := newFlagSet("refund")
+	amount := flags.String("amount", "", "amount to refund, defaults to the full transaction amount")
+	merchant := addMerchantFlag(flags)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		return fail(errors.New("refund takes exactly one id"))
+	}
+
+	refundAmount := 0.0
+	if *amount != "" {
+		parsed, err := strconv.ParseFloat(*amount, 64)
+		if err != nil || parsed <= 0 {
+			return fail(errors.New("amount must be a positive number"))
+		}
+		refundAmount = parsed
+	}
+
+	operations := deps().OperationsService
+	transaction, err := operations.FindTransaction(ctx, optionalId(*merchant), flags.Arg(0))
+	if err != nil {
+		return fail(err)
+	}
+
+	result, err := operations.RefundTransaction(ctx, *transaction, refundAmount, *dryRun)
+	if err != nil {
+		return fail(err)
+	}
+	return printJson(result)
+}
+
+func runReconcile(ctx context.Context, args []string) int {
+	flags, dryRun := newFlagSet("reconcile")
+	force := addForceFlag(flags)
+	filters := addFilterFlags(flags, "")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	filter, err := filters.filter()
+	if err != nil {
+		return fail(err)
+	}
+
+	reconciliation := deps().ReconciliationService
+	report, err := reconciliation.Run(ctx, filter, *force, *dryRun)
+	if err != nil {
+		return fail(err)
+	}
+
+	printJson(report)
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func runExport(ctx context.Context, args []string) int {
+	flags, dryRun := newFlagSet("export")
+	out := flags.String("out", "", "file to write, defaults to stdout")
+	filters := addFilterFlags(flags, "")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	filter, err := filters.filter()
+	if err != nil {
+		return fail(err)
+	}
+
+	transactions, err := deps().OperationsService.ListTransactions(ctx, filter)
+	if err != nil {
+		return fail(err)
+	}
+	if *dryRun {
+		return printJson(map[string]interface{}{"dryRun": true, "transactions": len(transactions)})
+	}
+
+	writer := os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return fail(err)
+		}
+		defer file.Close()
+		writer = file
+	}
+
+	if err := services.WriteTransactionsCsv(writer, transactions); err != nil {
+		return fail(err)
+	}
+	if *out != "" {
+		return printJson(map[string]interface{}{"out": *out, "transactions": len(transactions)})
+	}
+	return 0
+}
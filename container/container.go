@@ -0,0 +1,99 @@
+// Package container wires the service together. It builds every repository,
+// service, controller and middleware once, passing them the application's
+// config, logger, database, keyring and clock, so that services sharing
+// state such as circuit breakers share the same instance.
+package container
+
+import (
+	"github.com/go-playground/validator/v10"
+	"payment-service/app"
+	"payment-service/controllers"
+	"payment-service/domain/repositories"
+	"payment-service/domain/services"
+	"payment-service/middlewares"
+	"payment-service/requests"
+)
+
+type Container struct {
+	App *app.Application
+
+	TransactionRepository   repositories.TransactionRepository
+	MerchantRepository      repositories.MerchantRepository
+	ApiKeyRepository        repositories.ApiKeyRepository
+	RoutingRuleRepository   *repositories.RoutingRuleRepository
+	RateLimitRepository     *repositories.RateLimitRepository
+	WebhookStatusRepository *repositories.WebhookStatusRepository
+
+	MerchantService       *services.MerchantService
+	AlertService          *services.AlertService
+	CircuitBreakerService *services.CircuitBreakerService
+	ApprovalRateService   *services.ApprovalRateService
+	RoutingService        *services.RoutingService
+	PaymentService        *services.PaymentService
+	OperationsService     *services.OperationsService
+	ReconciliationService *services.ReconciliationService
+	ApiKeyService         *services.ApiKeyService
+	RateLimitService      *services.RateLimitService
+	RoutingRuleService    *services.RoutingRuleService
+	StatusService         *services.StatusService
+	EncryptionService     *services.EncryptionService
+
+	AuthMiddleware      *middlewares.AuthMiddleware
+	RateLimitMiddleware *middlewares.RateLimitMiddleware
+
+	Validator *validator.Validate
+
+	PaymentController     *controllers.PaymentController
+	ApiKeyController      *controllers.ApiKeyController
+	MerchantController    *controllers.MerchantController
+	RoutingRuleController *controllers.RoutingRuleController
+	StatusController      *controllers.StatusController
+}
+
+// New builds everything on the "postgres" connection of application. It
+// fails when that connection is not available.
+func New(application *app.Application) (*Container, error) {
+	config := application.Config()
+	log := application.Logger()
+	keyring := application.Keyring()
+	clock := application.Clock()
+	db, err := application.GetPgDbConnectionByName("postgres")
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Container{App: application}
+
+	c.TransactionRepository = repositories.NewTransactionRepository(db, keyring)
+	c.MerchantRepository = repositories.NewMerchantRepository(db, keyring)
+	c.ApiKeyRepository = repositories.NewApiKeyRepository(db, keyring)
+	c.RoutingRuleRepository = repositories.NewRoutingRuleRepository(db)
+	c.RateLimitRepository = repositories.NewRateLimitRepository(db)
+	c.WebhookStatusRepository = repositories.NewWebhookStatusRepository(db)
+
+	c.MerchantService = services.NewMerchantService(c.MerchantRepository, config, keyring, log, clock)
+	c.AlertService = services.NewAlertService(config, log)
+	c.CircuitBreakerService = services.NewCircuitBreakerService(config, log)
+	c.ApprovalRateService = services.NewApprovalRateService(config)
+	c.RoutingService = services.NewRoutingService(c.MerchantService, c.CircuitBreakerService, c.ApprovalRateService, c.RoutingRuleRepository, config, log, clock)
+	c.PaymentService = services.NewPaymentService(c.TransactionRepository, c.MerchantService, c.AlertService, c.RoutingService, c.CircuitBreakerService, c.ApprovalRateService, log)
+	c.OperationsService = services.NewOperationsService(c.PaymentService, log)
+	c.ReconciliationService = services.NewReconciliationService(c.OperationsService, log)
+	c.ApiKeyService = services.NewApiKeyService(c.ApiKeyRepository, c.MerchantService, config, keyring, log, clock)
+	c.RateLimitService = services.NewRateLimitService(c.RateLimitRepository, config, log, clock)
+	c.RoutingRuleService = services.NewRoutingRuleService(c.RoutingRuleRepository, c.MerchantService, log)
+	c.StatusService = services.NewStatusService(c.MerchantService, c.CircuitBreakerService, c.WebhookStatusRepository, log, clock)
+	c.EncryptionService = services.NewEncryptionService(c.TransactionRepository, c.MerchantRepository, c.ApiKeyRepository, keyring, config, log)
+
+	c.AuthMiddleware = middlewares.NewAuthMiddleware(c.ApiKeyService, c.MerchantService, config)
+	c.RateLimitMiddleware = middlewares.NewRateLimitMiddleware(c.RateLimitService)
+
+	c.Validator = requests.NewValidator(clock)
+
+	c.PaymentController = controllers.NewPaymentController(c.PaymentService, c.OperationsService, c.StatusService, c.Validator, log)
+	c.ApiKeyController = controllers.NewApiKeyController(c.ApiKeyService, c.Validator)
+	c.MerchantController = controllers.NewMerchantController(c.MerchantService, c.Validator)
+	c.RoutingRuleController = controllers.NewRoutingRuleController(c.RoutingRuleService, c.Validator)
+	c.StatusController = controllers.NewStatusController(c.StatusService, application)
+	return c, nil
+}
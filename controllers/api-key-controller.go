@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+	"payment-service/app"
+	"payment-service/domain/services"
+	"payment-service/errors"
+	"payment-service/middlewares"
+	"payment-service/requests"
+	"strconv"
+)
+
+type ApiKeyController struct {
+	app.Controller
+	ApiKeyService *services.ApiKeyService
+	Validator     *validator.Validate
+}
+
+func NewApiKeyController(apiKeyService *services.ApiKeyService, validate *validator.Validate) *ApiKeyController {
+	return &ApiKeyController{
+		ApiKeyService: apiKeyService,
+		Validator:     validate,
+	}
+}
+
+func (self *ApiKeyController) CreateApiKey(w http.ResponseWriter, r *http.Request) {
+	var body requests.CreateApiKeyRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		self.JsonValidationErrors(w, r, err)
+		return
+	}
+
+	err = self.Validator.Struct(body)
+	if err != nil {
+		self.JsonValidationErrors(w, r, err)
+		return
+	}
+
+	// Merchant keys can only create keys for their own merchant.
+	merchantId := body.MerchantId
+	if merchant := middlewares.MerchantFromContext(r.Context()); merchant != nil {
+		if merchantId != nil && *merchantId != merchant.ID {
+			self.JsonProblem(w, r, &errors.ForbiddenError{Message: "merchant api keys cannot create keys for other merchants"})
+			return
+		}
+		merchantId = &merchant.ID
+	}
+
+	res, err := self.ApiKeyService.CreateApiKey(r.Context(), body.Name, body.Scopes, body.RequireSignature, merchantId)
+	if err != nil {
+		self.JsonProblem(w, r, err)
+		return
+	}
+	self.Json(w, res, http.StatusCreated)
+}
+
+func (self *ApiKeyController) ListApiKeys(w http.ResponseWriter, r *http.Request) {
+	res, err := self.ApiKeyService.ListApiKeys(r.Context(), contextMerchantId(r))
+	if err != nil {
+		self.JsonProblem(w, r, err)
+		return
+	}
+	self.Json(w, res, http.StatusOK)
+}
+
+func (self *ApiKeyController) RevokeApiKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		self.JsonProblem(w, r, &errors.ValidationError{Message: "Invalid api key id"})
+		return
+	}
+
+	res, err := self.ApiKeyService.RevokeApiKey(r.Context(), contextMerchantId(r), uint(id))
+	if err != nil {
+		self.JsonProblem(w, r, err)
+		return
+	}
+	if res == nil {
+		self.JsonProblem(w, r, &errors.NotFoundError{Message: "Api key not found"})
+		return
+	}
+	self.Json(w, res, http.StatusOK)
+}
+
+// contextMerchantId returns the merchant id of the calling API key, or nil
+// for platform keys.
+func contextMerchantId(r *http.Request) *uint {
+	if merchant := middlewares.MerchantFromContext(r.Context()); merchant != nil {
+		return &merchant.ID
+	}
+	return nil
+}
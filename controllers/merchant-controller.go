@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+	"payment-service/app"
+	"payment-service/domain/entities"
+	"payment-service/domain/services"
+	"payment-service/domain/types"
+	"payment-service/errors"
+	"payment-service/requests"
+	"strconv"
+)
+
+type MerchantController struct {
+	app.Controller
+	MerchantService *services.MerchantService
+	Validator       *validator.Validate
+}
+
+func NewMerchantController(merchantService *services.MerchantService, validate *validator.Validate) *MerchantController {
+	return &MerchantController{
+		MerchantService: merchantService,
+		Validator:       validate,
+	}
+}
+
+func (self *MerchantController) CreateMerchant(w http.ResponseWriter, r *http.Request) {
+	params, ok := self.merchantParams(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := self.MerchantService.CreateMerchant(r.Context(), params)
+	if err != nil {
+		self.JsonProblem(w, r, err)
+		return
+	}
+	self.Json(w, res, http.StatusCreated)
+}
+
+func (self *MerchantController) ListMerchants(w http.ResponseWriter, r *http.Request) {
+	res, err := self.MerchantService.ListMerchants(r.Context())
+	if err != nil {
+		self.JsonProblem(w, r, err)
+		return
+	}
+	self.Json(w, res, http.StatusOK)
+}
+
+func (self *MerchantController) GetMerchant(w http.ResponseWriter, r *http.Request) {
+	id, ok := self.merchantId(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := self.MerchantService.GetMerchant(r.Context(), id)
+	self.merchantResponse(w, r, res, err)
+}
+
+func (self *MerchantController) UpdateMerchant(w http.ResponseWriter, r *http.Request) {
+	id, ok := self.merchantId(w, r)
+	if !ok {
+		return
+	}
+	params, ok := self.merchantParams(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := self.MerchantService.UpdateMerchant(r.Context(), id, params)
+	self.merchantResponse(w, r, res, err)
+}
+
+func (self *MerchantController) DisableMerchant(w http.ResponseWriter, r *http.Request) {
+	id, ok := self.merchantId(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := self.MerchantService.SetMerchantDisabled(r.Context(), id, true)
+	self.merchantResponse(w, r, res, err)
+}
+
+func (self *MerchantController) EnableMerchant(w http.ResponseWriter, r *http.Request) {
+	id, ok := self.merchantId(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := self.MerchantService.SetMerchantDisabled(r.Context(), id, false)
+	self.merchantResponse(w, r, res, err)
+}
+
+func (self *MerchantController) merchantParams(w http.ResponseWriter, r *http.Request) (types.MerchantParams, bool) {
+	var body requests.MerchantRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		self.JsonValidationErrors(w, r, err)
+		return types.MerchantParams{}, false
+	}
+
+	err = self.Validator.Struct(body)
+	if err != nil {
+		self.JsonValidationErrors(w, r, err)
+		return types.MerchantParams{}, false
+	}
+
+	return types.MerchantParams{
+		Name:                        body.Name,
+		Credentials:                 body.Credentials,
+		AuthorizeFeePercent:         body.AuthorizeFeePercent,
+		AuthorizeFeeFixed:           body.AuthorizeFeeFixed,
+		AuthorizeSettlementCurrency: body.AuthorizeSettlementCurrency,
+	}, true
+}
+
+func (self *MerchantController) merchantId(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "merchantId"), 10, 64)
+	if err != nil {
+		self.JsonProblem(w, r, &errors.ValidationError{Message: "Invalid merchant id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (self *MerchantController) merchantResponse(w http.ResponseWriter, r *http.Request, res *entities.Merchant, err error) {
+	if err != nil {
+		self.JsonProblem(w, r, err)
+		return
+	}
+	if res == nil {
+		self.JsonProblem(w, r, &errors.NotFoundError{Message: "Merchant not found"})
+		return
+	}
+	self.Json(w, res, http.StatusOK)
+}
@@ -2,28 +2,41 @@ package controllers
 
 import (
 	"encoding/json"
-	"fmt"
+	"github.com/go-chi/chi"
 	"github.com/go-playground/validator/v10"
 	"github.com/stripe/stripe-go/webhook"
 	"io/ioutil"
 	"net/http"
 	"payment-service/app"
-	"payment-service/domain/providers"
+	"payment-service/app/logger"
+	"payment-service/app/redaction"
+	"payment-service/domain/cards"
+	"payment-service/domain/entities"
+	"payment-service/domain/metrics"
 	"payment-service/domain/services"
 	"payment-service/domain/types"
 	"payment-service/errors"
+	"payment-service/middlewares"
 	"payment-service/requests"
+	"strconv"
 )
 
 type PaymentController struct {
 	app.Controller
-	PaymentService *services.PaymentService
+	PaymentService    *services.PaymentService
+	OperationsService *services.OperationsService
+	StatusService     *services.StatusService
+	Validator         *validator.Validate
+	Logger            *logger.Logger
 }
 
-func NewPaymentController() *PaymentController {
-	paymentService := services.NewPaymentService()
+func NewPaymentController(paymentService *services.PaymentService, operationsService *services.OperationsService, statusService *services.StatusService, validate *validator.Validate, log *logger.Logger) *PaymentController {
 	return &PaymentController{
-		PaymentService: paymentService,
+		PaymentService:    paymentService,
+		OperationsService: operationsService,
+		StatusService:     statusService,
+		Validator:         validate,
+		Logger:            log,
 	}
 }
 
@@ -31,14 +44,13 @@ func (self *PaymentController) Deposit(w http.ResponseWriter, r *http.Request) {
 	var body requests.DepositRequest
 	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
-		self.JsonValidationErrors(w, err)
+		self.JsonValidationErrors(w, r, err)
 		return
 	}
 
-	validate := validator.New()
-	err = validate.Struct(body)
+	err = self.Validator.Struct(body)
 	if err != nil {
-		self.JsonValidationErrors(w, err)
+		self.JsonValidationErrors(w, r, err)
 		return
 	}
 
@@ -49,23 +61,13 @@ func (self *PaymentController) Deposit(w http.ResponseWriter, r *http.Request) {
 		TransactionId:    body.TransactionId,
 		UserId:           body.UserId,
 		Provider:         body.Provider,
-		CreditCardNumber: body.CreditCardNumber,
+		CreditCardNumber: cards.Normalize(body.CreditCardNumber),
 		ExpirationDate:   body.ExpirationDate,
 		CVV:              body.CVV,
 	}
-	if body.Provider == "stripe" {
-		self.PaymentService.SetPaymentProvider(providers.NewStripePaymentProvider())
-	} else if body.Provider == "authorize" {
-		self.PaymentService.SetPaymentProvider(providers.NewAuthorizeNetPaymentProvider())
-
-	} else {
-		self.JsonError(w, "Invalid provider", http.StatusBadRequest)
-		return
-	}
-	res, err := self.PaymentService.Deposit(params)
+	res, err := self.PaymentService.Deposit(r.Context(), middlewares.MerchantFromContext(r.Context()), params)
 	if err != nil {
-		statusCode := errors.MapErrorToStatusCode(err)
-		self.JsonError(w, err.Error(), statusCode)
+		self.JsonProblem(w, r, err)
 		return
 	}
 	self.Json(w, res, http.StatusOK)
@@ -75,14 +77,13 @@ func (self *PaymentController) Withdraw(w http.ResponseWriter, r *http.Request)
 	var body requests.WithdrawRequest
 	err := json.NewDecoder(r.Body).Decode(&body)
 	if err != nil {
-		self.JsonValidationErrors(w, err)
+		self.JsonValidationErrors(w, r, err)
 		return
 	}
 
-	validate := validator.New()
-	err = validate.Struct(body)
+	err = self.Validator.Struct(body)
 	if err != nil {
-		self.JsonValidationErrors(w, err)
+		self.JsonValidationErrors(w, r, err)
 		return
 	}
 
@@ -93,23 +94,63 @@ func (self *PaymentController) Withdraw(w http.ResponseWriter, r *http.Request)
 		TransactionId:    body.TransactionId,
 		UserId:           body.UserId,
 		Provider:         body.Provider,
-		CreditCardNumber: body.CreditCardNumber,
+		CreditCardNumber: cards.Normalize(body.CreditCardNumber),
 		ExpirationDate:   body.ExpirationDate,
 		CVV:              body.CVV,
 	}
 
-	if body.Provider == "stripe" {
-		self.PaymentService.SetPaymentProvider(providers.NewStripePaymentProvider())
-	} else if body.Provider == "authorize" {
-		self.PaymentService.SetPaymentProvider(providers.NewAuthorizeNetPaymentProvider())
-	} else {
-		self.JsonError(w, "Invalid provider", http.StatusBadRequest)
+	res, err := self.PaymentService.Withdraw(r.Context(), middlewares.MerchantFromContext(r.Context()), params)
+	if err != nil {
+		self.JsonProblem(w, r, err)
+		return
+	}
+	self.Json(w, res, http.StatusOK)
+}
+
+func (self *PaymentController) GetTransaction(w http.ResponseWriter, r *http.Request) {
+	transactionId := chi.URLParam(r, "transactionId")
+
+	res, err := self.PaymentService.GetTransaction(r.Context(), middlewares.MerchantFromContext(r.Context()), transactionId)
+	if err != nil {
+		self.JsonProblem(w, r, err)
+		return
+	}
+	if res == nil {
+		self.JsonProblem(w, r, &errors.NotFoundError{Message: "Transaction not found"})
+		return
+	}
+	self.Json(w, res, http.StatusOK)
+}
+
+func (self *PaymentController) Refund(w http.ResponseWriter, r *http.Request) {
+	var body requests.RefundRequest
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			self.JsonValidationErrors(w, r, err)
+			return
+		}
+	}
+
+	err := self.Validator.Struct(body)
+	if err != nil {
+		self.JsonValidationErrors(w, r, err)
+		return
+	}
+
+	transaction, err := self.PaymentService.GetTransaction(r.Context(), middlewares.MerchantFromContext(r.Context()), chi.URLParam(r, "transactionId"))
+	if err != nil {
+		self.JsonProblem(w, r, err)
+		return
+	}
+	if transaction == nil {
+		self.JsonProblem(w, r, &errors.NotFoundError{Message: "Transaction not found"})
 		return
 	}
-	res, err := self.PaymentService.Withdraw(params)
+
+	res, err := self.OperationsService.RefundTransaction(r.Context(), *transaction, body.Amount, body.DryRun)
 	if err != nil {
-		statusCode := errors.MapErrorToStatusCode(err)
-		self.JsonError(w, err.Error(), statusCode)
+		self.JsonProblem(w, r, err)
 		return
 	}
 	self.Json(w, res, http.StatusOK)
@@ -121,25 +162,48 @@ func (self *PaymentController) StripeWebhook(w http.ResponseWriter, r *http.Requ
 	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
 	payload, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		fmt.Fprintf(w, "Error reading request body: %v", err)
+		self.JsonProblem(w, r, &errors.ValidationError{Message: "Error reading request body: " + err.Error()})
+		return
+	}
+
+	merchant, config, ok := self.webhookMerchant(w, r)
+	if !ok {
+		return
+	}
+	if merchant != nil {
+		r = r.WithContext(logger.ContextWith(r.Context(), logger.FieldMerchantId, merchant.ID))
+	}
+
+	// Without an endpoint secret anyone could sign events with an empty
+	// HMAC key, so the webhook is refused rather than verified.
+	if config.Credentials.StripeEndpointSecret == "" {
+		self.Logger.FromContext(r.Context()).Error("Stripe webhook received but no endpoint secret is configured")
+		metrics.WebhookReceived("stripe", "unknown")
+		metrics.WebhookHandled("stripe", "unknown", metrics.WebhookRejected)
+		self.JsonProblem(w, r, &errors.ValidationError{Message: "Stripe webhooks are not configured"})
 		return
 	}
 
 	// Verify webhook signature
-	event, err := webhook.ConstructEvent(payload, r.Header.Get("Stripe-Signature"), app.App().Config().GetString("payment.stripe_endpoint_secret"))
+	event, err := webhook.ConstructEvent(payload, r.Header.Get("Stripe-Signature"), config.Credentials.StripeEndpointSecret)
 	if err != nil {
-		app.App().Logger().Error("Error verifying webhook signature: ", err.Error())
-		w.WriteHeader(http.StatusBadRequest)
+		self.Logger.FromContext(r.Context()).Error("Error verifying webhook signature: ", err.Error())
+		metrics.WebhookReceived("stripe", "unknown")
+		metrics.WebhookHandled("stripe", "unknown", metrics.WebhookRejected)
+		self.JsonProblem(w, r, &errors.UnauthorizedError{Message: "Invalid signature"})
 		return
 	}
+	metrics.WebhookReceived("stripe", event.Type)
 
-	err = self.PaymentService.HandleStripeEvents(event)
+	err = self.PaymentService.HandleStripeEvents(r.Context(), merchant, event)
 	if err != nil {
-		app.App().Logger().Error("Error handling stripe event: ", err.Error())
-		w.WriteHeader(http.StatusBadRequest)
+		self.Logger.FromContext(r.Context()).Error("Error handling stripe event: ", err.Error())
+		metrics.WebhookHandled("stripe", event.Type, metrics.WebhookFailed)
+		self.JsonProblem(w, r, err)
 		return
 	}
+	metrics.WebhookHandled("stripe", event.Type, metrics.WebhookProcessed)
+	self.StatusService.RecordWebhook(r.Context(), "stripe", event.Type)
 
 	self.Json(w, nil, http.StatusOK)
 }
@@ -147,30 +211,76 @@ func (self *PaymentController) StripeWebhook(w http.ResponseWriter, r *http.Requ
 func (self *PaymentController) AuthorizeWebhook(w http.ResponseWriter, r *http.Request) {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		self.JsonProblem(w, r, &errors.ValidationError{Message: "Failed to read request body"})
 		return
 	}
 	defer r.Body.Close()
 
-	if !self.PaymentService.VerifyAuthorizeSignature(r, body) {
-		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+	merchant, _, ok := self.webhookMerchant(w, r)
+	if !ok {
 		return
 	}
+	if merchant != nil {
+		r = r.WithContext(logger.ContextWith(r.Context(), logger.FieldMerchantId, merchant.ID))
+	}
 
-	app.App().Logger().Info("Received Webhook: ", string(body))
+	if !self.PaymentService.VerifyAuthorizeSignature(merchant, r, body) {
+		metrics.WebhookReceived("authorize", "unknown")
+		metrics.WebhookHandled("authorize", "unknown", metrics.WebhookRejected)
+		self.JsonProblem(w, r, &errors.UnauthorizedError{Message: "Invalid signature"})
+		return
+	}
+
+	self.Logger.FromContext(r.Context()).Info("Received Webhook: ", redaction.Redact(string(body)))
 
 	var event requests.WebhookEvent
 	err = json.Unmarshal(body, &event)
 	if err != nil {
-		http.Error(w, "Failed to parse JSON", http.StatusBadRequest)
+		metrics.WebhookReceived("authorize", "unknown")
+		metrics.WebhookHandled("authorize", "unknown", metrics.WebhookRejected)
+		self.JsonProblem(w, r, &errors.ValidationError{Message: "Failed to parse JSON"})
 		return
 	}
+	metrics.WebhookReceived("authorize", event.EventType)
 
-	self.PaymentService.HandleAuthorizeEvents(event)
-
-	// Respond to the webhook request
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+	// Failures are logged by the service; the webhook is acknowledged either way.
+	if err := self.PaymentService.HandleAuthorizeEvents(r.Context(), merchant, event); err != nil {
+		metrics.WebhookHandled("authorize", event.EventType, metrics.WebhookFailed)
+	} else {
+		metrics.WebhookHandled("authorize", event.EventType, metrics.WebhookProcessed)
+		self.StatusService.RecordWebhook(r.Context(), "authorize", event.EventType)
+	}
 
 	self.Json(w, nil, http.StatusOK)
 }
+
+// webhookMerchant resolves the merchant of a webhook route from its
+// {merchantId} parameter, or the platform (nil) on the routes without one.
+// It writes the error response and returns false for unknown or disabled
+// merchants.
+func (self *PaymentController) webhookMerchant(w http.ResponseWriter, r *http.Request) (*entities.Merchant, types.ProviderConfig, bool) {
+	var merchant *entities.Merchant
+	if param := chi.URLParam(r, "merchantId"); param != "" {
+		id, err := strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			self.JsonProblem(w, r, &errors.NotFoundError{Message: "Invalid merchant id"})
+			return nil, types.ProviderConfig{}, false
+		}
+		merchant, err = self.PaymentService.MerchantService.GetMerchant(r.Context(), uint(id))
+		if err != nil {
+			self.JsonProblem(w, r, err)
+			return nil, types.ProviderConfig{}, false
+		}
+		if merchant == nil || merchant.DisabledAt != nil {
+			self.JsonProblem(w, r, &errors.NotFoundError{Message: "Merchant not found"})
+			return nil, types.ProviderConfig{}, false
+		}
+	}
+
+	config, err := self.PaymentService.MerchantService.ProviderConfig(merchant)
+	if err != nil {
+		self.JsonProblem(w, r, err)
+		return nil, types.ProviderConfig{}, false
+	}
+	return merchant, config, true
+}
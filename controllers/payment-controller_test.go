@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/spf13/viper"
+	"github.com/stripe/stripe-go/webhook"
+
+	"payment-service/app/clock"
+	"payment-service/app/logger"
+	"payment-service/domain/entities"
+	"payment-service/domain/repositories"
+	"payment-service/domain/services"
+)
+
+var testLogger = logger.NewLogger(&logger.Debug{Enabled: true, Level: "error", Format: logger.LogFormatConsole})
+
+// newWebhookController returns a PaymentController for the platform
+// credentials in config, on an in-memory repository holding one pending
+// deposit with payment id pi_forged.
+func newWebhookController(t *testing.T, config *viper.Viper) (*PaymentController, *repositories.MemoryTransactionRepository) {
+	t.Helper()
+	now := clock.NewFake(time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC))
+	transactions := repositories.NewMemoryTransactionRepository(now)
+	if _, err := transactions.SaveTransaction(context.Background(), entities.Transaction{
+		TransactionID:   "forged",
+		TransactionType: "deposit",
+		Status:          "pending",
+		GatewayName:     "stripe",
+		PaymentId:       "pi_forged",
+		Amount:          1000,
+		Currency:        "usd",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	merchantService := services.NewMerchantService(nil, config, nil, testLogger, now)
+	circuitBreakerService := services.NewCircuitBreakerService(config, testLogger)
+	approvalRateService := services.NewApprovalRateService(config)
+	routingService := services.NewRoutingService(merchantService, circuitBreakerService, approvalRateService, nil, config, testLogger, now)
+	paymentService := services.NewPaymentService(transactions, merchantService, services.NewAlertService(config, testLogger), routingService, circuitBreakerService, approvalRateService, testLogger)
+	return NewPaymentController(paymentService, nil, nil, nil, testLogger), transactions
+}
+
+func TestStripeWebhookRejectsEventsWithoutEndpointSecret(t *testing.T) {
+	payload := []byte(`{"id":"evt_forged","object":"event","type":"payment_intent.succeeded",` +
+		`"data":{"object":{"id":"pi_forged","object":"payment_intent","amount":1000,"currency":"usd","status":"succeeded"}}}`)
+	signedAt := time.Now()
+	// Signed with an empty key, as anyone can when no secret is configured.
+	forgedSignature := fmt.Sprintf("t=%d,v1=%x", signedAt.Unix(), webhook.ComputeSignature(signedAt, payload, ""))
+
+	tests := []struct {
+		name           string
+		endpointSecret string
+		wantStatus     int
+	}{
+		{"no endpoint secret", "", http.StatusBadRequest},
+		{"signature with another secret", "whsec_configured", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("payment.stripe_endpoint_secret", test.endpointSecret)
+			controller, transactions := newWebhookController(t, config)
+
+			request := httptest.NewRequest(http.MethodPost, "/webhook/stripe", bytes.NewReader(payload))
+			request.Header.Set("Stripe-Signature", forgedSignature)
+			recorder := httptest.NewRecorder()
+			router := chi.NewRouter()
+			router.Post("/webhook/stripe", controller.StripeWebhook)
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.wantStatus {
+				t.Errorf("status %d, want %d: %s", recorder.Code, test.wantStatus, recorder.Body.String())
+			}
+			stored, _ := transactions.GetTransactionByTransactionId(context.Background(), nil, "forged")
+			if stored == nil || stored.Status != "pending" {
+				t.Errorf("forged event changed the transaction to %+v", stored)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+	"payment-service/app"
+	"payment-service/domain/entities"
+	"payment-service/domain/services"
+	"payment-service/domain/types"
+	"payment-service/errors"
+	"payment-service/requests"
+	"strconv"
+)
+
+type RoutingRuleController struct {
+	app.Controller
+	RoutingRuleService *services.RoutingRuleService
+	Validator          *validator.Validate
+}
+
+func NewRoutingRuleController(routingRuleService *services.RoutingRuleService, validate *validator.Validate) *RoutingRuleController {
+	return &RoutingRuleController{
+		RoutingRuleService: routingRuleService,
+		Validator:          validate,
+	}
+}
+
+func (self *RoutingRuleController) ListRoutingRules(w http.ResponseWriter, r *http.Request) {
+	res, err := self.RoutingRuleService.ListRoutingRules(r.Context())
+	if err != nil {
+		self.JsonProblem(w, r, err)
+		return
+	}
+	self.Json(w, res, http.StatusOK)
+}
+
+func (self *RoutingRuleController) CreateRoutingRule(w http.ResponseWriter, r *http.Request) {
+	params, ok := self.routingRuleParams(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := self.RoutingRuleService.CreateRoutingRule(r.Context(), params)
+	if err != nil {
+		self.JsonProblem(w, r, err)
+		return
+	}
+	self.Json(w, res, http.StatusCreated)
+}
+
+func (self *RoutingRuleController) GetRoutingRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := self.routingRuleId(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := self.RoutingRuleService.GetRoutingRule(r.Context(), id)
+	self.routingRuleResponse(w, r, res, err)
+}
+
+func (self *RoutingRuleController) ReplaceRoutingRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := self.routingRuleId(w, r)
+	if !ok {
+		return
+	}
+	params, ok := self.routingRuleParams(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := self.RoutingRuleService.ReplaceRoutingRule(r.Context(), id, params)
+	self.routingRuleResponse(w, r, res, err)
+}
+
+func (self *RoutingRuleController) DeleteRoutingRule(w http.ResponseWriter, r *http.Request) {
+	id, ok := self.routingRuleId(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := self.RoutingRuleService.DeleteRoutingRule(r.Context(), id)
+	if err != nil {
+		self.JsonProblem(w, r, err)
+		return
+	}
+	if !deleted {
+		self.JsonProblem(w, r, &errors.NotFoundError{Message: "Routing rule not found"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (self *RoutingRuleController) routingRuleParams(w http.ResponseWriter, r *http.Request) (types.RoutingRuleParams, bool) {
+	var body requests.RoutingRuleRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		self.JsonValidationErrors(w, r, err)
+		return types.RoutingRuleParams{}, false
+	}
+
+	err = self.Validator.Struct(body)
+	if err != nil {
+		self.JsonValidationErrors(w, r, err)
+		return types.RoutingRuleParams{}, false
+	}
+
+	params := types.RoutingRuleParams{
+		Name:            body.Name,
+		Priority:        100,
+		Enabled:         true,
+		MerchantId:      body.MerchantId,
+		Operation:       body.Operation,
+		Currencies:      body.Currencies,
+		MinAmount:       body.MinAmount,
+		MaxAmount:       body.MaxAmount,
+		PaymentMethods:  body.PaymentMethods,
+		CardBrands:      body.CardBrands,
+		BinCountries:    body.BinCountries,
+		TimeFrom:        body.TimeFrom,
+		TimeUntil:       body.TimeUntil,
+		TimeZone:        body.TimeZone,
+		MinApprovalRate: body.MinApprovalRate,
+		Strategy:        body.Strategy,
+		Targets:         body.Targets,
+	}
+	if body.Priority != nil {
+		params.Priority = *body.Priority
+	}
+	if body.Enabled != nil {
+		params.Enabled = *body.Enabled
+	}
+	return params, true
+}
+
+func (self *RoutingRuleController) routingRuleId(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(chi.URLParam(r, "ruleId"), 10, 64)
+	if err != nil {
+		self.JsonProblem(w, r, &errors.ValidationError{Message: "Invalid routing rule id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (self *RoutingRuleController) routingRuleResponse(w http.ResponseWriter, r *http.Request, res *entities.RoutingRule, err error) {
+	if err != nil {
+		self.JsonProblem(w, r, err)
+		return
+	}
+	if res == nil {
+		self.JsonProblem(w, r, &errors.NotFoundError{Message: "Routing rule not found"})
+		return
+	}
+	self.Json(w, res, http.StatusOK)
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"net/http"
+	"payment-service/app"
+	"payment-service/app/circuitbreaker"
+	"payment-service/domain/services"
+	"payment-service/domain/types"
+)
+
+type StatusController struct {
+	app.Controller
+	StatusService *services.StatusService
+	Application   *app.Application
+}
+
+func NewStatusController(statusService *services.StatusService, application *app.Application) *StatusController {
+	return &StatusController{
+		StatusService: statusService,
+		Application:   application,
+	}
+}
+
+// Healthz is the liveness probe: the process is up and serving HTTP.
+func (self *StatusController) Healthz(w http.ResponseWriter, r *http.Request) {
+	self.Json(w, map[string]string{"status": app.HealthOk}, http.StatusOK)
+}
+
+// Readyz is the readiness probe. It answers 503 while a dependency check
+// fails or the server is draining.
+func (self *StatusController) Readyz(w http.ResponseWriter, r *http.Request) {
+	report := self.Application.Readiness(r.Context())
+	statusCode := http.StatusOK
+	if !report.Ready() {
+		statusCode = http.StatusServiceUnavailable
+	}
+	self.Json(w, report, statusCode)
+}
+
+// Status reports readiness together with provider reachability, circuit
+// breaker state and the last successful webhook per provider. Its status is
+// "degraded" when any check or configured provider fails, or a breaker is
+// not closed.
+func (self *StatusController) Status(w http.ResponseWriter, r *http.Request) {
+	report := self.Application.Readiness(r.Context())
+	providerStatuses, err := self.StatusService.ProviderStatuses(r.Context())
+	if err != nil {
+		self.JsonProblem(w, r, err)
+		return
+	}
+
+	status := "ok"
+	if !report.Ready() {
+		status = "degraded"
+	}
+	for _, providerStatus := range providerStatuses {
+		if providerStatus.Status != types.ProviderStatusOk && providerStatus.Status != types.ProviderStatusNotConfigured {
+			status = "degraded"
+		}
+		if providerStatus.CircuitBreaker != string(circuitbreaker.StateClosed) {
+			status = "degraded"
+		}
+	}
+
+	self.Json(w, map[string]interface{}{
+		"status":    status,
+		"readiness": report,
+		"providers": providerStatuses,
+	}, http.StatusOK)
+}
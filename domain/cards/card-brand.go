@@ -0,0 +1,164 @@
+// Package cards holds card number rules shared by request validation and
+// the providers: Luhn checks, brand detection from BIN ranges and expiry
+// parsing.
+package cards
+
+import (
+	"strconv"
+	"strings"
+)
+
+type Brand string
+
+const (
+	BrandUnknown    Brand = ""
+	BrandVisa       Brand = "visa"
+	BrandMastercard Brand = "mastercard"
+	BrandAmex       Brand = "amex"
+	BrandDiscover   Brand = "discover"
+	BrandDiners     Brand = "diners"
+	BrandJcb        Brand = "jcb"
+	BrandUnionPay   Brand = "unionpay"
+	BrandMaestro    Brand = "maestro"
+)
+
+// binRange matches card numbers whose leading digits, read as a number of
+// the same width as Low, fall between Low and High inclusive.
+type binRange struct {
+	Brand   Brand
+	Low     string
+	High    string
+	Lengths []int
+}
+
+// binRanges is checked in order, so narrower co-branded ranges come before
+// the wider range they sit in.
+var binRanges = []binRange{
+	{Brand: BrandAmex, Low: "34", High: "34", Lengths: []int{15}},
+	{Brand: BrandAmex, Low: "37", High: "37", Lengths: []int{15}},
+	{Brand: BrandDiners, Low: "300", High: "305", Lengths: []int{14, 15, 16, 17, 18, 19}},
+	{Brand: BrandDiners, Low: "36", High: "36", Lengths: []int{14, 15, 16, 17, 18, 19}},
+	{Brand: BrandDiners, Low: "38", High: "39", Lengths: []int{14, 15, 16, 17, 18, 19}},
+	{Brand: BrandJcb, Low: "3528", High: "3589", Lengths: []int{16, 17, 18, 19}},
+	{Brand: BrandVisa, Low: "4", High: "4", Lengths: []int{13, 16, 19}},
+	{Brand: BrandMastercard, Low: "51", High: "55", Lengths: []int{16}},
+	{Brand: BrandMastercard, Low: "2221", High: "2720", Lengths: []int{16}},
+	{Brand: BrandDiscover, Low: "6011", High: "6011", Lengths: []int{16, 17, 18, 19}},
+	{Brand: BrandDiscover, Low: "622126", High: "622925", Lengths: []int{16, 17, 18, 19}},
+	{Brand: BrandDiscover, Low: "644", High: "649", Lengths: []int{16, 17, 18, 19}},
+	{Brand: BrandDiscover, Low: "65", High: "65", Lengths: []int{16, 17, 18, 19}},
+	{Brand: BrandUnionPay, Low: "62", High: "62", Lengths: []int{16, 17, 18, 19}},
+	{Brand: BrandMaestro, Low: "6304", High: "6304", Lengths: []int{12, 13, 14, 15, 16, 17, 18, 19}},
+	{Brand: BrandMaestro, Low: "6759", High: "6759", Lengths: []int{12, 13, 14, 15, 16, 17, 18, 19}},
+	{Brand: BrandMaestro, Low: "50", High: "50", Lengths: []int{12, 13, 14, 15, 16, 17, 18, 19}},
+	{Brand: BrandMaestro, Low: "56", High: "58", Lengths: []int{12, 13, 14, 15, 16, 17, 18, 19}},
+}
+
+// DetectBrand returns the brand of a card number from its BIN, or
+// BrandUnknown when no range matches.
+func DetectBrand(number string) Brand {
+	number = Normalize(number)
+	for _, bin := range binRanges {
+		if bin.matches(number) {
+			return bin.Brand
+		}
+	}
+	return BrandUnknown
+}
+
+// IsValidNumber reports whether number is a Luhn-valid card number of a
+// length allowed for its brand. Numbers of unknown brands must be 12 to 19
+// digits long.
+func IsValidNumber(number string) bool {
+	number = Normalize(number)
+	if !isDigits(number) || !IsLuhnValid(number) {
+		return false
+	}
+
+	for _, bin := range binRanges {
+		if bin.matches(number) {
+			return containsInt(bin.Lengths, len(number))
+		}
+	}
+	return len(number) >= 12 && len(number) <= 19
+}
+
+// IsLuhnValid reports whether digits passes the Luhn checksum.
+func IsLuhnValid(digits string) bool {
+	if digits == "" || !isDigits(digits) {
+		return false
+	}
+
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		digit := int(digits[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// CvvLengths returns the security code lengths accepted for brand.
+func CvvLengths(brand Brand) []int {
+	switch brand {
+	case BrandAmex:
+		return []int{4}
+	case BrandUnknown:
+		return []int{3, 4}
+	default:
+		return []int{3}
+	}
+}
+
+// IsValidCvv reports whether cvv is all digits and of a length accepted for
+// brand.
+func IsValidCvv(cvv string, brand Brand) bool {
+	return isDigits(cvv) && containsInt(CvvLengths(brand), len(cvv))
+}
+
+// Normalize strips the spaces and dashes customers type between digit
+// groups.
+func Normalize(number string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(number)
+}
+
+func (self binRange) matches(number string) bool {
+	if len(number) < len(self.Low) {
+		return false
+	}
+	prefix, err := strconv.Atoi(number[:len(self.Low)])
+	if err != nil {
+		return false
+	}
+	low, _ := strconv.Atoi(self.Low)
+	high, _ := strconv.Atoi(self.High)
+	return prefix >= low && prefix <= high
+}
+
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, char := range value {
+		if char < '0' || char > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func containsInt(values []int, value int) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package cards
+
+import "testing"
+
+func TestDetectBrand(t *testing.T) {
+	tests := []struct {
+		number string
+		want   Brand
+	}{
+		{"4111111111111111", BrandVisa},
+		{"4111 1111 1111 1111", BrandVisa},
+		{"5105105105105100", BrandMastercard},
+		{"5599999999999999", BrandMastercard},
+		{"5600000000000000", BrandMaestro},
+		{"2221000000000000", BrandMastercard},
+		{"2720999999999996", BrandMastercard},
+		{"2220999999999999", BrandUnknown},
+		{"2721000000000004", BrandUnknown},
+		{"340000000000009", BrandAmex},
+		{"378282246310005", BrandAmex},
+		{"30569309025904", BrandDiners},
+		{"3060000000000000", BrandUnknown},
+		{"3528000000000000", BrandJcb},
+		{"3589999999999999", BrandJcb},
+		{"3590000000000000", BrandUnknown},
+		{"6011111111111117", BrandDiscover},
+		{"6221260000000000", BrandDiscover},
+		{"6221250000000000", BrandUnionPay},
+		{"6229260000000000", BrandUnionPay},
+		{"6500000000000000", BrandDiscover},
+		{"6200000000000005", BrandUnionPay},
+		{"6759649826438453", BrandMaestro},
+		{"1234567890123456", BrandUnknown},
+		{"", BrandUnknown},
+	}
+	for _, test := range tests {
+		if got := DetectBrand(test.number); got != test.want {
+			t.Errorf("DetectBrand(%q) = %q, want %q", test.number, got, test.want)
+		}
+	}
+}
+
+func TestIsLuhnValid(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   bool
+	}{
+		{"4111111111111111", true},
+		{"4111111111111112", false},
+		{"378282246310005", true},
+		{"0", true},
+		{"18", true},
+		{"10", false},
+		{"", false},
+		{"4111-1111", false},
+	}
+	for _, test := range tests {
+		if got := IsLuhnValid(test.digits); got != test.want {
+			t.Errorf("IsLuhnValid(%q) = %t, want %t", test.digits, got, test.want)
+		}
+	}
+}
+
+func TestIsValidNumber(t *testing.T) {
+	tests := []struct {
+		number string
+		want   bool
+	}{
+		{"4111111111111111", true},
+		{"4111-1111-1111-1111", true},
+		{"4222222222222", true},
+		{"4111111111111111110", true},
+		{"41111111111111113", false},
+		{"4111111111111112", false},
+		{"378282246310005", true},
+		{"3782822463100003", false},
+		{"5555555555554444", true},
+		{"5555555555554444117", false},
+		{"2721000000000004", true},
+		{"500000000000005", true},
+		{"9999999999999995", true},
+		{"4111 1111 1111 111a", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := IsValidNumber(test.number); got != test.want {
+			t.Errorf("IsValidNumber(%q) = %t, want %t", test.number, got, test.want)
+		}
+	}
+}
+
+func TestIsValidCvv(t *testing.T) {
+	tests := []struct {
+		cvv   string
+		brand Brand
+		want  bool
+	}{
+		{"123", BrandVisa, true},
+		{"1234", BrandVisa, false},
+		{"1234", BrandAmex, true},
+		{"123", BrandAmex, false},
+		{"123", BrandUnknown, true},
+		{"1234", BrandUnknown, true},
+		{"12", BrandUnknown, false},
+		{"12a", BrandVisa, false},
+		{"", BrandVisa, false},
+	}
+	for _, test := range tests {
+		if got := IsValidCvv(test.cvv, test.brand); got != test.want {
+			t.Errorf("IsValidCvv(%q, %q) = %t, want %t", test.cvv, test.brand, got, test.want)
+		}
+	}
+}
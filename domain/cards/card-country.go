@@ -0,0 +1,55 @@
+package cards
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// BinCountries maps BIN prefixes to the ISO 3166-1 alpha-2 country of the
+// issuing bank. Card networks do not publish this mapping, so it is loaded
+// from a file exported from a BIN database.
+type BinCountries map[string]string
+
+// LoadBinCountries reads a CSV file of prefix,country rows, such as
+// "411111,US". Rows starting with # are comments.
+func LoadBinCountries(path string) (BinCountries, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	countries := BinCountries{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return countries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		prefix := Normalize(strings.TrimSpace(record[0]))
+		if !isDigits(prefix) {
+			return nil, fmt.Errorf("%s: invalid BIN prefix %q", path, record[0])
+		}
+		countries[prefix] = strings.ToUpper(strings.TrimSpace(record[1]))
+	}
+}
+
+// Country returns the issuing country of the longest prefix of number in
+// the table, or an empty string.
+func (self BinCountries) Country(number string) string {
+	number = Normalize(number)
+	for length := len(number); length > 0; length-- {
+		if country, ok := self[number[:length]]; ok {
+			return country
+		}
+	}
+	return ""
+}
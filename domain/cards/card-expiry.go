@@ -0,0 +1,35 @@
+package cards
+
+import (
+	"strconv"
+	"time"
+)
+
+// ParseExpiry reads an expiration date in MMYY or YYYY-MM format, the two
+// formats Authorize.Net accepts.
+func ParseExpiry(value string) (month int, year int, ok bool) {
+	switch {
+	case len(value) == 4 && isDigits(value):
+		month, _ = strconv.Atoi(value[:2])
+		year, _ = strconv.Atoi(value[2:])
+		year += 2000
+	case len(value) == 7 && value[4] == '-' && isDigits(value[:4]) && isDigits(value[5:]):
+		year, _ = strconv.Atoi(value[:4])
+		month, _ = strconv.Atoi(value[5:])
+	default:
+		return 0, 0, false
+	}
+
+	if month < 1 || month > 12 {
+		return 0, 0, false
+	}
+	return month, year, true
+}
+
+// IsExpired reports whether a card expiring in month/year is no longer
+// valid at now. Cards stay valid through the last day of their expiry
+// month.
+func IsExpired(month int, year int, now time.Time) bool {
+	validUntil := time.Date(year, time.Month(month)+1, 1, 0, 0, 0, 0, time.UTC)
+	return !now.UTC().Before(validUntil)
+}
@@ -0,0 +1,59 @@
+package cards
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseExpiry(t *testing.T) {
+	tests := []struct {
+		value string
+		month int
+		year  int
+		ok    bool
+	}{
+		{"1225", 12, 2025, true},
+		{"0130", 1, 2030, true},
+		{"2030-12", 12, 2030, true},
+		{"2026-01", 1, 2026, true},
+		{"0025", 0, 0, false},
+		{"1325", 0, 0, false},
+		{"2030-00", 0, 0, false},
+		{"2030-13", 0, 0, false},
+		{"12/25", 0, 0, false},
+		{"2030-1", 0, 0, false},
+		{"203012", 0, 0, false},
+		{"12a5", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, test := range tests {
+		month, year, ok := ParseExpiry(test.value)
+		if month != test.month || year != test.year || ok != test.ok {
+			t.Errorf("ParseExpiry(%q) = %d, %d, %t, want %d, %d, %t", test.value, month, year, ok, test.month, test.year, test.ok)
+		}
+	}
+}
+
+func TestIsExpired(t *testing.T) {
+	plusTwo := time.FixedZone("UTC+2", 2*60*60)
+	tests := []struct {
+		name  string
+		month int
+		year  int
+		now   time.Time
+		want  bool
+	}{
+		{"last second of the expiry month", 12, 2025, time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC), false},
+		{"first second after the expiry month", 12, 2025, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"first day of the expiry month", 1, 2026, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), false},
+		{"end of a short month", 2, 2028, time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC), false},
+		{"month before the expiry month", 1, 2026, time.Date(2025, 12, 31, 0, 0, 0, 0, time.UTC), false},
+		{"a year later", 6, 2025, time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), true},
+		{"local time already in the next month", 12, 2025, time.Date(2026, 1, 1, 1, 0, 0, 0, plusTwo), false},
+	}
+	for _, test := range tests {
+		if got := IsExpired(test.month, test.year, test.now); got != test.want {
+			t.Errorf("%s: IsExpired(%d, %d, %s) = %t, want %t", test.name, test.month, test.year, test.now, got, test.want)
+		}
+	}
+}
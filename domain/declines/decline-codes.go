@@ -0,0 +1,208 @@
+// Package declines maps the decline and error codes of each provider onto
+// one set of codes, so clients can handle a decline the same way whichever
+// provider processed the payment.
+package declines
+
+import (
+	"payment-service/domain/entities"
+	"payment-service/errors"
+)
+
+type Code string
+
+const (
+	CodeInsufficientFunds      Code = "insufficient_funds"
+	CodeCardDeclined           Code = "card_declined"
+	CodeDoNotHonor             Code = "do_not_honor"
+	CodeExpiredCard            Code = "expired_card"
+	CodeIncorrectExpiry        Code = "incorrect_expiry"
+	CodeIncorrectCvc           Code = "incorrect_cvc"
+	CodeIncorrectNumber        Code = "incorrect_number"
+	CodeIncorrectAddress       Code = "incorrect_address"
+	CodeFraudSuspected         Code = "fraud_suspected"
+	CodeLostOrStolenCard       Code = "lost_or_stolen_card"
+	CodeLimitExceeded          Code = "limit_exceeded"
+	CodeCardNotSupported       Code = "card_not_supported"
+	CodeCurrencyNotSupported   Code = "currency_not_supported"
+	CodeAuthenticationRequired Code = "authentication_required"
+	CodeDuplicateTransaction   Code = "duplicate_transaction"
+	CodeInvalidAmount          Code = "invalid_amount"
+	CodeInvalidAccount         Code = "invalid_account"
+	CodeProcessingError        Code = "processing_error"
+)
+
+// Decline is a normalized decline. Retryable is true when the same payment
+// may succeed if it is sent again later; otherwise the customer has to use
+// another card or fix its details. ProviderCode is the provider's own code.
+type Decline struct {
+	Code         Code   `json:"code"`
+	Retryable    bool   `json:"retryable"`
+	ProviderCode string `json:"providerCode"`
+}
+
+// retryable lists the codes of declines caused by a temporary failure at
+// the provider, the network or the issuer.
+var retryable = map[Code]bool{
+	CodeProcessingError: true,
+}
+
+func decline(code Code, providerCode string) Decline {
+	return Decline{Code: code, Retryable: retryable[code], ProviderCode: providerCode}
+}
+
+// stripeCodes maps Stripe decline codes, and the error codes Stripe sends
+// for card errors without a decline code.
+var stripeCodes = map[string]Code{
+	"insufficient_funds":                CodeInsufficientFunds,
+	"generic_decline":                   CodeCardDeclined,
+	"card_declined":                     CodeCardDeclined,
+	"call_issuer":                       CodeCardDeclined,
+	"restricted_card":                   CodeCardDeclined,
+	"no_action_taken":                   CodeCardDeclined,
+	"revocation_of_all_authorizations":  CodeCardDeclined,
+	"revocation_of_authorization":       CodeCardDeclined,
+	"stop_payment_order":                CodeCardDeclined,
+	"new_account_information_available": CodeCardDeclined,
+	"testmode_decline":                  CodeCardDeclined,
+	"do_not_honor":                      CodeDoNotHonor,
+	"do_not_try_again":                  CodeDoNotHonor,
+	"expired_card":                      CodeExpiredCard,
+	"invalid_expiry_month":              CodeIncorrectExpiry,
+	"invalid_expiry_year":               CodeIncorrectExpiry,
+	"incorrect_cvc":                     CodeIncorrectCvc,
+	"invalid_cvc":                       CodeIncorrectCvc,
+	"incorrect_number":                  CodeIncorrectNumber,
+	"invalid_number":                    CodeIncorrectNumber,
+	"incorrect_zip":                     CodeIncorrectAddress,
+	"fraudulent":                        CodeFraudSuspected,
+	"merchant_blacklist":                CodeFraudSuspected,
+	"security_violation":                CodeFraudSuspected,
+	"lost_card":                         CodeLostOrStolenCard,
+	"stolen_card":                       CodeLostOrStolenCard,
+	"pickup_card":                       CodeLostOrStolenCard,
+	"card_velocity_exceeded":            CodeLimitExceeded,
+	"withdrawal_count_limit_exceeded":   CodeLimitExceeded,
+	"pin_try_exceeded":                  CodeLimitExceeded,
+	"card_not_supported":                CodeCardNotSupported,
+	"not_permitted":                     CodeCardNotSupported,
+	"service_not_allowed":               CodeCardNotSupported,
+	"transaction_not_allowed":           CodeCardNotSupported,
+	"currency_not_supported":            CodeCurrencyNotSupported,
+	"authentication_required":           CodeAuthenticationRequired,
+	"approve_with_id":                   CodeAuthenticationRequired,
+	"duplicate_transaction":             CodeDuplicateTransaction,
+	"invalid_amount":                    CodeInvalidAmount,
+	"invalid_account":                   CodeInvalidAccount,
+	"processing_error":                  CodeProcessingError,
+	"issuer_not_available":              CodeProcessingError,
+	"reenter_transaction":               CodeProcessingError,
+	"try_again_later":                   CodeProcessingError,
+}
+
+// FromStripe normalizes a Stripe card error by its decline code, falling
+// back to its error code. Unknown codes are generic card declines.
+func FromStripe(declineCode string, errorCode string) Decline {
+	for _, providerCode := range []string{declineCode, errorCode} {
+		if code, ok := stripeCodes[providerCode]; ok {
+			return decline(code, providerCode)
+		}
+	}
+	if declineCode != "" {
+		return decline(CodeCardDeclined, declineCode)
+	}
+	return decline(CodeCardDeclined, errorCode)
+}
+
+// stripePayoutCodes maps the failure codes of Stripe payouts.
+var stripePayoutCodes = map[string]Code{
+	"insufficient_funds":       CodeInsufficientFunds,
+	"account_closed":           CodeInvalidAccount,
+	"account_frozen":           CodeInvalidAccount,
+	"bank_account_restricted":  CodeInvalidAccount,
+	"invalid_account_number":   CodeInvalidAccount,
+	"no_account":               CodeInvalidAccount,
+	"debit_not_authorized":     CodeDoNotHonor,
+	"declined":                 CodeCardDeclined,
+	"expired_card":             CodeExpiredCard,
+	"lost_or_stolen_card":      CodeLostOrStolenCard,
+	"invalid_currency":         CodeCurrencyNotSupported,
+	"unsupported_card":         CodeCardNotSupported,
+	"could_not_process":        CodeProcessingError,
+	"incorrect_account_holder": CodeInvalidAccount,
+}
+
+// FromStripePayout normalizes the failure code of a Stripe payout.
+func FromStripePayout(failureCode string) Decline {
+	if code, ok := stripePayoutCodes[failureCode]; ok {
+		return decline(code, failureCode)
+	}
+	return decline(CodeCardDeclined, failureCode)
+}
+
+// authorizeCodes maps Authorize.Net response reason codes, as sent in the
+// errorCode of a declined transactionResponse.
+var authorizeCodes = map[string]Code{
+	"2":   CodeCardDeclined,
+	"3":   CodeCardDeclined,
+	"4":   CodeLostOrStolenCard,
+	"5":   CodeInvalidAmount,
+	"6":   CodeIncorrectNumber,
+	"7":   CodeIncorrectExpiry,
+	"8":   CodeExpiredCard,
+	"11":  CodeDuplicateTransaction,
+	"17":  CodeCardNotSupported,
+	"19":  CodeProcessingError,
+	"20":  CodeProcessingError,
+	"21":  CodeProcessingError,
+	"22":  CodeProcessingError,
+	"23":  CodeProcessingError,
+	"25":  CodeProcessingError,
+	"26":  CodeProcessingError,
+	"27":  CodeIncorrectAddress,
+	"28":  CodeCardNotSupported,
+	"37":  CodeIncorrectNumber,
+	"39":  CodeCurrencyNotSupported,
+	"44":  CodeIncorrectCvc,
+	"45":  CodeIncorrectCvc,
+	"57":  CodeProcessingError,
+	"58":  CodeProcessingError,
+	"59":  CodeProcessingError,
+	"60":  CodeProcessingError,
+	"61":  CodeProcessingError,
+	"62":  CodeProcessingError,
+	"63":  CodeProcessingError,
+	"65":  CodeIncorrectCvc,
+	"120": CodeProcessingError,
+	"121": CodeProcessingError,
+	"122": CodeProcessingError,
+	"250": CodeFraudSuspected,
+	"251": CodeFraudSuspected,
+	"252": CodeFraudSuspected,
+	"253": CodeFraudSuspected,
+	"254": CodeFraudSuspected,
+}
+
+// FromAuthorize normalizes an Authorize.Net response reason code. Unknown
+// codes are generic card declines.
+func FromAuthorize(reasonCode string) Decline {
+	if code, ok := authorizeCodes[reasonCode]; ok {
+		return decline(code, reasonCode)
+	}
+	return decline(CodeCardDeclined, reasonCode)
+}
+
+// Apply records the decline on transaction.
+func (self Decline) Apply(transaction *entities.Transaction) {
+	transaction.DeclineCode = string(self.Code)
+	transaction.DeclineRetryable = self.Retryable
+	transaction.ProviderDeclineCode = self.ProviderCode
+}
+
+// Error returns the decline as the error of a provider call.
+func (self Decline) Error(message string) *errors.ProviderDeclinedError {
+	return &errors.ProviderDeclinedError{
+		Message:     message,
+		DeclineCode: string(self.Code),
+		Retryable:   self.Retryable,
+	}
+}
@@ -0,0 +1,108 @@
+package declines
+
+import (
+	"testing"
+
+	"payment-service/domain/entities"
+)
+
+func TestFromStripe(t *testing.T) {
+	tests := []struct {
+		name        string
+		declineCode string
+		errorCode   string
+		want        Decline
+	}{
+		{"decline code", "insufficient_funds", "card_declined", Decline{CodeInsufficientFunds, false, "insufficient_funds"}},
+		{"generic decline", "generic_decline", "card_declined", Decline{CodeCardDeclined, false, "generic_decline"}},
+		{"lost card", "lost_card", "card_declined", Decline{CodeLostOrStolenCard, false, "lost_card"}},
+		{"fraud", "fraudulent", "card_declined", Decline{CodeFraudSuspected, false, "fraudulent"}},
+		{"do not try again", "do_not_try_again", "card_declined", Decline{CodeDoNotHonor, false, "do_not_try_again"}},
+		{"issuer unavailable", "issuer_not_available", "card_declined", Decline{CodeProcessingError, true, "issuer_not_available"}},
+		{"try again later", "try_again_later", "card_declined", Decline{CodeProcessingError, true, "try_again_later"}},
+		{"error code without a decline code", "", "expired_card", Decline{CodeExpiredCard, false, "expired_card"}},
+		{"incorrect cvc error code", "", "incorrect_cvc", Decline{CodeIncorrectCvc, false, "incorrect_cvc"}},
+		{"processing error code", "", "processing_error", Decline{CodeProcessingError, true, "processing_error"}},
+		{"unknown decline code falls back to the error code", "new_stripe_code", "incorrect_number", Decline{CodeIncorrectNumber, false, "incorrect_number"}},
+		{"unknown decline code", "new_stripe_code", "card_declined_v2", Decline{CodeCardDeclined, false, "new_stripe_code"}},
+		{"unknown error code", "", "new_error_code", Decline{CodeCardDeclined, false, "new_error_code"}},
+		{"no codes", "", "", Decline{CodeCardDeclined, false, ""}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := FromStripe(test.declineCode, test.errorCode); got != test.want {
+				t.Errorf("FromStripe(%q, %q) = %+v, want %+v", test.declineCode, test.errorCode, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFromStripePayout(t *testing.T) {
+	tests := []struct {
+		failureCode string
+		want        Decline
+	}{
+		{"account_closed", Decline{CodeInvalidAccount, false, "account_closed"}},
+		{"insufficient_funds", Decline{CodeInsufficientFunds, false, "insufficient_funds"}},
+		{"could_not_process", Decline{CodeProcessingError, true, "could_not_process"}},
+		{"new_failure_code", Decline{CodeCardDeclined, false, "new_failure_code"}},
+	}
+	for _, test := range tests {
+		if got := FromStripePayout(test.failureCode); got != test.want {
+			t.Errorf("FromStripePayout(%q) = %+v, want %+v", test.failureCode, got, test.want)
+		}
+	}
+}
+
+func TestFromAuthorize(t *testing.T) {
+	tests := []struct {
+		name       string
+		reasonCode string
+		want       Decline
+	}{
+		{"declined", "2", Decline{CodeCardDeclined, false, "2"}},
+		{"pick up card", "4", Decline{CodeLostOrStolenCard, false, "4"}},
+		{"invalid card number", "6", Decline{CodeIncorrectNumber, false, "6"}},
+		{"expired card", "8", Decline{CodeExpiredCard, false, "8"}},
+		{"duplicate transaction", "11", Decline{CodeDuplicateTransaction, false, "11"}},
+		{"processor error", "19", Decline{CodeProcessingError, true, "19"}},
+		{"processor timeout", "120", Decline{CodeProcessingError, true, "120"}},
+		{"address mismatch", "27", Decline{CodeIncorrectAddress, false, "27"}},
+		{"cvv mismatch", "44", Decline{CodeIncorrectCvc, false, "44"}},
+		{"fraud filter", "252", Decline{CodeFraudSuspected, false, "252"}},
+		{"unknown code", "9999", Decline{CodeCardDeclined, false, "9999"}},
+		{"no code", "", Decline{CodeCardDeclined, false, ""}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := FromAuthorize(test.reasonCode); got != test.want {
+				t.Errorf("FromAuthorize(%q) = %+v, want %+v", test.reasonCode, got, test.want)
+			}
+		})
+	}
+}
+
+func TestOnlyProcessingErrorsAreRetryable(t *testing.T) {
+	tables := map[string]map[string]Code{"stripe": stripeCodes, "stripe payout": stripePayoutCodes, "authorize": authorizeCodes}
+	for table, codes := range tables {
+		for providerCode, code := range codes {
+			if got := decline(code, providerCode).Retryable; got != (code == CodeProcessingError) {
+				t.Errorf("%s code %s maps to %s with retryable %t", table, providerCode, code, got)
+			}
+		}
+	}
+}
+
+func TestDeclineAppliesToTransactionsAndErrors(t *testing.T) {
+	decline := FromAuthorize("19")
+	var transaction entities.Transaction
+	decline.Apply(&transaction)
+	if transaction.DeclineCode != "processing_error" || !transaction.DeclineRetryable || transaction.ProviderDeclineCode != "19" {
+		t.Errorf("applied decline %q retryable %t provider code %q", transaction.DeclineCode, transaction.DeclineRetryable, transaction.ProviderDeclineCode)
+	}
+
+	err := decline.Error("An error occurred during processing")
+	if err.DeclineCode != "processing_error" || !err.Retryable || err.Message != "An error occurred during processing" {
+		t.Errorf("decline error %+v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package entities
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	ScopeDeposit  = "deposit"
+	ScopeWithdraw = "withdraw"
+	ScopeRefund   = "refund"
+	ScopeRead     = "read"
+	ScopeAdmin    = "admin"
+)
+
+var ApiKeyScopes = []string{ScopeDeposit, ScopeWithdraw, ScopeRefund, ScopeRead, ScopeAdmin}
+
+// ApiKey authenticates API clients. Only the SHA-256 hash of the key is
+// stored; Prefix is the public part of the key used to look it up. Keys
+// with a MerchantID act for that merchant only; platform keys have none
+// and use the global provider configuration. The signing secret is
+// encrypted with the row's data key, like merchant credentials.
+type ApiKey struct {
+	ID               uint       `gorm:"primaryKey;autoIncrement"`
+	Name             string     `gorm:"type:varchar(255);not null"`
+	MerchantID       *uint      `gorm:"index"`
+	Prefix           string     `gorm:"type:varchar(16);not null;uniqueIndex"`
+	KeyHash          string     `gorm:"type:varchar(64);not null" json:"-"`
+	Scopes           string     `gorm:"type:varchar(255);not null"`
+	SigningSecret    *string    `gorm:"type:text" json:"-"`
+	EncryptedDataKey *string    `gorm:"type:text" json:"-"`
+	EncryptionKeyId  string     `gorm:"type:varchar(64)" json:"-"`
+	RequireSignature bool       `gorm:"not null;default:false"`
+	LastUsedAt       *time.Time `gorm:"type:timestamptz"`
+	RevokedAt        *time.Time `gorm:"type:timestamptz"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt        time.Time  `gorm:"autoUpdateTime"`
+}
+
+// HasScope reports whether the key grants scope. The admin scope grants
+// every scope.
+func (self ApiKey) HasScope(scope string) bool {
+	for _, granted := range strings.Split(self.Scopes, ",") {
+		granted = strings.TrimSpace(granted)
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// ApiRequestNonce records a signed request nonce so it cannot be replayed.
+type ApiRequestNonce struct {
+	ApiKeyID  uint      `gorm:"primaryKey"`
+	Nonce     string    `gorm:"primaryKey;type:varchar(64)"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,21 @@
+package entities
+
+import "time"
+
+// Merchant is a tenant with its own provider accounts. Credentials holds the
+// JSON encoded types.MerchantCredentials, encrypted with the row's data key
+// like transaction payloads. Unset fee settings fall back to the global
+// configuration.
+type Merchant struct {
+	ID                          uint       `gorm:"primaryKey;autoIncrement"`
+	Name                        string     `gorm:"type:varchar(255);not null;uniqueIndex"`
+	Credentials                 *string    `gorm:"type:text" json:"-"`
+	EncryptedDataKey            *string    `gorm:"type:text" json:"-"`
+	EncryptionKeyId             string     `gorm:"type:varchar(64)" json:"-"`
+	AuthorizeFeePercent         *float64   `gorm:"type:decimal(7,4)"`
+	AuthorizeFeeFixed           *float64   `gorm:"type:decimal(15,2)"`
+	AuthorizeSettlementCurrency string     `gorm:"type:varchar(3)"`
+	DisabledAt                  *time.Time `gorm:"type:timestamptz"`
+	CreatedAt                   time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt                   time.Time  `gorm:"autoUpdateTime"`
+}
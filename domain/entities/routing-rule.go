@@ -0,0 +1,79 @@
+package entities
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Routing strategies, choosing among the targets of a matching rule.
+const (
+	// RoutingStrategyWeighted splits traffic at random in proportion to the
+	// target weights, for A/B tests between providers.
+	RoutingStrategyWeighted = "weighted"
+	// RoutingStrategyApprovalRate picks the target with the highest observed
+	// approval rate.
+	RoutingStrategyApprovalRate = "approval_rate"
+)
+
+// RoutingRule picks the provider for deposits and withdrawals that do not
+// name one. Rules are tried by ascending Priority; the first rule whose
+// conditions all hold and that has an available target decides. Empty
+// conditions always hold. List fields are comma separated, and Targets is
+// a list of provider:weight pairs such as "stripe:80,authorize:20".
+// MinAmount and MaxAmount are in major units of the request currency,
+// whatever unit the request amount was sent in. Rules without a MerchantID
+// apply to every merchant.
+type RoutingRule struct {
+	ID              uint      `gorm:"primaryKey;autoIncrement"`
+	Name            string    `gorm:"type:varchar(255);not null"`
+	Priority        int       `gorm:"not null"`
+	Enabled         bool      `gorm:"not null"`
+	MerchantID      *uint     `gorm:"index"`
+	Operation       string    `gorm:"type:varchar(10)"`
+	Currencies      string    `gorm:"type:varchar(255)"`
+	MinAmount       *float64  `gorm:"type:decimal(15,2)"`
+	MaxAmount       *float64  `gorm:"type:decimal(15,2)"`
+	PaymentMethods  string    `gorm:"type:varchar(255)"`
+	CardBrands      string    `gorm:"type:varchar(255)"`
+	BinCountries    string    `gorm:"type:varchar(255)"`
+	TimeFrom        string    `gorm:"type:varchar(5)"`
+	TimeUntil       string    `gorm:"type:varchar(5)"`
+	TimeZone        string    `gorm:"type:varchar(64)"`
+	MinApprovalRate *float64  `gorm:"type:decimal(5,4)"`
+	Strategy        string    `gorm:"type:varchar(20);not null"`
+	Targets         string    `gorm:"type:varchar(255);not null"`
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+	UpdatedAt       time.Time `gorm:"autoUpdateTime"`
+}
+
+// RoutingTarget is a provider a rule routes to, with its share of traffic.
+type RoutingTarget struct {
+	Provider string `json:"provider"`
+	Weight   int    `json:"weight"`
+}
+
+// TargetList parses Targets. A target without a weight gets weight 1.
+func (self RoutingRule) TargetList() []RoutingTarget {
+	var targets []RoutingTarget
+	for _, value := range SplitList(self.Targets) {
+		target := RoutingTarget{Provider: value, Weight: 1}
+		if provider, weight, ok := strings.Cut(value, ":"); ok {
+			target.Provider = strings.TrimSpace(provider)
+			target.Weight, _ = strconv.Atoi(strings.TrimSpace(weight))
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// SplitList splits a comma separated list, dropping empty entries.
+func SplitList(value string) []string {
+	var values []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			values = append(values, entry)
+		}
+	}
+	return values
+}
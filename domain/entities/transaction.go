@@ -3,18 +3,31 @@ package entities
 import "time"
 
 type Transaction struct {
-	ID              uint      `gorm:"primaryKey;autoIncrement"`
-	TransactionType string    `gorm:"type:varchar(10);not null;check:transaction_type IN ('deposit', 'withdrawal')"`
-	Amount          float64   `gorm:"type:decimal(15,2);not null"`
-	Currency        string    `gorm:"type:varchar(3);not null"`
-	Status          string    `gorm:"type:varchar(20);not null"`
-	TransactionID   string    `gorm:"type:varchar(255) unique"`
-	ChargeId        string    `gorm:"type:varchar(255)"`
-	PaymentId       string    `gorm:"type:varchar(255)"`
-	GatewayName     string    `gorm:"type:varchar(255)"`
-	RequestPayload  *string   `gorm:"type:text"`
-	ResponsePayload *string   `gorm:"type:text"`
-	CallbackPayload *string   `gorm:"type:text"`
-	CreatedAt       time.Time `gorm:"autoCreateTime"`
-	UpdatedAt       time.Time `gorm:"autoUpdateTime"`
+	ID                  uint      `gorm:"primaryKey;autoIncrement"`
+	TransactionType     string    `gorm:"type:varchar(10);not null;check:transaction_type IN ('deposit', 'withdrawal')"`
+	Amount              float64   `gorm:"type:decimal(15,2);not null"`
+	Currency            string    `gorm:"type:varchar(3);not null"`
+	Status              string    `gorm:"type:varchar(20);not null"`
+	TransactionID       string    `gorm:"type:varchar(255)"`
+	ChargeId            string    `gorm:"type:varchar(255)"`
+	PaymentId           string    `gorm:"type:varchar(255)"`
+	GatewayName         string    `gorm:"type:varchar(255)"`
+	MerchantID          *uint     `gorm:"index"`
+	FeeAmount           *float64  `gorm:"type:decimal(15,2)"`
+	NetAmount           *float64  `gorm:"type:decimal(15,2)"`
+	RefundedAmount      float64   `gorm:"type:decimal(15,2);not null;default:0"`
+	SettlementCurrency  string    `gorm:"type:varchar(3)"`
+	RequestPayload      *string   `gorm:"type:text"`
+	ResponsePayload     *string   `gorm:"type:text"`
+	CallbackPayload     *string   `gorm:"type:text"`
+	EncryptedDataKey    *string   `gorm:"type:text" json:"-"`
+	EncryptionKeyId     string    `gorm:"type:varchar(64)" json:"-"`
+	TraceParent         string    `gorm:"type:varchar(55)" json:"-"`
+	ProviderAttempts    int       `gorm:"not null;default:0"`
+	RoutingDecision     *string   `gorm:"type:text"`
+	DeclineCode         string    `gorm:"type:varchar(40)"`
+	DeclineRetryable    bool      `gorm:"not null;default:false"`
+	ProviderDeclineCode string    `gorm:"type:varchar(64)"`
+	CreatedAt           time.Time `gorm:"autoCreateTime"`
+	UpdatedAt           time.Time `gorm:"autoUpdateTime"`
 }
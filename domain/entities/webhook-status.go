@@ -0,0 +1,11 @@
+package entities
+
+import "time"
+
+// WebhookStatus records the last webhook of a provider that was processed
+// successfully, shared by all replicas.
+type WebhookStatus struct {
+	Provider        string    `gorm:"type:varchar(32);primaryKey" json:"provider"`
+	LastEventType   string    `gorm:"type:varchar(255);not null" json:"lastEventType"`
+	LastSucceededAt time.Time `gorm:"not null" json:"lastSucceededAt"`
+}
@@ -0,0 +1,214 @@
+// Package metrics defines the payment domain metrics served on /metrics.
+package metrics
+
+import (
+	"context"
+	stderrors "errors"
+	"net"
+	"strings"
+	"time"
+
+	"payment-service/app/metrics"
+	"payment-service/domain/entities"
+	"payment-service/errors"
+)
+
+var transactions = metrics.NewCounterVec("payment_transactions_total",
+	"Deposits and withdrawals that reached a final status, by type, provider, currency and status.",
+	"type", "provider", "currency", "status")
+
+var providerRequestDuration = metrics.NewHistogramVec("payment_provider_request_duration_seconds",
+	"Latency of provider Charge and Withdraw calls by provider, operation and error class.",
+	metrics.DefaultBuckets, "provider", "operation", "error_class")
+
+var providerRetries = metrics.NewCounterVec("payment_provider_retries_total",
+	"Provider HTTP requests retried, by provider and the error class of the failed attempt.",
+	"provider", "error_class")
+
+var providerCircuitState = metrics.NewGaugeVec("payment_provider_circuit_state",
+	"Circuit breaker state per provider: 0 closed, 1 half-open, 2 open.",
+	"provider")
+
+var providerCircuitTransitions = metrics.NewCounterVec("payment_provider_circuit_transitions_total",
+	"Circuit breaker state changes, by provider and the state entered.",
+	"provider", "state")
+
+var providerFailovers = metrics.NewCounterVec("payment_provider_failovers_total",
+	"Requests without a pinned provider routed past a provider whose circuit breaker was open, by operation, skipped and chosen provider.",
+	"operation", "from", "to")
+
+var providerApprovalRate = metrics.NewGaugeVec("payment_provider_approval_rate",
+	"Share of recent charges and payouts each provider approved, as used by routing rules.",
+	"provider")
+
+var routingDecisions = metrics.NewCounterVec("payment_routing_decisions_total",
+	"Provider choices for deposits and withdrawals, by operation, routing mode, rule and provider.",
+	"operation", "mode", "rule", "provider")
+
+var webhookEventsReceived = metrics.NewCounterVec("payment_webhook_events_received_total",
+	"Provider webhook events received, by provider and event type.",
+	"provider", "type")
+
+var webhookEventsProcessed = metrics.NewCounterVec("payment_webhook_events_processed_total",
+	"Provider webhook events by provider, event type and outcome.",
+	"provider", "type", "outcome")
+
+var jobRuns = metrics.NewCounterVec("payment_job_runs_total",
+	"Runs of reconciliation and background sweeps, by job and outcome.",
+	"job", "outcome")
+
+var jobDuration = metrics.NewHistogramVec("payment_job_duration_seconds",
+	"Duration of reconciliation and background sweep runs.",
+	[]float64{.01, .05, .1, .5, 1, 5, 10, 30, 60, 300}, "job")
+
+var jobItems = metrics.NewCounterVec("payment_job_items_total",
+	"Items handled by reconciliation and background sweeps, by job and result.",
+	"job", "result")
+
+var jobLastSuccess = metrics.NewGaugeVec("payment_job_last_success_timestamp_seconds",
+	"Unix time of the last successful run of each job.",
+	"job")
+
+// Webhook outcomes.
+const (
+	WebhookProcessed = "processed"
+	WebhookFailed    = "failed"
+	WebhookRejected  = "rejected"
+)
+
+// Provider error classes.
+const (
+	ErrorClassNone     = "none"
+	ErrorClassDeclined = "declined"
+	ErrorClassRejected = "rejected"
+	ErrorClassInternal = "internal"
+	ErrorClassTimeout  = "timeout"
+	ErrorClassNetwork  = "network"
+	ErrorClassUnknown  = "unknown"
+)
+
+var finalStatuses = map[string]bool{
+	"succeeded":          true,
+	"failed":             true,
+	"refunded":           true,
+	"partially_refunded": true,
+	"mismatch":           true,
+}
+
+// RecordTransaction counts a saved transaction once it is in a final
+// status. Pending transactions are counted when their webhook arrives.
+func RecordTransaction(transaction entities.Transaction) {
+	if !finalStatuses[transaction.Status] {
+		return
+	}
+	transactions.WithLabelValues(
+		transaction.TransactionType,
+		transaction.GatewayName,
+		strings.ToLower(transaction.Currency),
+		transaction.Status,
+	).Inc()
+}
+
+// ObserveProviderCall records the latency of a provider call started at
+// start, classified by the error it returned and the resulting transaction.
+func ObserveProviderCall(provider string, operation string, start time.Time, transaction entities.Transaction, err error) {
+	providerRequestDuration.WithLabelValues(provider, operation, ErrorClass(transaction, err)).
+		Observe(time.Since(start).Seconds())
+}
+
+// ErrorClass groups a provider call result into a small set of classes: a
+// failed transaction without an error, or a ProviderDeclinedError, is a decline,
+// validation errors are requests the provider rejected, and transport
+// errors are split into timeouts and other network errors.
+func ErrorClass(transaction entities.Transaction, err error) string {
+	if err == nil {
+		if transaction.Status == "failed" {
+			return ErrorClassDeclined
+		}
+		return ErrorClassNone
+	}
+
+	var netErr net.Error
+	switch {
+	case stderrors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	case stderrors.As(err, &netErr):
+		if netErr.Timeout() {
+			return ErrorClassTimeout
+		}
+		return ErrorClassNetwork
+	}
+
+	switch err.(type) {
+	case *errors.ProviderDeclinedError:
+		return ErrorClassDeclined
+	case *errors.ValidationError:
+		return ErrorClassRejected
+	case *errors.InternalServerError:
+		return ErrorClassInternal
+	case *errors.TimeoutError:
+		return ErrorClassTimeout
+	}
+	return ErrorClassUnknown
+}
+
+// ProviderRetry counts a retried provider request. errorClass is the
+// httpclient class of the failed attempt.
+func ProviderRetry(provider string, errorClass string) {
+	providerRetries.WithLabelValues(provider, errorClass).Inc()
+}
+
+// circuitStateValues are the payment_provider_circuit_state gauge values.
+var circuitStateValues = map[string]float64{
+	"closed":    0,
+	"half_open": 1,
+	"open":      2,
+}
+
+// CircuitState sets the breaker state gauge of provider. changed counts a
+// transition into state.
+func CircuitState(provider string, state string, changed bool) {
+	providerCircuitState.WithLabelValues(provider).Set(circuitStateValues[state])
+	if changed {
+		providerCircuitTransitions.WithLabelValues(provider, state).Inc()
+	}
+}
+
+// ProviderFailover counts a request routed to provider to instead of from.
+// to is "none" when no provider was left.
+func ProviderFailover(operation string, from string, to string) {
+	providerFailovers.WithLabelValues(operation, from, to).Inc()
+}
+
+func ApprovalRate(provider string, rate float64) {
+	providerApprovalRate.WithLabelValues(provider).Set(rate)
+}
+
+// RoutingDecision counts a provider choice. rule is the rule name, or empty
+// when no rule decided.
+func RoutingDecision(operation string, mode string, rule string, provider string) {
+	routingDecisions.WithLabelValues(operation, mode, rule, provider).Inc()
+}
+
+func WebhookReceived(provider string, eventType string) {
+	webhookEventsReceived.WithLabelValues(provider, eventType).Inc()
+}
+
+func WebhookHandled(provider string, eventType string, outcome string) {
+	webhookEventsProcessed.WithLabelValues(provider, eventType, outcome).Inc()
+}
+
+// JobRun records a run of job started at start. items maps a result such as
+// "checked" or "failed" to the number of items with that result.
+func JobRun(job string, start time.Time, items map[string]int64, err error) {
+	jobDuration.WithLabelValues(job).Observe(time.Since(start).Seconds())
+	for result, count := range items {
+		jobItems.WithLabelValues(job, result).Add(float64(count))
+	}
+	if err != nil {
+		jobRuns.WithLabelValues(job, "failed").Inc()
+		return
+	}
+	jobRuns.WithLabelValues(job, "succeeded").Inc()
+	jobLastSuccess.WithLabelValues(job).Set(float64(time.Now().Unix()))
+}
@@ -0,0 +1,35 @@
+// Package money converts amounts between a currency's major units, such as
+// dollars, and the minor units some providers count in, such as cents.
+package money
+
+import (
+	"math"
+	"strings"
+)
+
+// zeroDecimalCurrencies have no minor unit: Stripe counts them in major
+// units.
+var zeroDecimalCurrencies = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "JPY": true, "KMF": true,
+	"KRW": true, "MGA": true, "PYG": true, "RWF": true, "UGX": true, "VND": true,
+	"VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+// MinorUnitDigits returns the number of decimals of currency, an ISO 4217
+// code in any case.
+func MinorUnitDigits(currency string) int {
+	if zeroDecimalCurrencies[strings.ToUpper(currency)] {
+		return 0
+	}
+	return 2
+}
+
+// ToMajor converts an amount in minor units of currency to major units.
+func ToMajor(amount float64, currency string) float64 {
+	return amount / math.Pow10(MinorUnitDigits(currency))
+}
+
+// ToMinor converts an amount in major units of currency to minor units.
+func ToMinor(amount float64, currency string) float64 {
+	return math.Round(amount * math.Pow10(MinorUnitDigits(currency)))
+}
@@ -0,0 +1,24 @@
+package money
+
+import "testing"
+
+func TestCurrencyUnits(t *testing.T) {
+	tests := []struct {
+		currency string
+		minor    float64
+		major    float64
+	}{
+		{"usd", 1059, 10.59},
+		{"EUR", 5, 0.05},
+		{"jpy", 500, 500},
+		{"KRW", 1000, 1000},
+	}
+	for _, test := range tests {
+		if major := ToMajor(test.minor, test.currency); major != test.major {
+			t.Errorf("ToMajor(%v, %s) = %v, want %v", test.minor, test.currency, major, test.major)
+		}
+		if minor := ToMinor(test.major, test.currency); minor != test.minor {
+			t.Errorf("ToMinor(%v, %s) = %v, want %v", test.major, test.currency, minor, test.minor)
+		}
+	}
+}
@@ -2,17 +2,32 @@ package providers
 
 import (
 	"bytes"
+	"context"
 	"encoding/xml"
 	"io/ioutil"
+	"math"
 	"net/http"
-	"payment-service/app"
+	"payment-service/app/httpclient"
+	"payment-service/app/logger"
+	"payment-service/app/redaction"
+	"payment-service/domain/declines"
 	"payment-service/domain/entities"
 	"payment-service/domain/types"
 	"payment-service/errors"
+	"strings"
+	"time"
 )
 
+// AuthorizeNetPaymentProvider talks to the Authorize.Net XML API. Every call
+// runs with the caller's context, bounded by timeout. The API has no
+// idempotency keys, so createTransactionRequest is only retried when it
+// never reached Authorize.Net; read-only requests are retried like GETs.
 type AuthorizeNetPaymentProvider struct {
 	endpoint string
+	config   types.ProviderConfig
+	client   *http.Client
+	timeout  time.Duration
+	logger   *logger.Logger
 }
 
 type CreateTransactionRequest struct {
@@ -41,6 +56,7 @@ type TransactionRequestType struct {
 	TransactionType string      `xml:"transactionType"`
 	Amount          float64     `xml:"amount"`
 	Payment         PaymentType `xml:"payment"`
+	RefTransId      string      `xml:"refTransId,omitempty"`
 }
 
 type CreateTransactionResponse struct {
@@ -60,215 +76,384 @@ type Message struct {
 }
 
 type TransactionResponse struct {
-	ResponseCode   string    `xml:"responseCode"`
-	AuthCode       string    `xml:"authCode"`
-	AVSResultCode  string    `xml:"avsResultCode"`
-	CVVResultCode  string    `xml:"cvvResultCode"`
-	CAVVResultCode string    `xml:"cavvResultCode"`
-	TransId        string    `xml:"transId"`
-	AccountNumber  string    `xml:"accountNumber"`
-	AccountType    string    `xml:"accountType"`
-	Messages       []Message `xml:"messages>message"`
-	NetworkTransId string    `xml:"networkTransId"`
+	ResponseCode   string             `xml:"responseCode"`
+	AuthCode       string             `xml:"authCode"`
+	AVSResultCode  string             `xml:"avsResultCode"`
+	CVVResultCode  string             `xml:"cvvResultCode"`
+	CAVVResultCode string             `xml:"cavvResultCode"`
+	TransId        string             `xml:"transId"`
+	AccountNumber  string             `xml:"accountNumber"`
+	AccountType    string             `xml:"accountType"`
+	Messages       []Message          `xml:"messages>message"`
+	Errors         []TransactionError `xml:"errors>error"`
+	NetworkTransId string             `xml:"networkTransId"`
 }
 
-func NewAuthorizeNetPaymentProvider() *AuthorizeNetPaymentProvider {
+// TransactionError is a reason a transaction was declined or failed.
+// ErrorCode is the response reason code.
+type TransactionError struct {
+	ErrorCode string `xml:"errorCode"`
+	ErrorText string `xml:"errorText"`
+}
+
+type GetTransactionDetailsRequest struct {
+	XMLName                xml.Name                   `xml:"getTransactionDetailsRequest"`
+	Xmlns                  string                     `xml:"xmlns,attr"`
+	MerchantAuthentication MerchantAuthenticationType `xml:"merchantAuthentication"`
+	TransId                string                     `xml:"transId"`
+}
+
+type GetTransactionDetailsResponse struct {
+	XMLName     xml.Name           `xml:"getTransactionDetailsResponse"`
+	Messages    Messages           `xml:"messages"`
+	Transaction *TransactionDetail `xml:"transaction"`
+}
+
+type AuthenticateTestRequest struct {
+	XMLName                xml.Name                   `xml:"authenticateTestRequest"`
+	Xmlns                  string                     `xml:"xmlns,attr"`
+	MerchantAuthentication MerchantAuthenticationType `xml:"merchantAuthentication"`
+}
+
+type AuthenticateTestResponse struct {
+	XMLName  xml.Name `xml:"authenticateTestResponse"`
+	Messages Messages `xml:"messages"`
+}
+
+type TransactionDetail struct {
+	TransId           string      `xml:"transId"`
+	TransactionType   string      `xml:"transactionType"`
+	TransactionStatus string      `xml:"transactionStatus"`
+	ResponseCode      string      `xml:"responseCode"`
+	AuthAmount        float64     `xml:"authAmount"`
+	SettleAmount      float64     `xml:"settleAmount"`
+	Payment           PaymentType `xml:"payment"`
+}
+
+// authorizeTransactionStatuses maps Authorize.Net transactionStatus values to
+// transaction statuses. Unlisted values leave the status unchanged.
+var authorizeTransactionStatuses = map[string]string{
+	"authorizedPendingCapture":  "pending",
+	"capturedPendingSettlement": "succeeded",
+	"settledSuccessfully":       "succeeded",
+	"refundPendingSettlement":   "succeeded",
+	"refundSettledSuccessfully": "succeeded",
+	"declined":                  "failed",
+	"expired":                   "failed",
+	"voided":                    "failed",
+	"failedReview":              "failed",
+	"settlementError":           "failed",
+	"generalError":              "failed",
+}
+
+// AuthorizeSandboxUrl is the Authorize.Net API used when no
+// payment.authorize_base_url is configured.
+const AuthorizeSandboxUrl = "https://apitest.authorize.net"
+
+func NewAuthorizeNetPaymentProvider(config types.ProviderConfig, log *logger.Logger) *AuthorizeNetPaymentProvider {
+	baseUrl := config.AuthorizeBaseUrl
+	if baseUrl == "" {
+		baseUrl = AuthorizeSandboxUrl
+	}
 	return &AuthorizeNetPaymentProvider{
-		endpoint: "https://apitest.authorize.net/xml/v1/request.api",
+		endpoint: strings.TrimSuffix(baseUrl, "/") + "/xml/v1/request.api",
+		config:   config,
+		client:   newHttpClient("authorize", config.AuthorizeRetry, log),
+		timeout:  config.AuthorizeTimeout,
+		logger:   log,
 	}
 }
 
-func (self *AuthorizeNetPaymentProvider) Charge(params types.DepositParams, transaction entities.Transaction) (entities.Transaction, error) {
-	request := CreateTransactionRequest{
-		Xmlns: "AnetApi/xml/v1/schema/AnetApiSchema.xsd",
-		MerchantAuthentication: MerchantAuthenticationType{
-			Name:           app.App().Config().GetString("payment.authorize_login_id"),
-			TransactionKey: app.App().Config().GetString("payment.authorize_transaction_key"),
+func (self *AuthorizeNetPaymentProvider) Charge(ctx context.Context, params types.DepositParams, transaction entities.Transaction) (entities.Transaction, error) {
+	return self.createTransaction(ctx, TransactionRequestType{
+		TransactionType: "authCaptureTransaction",
+		Amount:          params.Amount,
+		Payment: PaymentType{
+			CreditCard: CreditCardType{
+				CardNumber:     params.CreditCardNumber,
+				ExpirationDate: params.ExpirationDate,
+				CardCode:       params.CVV,
+			},
 		},
-		TransactionRequest: TransactionRequestType{
-			TransactionType: "authCaptureTransaction",
-			Amount:          params.Amount,
-			Payment: PaymentType{
-				CreditCard: CreditCardType{
-					CardNumber:     params.CreditCardNumber,
-					ExpirationDate: params.ExpirationDate,
-					CardCode:       params.CVV,
-				},
+	}, transaction)
+}
+
+func (self *AuthorizeNetPaymentProvider) Withdraw(ctx context.Context, params types.WithdrawParams, transaction entities.Transaction) (entities.Transaction, error) {
+	return self.createTransaction(ctx, TransactionRequestType{
+		TransactionType: "refundTransaction",
+		Amount:          float64(params.Amount),
+		Payment: PaymentType{
+			CreditCard: CreditCardType{
+				CardNumber:     params.CreditCardNumber,
+				ExpirationDate: params.ExpirationDate,
+				CardCode:       params.CVV,
 			},
 		},
-	}
+	}, transaction)
+}
 
-	maskedRequest := request
-	maskedRequest.TransactionRequest.Payment.CreditCard.CardNumber = "****"
-	maskedRequest.TransactionRequest.Payment.CreditCard.CardCode = "****"
-	maskedRequest.TransactionRequest.Payment.CreditCard.ExpirationDate = "****"
-	maskedRequestXml, _ := xml.MarshalIndent(maskedRequest, "", "    ")
-	maskedRequestStr := string(maskedRequestXml)
-	transaction.RequestPayload = &maskedRequestStr
+// createTransaction sends a createTransactionRequest for a charge or a
+// payout and records the masked request, the response and the payment id on
+// transaction.
+func (self *AuthorizeNetPaymentProvider) createTransaction(ctx context.Context, transactionRequest TransactionRequestType, transaction entities.Transaction) (entities.Transaction, error) {
+	ctx, cancel := withTimeout(ctx, self.timeout)
+	defer cancel()
+	ctx = httpclient.WithAttempts(ctx)
 
-	// Convert the request to XML
-	requestXml, err := xml.MarshalIndent(request, "", "    ")
+	request := CreateTransactionRequest{
+		Xmlns:                  "AnetApi/xml/v1/schema/AnetApiSchema.xsd",
+		MerchantAuthentication: self.merchantAuthentication(),
+		TransactionRequest:     transactionRequest,
+	}
+
+	response := new(CreateTransactionResponse)
+	requestXml, responseXml, err := self.post(ctx, request, response)
+	transaction.ProviderAttempts = httpclient.Attempts(ctx)
+	if requestXml != nil {
+		maskedRequestStr := redaction.Redact(string(requestXml))
+		transaction.RequestPayload = &maskedRequestStr
+	}
 	if err != nil {
-		app.App().Logger().Error("failed to marshal XML: ", err.Error())
+		return transaction, err
+	}
+
+	if response.TransactionResponse == nil {
+		self.logger.FromContext(ctx).Error("transaction failed: no transaction ID returned")
 		return transaction, &errors.ValidationError{
-			Message: "failed to marshal XML: " + err.Error(),
+			Message: "transaction failed: no transaction ID returned",
 		}
 	}
+	transaction.PaymentId = response.TransactionResponse.TransId
 
-	xmlHeader := []byte(xml.Header)
-	fullRequestXml := append(xmlHeader, requestXml...)
+	responseStr := string(responseXml)
+	transaction.ResponsePayload = &responseStr
 
-	httpClient := &http.Client{}
-	req, err := http.NewRequest("POST", self.endpoint, bytes.NewBuffer(fullRequestXml))
-	if err != nil {
-		app.App().Logger().Error("failed to create HTTP request: ", err.Error())
-		return transaction, &errors.ValidationError{
-			Message: "failed to create HTTP request: " + err.Error(),
-		}
+	if response.TransactionResponse.ResponseCode != "1" {
+		return transaction, authorizeDeclineError(response.TransactionResponse, &transaction)
+	}
+	transaction.Status = "succeeded"
+
+	return transaction, nil
+}
+
+// authorizeDeclineError fails a transaction Authorize.Net did not approve
+// with the normalized code of the first reason it gave, and returns the
+// decline, the same way a Stripe card error is returned.
+func authorizeDeclineError(response *TransactionResponse, transaction *entities.Transaction) error {
+	reasonCode, reasonText := "", "transaction was declined"
+	if len(response.Errors) > 0 {
+		reasonCode, reasonText = response.Errors[0].ErrorCode, response.Errors[0].ErrorText
+	}
+	decline := declines.FromAuthorize(reasonCode)
+	decline.Apply(transaction)
+	transaction.Status = "failed"
+	return decline.Error(reasonText)
+}
+
+// ApplyFees computes the processing fee from the merchant's Authorize.Net fee
+// schedule (AuthorizeFeePercent and AuthorizeFeeFixed). Settlement happens in
+// AuthorizeSettlementCurrency, defaulting to the transaction currency.
+func (self *AuthorizeNetPaymentProvider) ApplyFees(ctx context.Context, transaction entities.Transaction) (entities.Transaction, error) {
+	fee := transaction.Amount*self.config.AuthorizeFeePercent/100 + self.config.AuthorizeFeeFixed
+	fee = math.Round(fee*100) / 100
+	net := math.Round((transaction.Amount-fee)*100) / 100
+
+	transaction.FeeAmount = &fee
+	transaction.NetAmount = &net
+	transaction.SettlementCurrency = self.config.AuthorizeSettlementCurrency
+	if transaction.SettlementCurrency == "" {
+		transaction.SettlementCurrency = transaction.Currency
 	}
-	req.Header.Set("Content-Type", "text/xml")
 
-	resp, err := httpClient.Do(req)
+	return transaction, nil
+}
+
+// FetchStatus looks the transaction up with getTransactionDetailsRequest.
+func (self *AuthorizeNetPaymentProvider) FetchStatus(ctx context.Context, transaction entities.Transaction) (entities.Transaction, error) {
+	ctx, cancel := withTimeout(ctx, self.timeout)
+	defer cancel()
+
+	detail, err := self.getTransactionDetails(ctx, transaction.PaymentId)
 	if err != nil {
-		app.App().Logger().Error("failed to send HTTP request: ", err.Error())
+		return transaction, err
+	}
+
+	if status, ok := authorizeTransactionStatuses[detail.TransactionStatus]; ok {
+		transaction.Status = status
+	}
+	return transaction, nil
+}
+
+// Refund issues a refundTransaction of amount against the original capture
+// and adds it to RefundedAmount. The masked card number Authorize.Net
+// requires is read from the transaction details.
+func (self *AuthorizeNetPaymentProvider) Refund(ctx context.Context, transaction entities.Transaction, amount float64) (entities.Transaction, error) {
+	if transaction.TransactionType != "deposit" {
 		return transaction, &errors.ValidationError{
-			Message: "failed to send HTTP request: " + err.Error(),
+			Message: "only deposits can be refunded",
 		}
 	}
-	defer resp.Body.Close()
+	ctx, cancel := withTimeout(ctx, self.timeout)
+	defer cancel()
 
-	responseXml, err := ioutil.ReadAll(resp.Body)
+	detail, err := self.getTransactionDetails(ctx, transaction.PaymentId)
 	if err != nil {
-		app.App().Logger().Error("failed to read HTTP response: ", err.Error())
-		return transaction, &errors.ValidationError{
-			Message: "failed to read HTTP response: " + err.Error(),
-		}
+		return transaction, err
+	}
+
+	cardNumber := detail.Payment.CreditCard.CardNumber
+	if len(cardNumber) > 4 {
+		cardNumber = cardNumber[len(cardNumber)-4:]
+	}
+
+	request := CreateTransactionRequest{
+		Xmlns:                  "AnetApi/xml/v1/schema/AnetApiSchema.xsd",
+		MerchantAuthentication: self.merchantAuthentication(),
+		TransactionRequest: TransactionRequestType{
+			TransactionType: "refundTransaction",
+			Amount:          amount,
+			Payment: PaymentType{
+				CreditCard: CreditCardType{
+					CardNumber:     cardNumber,
+					ExpirationDate: "XXXX",
+				},
+			},
+			RefTransId: transaction.PaymentId,
+		},
 	}
 
 	response := new(CreateTransactionResponse)
-	err = xml.Unmarshal(responseXml, response)
+	_, responseXml, err := self.post(ctx, request, response)
 	if err != nil {
-		app.App().Logger().Error("failed to unmarshal XML response: ", err.Error())
+		return transaction, err
+	}
+
+	responseStr := string(responseXml)
+	transaction.ResponsePayload = &responseStr
+
+	if response.TransactionResponse == nil || response.TransactionResponse.ResponseCode != "1" {
 		return transaction, &errors.ValidationError{
-			Message: "failed to unmarshal XML response: " + err.Error(),
+			Message: "refund was declined: " + messagesText(response.Messages),
 		}
 	}
 
-	if response.TransactionResponse != nil {
-		transaction.PaymentId = response.TransactionResponse.TransId
+	transaction.RefundedAmount = math.Round((transaction.RefundedAmount+amount)*100) / 100
+	if transaction.RefundedAmount < transaction.Amount {
+		transaction.Status = "partially_refunded"
 	} else {
-		app.App().Logger().Error("transaction failed: no transaction ID returned")
-		return transaction, &errors.ValidationError{
-			Message: "transaction failed: no transaction ID returned",
+		transaction.Status = "refunded"
+	}
+	return transaction, nil
+}
+
+func (self *AuthorizeNetPaymentProvider) getTransactionDetails(ctx context.Context, transId string) (*TransactionDetail, error) {
+	if transId == "" {
+		return nil, &errors.ValidationError{
+			Message: "transaction has no payment id",
 		}
 	}
 
-	responseStr := string(responseXml)
-	transaction.ResponsePayload = &responseStr
+	request := GetTransactionDetailsRequest{
+		Xmlns:                  "AnetApi/xml/v1/schema/AnetApiSchema.xsd",
+		MerchantAuthentication: self.merchantAuthentication(),
+		TransId:                transId,
+	}
 
-	if response.TransactionResponse.ResponseCode == "1" {
-		transaction.PaymentId = response.TransactionResponse.TransId
-		transaction.Status = "succeeded"
-	} else {
-		transaction.Status = "failed"
+	response := new(GetTransactionDetailsResponse)
+	if _, _, err := self.post(httpclient.WithIdempotent(ctx), request, response); err != nil {
+		return nil, err
 	}
 
-	return transaction, nil
+	if response.Transaction == nil {
+		return nil, &errors.ValidationError{
+			Message: "transaction details not found: " + messagesText(response.Messages),
+		}
+	}
+	return response.Transaction, nil
 }
 
-func (self *AuthorizeNetPaymentProvider) Withdraw(params types.WithdrawParams, transaction entities.Transaction) (entities.Transaction, error) {
-	request := CreateTransactionRequest{
-		Xmlns: "AnetApi/xml/v1/schema/AnetApiSchema.xsd",
-		MerchantAuthentication: MerchantAuthenticationType{
-			Name:           app.App().Config().GetString("payment.authorize_login_id"),
-			TransactionKey: app.App().Config().GetString("payment.authorize_transaction_key"),
-		},
-		TransactionRequest: TransactionRequestType{
-			TransactionType: "refundTransaction",
-			Amount:          float64(params.Amount),
-			Payment: PaymentType{
-				CreditCard: CreditCardType{
-					CardNumber:     params.CreditCardNumber,
-					ExpirationDate: params.ExpirationDate,
-					CardCode:       params.CVV,
-				},
-			},
-		},
+// CheckConnection sends an authenticateTestRequest, which only verifies the
+// API login and transaction key.
+func (self *AuthorizeNetPaymentProvider) CheckConnection(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, self.timeout)
+	defer cancel()
+
+	request := AuthenticateTestRequest{
+		Xmlns:                  "AnetApi/xml/v1/schema/AnetApiSchema.xsd",
+		MerchantAuthentication: self.merchantAuthentication(),
+	}
+
+	response := new(AuthenticateTestResponse)
+	if _, _, err := self.post(httpclient.WithIdempotent(ctx), request, response); err != nil {
+		return err
+	}
+	if response.Messages.ResultCode != "Ok" {
+		return &errors.ValidationError{
+			Message: "authentication failed: " + messagesText(response.Messages),
+		}
 	}
+	return nil
+}
 
-	maskedRequest := request
-	maskedRequest.TransactionRequest.Payment.CreditCard.CardNumber = "****"
-	maskedRequest.TransactionRequest.Payment.CreditCard.CardCode = "****"
-	maskedRequest.TransactionRequest.Payment.CreditCard.ExpirationDate = "****"
-	maskedRequestXml, _ := xml.MarshalIndent(maskedRequest, "", "    ")
-	maskedRequestStr := string(maskedRequestXml)
-	transaction.RequestPayload = &maskedRequestStr
+func (self *AuthorizeNetPaymentProvider) merchantAuthentication() MerchantAuthenticationType {
+	return MerchantAuthenticationType{
+		Name:           self.config.Credentials.AuthorizeLoginId,
+		TransactionKey: self.config.Credentials.AuthorizeTransactionKey,
+	}
+}
 
-	requestXml, err := xml.MarshalIndent(request, "", "    ")
+// post sends an XML API request and unmarshals the reply into response,
+// returning the request and response bodies as sent and received.
+func (self *AuthorizeNetPaymentProvider) post(ctx context.Context, request interface{}, response interface{}) ([]byte, []byte, error) {
+	requestXml, err := xml.Marshal(request)
 	if err != nil {
-		app.App().Logger().Error("failed to marshal XML: ", err.Error())
-		return transaction, &errors.ValidationError{
+		return nil, nil, &errors.ValidationError{
 			Message: "failed to marshal XML: " + err.Error(),
 		}
 	}
 
-	xmlHeader := []byte(xml.Header)
-	fullRequestXml := append(xmlHeader, requestXml...)
-
-	httpClient := &http.Client{}
-	req, err := http.NewRequest("POST", self.endpoint, bytes.NewBuffer(fullRequestXml))
+	req, err := http.NewRequestWithContext(ctx, "POST", self.endpoint, bytes.NewBuffer(append([]byte(xml.Header), requestXml...)))
 	if err != nil {
-		app.App().Logger().Error("failed to create HTTP request: ", err.Error())
-		return transaction, &errors.ValidationError{
+		return requestXml, nil, &errors.InternalServerError{
 			Message: "failed to create HTTP request: " + err.Error(),
 		}
 	}
 	req.Header.Set("Content-Type", "text/xml")
 
-	resp, err := httpClient.Do(req)
+	resp, err := self.client.Do(req)
 	if err != nil {
-		app.App().Logger().Error("failed to send HTTP request: ", err.Error())
-		return transaction, &errors.ValidationError{
+		self.logger.FromContext(ctx).Error("failed to send HTTP request: ", err.Error())
+		return requestXml, nil, providerError(ctx, &errors.InternalServerError{
 			Message: "failed to send HTTP request: " + err.Error(),
-		}
+		})
 	}
 	defer resp.Body.Close()
 
 	responseXml, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		app.App().Logger().Error("failed to read HTTP response: ", err.Error())
-		return transaction, &errors.ValidationError{
+		return requestXml, nil, providerError(ctx, &errors.InternalServerError{
 			Message: "failed to read HTTP response: " + err.Error(),
-		}
+		})
 	}
-
-	response := new(CreateTransactionResponse)
-	err = xml.Unmarshal(responseXml, response)
-	if err != nil {
-		app.App().Logger().Error("failed to unmarshal XML response: ", err.Error())
-		return transaction, &errors.ValidationError{
-			Message: "failed to unmarshal XML response: " + err.Error(),
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return requestXml, nil, &errors.InternalServerError{
+			Message: "authorize.net returned " + resp.Status,
 		}
 	}
 
-	if response.TransactionResponse != nil {
-		transaction.PaymentId = response.TransactionResponse.TransId
-	} else {
-		app.App().Logger().Error("transaction failed: no transaction ID returned")
-		return transaction, &errors.ValidationError{
-			Message: "transaction failed: no transaction ID returned",
+	// Authorize.Net prefixes responses with a UTF-8 byte order mark.
+	if err := xml.Unmarshal(bytes.TrimPrefix(responseXml, []byte("\xef\xbb\xbf")), response); err != nil {
+		return requestXml, responseXml, &errors.InternalServerError{
+			Message: "failed to unmarshal XML response: " + err.Error(),
 		}
 	}
+	return requestXml, responseXml, nil
+}
 
-	responseStr := string(responseXml)
-	transaction.ResponsePayload = &responseStr
-
-	if response.TransactionResponse.ResponseCode == "1" {
-		transaction.PaymentId = response.TransactionResponse.TransId
-		transaction.Status = "succeeded"
-	} else {
-		transaction.Status = "failed"
+func messagesText(messages Messages) string {
+	texts := make([]string, 0, len(messages.Message))
+	for _, message := range messages.Message {
+		texts = append(texts, message.Code+" "+message.Text)
 	}
-
-	return transaction, nil
+	return strings.Join(texts, "; ")
 }
@@ -0,0 +1,517 @@
+package fakeproviders
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// AuthorizeOptions configures an AuthorizeServer.
+type AuthorizeOptions struct {
+	// LoginId and TransactionKey are the only credentials accepted; empty
+	// accepts any.
+	LoginId        string
+	TransactionKey string
+	// WebhookUrl receives an event for every approved transaction, signed
+	// with WebhookSignatureKey in the X-ANET-Signature header. Empty sends
+	// none.
+	WebhookUrl          string
+	WebhookSignatureKey string
+	// DuplicateWindow rejects a transaction with the same type, amount and
+	// card as one submitted within the window, with reason code 11, like
+	// Authorize.Net's duplicate check. Zero disables the check.
+	DuplicateWindow time.Duration
+}
+
+// AuthorizeTransaction is a transaction an AuthorizeServer has recorded.
+type AuthorizeTransaction struct {
+	TransId         string
+	TransactionType string
+	// TransactionStatus is the status getTransactionDetailsRequest reports,
+	// such as "capturedPendingSettlement" or "declined".
+	TransactionStatus string
+	ResponseCode      string
+	Amount            float64
+	// CardNumber is masked to its last four digits, as Authorize.Net
+	// returns it.
+	CardNumber string
+	RefTransId string
+
+	refunded    float64
+	submittedAt time.Time
+	duplicate   string
+}
+
+// AuthorizeServer emulates createTransactionRequest (authCaptureTransaction
+// and refundTransaction, linked or not), getTransactionDetailsRequest and
+// authenticateTestRequest of the Authorize.Net XML API. Responses start with
+// a UTF-8 byte order mark like the real ones. Approved captures send
+// net.authorize.payment.authcapture.created and approved refunds
+// net.authorize.payment.refund.created.
+type AuthorizeServer struct {
+	script
+	// URL is the base URL to configure as payment.authorize_base_url.
+	URL string
+
+	options  AuthorizeOptions
+	server   *httptest.Server
+	webhooks *webhookSender
+
+	mutex        sync.Mutex
+	lastId       int
+	transactions map[string]*AuthorizeTransaction
+}
+
+const authorizeNamespace = "AnetApi/xml/v1/schema/AnetApiSchema.xsd"
+
+// authorizeRequest holds the fields of every request the server answers.
+type authorizeRequest struct {
+	XMLName                xml.Name
+	MerchantAuthentication struct {
+		Name           string `xml:"name"`
+		TransactionKey string `xml:"transactionKey"`
+	} `xml:"merchantAuthentication"`
+	TransactionRequest struct {
+		TransactionType string  `xml:"transactionType"`
+		Amount          float64 `xml:"amount"`
+		Payment         struct {
+			CreditCard struct {
+				CardNumber     string `xml:"cardNumber"`
+				ExpirationDate string `xml:"expirationDate"`
+				CardCode       string `xml:"cardCode"`
+			} `xml:"creditCard"`
+		} `xml:"payment"`
+		RefTransId string `xml:"refTransId"`
+	} `xml:"transactionRequest"`
+	TransId string `xml:"transId"`
+}
+
+type authorizeMessages struct {
+	ResultCode string             `xml:"resultCode"`
+	Message    []authorizeMessage `xml:"message"`
+}
+
+type authorizeMessage struct {
+	Code string `xml:"code"`
+	Text string `xml:"text"`
+}
+
+type authorizeTransactionResponse struct {
+	ResponseCode  string                          `xml:"responseCode"`
+	AuthCode      string                          `xml:"authCode"`
+	AVSResultCode string                          `xml:"avsResultCode"`
+	CVVResultCode string                          `xml:"cvvResultCode"`
+	TransId       string                          `xml:"transId"`
+	RefTransID    string                          `xml:"refTransID"`
+	AccountNumber string                          `xml:"accountNumber"`
+	AccountType   string                          `xml:"accountType"`
+	Messages      []authorizeTransactionMessage   `xml:"messages>message,omitempty"`
+	Errors        []authorizeTransactionErrorCode `xml:"errors>error,omitempty"`
+}
+
+type authorizeTransactionMessage struct {
+	Code        string `xml:"code"`
+	Description string `xml:"description"`
+}
+
+type authorizeTransactionErrorCode struct {
+	ErrorCode string `xml:"errorCode"`
+	ErrorText string `xml:"errorText"`
+}
+
+type authorizeCreateTransactionResponse struct {
+	XMLName             xml.Name                      `xml:"createTransactionResponse"`
+	Xmlns               string                        `xml:"xmlns,attr"`
+	Messages            authorizeMessages             `xml:"messages"`
+	TransactionResponse *authorizeTransactionResponse `xml:"transactionResponse,omitempty"`
+}
+
+type authorizeTransactionDetailsResponse struct {
+	XMLName     xml.Name                  `xml:"getTransactionDetailsResponse"`
+	Xmlns       string                    `xml:"xmlns,attr"`
+	Messages    authorizeMessages         `xml:"messages"`
+	Transaction *authorizeTransactionInfo `xml:"transaction,omitempty"`
+}
+
+type authorizeTransactionInfo struct {
+	TransId           string  `xml:"transId"`
+	RefTransId        string  `xml:"refTransId,omitempty"`
+	TransactionType   string  `xml:"transactionType"`
+	TransactionStatus string  `xml:"transactionStatus"`
+	ResponseCode      string  `xml:"responseCode"`
+	AuthAmount        float64 `xml:"authAmount"`
+	SettleAmount      float64 `xml:"settleAmount"`
+	Payment           struct {
+		CreditCard struct {
+			CardNumber     string `xml:"cardNumber"`
+			ExpirationDate string `xml:"expirationDate"`
+		} `xml:"creditCard"`
+	} `xml:"payment"`
+}
+
+type authorizeAuthenticateTestResponse struct {
+	XMLName  xml.Name          `xml:"authenticateTestResponse"`
+	Xmlns    string            `xml:"xmlns,attr"`
+	Messages authorizeMessages `xml:"messages"`
+}
+
+// authorizeReasons are the texts of the response reason codes the server
+// answers with. Codes in authorizeErrorReasons come with response code 3,
+// the others with 2.
+var authorizeReasons = map[string]string{
+	"2":  "This transaction has been declined.",
+	"3":  "This transaction has been declined.",
+	"4":  "This transaction has been declined.",
+	"5":  "A valid amount is required.",
+	"6":  "The credit card number is invalid.",
+	"8":  "The credit card has expired.",
+	"11": "A duplicate transaction has been submitted.",
+	"27": "The transaction has been declined because of an AVS mismatch with the address provided by the cardholder.",
+	"44": "This transaction has been declined.",
+	"45": "This transaction has been declined.",
+	"54": "The referenced transaction does not meet the criteria for issuing a credit.",
+	"65": "This transaction has been declined.",
+}
+
+var authorizeErrorReasons = map[string]bool{"5": true, "6": true, "8": true, "11": true, "54": true}
+
+var authorizeStatuses = map[string]string{
+	"authCaptureTransaction": "capturedPendingSettlement",
+	"refundTransaction":      "refundPendingSettlement",
+}
+
+var authorizeEvents = map[string]string{
+	"authCaptureTransaction": "net.authorize.payment.authcapture.created",
+	"refundTransaction":      "net.authorize.payment.refund.created",
+}
+
+// NewAuthorizeServer starts an AuthorizeServer. Close it when done.
+func NewAuthorizeServer(options AuthorizeOptions) *AuthorizeServer {
+	server := &AuthorizeServer{
+		options:      options,
+		webhooks:     newWebhookSender(),
+		transactions: map[string]*AuthorizeTransaction{},
+	}
+
+	r := chi.NewRouter()
+	r.Post("/xml/v1/request.api", server.handle)
+
+	server.server = httptest.NewServer(r)
+	server.URL = server.server.URL
+	return server
+}
+
+// Close stops the server after the pending webhooks have been sent.
+func (self *AuthorizeServer) Close() {
+	self.server.Close()
+	self.webhooks.close()
+}
+
+// WaitWebhooks waits until every webhook sent so far has been delivered or
+// given up on, and returns all deliveries.
+func (self *AuthorizeServer) WaitWebhooks() []Delivery {
+	return self.webhooks.wait()
+}
+
+// Transaction returns the transaction with the given transId.
+func (self *AuthorizeServer) Transaction(transId string) (AuthorizeTransaction, bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	transaction, ok := self.transactions[transId]
+	if !ok {
+		return AuthorizeTransaction{}, false
+	}
+	return *transaction, true
+}
+
+// Transactions returns every recorded transaction in the order they were
+// submitted.
+func (self *AuthorizeServer) Transactions() []AuthorizeTransaction {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	transactions := make([]AuthorizeTransaction, 0, len(self.transactions))
+	for _, transaction := range self.transactions {
+		transactions = append(transactions, *transaction)
+	}
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactions[i].TransId < transactions[j].TransId
+	})
+	return transactions
+}
+
+// Payments returns the number of transactions created, declined ones
+// included.
+func (self *AuthorizeServer) Payments() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return len(self.transactions)
+}
+
+func (self *AuthorizeServer) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return
+	}
+	request := new(authorizeRequest)
+	if err := xml.Unmarshal(body, request); err != nil {
+		writeXml(w, &authorizeAuthenticateTestResponse{Xmlns: authorizeNamespace, Messages: authorizeError("E00003", "An error occurred while parsing the XML request.")})
+		return
+	}
+
+	scenario := self.next(request.TransactionRequest.Payment.CreditCard.CardNumber)
+	if !scenario.play(w, r) {
+		return
+	}
+
+	if !self.authenticated(request) {
+		messages := authorizeError("E00007", "User authentication failed due to invalid authentication values.")
+		switch request.XMLName.Local {
+		case "createTransactionRequest":
+			writeXml(w, &authorizeCreateTransactionResponse{Xmlns: authorizeNamespace, Messages: messages})
+		case "getTransactionDetailsRequest":
+			writeXml(w, &authorizeTransactionDetailsResponse{Xmlns: authorizeNamespace, Messages: messages})
+		default:
+			writeXml(w, &authorizeAuthenticateTestResponse{Xmlns: authorizeNamespace, Messages: messages})
+		}
+		return
+	}
+
+	switch request.XMLName.Local {
+	case "createTransactionRequest":
+		response, transaction := self.createTransaction(request, scenario)
+		writeXml(w, response)
+		if transaction != nil && transaction.ResponseCode == "1" {
+			self.send(*transaction)
+		}
+	case "getTransactionDetailsRequest":
+		writeXml(w, self.transactionDetails(request.TransId))
+	case "authenticateTestRequest":
+		writeXml(w, &authorizeAuthenticateTestResponse{Xmlns: authorizeNamespace, Messages: authorizeOk()})
+	default:
+		writeXml(w, &authorizeAuthenticateTestResponse{
+			Xmlns:    authorizeNamespace,
+			Messages: authorizeError("E00045", "The root node does not reference a valid XML namespace."),
+		})
+	}
+}
+
+func (self *AuthorizeServer) authenticated(request *authorizeRequest) bool {
+	authentication := request.MerchantAuthentication
+	return (self.options.LoginId == "" || authentication.Name == self.options.LoginId) &&
+		(self.options.TransactionKey == "" || authentication.TransactionKey == self.options.TransactionKey)
+}
+
+// createTransaction records the transaction and returns the response with
+// the transaction, or with nil when the request was invalid.
+func (self *AuthorizeServer) createTransaction(request *authorizeRequest, scenario Scenario) (*authorizeCreateTransactionResponse, *AuthorizeTransaction) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	transactionRequest := request.TransactionRequest
+	if _, ok := authorizeStatuses[transactionRequest.TransactionType]; !ok {
+		return &authorizeCreateTransactionResponse{
+			Xmlns:    authorizeNamespace,
+			Messages: authorizeError("E00003", "The transactionType '"+transactionRequest.TransactionType+"' is not supported."),
+		}, nil
+	}
+
+	cardNumber := transactionRequest.Payment.CreditCard.CardNumber
+	transaction := &AuthorizeTransaction{
+		TransId:         self.newTransId(),
+		TransactionType: transactionRequest.TransactionType,
+		Amount:          transactionRequest.Amount,
+		CardNumber:      "XXXX" + lastFour(cardNumber),
+		RefTransId:      transactionRequest.RefTransId,
+		submittedAt:     time.Now(),
+		duplicate:       fmt.Sprintf("%s|%.2f|%s", transactionRequest.TransactionType, transactionRequest.Amount, cardNumber),
+	}
+
+	reason := ""
+	switch {
+	case transaction.Amount <= 0:
+		reason = "5"
+	case self.isDuplicate(transaction):
+		reason = "11"
+	case transaction.RefTransId != "" && !self.refundable(transaction):
+		reason = "54"
+	case scenario.Outcome == Decline:
+		reason = scenario.DeclineCode
+		if reason == "" {
+			reason = "2"
+		}
+	}
+
+	response := &authorizeTransactionResponse{
+		TransId:       transaction.TransId,
+		RefTransID:    transaction.RefTransId,
+		AccountNumber: transaction.CardNumber,
+		AccountType:   "Visa",
+	}
+	if reason == "" {
+		transaction.ResponseCode = "1"
+		transaction.TransactionStatus = authorizeStatuses[transaction.TransactionType]
+		if original, ok := self.transactions[transaction.RefTransId]; ok {
+			original.refunded += transaction.Amount
+		}
+		response.AuthCode = fmt.Sprintf("%06X", self.lastId)
+		response.AVSResultCode = "Y"
+		response.CVVResultCode = "P"
+		response.Messages = []authorizeTransactionMessage{{Code: "1", Description: "This transaction has been approved."}}
+	} else {
+		transaction.ResponseCode = "2"
+		if authorizeErrorReasons[reason] {
+			transaction.ResponseCode = "3"
+		}
+		transaction.TransactionStatus = "declined"
+		text, ok := authorizeReasons[reason]
+		if !ok {
+			text = "This transaction has been declined."
+		}
+		response.AVSResultCode = "P"
+		response.Errors = []authorizeTransactionErrorCode{{ErrorCode: reason, ErrorText: text}}
+	}
+	response.ResponseCode = transaction.ResponseCode
+	self.transactions[transaction.TransId] = transaction
+
+	messages := authorizeOk()
+	if transaction.ResponseCode != "1" {
+		messages = authorizeError("E00027", "The transaction was unsuccessful.")
+	}
+	return &authorizeCreateTransactionResponse{
+		Xmlns:               authorizeNamespace,
+		Messages:            messages,
+		TransactionResponse: response,
+	}, transaction
+}
+
+// isDuplicate reports whether an equal transaction was submitted within the
+// duplicate window. The caller holds the mutex.
+func (self *AuthorizeServer) isDuplicate(transaction *AuthorizeTransaction) bool {
+	if self.options.DuplicateWindow <= 0 {
+		return false
+	}
+	for _, previous := range self.transactions {
+		if previous.duplicate == transaction.duplicate && transaction.submittedAt.Sub(previous.submittedAt) < self.options.DuplicateWindow {
+			return true
+		}
+	}
+	return false
+}
+
+// refundable reports whether the linked refund transaction may be credited
+// against its referenced capture. The caller holds the mutex.
+func (self *AuthorizeServer) refundable(refund *AuthorizeTransaction) bool {
+	original, ok := self.transactions[refund.RefTransId]
+	return ok && original.TransactionType == "authCaptureTransaction" && original.ResponseCode == "1" &&
+		original.CardNumber == refund.CardNumber && original.refunded+refund.Amount <= original.Amount+0.005
+}
+
+func (self *AuthorizeServer) transactionDetails(transId string) *authorizeTransactionDetailsResponse {
+	self.mutex.Lock()
+	transaction, ok := self.transactions[transId]
+	var snapshot AuthorizeTransaction
+	if ok {
+		snapshot = *transaction
+	}
+	self.mutex.Unlock()
+
+	if !ok {
+		return &authorizeTransactionDetailsResponse{
+			Xmlns:    authorizeNamespace,
+			Messages: authorizeError("E00040", "The record cannot be found."),
+		}
+	}
+
+	info := &authorizeTransactionInfo{
+		TransId:           snapshot.TransId,
+		RefTransId:        snapshot.RefTransId,
+		TransactionType:   snapshot.TransactionType,
+		TransactionStatus: snapshot.TransactionStatus,
+		ResponseCode:      snapshot.ResponseCode,
+		AuthAmount:        snapshot.Amount,
+	}
+	if snapshot.ResponseCode == "1" {
+		info.SettleAmount = snapshot.Amount
+	}
+	info.Payment.CreditCard.CardNumber = snapshot.CardNumber
+	info.Payment.CreditCard.ExpirationDate = "XXXX"
+	return &authorizeTransactionDetailsResponse{
+		Xmlns:       authorizeNamespace,
+		Messages:    authorizeOk(),
+		Transaction: info,
+	}
+}
+
+// send queues the webhook of an approved transaction, signed like
+// Authorize.Net signs notifications.
+func (self *AuthorizeServer) send(transaction AuthorizeTransaction) {
+	if self.options.WebhookUrl == "" {
+		return
+	}
+	eventType := authorizeEvents[transaction.TransactionType]
+	body, _ := json.Marshal(map[string]interface{}{
+		"notificationId": fmt.Sprintf("fake-%s", transaction.TransId),
+		"eventType":      eventType,
+		"eventDate":      time.Now().UTC().Format(time.RFC3339Nano),
+		"webhookId":      "fake-webhook",
+		"payload": map[string]interface{}{
+			"responseCode": 1,
+			"authCode":     "",
+			"avsResponse":  "Y",
+			"authAmount":   math.Round(transaction.Amount*100) / 100,
+			"entityName":   "transaction",
+			"id":           transaction.TransId,
+		},
+	})
+
+	mac := hmac.New(sha512.New, []byte(self.options.WebhookSignatureKey))
+	mac.Write(body)
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("X-ANET-Signature", "sha512="+strings.ToUpper(hex.EncodeToString(mac.Sum(nil))))
+	self.webhooks.send(hook{url: self.options.WebhookUrl, event: eventType, body: body, header: header})
+}
+
+// newTransId returns the next transaction id. The caller holds the mutex.
+func (self *AuthorizeServer) newTransId() string {
+	self.lastId++
+	return fmt.Sprintf("%d", 60000000000+self.lastId)
+}
+
+func authorizeOk() authorizeMessages {
+	return authorizeMessages{ResultCode: "Ok", Message: []authorizeMessage{{Code: "I00001", Text: "Successful."}}}
+}
+
+func authorizeError(code string, text string) authorizeMessages {
+	return authorizeMessages{ResultCode: "Error", Message: []authorizeMessage{{Code: code, Text: text}}}
+}
+
+func lastFour(cardNumber string) string {
+	if len(cardNumber) > 4 {
+		return cardNumber[len(cardNumber)-4:]
+	}
+	return cardNumber
+}
+
+// writeXml answers with response, prefixed with a byte order mark like
+// Authorize.Net's answers.
+func writeXml(w http.ResponseWriter, response interface{}) {
+	body, _ := xml.Marshal(response)
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(append([]byte("\xef\xbb\xbf"+xml.Header), body...))
+}
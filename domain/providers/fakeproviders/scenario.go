@@ -0,0 +1,123 @@
+// Package fakeproviders runs local HTTP servers that emulate the parts of the
+// Stripe API and the Authorize.Net XML API the providers use, so provider
+// flows can be tested without sandbox accounts or network. Point a provider
+// at a server with payment.stripe_base_url or payment.authorize_base_url.
+//
+// Every request is answered from a scripted Scenario: approved, declined,
+// failed with an HTTP error, dropped without an answer, or any of these after
+// a delay. Changes are reported to the service with webhooks signed the way
+// the real provider signs them.
+package fakeproviders
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Outcome is how a server answers a request.
+type Outcome string
+
+const (
+	// Approve succeeds the request.
+	Approve Outcome = "approve"
+	// Decline refuses a charge, payout or refund the way the provider
+	// refuses a card: Stripe with a card_error, Authorize.Net with response
+	// code 2. Requests that do not move money are approved instead.
+	Decline Outcome = "decline"
+	// Fail answers with an HTTP error.
+	Fail Outcome = "fail"
+	// Drop closes the connection without answering.
+	Drop Outcome = "drop"
+)
+
+// Scenario scripts the answer to one request.
+type Scenario struct {
+	Outcome Outcome
+	// DeclineCode is the reason of a Decline: a Stripe decline_code such as
+	// "insufficient_funds", or an Authorize.Net response reason code such as
+	// "6". Empty declines without a specific reason.
+	DeclineCode string
+	// StatusCode is the status of a Fail, 500 by default.
+	StatusCode int
+	// Delay is waited before answering. A delay beyond the provider's
+	// timeout makes the call time out; the request then has no effect.
+	Delay time.Duration
+}
+
+// script chooses the scenario of each request: queued scenarios first, in
+// order, then the scenario set for the request's key, then Approve.
+type script struct {
+	mutex sync.Mutex
+	queue []Scenario
+	byKey map[string]Scenario
+}
+
+// Enqueue scripts the next requests, whatever they are, in order.
+func (self *script) Enqueue(scenarios ...Scenario) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.queue = append(self.queue, scenarios...)
+}
+
+// Script answers every request for key with scenario, unless a queued
+// scenario comes first. The key of a Stripe request is its payment method
+// or payout destination, or the card number of a payment method created
+// from card details; the key of an Authorize.Net request is its card
+// number.
+func (self *script) Script(key string, scenario Scenario) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.byKey == nil {
+		self.byKey = map[string]Scenario{}
+	}
+	self.byKey[key] = scenario
+}
+
+func (self *script) next(key string) Scenario {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if len(self.queue) > 0 {
+		scenario := self.queue[0]
+		self.queue = self.queue[1:]
+		return scenario
+	}
+	if scenario, ok := self.byKey[key]; ok {
+		return scenario
+	}
+	return Scenario{Outcome: Approve}
+}
+
+// play waits out the scenario's delay and answers the request itself when
+// the scenario fails or drops it. It returns false when the request has
+// been answered or abandoned by the client.
+func (self Scenario) play(w http.ResponseWriter, r *http.Request) bool {
+	if self.Delay > 0 {
+		timer := time.NewTimer(self.Delay)
+		defer timer.Stop()
+		select {
+		case <-r.Context().Done():
+			return false
+		case <-timer.C:
+		}
+	}
+
+	switch self.Outcome {
+	case Fail:
+		status := self.StatusCode
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		http.Error(w, http.StatusText(status), status)
+		return false
+	case Drop:
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return false
+			}
+		}
+		panic(http.ErrAbortHandler)
+	}
+	return true
+}
@@ -0,0 +1,572 @@
+package fakeproviders
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stripe/stripe-go"
+	"github.com/stripe/stripe-go/webhook"
+)
+
+// StripeOptions configures a StripeServer.
+type StripeOptions struct {
+	// SecretKey is the only API key accepted; empty accepts any.
+	SecretKey string
+	// WebhookUrl receives an event for every change, signed with
+	// WebhookSecret in the Stripe-Signature header. Empty sends none.
+	WebhookUrl    string
+	WebhookSecret string
+}
+
+// StripeServer emulates PaymentMethods, PaymentIntents, Payouts, Refunds,
+// Charges and the Balance of the Stripe API. Requests with an Idempotency-Key are answered
+// once and replayed after, like Stripe does; requests that fail or drop
+// under their scenario are not recorded, so their retry is executed.
+//
+// Charges succeed at once with a fee of 2.9% plus 30 and send
+// payment_intent.succeeded; declined charges send
+// payment_intent.payment_failed. Payouts stay pending until PayPayout or
+// FailPayout, and refunds send charge.refunded.
+type StripeServer struct {
+	script
+	// URL is the base URL to configure as payment.stripe_base_url.
+	URL string
+
+	options  StripeOptions
+	server   *httptest.Server
+	webhooks *webhookSender
+
+	mutex          sync.Mutex
+	lastId         int
+	paymentMethods map[string]string
+	paymentIntents map[string]*stripePaymentIntent
+	charges        map[string]*stripe.Charge
+	payouts        map[string]*stripe.Payout
+	idempotent     map[string]stripeResult
+}
+
+// stripePaymentIntent adds latest_charge, which the service reads from
+// webhooks, to the PaymentIntent of stripe-go.
+type stripePaymentIntent struct {
+	stripe.PaymentIntent
+	LatestCharge string `json:"latest_charge,omitempty"`
+}
+
+// stripeResult is a recorded answer to an idempotent request.
+type stripeResult struct {
+	params string
+	status int
+	body   []byte
+}
+
+// stripeEvent is a webhook to send once the request that caused it has been
+// answered.
+type stripeEvent struct {
+	eventType      string
+	object         interface{}
+	idempotencyKey string
+}
+
+// NewStripeServer starts a StripeServer. Close it when done.
+func NewStripeServer(options StripeOptions) *StripeServer {
+	server := &StripeServer{
+		options:        options,
+		webhooks:       newWebhookSender(),
+		paymentMethods: map[string]string{},
+		paymentIntents: map[string]*stripePaymentIntent{},
+		charges:        map[string]*stripe.Charge{},
+		payouts:        map[string]*stripe.Payout{},
+		idempotent:     map[string]stripeResult{},
+	}
+
+	r := chi.NewRouter()
+	r.Use(server.authenticate)
+	r.Post("/v1/payment_methods", server.createPaymentMethod)
+	r.Post("/v1/payment_intents", server.createPaymentIntent)
+	r.Get("/v1/payment_intents/{id}", server.getPaymentIntent)
+	r.Post("/v1/payouts", server.createPayout)
+	r.Get("/v1/payouts/{id}", server.getPayout)
+	r.Post("/v1/refunds", server.createRefund)
+	r.Get("/v1/charges/{id}", server.getCharge)
+	r.Get("/v1/balance", server.getBalance)
+
+	server.server = httptest.NewServer(r)
+	server.URL = server.server.URL
+	return server
+}
+
+// Close stops the server after the pending webhooks have been sent.
+func (self *StripeServer) Close() {
+	self.server.Close()
+	self.webhooks.close()
+}
+
+// WaitWebhooks waits until every webhook sent so far has been delivered or
+// given up on, and returns all deliveries.
+func (self *StripeServer) WaitWebhooks() []Delivery {
+	return self.webhooks.wait()
+}
+
+// PaymentIntent returns the PaymentIntent with the given id.
+func (self *StripeServer) PaymentIntent(id string) (stripe.PaymentIntent, bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	intent, ok := self.paymentIntents[id]
+	if !ok {
+		return stripe.PaymentIntent{}, false
+	}
+	return intent.PaymentIntent, true
+}
+
+// Payments returns the number of PaymentIntents and payouts created,
+// declined ones included. An idempotent replay creates none.
+func (self *StripeServer) Payments() int {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return len(self.paymentIntents) + len(self.payouts)
+}
+
+// PayPayout marks a pending payout paid and sends payout.paid.
+func (self *StripeServer) PayPayout(id string) error {
+	return self.settlePayout(id, stripe.PayoutStatusPaid, "")
+}
+
+// FailPayout marks a pending payout failed with failureCode, such as
+// "account_closed", and sends payout.failed.
+func (self *StripeServer) FailPayout(id string, failureCode string) error {
+	return self.settlePayout(id, stripe.PayoutStatusFailed, failureCode)
+}
+
+func (self *StripeServer) settlePayout(id string, status stripe.PayoutStatus, failureCode string) error {
+	self.mutex.Lock()
+	payout, ok := self.payouts[id]
+	if !ok || payout.Status != stripe.PayoutStatusPending {
+		self.mutex.Unlock()
+		return fmt.Errorf("no pending payout %s", id)
+	}
+	payout.Status = status
+	payout.FailureCode = stripe.PayoutFailureCode(failureCode)
+	snapshot := *payout
+	self.mutex.Unlock()
+
+	self.send(stripeEvent{eventType: "payout." + string(status), object: snapshot})
+	return nil
+}
+
+func (self *StripeServer) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if self.options.SecretKey != "" && r.Header.Get("Authorization") != "Bearer "+self.options.SecretKey {
+			writeStripeError(w, http.StatusUnauthorized, &stripe.Error{
+				Type: stripe.ErrorTypeInvalidRequest,
+				Msg:  "Invalid API Key provided.",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// createPaymentMethod creates a card PaymentMethod. It always succeeds; the
+// scenario of its card number plays when a PaymentIntent charges it.
+func (self *StripeServer) createPaymentMethod(w http.ResponseWriter, r *http.Request) {
+	if r.ParseForm() != nil {
+		writeStripeError(w, http.StatusBadRequest, invalidRequest("Invalid request body."))
+		return
+	}
+	self.idempotently(w, r, func() (int, interface{}, []stripeEvent) {
+		number := r.PostForm.Get("card[number]")
+		if r.PostForm.Get("type") != string(stripe.PaymentMethodTypeCard) || number == "" {
+			return http.StatusBadRequest, stripeErrorBody(invalidRequest("Missing required param: card[number].")), nil
+		}
+		method := stripe.PaymentMethod{
+			ID:      self.newId("pm"),
+			Type:    stripe.PaymentMethodTypeCard,
+			Created: time.Now().Unix(),
+		}
+		self.paymentMethods[method.ID] = number
+		return http.StatusOK, method, nil
+	})
+}
+
+func (self *StripeServer) createPaymentIntent(w http.ResponseWriter, r *http.Request) {
+	if r.ParseForm() != nil {
+		writeStripeError(w, http.StatusBadRequest, invalidRequest("Invalid request body."))
+		return
+	}
+	scenario := self.next(self.scenarioKey(r.PostForm.Get("payment_method")))
+	if !scenario.play(w, r) {
+		return
+	}
+	self.idempotently(w, r, func() (int, interface{}, []stripeEvent) {
+		amount, _ := strconv.ParseInt(r.PostForm.Get("amount"), 10, 64)
+		if amount <= 0 {
+			return http.StatusBadRequest, stripeErrorBody(invalidRequest("Invalid positive integer amount.")), nil
+		}
+
+		intent := &stripePaymentIntent{PaymentIntent: stripe.PaymentIntent{
+			ID:       self.newId("pi"),
+			Amount:   amount,
+			Currency: r.PostForm.Get("currency"),
+			Created:  time.Now().Unix(),
+		}}
+		charge := self.newCharge(intent)
+		intent.LatestCharge = charge.ID
+		intent.Charges = &stripe.ChargeList{Data: []*stripe.Charge{charge}}
+		self.paymentIntents[intent.ID] = intent
+		self.charges[charge.ID] = charge
+
+		if scenario.Outcome == Decline {
+			charge.Status = "failed"
+			charge.Paid = false
+			charge.Captured = false
+			charge.BalanceTransaction = nil
+			intent.Status = stripe.PaymentIntentStatusRequiresPaymentMethod
+			intent.LastPaymentError = cardError(scenario.DeclineCode, charge.ID)
+
+			declined := *intent.LastPaymentError
+			declined.PaymentIntent = &intent.PaymentIntent
+			return http.StatusPaymentRequired, stripeErrorBody(&declined), []stripeEvent{
+				{eventType: "payment_intent.payment_failed", object: *intent},
+			}
+		}
+
+		intent.Status = stripe.PaymentIntentStatusSucceeded
+		return http.StatusOK, *intent, []stripeEvent{
+			{eventType: "payment_intent.succeeded", object: *intent},
+		}
+	})
+}
+
+// scenarioKey returns the card number of the PaymentMethod paymentMethod
+// created by createPaymentMethod, or paymentMethod itself.
+func (self *StripeServer) scenarioKey(paymentMethod string) string {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if number, ok := self.paymentMethods[paymentMethod]; ok {
+		return number
+	}
+	return paymentMethod
+}
+
+// newCharge returns the succeeded charge of intent, with a balance
+// transaction holding Stripe's fee.
+func (self *StripeServer) newCharge(intent *stripePaymentIntent) *stripe.Charge {
+	fee := int64(math.Round(float64(intent.Amount)*0.029)) + 30
+	return &stripe.Charge{
+		ID:            self.newId("ch"),
+		Amount:        intent.Amount,
+		Currency:      stripe.Currency(intent.Currency),
+		PaymentIntent: intent.ID,
+		Paid:          true,
+		Captured:      true,
+		Status:        "succeeded",
+		Created:       intent.Created,
+		BalanceTransaction: &stripe.BalanceTransaction{
+			ID:       self.newId("txn"),
+			Amount:   intent.Amount,
+			Currency: stripe.Currency(intent.Currency),
+			Fee:      fee,
+			Net:      intent.Amount - fee,
+		},
+	}
+}
+
+func (self *StripeServer) getPaymentIntent(w http.ResponseWriter, r *http.Request) {
+	if !self.next("").play(w, r) {
+		return
+	}
+	self.mutex.Lock()
+	intent, ok := self.paymentIntents[chi.URLParam(r, "id")]
+	var snapshot stripePaymentIntent
+	if ok {
+		snapshot = *intent
+	}
+	self.mutex.Unlock()
+
+	if !ok {
+		writeStripeError(w, http.StatusNotFound, missing("payment_intent", chi.URLParam(r, "id")))
+		return
+	}
+	writeJson(w, http.StatusOK, snapshot)
+}
+
+func (self *StripeServer) createPayout(w http.ResponseWriter, r *http.Request) {
+	if r.ParseForm() != nil {
+		writeStripeError(w, http.StatusBadRequest, invalidRequest("Invalid request body."))
+		return
+	}
+	scenario := self.next(r.PostForm.Get("destination"))
+	if !scenario.play(w, r) {
+		return
+	}
+	self.idempotently(w, r, func() (int, interface{}, []stripeEvent) {
+		amount, _ := strconv.ParseInt(r.PostForm.Get("amount"), 10, 64)
+		if amount <= 0 {
+			return http.StatusBadRequest, stripeErrorBody(invalidRequest("Invalid positive integer amount.")), nil
+		}
+		if scenario.Outcome == Decline {
+			code := scenario.DeclineCode
+			if code == "" {
+				code = "balance_insufficient"
+			}
+			return http.StatusBadRequest, stripeErrorBody(&stripe.Error{
+				Type: stripe.ErrorTypeInvalidRequest,
+				Code: stripe.ErrorCode(code),
+				Msg:  "You have insufficient funds in your Stripe account for this transfer.",
+			}), nil
+		}
+
+		payout := &stripe.Payout{
+			ID:       self.newId("po"),
+			Amount:   amount,
+			Currency: stripe.Currency(r.PostForm.Get("currency")),
+			Status:   stripe.PayoutStatusPending,
+			Created:  time.Now().Unix(),
+		}
+		self.payouts[payout.ID] = payout
+		return http.StatusOK, *payout, []stripeEvent{
+			{eventType: "payout.created", object: *payout},
+		}
+	})
+}
+
+func (self *StripeServer) getPayout(w http.ResponseWriter, r *http.Request) {
+	if !self.next("").play(w, r) {
+		return
+	}
+	self.mutex.Lock()
+	payout, ok := self.payouts[chi.URLParam(r, "id")]
+	var snapshot stripe.Payout
+	if ok {
+		snapshot = *payout
+	}
+	self.mutex.Unlock()
+
+	if !ok {
+		writeStripeError(w, http.StatusNotFound, missing("payout", chi.URLParam(r, "id")))
+		return
+	}
+	writeJson(w, http.StatusOK, snapshot)
+}
+
+func (self *StripeServer) createRefund(w http.ResponseWriter, r *http.Request) {
+	if r.ParseForm() != nil {
+		writeStripeError(w, http.StatusBadRequest, invalidRequest("Invalid request body."))
+		return
+	}
+	scenario := self.next(r.PostForm.Get("payment_intent"))
+	if !scenario.play(w, r) {
+		return
+	}
+	self.idempotently(w, r, func() (int, interface{}, []stripeEvent) {
+		intent, ok := self.paymentIntents[r.PostForm.Get("payment_intent")]
+		if !ok {
+			return http.StatusNotFound, stripeErrorBody(missing("payment_intent", r.PostForm.Get("payment_intent"))), nil
+		}
+		charge := self.charges[intent.LatestCharge]
+		if intent.Status != stripe.PaymentIntentStatusSucceeded || charge.Refunded {
+			return http.StatusBadRequest, stripeErrorBody(invalidRequest("This PaymentIntent does not have a successful charge to refund.")), nil
+		}
+		amount := charge.Amount - charge.AmountRefunded
+		if value := r.PostForm.Get("amount"); value != "" {
+			amount, _ = strconv.ParseInt(value, 10, 64)
+		}
+		if amount <= 0 || amount > charge.Amount-charge.AmountRefunded {
+			return http.StatusBadRequest, stripeErrorBody(invalidRequest("Refund amount is greater than unrefunded amount on charge.")), nil
+		}
+
+		refund := stripe.Refund{
+			ID:       self.newId("re"),
+			Object:   "refund",
+			Amount:   amount,
+			Currency: charge.Currency,
+			Status:   stripe.RefundStatusSucceeded,
+			Created:  time.Now().Unix(),
+		}
+		if scenario.Outcome == Decline {
+			refund.Status = stripe.RefundStatusFailed
+			refund.FailureReason = stripe.RefundFailureReasonUnknown
+			refund.Charge = &stripe.Charge{ID: charge.ID}
+			return http.StatusOK, refund, nil
+		}
+
+		charge.AmountRefunded += amount
+		charge.Refunded = charge.AmountRefunded >= charge.Amount
+		refund.Charge = charge
+		return http.StatusOK, refund, []stripeEvent{
+			{eventType: "charge.refunded", object: *charge},
+		}
+	})
+}
+
+func (self *StripeServer) getCharge(w http.ResponseWriter, r *http.Request) {
+	if !self.next("").play(w, r) {
+		return
+	}
+	self.mutex.Lock()
+	charge, ok := self.charges[chi.URLParam(r, "id")]
+	var snapshot stripe.Charge
+	if ok {
+		snapshot = *charge
+	}
+	self.mutex.Unlock()
+
+	if !ok {
+		writeStripeError(w, http.StatusNotFound, missing("charge", chi.URLParam(r, "id")))
+		return
+	}
+	writeJson(w, http.StatusOK, snapshot)
+}
+
+func (self *StripeServer) getBalance(w http.ResponseWriter, r *http.Request) {
+	if !self.next("").play(w, r) {
+		return
+	}
+	writeJson(w, http.StatusOK, map[string]interface{}{
+		"object":    "balance",
+		"available": []map[string]interface{}{{"amount": 0, "currency": "usd"}},
+		"pending":   []map[string]interface{}{{"amount": 0, "currency": "usd"}},
+		"livemode":  false,
+	})
+}
+
+// idempotently runs a request that changes state, holding the server's
+// mutex, and sends its events once it has been answered. A request whose
+// Idempotency-Key was used before gets the recorded answer instead, or an
+// idempotency_error when its parameters differ.
+func (self *StripeServer) idempotently(w http.ResponseWriter, r *http.Request, execute func() (int, interface{}, []stripeEvent)) {
+	key := r.Header.Get("Idempotency-Key")
+	params := r.PostForm.Encode()
+
+	self.mutex.Lock()
+	if result, ok := self.idempotent[r.URL.Path+" "+key]; key != "" && ok {
+		self.mutex.Unlock()
+		if result.params != params {
+			writeStripeError(w, http.StatusBadRequest, &stripe.Error{
+				Type: stripe.ErrorType("idempotency_error"),
+				Msg:  "Keys for idempotent requests can only be used with the same parameters they were first used with.",
+			})
+			return
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		writeRaw(w, result.status, result.body)
+		return
+	}
+
+	status, response, events := execute()
+	body, _ := json.Marshal(response)
+	if key != "" {
+		self.idempotent[r.URL.Path+" "+key] = stripeResult{params: params, status: status, body: body}
+	}
+	self.mutex.Unlock()
+
+	if status == http.StatusPaymentRequired {
+		w.Header().Set("Stripe-Should-Retry", "false")
+	}
+	writeRaw(w, status, body)
+	for _, event := range events {
+		event.idempotencyKey = key
+		self.send(event)
+	}
+}
+
+// send queues event for the webhook URL, signed like Stripe signs events.
+func (self *StripeServer) send(event stripeEvent) {
+	if self.options.WebhookUrl == "" {
+		return
+	}
+	object, _ := json.Marshal(event.object)
+
+	self.mutex.Lock()
+	id := self.newId("evt")
+	self.mutex.Unlock()
+
+	now := time.Now()
+	body, _ := json.Marshal(stripe.Event{
+		ID:      id,
+		Type:    event.eventType,
+		Created: now.Unix(),
+		Data:    &stripe.EventData{Raw: object},
+		Request: &stripe.EventRequest{IdempotencyKey: event.idempotencyKey},
+	})
+	signature := hex.EncodeToString(webhook.ComputeSignature(now, body, self.options.WebhookSecret))
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Stripe-Signature", fmt.Sprintf("t=%d,v1=%s", now.Unix(), signature))
+	self.webhooks.send(hook{url: self.options.WebhookUrl, event: event.eventType, body: body, header: header})
+}
+
+// newId returns a new object id with Stripe's prefix for its type. The
+// caller holds the mutex.
+func (self *StripeServer) newId(prefix string) string {
+	self.lastId++
+	return fmt.Sprintf("%s_fake%014d", prefix, self.lastId)
+}
+
+// stripeCardErrorCodes are declines Stripe reports in the error code rather
+// than the decline_code.
+var stripeCardErrorCodes = map[string]string{
+	"expired_card":      "Your card has expired.",
+	"incorrect_cvc":     "Your card's security code is incorrect.",
+	"incorrect_number":  "Your card number is incorrect.",
+	"processing_error":  "An error occurred while processing your card. Try again in a little bit.",
+	"card_decline_rate": "Your card was declined.",
+}
+
+func cardError(declineCode string, chargeId string) *stripe.Error {
+	if message, ok := stripeCardErrorCodes[declineCode]; ok {
+		return &stripe.Error{Type: stripe.ErrorTypeCard, Code: stripe.ErrorCode(declineCode), Msg: message, ChargeID: chargeId}
+	}
+	if declineCode == "" {
+		declineCode = "generic_decline"
+	}
+	return &stripe.Error{
+		Type:        stripe.ErrorTypeCard,
+		Code:        stripe.ErrorCodeCardDeclined,
+		DeclineCode: stripe.DeclineCode(declineCode),
+		Msg:         "Your card was declined.",
+		ChargeID:    chargeId,
+	}
+}
+
+func invalidRequest(message string) *stripe.Error {
+	return &stripe.Error{Type: stripe.ErrorTypeInvalidRequest, Msg: message}
+}
+
+func missing(object string, id string) *stripe.Error {
+	return &stripe.Error{
+		Type:  stripe.ErrorTypeInvalidRequest,
+		Code:  stripe.ErrorCodeResourceMissing,
+		Param: "id",
+		Msg:   fmt.Sprintf("No such %s: '%s'", object, url.PathEscape(id)),
+	}
+}
+
+func stripeErrorBody(stripeErr *stripe.Error) interface{} {
+	return map[string]*stripe.Error{"error": stripeErr}
+}
+
+func writeStripeError(w http.ResponseWriter, status int, stripeErr *stripe.Error) {
+	writeJson(w, status, stripeErrorBody(stripeErr))
+}
+
+func writeJson(w http.ResponseWriter, status int, payload interface{}) {
+	body, _ := json.Marshal(payload)
+	writeRaw(w, status, body)
+}
+
+func writeRaw(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
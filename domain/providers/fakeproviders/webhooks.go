@@ -0,0 +1,107 @@
+package fakeproviders
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// webhookAttempts and webhookRetryDelay say how often a webhook the service
+// did not acknowledge is sent again. The real providers keep retrying for
+// days; a few quick retries cover a webhook that arrives before the service
+// has stored the transaction it refers to.
+const (
+	webhookAttempts   = 5
+	webhookRetryDelay = 100 * time.Millisecond
+)
+
+// Delivery is a webhook a server sent and the last answer it got.
+type Delivery struct {
+	Event      string
+	StatusCode int
+	Err        error
+}
+
+// hook is one webhook to send.
+type hook struct {
+	url    string
+	event  string
+	body   []byte
+	header http.Header
+}
+
+// webhookSender sends webhooks one at a time, in the order they were
+// queued, so the service sees events in the order they happened.
+type webhookSender struct {
+	client     *http.Client
+	queue      chan hook
+	pending    sync.WaitGroup
+	mutex      sync.Mutex
+	deliveries []Delivery
+}
+
+func newWebhookSender() *webhookSender {
+	sender := &webhookSender{
+		client: &http.Client{Timeout: 10 * time.Second},
+		queue:  make(chan hook, 64),
+	}
+	go sender.run()
+	return sender
+}
+
+func (self *webhookSender) send(hook hook) {
+	self.pending.Add(1)
+	self.queue <- hook
+}
+
+func (self *webhookSender) run() {
+	for hook := range self.queue {
+		delivery := self.deliver(hook)
+		self.mutex.Lock()
+		self.deliveries = append(self.deliveries, delivery)
+		self.mutex.Unlock()
+		self.pending.Done()
+	}
+}
+
+func (self *webhookSender) deliver(hook hook) Delivery {
+	delivery := Delivery{Event: hook.event}
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(webhookRetryDelay)
+		}
+		request, err := http.NewRequest(http.MethodPost, hook.url, bytes.NewReader(hook.body))
+		if err != nil {
+			delivery.Err = err
+			return delivery
+		}
+		request.Header = hook.header.Clone()
+		response, err := self.client.Do(request)
+		delivery.Err = err
+		delivery.StatusCode = 0
+		if err != nil {
+			continue
+		}
+		response.Body.Close()
+		delivery.StatusCode = response.StatusCode
+		if response.StatusCode < http.StatusMultipleChoices {
+			return delivery
+		}
+	}
+	return delivery
+}
+
+// wait blocks until every queued webhook has been delivered or given up on,
+// and returns all deliveries so far.
+func (self *webhookSender) wait() []Delivery {
+	self.pending.Wait()
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	return append([]Delivery(nil), self.deliveries...)
+}
+
+func (self *webhookSender) close() {
+	self.pending.Wait()
+	close(self.queue)
+}
@@ -0,0 +1,132 @@
+package providers
+
+import (
+	"payment-service/domain/money"
+	"payment-service/domain/types"
+	"strings"
+)
+
+// Operations a provider is chosen for.
+const (
+	OperationDeposit  = "deposit"
+	OperationWithdraw = "withdraw"
+)
+
+// ProviderCapabilities are the payment methods and currencies a provider
+// accepts.
+type ProviderCapabilities struct {
+	DepositMethods  []string
+	WithdrawMethods []string
+	// Currencies lists ISO 4217 codes; empty accepts any currency.
+	Currencies []string
+	// MinorUnits is set when requests give amounts in minor units of the
+	// currency, such as cents, rather than major units.
+	MinorUnits bool
+}
+
+// Methods returns the payment methods accepted for operation.
+func (self ProviderCapabilities) Methods(operation string) []string {
+	if operation == OperationWithdraw {
+		return self.WithdrawMethods
+	}
+	return self.DepositMethods
+}
+
+// paymentProviderCapabilities are the defaults per provider. Stripe charges
+// PaymentMethod tokens and pays out to destinations in any currency it
+// supports, with amounts in minor units; Authorize.Net takes card details
+// in the currencies its gateway processes, with amounts in major units.
+var paymentProviderCapabilities = map[string]ProviderCapabilities{
+	"stripe": {
+		DepositMethods:  []string{types.PaymentMethodToken},
+		WithdrawMethods: []string{types.PaymentMethodDestination},
+		MinorUnits:      true,
+	},
+	"authorize": {
+		DepositMethods:  []string{types.PaymentMethodCard},
+		WithdrawMethods: []string{types.PaymentMethodCard},
+		Currencies:      []string{"USD", "CAD", "GBP", "EUR", "AUD", "NZD"},
+	},
+}
+
+// Capabilities returns what provider name accepts, with the currencies
+// configured in config taking the place of the defaults. Stripe also takes
+// card deposits when config enables them.
+func Capabilities(name string, config types.ProviderConfig) ProviderCapabilities {
+	capabilities := paymentProviderCapabilities[name]
+	switch {
+	case name == "stripe" && len(config.StripeCurrencies) > 0:
+		capabilities.Currencies = config.StripeCurrencies
+	case name == "authorize" && len(config.AuthorizeCurrencies) > 0:
+		capabilities.Currencies = config.AuthorizeCurrencies
+	}
+	if name == "stripe" && config.StripeCardDeposits {
+		capabilities.DepositMethods = append([]string{types.PaymentMethodCard}, capabilities.DepositMethods...)
+	}
+	return capabilities
+}
+
+// Configured reports whether config has the credentials provider name needs.
+func Configured(name string, config types.ProviderConfig) bool {
+	switch name {
+	case "stripe":
+		return config.Credentials.StripeSecretKey != ""
+	case "authorize":
+		return config.Credentials.AuthorizeLoginId != "" && config.Credentials.AuthorizeTransactionKey != ""
+	}
+	return false
+}
+
+// Supports reports whether provider name is configured and accepts method
+// and currency for operation.
+func Supports(name string, config types.ProviderConfig, operation string, method string, currency string) bool {
+	if !Configured(name, config) {
+		return false
+	}
+	capabilities := Capabilities(name, config)
+	if !contains(capabilities.Methods(operation), method) {
+		return false
+	}
+	return len(capabilities.Currencies) == 0 || contains(capabilities.Currencies, currency)
+}
+
+// MajorAmount converts amount, as sent in a request for method and
+// operation, to major units of currency. Requests count amounts in the
+// unit of the provider that accepts the method by default, so card amounts
+// stay in major units even where Stripe takes card deposits.
+func MajorAmount(operation string, method string, amount float64, currency string) float64 {
+	for _, name := range PaymentProviderNames {
+		capabilities := paymentProviderCapabilities[name]
+		if contains(capabilities.Methods(operation), method) {
+			if capabilities.MinorUnits {
+				return money.ToMajor(amount, currency)
+			}
+			return amount
+		}
+	}
+	return amount
+}
+
+// ProviderAmount converts amount, as sent in a request for method and
+// operation, to the unit provider name counts in. It differs from amount
+// only when the provider takes a method it does not accept by default.
+func ProviderAmount(name string, operation string, method string, amount float64, currency string) float64 {
+	capabilities, ok := paymentProviderCapabilities[name]
+	if !ok {
+		return amount
+	}
+	major := MajorAmount(operation, method, amount, currency)
+	if capabilities.MinorUnits {
+		return money.ToMinor(major, currency)
+	}
+	return major
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
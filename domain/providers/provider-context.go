@@ -0,0 +1,33 @@
+package providers
+
+import (
+	"context"
+	"payment-service/errors"
+	"time"
+)
+
+// DefaultProviderTimeout bounds every provider call when no
+// payment.<provider>_timeout is configured. It stays below the 30s request
+// timeout so a slow provider fails the call rather than the whole request.
+const DefaultProviderTimeout = 20 * time.Second
+
+// withTimeout derives the context of one provider call. The call ends at
+// timeout or at the caller's own deadline, whichever comes first.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		timeout = DefaultProviderTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// providerError returns a TimeoutError when ctx has ended, since err is then
+// only a symptom of the deadline or cancellation, and err otherwise.
+func providerError(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	return &errors.TimeoutError{
+		Message: "provider call did not complete: " + ctx.Err().Error(),
+		Err:     ctx.Err(),
+	}
+}
@@ -0,0 +1,84 @@
+package providers
+
+import (
+	"testing"
+
+	"payment-service/app/logger"
+	"payment-service/domain/declines"
+	"payment-service/domain/providers/fakeproviders"
+	"payment-service/domain/providers/providertest"
+	"payment-service/domain/types"
+	"payment-service/interfaces"
+)
+
+const (
+	contractStripeKey         = "sk_test_contract"
+	contractAuthorizeLogin    = "contract-login"
+	contractAuthorizeKey      = "contract-transaction-key"
+	contractCardNumber        = "4111111111111111"
+	contractCardExpiration    = "2030-12"
+	contractCardSecurityCode  = "987"
+	contractStripeDestination = "ba_contract"
+)
+
+var testLogger = logger.NewLogger(&logger.Debug{Enabled: true, Level: "error", Format: logger.LogFormatConsole})
+
+func TestStripePaymentProviderContract(t *testing.T) {
+	providertest.Run(t, providertest.Harness{
+		New: func(t *testing.T, options providertest.Options) (interfaces.IPaymentProvider, providertest.Server) {
+			server := fakeproviders.NewStripeServer(fakeproviders.StripeOptions{SecretKey: contractStripeKey})
+			t.Cleanup(server.Close)
+			return NewStripePaymentProvider(types.ProviderConfig{
+				Credentials:   types.MerchantCredentials{StripeSecretKey: contractStripeKey},
+				StripeTimeout: options.Timeout,
+				StripeRetry:   options.Retry,
+				StripeBaseUrl: server.URL,
+			}, testLogger), server
+		},
+		Deposit:         types.DepositParams{Amount: 1000, Currency: "usd", Token: "pm_card_visa"},
+		Withdraw:        types.WithdrawParams{Amount: 500, Currency: "usd", Destination: contractStripeDestination},
+		DeclineCode:     "insufficient_funds",
+		Declined:        declines.CodeInsufficientFunds,
+		IdempotencyKeys: true,
+		ChargeIds:       true,
+		Secrets:         []string{contractStripeKey},
+	})
+}
+
+func TestAuthorizeNetPaymentProviderContract(t *testing.T) {
+	providertest.Run(t, providertest.Harness{
+		New: func(t *testing.T, options providertest.Options) (interfaces.IPaymentProvider, providertest.Server) {
+			server := fakeproviders.NewAuthorizeServer(fakeproviders.AuthorizeOptions{
+				LoginId:        contractAuthorizeLogin,
+				TransactionKey: contractAuthorizeKey,
+			})
+			t.Cleanup(server.Close)
+			return NewAuthorizeNetPaymentProvider(types.ProviderConfig{
+				Credentials: types.MerchantCredentials{
+					AuthorizeLoginId:        contractAuthorizeLogin,
+					AuthorizeTransactionKey: contractAuthorizeKey,
+				},
+				AuthorizeTimeout: options.Timeout,
+				AuthorizeRetry:   options.Retry,
+				AuthorizeBaseUrl: server.URL,
+			}, testLogger), server
+		},
+		Deposit: types.DepositParams{
+			Amount:           10.00,
+			Currency:         "USD",
+			CreditCardNumber: contractCardNumber,
+			ExpirationDate:   contractCardExpiration,
+			CVV:              contractCardSecurityCode,
+		},
+		Withdraw: types.WithdrawParams{
+			Amount:           5,
+			Currency:         "USD",
+			CreditCardNumber: contractCardNumber,
+			ExpirationDate:   contractCardExpiration,
+			CVV:              contractCardSecurityCode,
+		},
+		DeclineCode: "2",
+		Declined:    declines.CodeCardDeclined,
+		Secrets:     []string{contractAuthorizeKey},
+	})
+}
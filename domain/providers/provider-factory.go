@@ -0,0 +1,38 @@
+package providers
+
+import (
+	"payment-service/app/logger"
+	"payment-service/domain/types"
+	"payment-service/errors"
+	"payment-service/interfaces"
+)
+
+// PaymentProviderNames lists the providers NewPaymentProviderByName knows, in
+// the order they are tried when a request does not pin a provider.
+var PaymentProviderNames = []string{"stripe", "authorize"}
+
+// NewPaymentProviderByName returns the provider for the `provider` request
+// field, which is also stored as the transaction's GatewayName, acting with
+// the credentials in config and logging to log.
+func NewPaymentProviderByName(name string, config types.ProviderConfig, log *logger.Logger) (interfaces.IPaymentProvider, error) {
+	switch name {
+	case "stripe":
+		if !Configured(name, config) {
+			return nil, &errors.ValidationError{
+				Message: "stripe is not configured for this merchant",
+			}
+		}
+		return NewStripePaymentProvider(config, log), nil
+	case "authorize":
+		if !Configured(name, config) {
+			return nil, &errors.ValidationError{
+				Message: "authorize is not configured for this merchant",
+			}
+		}
+		return NewAuthorizeNetPaymentProvider(config, log), nil
+	default:
+		return nil, &errors.ValidationError{
+			Message: "Invalid provider",
+		}
+	}
+}
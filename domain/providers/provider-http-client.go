@@ -0,0 +1,25 @@
+package providers
+
+import (
+	"net/http"
+	"payment-service/app/httpclient"
+	"payment-service/app/logger"
+	"payment-service/domain/metrics"
+	"strconv"
+)
+
+// newHttpClient returns the retrying client a provider sends its requests
+// with. Retries are logged and counted per provider.
+func newHttpClient(provider string, policy httpclient.RetryPolicy, log *logger.Logger) *http.Client {
+	return httpclient.NewClient(policy, func(request *http.Request, retry httpclient.Retry) {
+		reason := string(retry.Class)
+		if retry.Err != nil {
+			reason += ": " + retry.Err.Error()
+		} else {
+			reason += ": status " + strconv.Itoa(retry.StatusCode)
+		}
+		log.FromContext(request.Context()).Warnf("retrying %s request to %s after attempt %d (%s) in %s",
+			provider, request.URL.Path, retry.Attempt, reason, retry.Delay)
+		metrics.ProviderRetry(provider, string(retry.Class))
+	})
+}
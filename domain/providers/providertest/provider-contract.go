@@ -0,0 +1,300 @@
+// Package providertest is the contract every IPaymentProvider has to honour,
+// so the service can treat the outcome of a charge or withdrawal the same way
+// whichever provider made it. A provider runs the suite from its own tests
+// with Run, against its fake server from domain/providers/fakeproviders.
+//
+// The contract:
+//   - An approved call returns no error, a transaction that is "succeeded",
+//     or "pending" when the provider settles it later, and the provider's
+//     PaymentId; charges also carry a ChargeId when the provider has one.
+//   - A declined charge returns a ProviderDeclinedError and a "failed"
+//     transaction with the PaymentId and the normalized decline codes.
+//   - Server errors, network errors and timeouts return an error that is not
+//     a decline, a TimeoutError for timeouts, and leave the transaction
+//     status alone: the provider may still act on the request.
+//   - A retried request never makes the provider move money twice: providers
+//     with idempotency keys retry a failed charge, the others never repeat
+//     a request that may have reached the provider.
+//   - RequestPayload is always recorded, with card details and credentials
+//     masked.
+package providertest
+
+import (
+	"context"
+	stderrors "errors"
+	"strings"
+	"testing"
+	"time"
+
+	"payment-service/app/httpclient"
+	"payment-service/domain/declines"
+	"payment-service/domain/entities"
+	"payment-service/domain/providers/fakeproviders"
+	"payment-service/domain/types"
+	"payment-service/errors"
+	"payment-service/interfaces"
+)
+
+// Options are the settings a provider under test must be created with.
+type Options struct {
+	// Timeout bounds each provider call.
+	Timeout time.Duration
+	// Retry is how failed requests are retried.
+	Retry httpclient.RetryPolicy
+}
+
+// Server is the fake server a provider under test talks to.
+type Server interface {
+	Enqueue(scenarios ...fakeproviders.Scenario)
+	// Payments returns the number of payments and payouts the server has
+	// created, declined ones included.
+	Payments() int
+}
+
+// Harness plugs a provider into the contract suite.
+type Harness struct {
+	// New starts a fake server, closed with t.Cleanup, and returns a
+	// provider created with options that talks to it.
+	New func(t *testing.T, options Options) (interfaces.IPaymentProvider, Server)
+	// Deposit and Withdraw are requests the server approves unless
+	// scripted otherwise. Their TransactionId is set by the suite.
+	Deposit  types.DepositParams
+	Withdraw types.WithdrawParams
+	// DeclineCode is the Scenario.DeclineCode the suite declines a charge
+	// with, and Declined the normalized code it has to be reported as.
+	DeclineCode string
+	Declined    declines.Code
+	// IdempotencyKeys says the provider sends an idempotency key with every
+	// charge, so a failed one is retried.
+	IdempotencyKeys bool
+	// ChargeIds says approved charges carry a ChargeId of their own, apart
+	// from the PaymentId.
+	ChargeIds bool
+	// Secrets are credentials that must never appear in a RequestPayload.
+	// The card details of Deposit and Withdraw are checked as well.
+	Secrets []string
+}
+
+// contractOptions keep the suite fast: every call gets one retry, after a
+// short delay, and a timeout well above the latency of a local server.
+var contractOptions = Options{
+	Timeout: 500 * time.Millisecond,
+	Retry: httpclient.RetryPolicy{
+		MaxAttempts: 2,
+		BaseDelay:   10 * time.Millisecond,
+		MaxDelay:    10 * time.Millisecond,
+	},
+}
+
+// Run runs the contract suite against the provider of harness.
+func Run(t *testing.T, harness Harness) {
+	t.Run("ChargeApproved", func(t *testing.T) {
+		provider, server := harness.New(t, contractOptions)
+		transaction, err := harness.charge(provider)
+		if err != nil {
+			t.Fatalf("Charge: %v", err)
+		}
+		expectApproved(t, transaction, server)
+		if harness.ChargeIds && transaction.ChargeId == "" {
+			t.Error("approved charge has no ChargeId")
+		}
+	})
+
+	t.Run("WithdrawApproved", func(t *testing.T) {
+		provider, server := harness.New(t, contractOptions)
+		transaction, err := harness.withdraw(provider)
+		if err != nil {
+			t.Fatalf("Withdraw: %v", err)
+		}
+		expectApproved(t, transaction, server)
+	})
+
+	t.Run("ChargeDeclined", func(t *testing.T) {
+		provider, server := harness.New(t, contractOptions)
+		server.Enqueue(fakeproviders.Scenario{Outcome: fakeproviders.Decline, DeclineCode: harness.DeclineCode})
+		transaction, err := harness.charge(provider)
+
+		var declined *errors.ProviderDeclinedError
+		if !stderrors.As(err, &declined) {
+			t.Fatalf("Charge returned %v (%T), want a ProviderDeclinedError", err, err)
+		}
+		if declined.DeclineCode != string(harness.Declined) {
+			t.Errorf("decline error has code %q, want %q", declined.DeclineCode, harness.Declined)
+		}
+		if transaction.Status != "failed" {
+			t.Errorf("declined charge is %s, want failed", transaction.Status)
+		}
+		if transaction.DeclineCode != string(harness.Declined) || transaction.ProviderDeclineCode != harness.DeclineCode {
+			t.Errorf("declined charge has codes %q/%q, want %q/%q",
+				transaction.DeclineCode, transaction.ProviderDeclineCode, harness.Declined, harness.DeclineCode)
+		}
+		if transaction.DeclineRetryable != declined.Retryable {
+			t.Errorf("declined charge is retryable %t, its error %t", transaction.DeclineRetryable, declined.Retryable)
+		}
+		if transaction.PaymentId == "" {
+			t.Error("declined charge has no PaymentId")
+		}
+	})
+
+	t.Run("ServerError", func(t *testing.T) {
+		provider, server := harness.New(t, contractOptions)
+		server.Enqueue(repeat(fakeproviders.Scenario{Outcome: fakeproviders.Fail}, contractOptions.Retry.MaxAttempts)...)
+		transaction, err := harness.charge(provider)
+		expectUnsettled(t, transaction, err)
+		if isTimeout(err) {
+			t.Errorf("server error returned a TimeoutError: %v", err)
+		}
+		expectPayments(t, server, 0)
+	})
+
+	t.Run("NetworkError", func(t *testing.T) {
+		provider, server := harness.New(t, contractOptions)
+		server.Enqueue(repeat(fakeproviders.Scenario{Outcome: fakeproviders.Drop}, contractOptions.Retry.MaxAttempts)...)
+		transaction, err := harness.charge(provider)
+		expectUnsettled(t, transaction, err)
+		if isTimeout(err) {
+			t.Errorf("network error returned a TimeoutError: %v", err)
+		}
+		expectPayments(t, server, 0)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		provider, server := harness.New(t, contractOptions)
+		server.Enqueue(fakeproviders.Scenario{Outcome: fakeproviders.Approve, Delay: 4 * contractOptions.Timeout})
+		transaction, err := harness.charge(provider)
+		expectUnsettled(t, transaction, err)
+		if !isTimeout(err) {
+			t.Errorf("Charge returned %v (%T), want a TimeoutError", err, err)
+		}
+		expectPayments(t, server, 0)
+	})
+
+	t.Run("RetryChargesOnce", func(t *testing.T) {
+		provider, server := harness.New(t, contractOptions)
+		server.Enqueue(fakeproviders.Scenario{Outcome: fakeproviders.Fail})
+		transaction, err := harness.charge(provider)
+		if !harness.IdempotencyKeys {
+			expectUnsettled(t, transaction, err)
+			if transaction.ProviderAttempts != 1 {
+				t.Errorf("failed charge made %d attempts without an idempotency key, want 1", transaction.ProviderAttempts)
+			}
+			expectPayments(t, server, 0)
+			return
+		}
+		if err != nil {
+			t.Fatalf("Charge with an idempotency key was not retried: %v", err)
+		}
+		expectApproved(t, transaction, server)
+		if transaction.ProviderAttempts != 2 {
+			t.Errorf("retried charge made %d attempts, want 2", transaction.ProviderAttempts)
+		}
+	})
+
+	t.Run("MasksRequestPayload", func(t *testing.T) {
+		provider, _ := harness.New(t, contractOptions)
+		charge, _ := harness.charge(provider)
+		withdrawal, _ := harness.withdraw(provider)
+
+		secrets := append([]string{
+			harness.Deposit.CreditCardNumber, harness.Deposit.ExpirationDate, harness.Deposit.CVV,
+			harness.Withdraw.CreditCardNumber, harness.Withdraw.ExpirationDate, harness.Withdraw.CVV,
+		}, harness.Secrets...)
+		for _, transaction := range []entities.Transaction{charge, withdrawal} {
+			if transaction.RequestPayload == nil {
+				t.Errorf("%s has no RequestPayload", transaction.TransactionType)
+				continue
+			}
+			for _, secret := range secrets {
+				if secret != "" && strings.Contains(*transaction.RequestPayload, secret) {
+					t.Errorf("%s RequestPayload contains %q: %s", transaction.TransactionType, secret, *transaction.RequestPayload)
+				}
+			}
+		}
+	})
+}
+
+func (self Harness) charge(provider interfaces.IPaymentProvider) (entities.Transaction, error) {
+	params := self.Deposit
+	params.TransactionId = "contract-deposit"
+	return provider.Charge(context.Background(), params, entities.Transaction{
+		TransactionType: "deposit",
+		TransactionID:   params.TransactionId,
+		Amount:          params.Amount,
+		Currency:        params.Currency,
+		Status:          "pending",
+	})
+}
+
+func (self Harness) withdraw(provider interfaces.IPaymentProvider) (entities.Transaction, error) {
+	params := self.Withdraw
+	params.TransactionId = "contract-withdrawal"
+	return provider.Withdraw(context.Background(), params, entities.Transaction{
+		TransactionType: "withdrawal",
+		TransactionID:   params.TransactionId,
+		Amount:          float64(params.Amount),
+		Currency:        params.Currency,
+		Status:          "pending",
+	})
+}
+
+// expectApproved checks an approved call and that the provider created
+// exactly one payment for it.
+func expectApproved(t *testing.T, transaction entities.Transaction, server Server) {
+	t.Helper()
+	if transaction.Status != "succeeded" && transaction.Status != "pending" {
+		t.Errorf("approved %s is %s, want succeeded or pending", transaction.TransactionType, transaction.Status)
+	}
+	if transaction.PaymentId == "" {
+		t.Errorf("approved %s has no PaymentId", transaction.TransactionType)
+	}
+	if transaction.DeclineCode != "" {
+		t.Errorf("approved %s has decline code %q", transaction.TransactionType, transaction.DeclineCode)
+	}
+	if transaction.RequestPayload == nil || transaction.ResponsePayload == nil {
+		t.Errorf("approved %s is missing its request or response payload", transaction.TransactionType)
+	}
+	if transaction.ProviderAttempts < 1 {
+		t.Errorf("approved %s counts %d attempts", transaction.TransactionType, transaction.ProviderAttempts)
+	}
+	expectPayments(t, server, 1)
+}
+
+// expectUnsettled checks a call that failed without an answer from the
+// provider: it is an error, but not a decline, and the transaction keeps
+// its status.
+func expectUnsettled(t *testing.T, transaction entities.Transaction, err error) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("call succeeded with status %s, want an error", transaction.Status)
+	}
+	var declined *errors.ProviderDeclinedError
+	if stderrors.As(err, &declined) {
+		t.Errorf("call returned a decline: %v", err)
+	}
+	if transaction.Status != "pending" {
+		t.Errorf("transaction is %s, want it left pending", transaction.Status)
+	}
+	if transaction.DeclineCode != "" {
+		t.Errorf("transaction has decline code %q", transaction.DeclineCode)
+	}
+}
+
+func isTimeout(err error) bool {
+	var timeout *errors.TimeoutError
+	return stderrors.As(err, &timeout)
+}
+
+func expectPayments(t *testing.T, server Server, want int) {
+	t.Helper()
+	if payments := server.Payments(); payments != want {
+		t.Errorf("server created %d payments, want %d", payments, want)
+	}
+}
+
+func repeat(scenario fakeproviders.Scenario, count int) []fakeproviders.Scenario {
+	scenarios := make([]fakeproviders.Scenario, count)
+	for i := range scenarios {
+		scenarios[i] = scenario
+	}
+	return scenarios
+}
@@ -1,26 +1,57 @@
 package providers
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/stripe/stripe-go"
-	"github.com/stripe/stripe-go/paymentintent"
-	"github.com/stripe/stripe-go/payout"
-	"payment-service/app"
+	"github.com/stripe/stripe-go/client"
+	"net/http"
+	"payment-service/app/httpclient"
+	"payment-service/app/logger"
+	"payment-service/app/redaction"
+	"payment-service/domain/cards"
+	"payment-service/domain/declines"
 	"payment-service/domain/entities"
+	"payment-service/domain/money"
 	"payment-service/domain/types"
 	"payment-service/errors"
+	"strconv"
 	"time"
 )
 
+// StripePaymentProvider acts for one Stripe account through its own API
+// client, so requests for different merchants never share the global
+// stripe.Key. Every call runs with the caller's context, bounded by timeout,
+// and failed requests are retried by the shared provider HTTP client.
 type StripePaymentProvider struct {
+	client  *client.API
+	timeout time.Duration
+	logger  *logger.Logger
 }
 
-func NewStripePaymentProvider() *StripePaymentProvider {
-	return &StripePaymentProvider{}
+func NewStripePaymentProvider(config types.ProviderConfig, log *logger.Logger) *StripePaymentProvider {
+	httpClient := newHttpClient("stripe", config.StripeRetry, log)
+	backends := stripe.NewBackends(httpClient)
+	if config.StripeBaseUrl != "" {
+		backends.API = stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{
+			HTTPClient: httpClient,
+			URL:        config.StripeBaseUrl,
+		})
+	}
+	return &StripePaymentProvider{
+		client:  client.New(config.Credentials.StripeSecretKey, backends),
+		timeout: config.StripeTimeout,
+		logger:  log,
+	}
 }
 
-func (self *StripePaymentProvider) Charge(params types.DepositParams, transaction entities.Transaction) (entities.Transaction, error) {
-	stripe.Key = app.App().Config().GetString("payment.stripe_secret_key")
+// Charge creates and confirms a PaymentIntent. The request carries the
+// transaction id as its idempotency key, so it is safe to retry.
+func (self *StripePaymentProvider) Charge(ctx context.Context, params types.DepositParams, transaction entities.Transaction) (entities.Transaction, error) {
+	ctx, cancel := withTimeout(ctx, self.timeout)
+	defer cancel()
+	ctx = httpclient.WithAttempts(ctx)
+
 	stripeParams := &stripe.PaymentIntentParams{
 		Amount:   stripe.Int64(int64(params.Amount)),
 		Currency: stripe.String(params.Currency),
@@ -28,56 +59,89 @@ func (self *StripePaymentProvider) Charge(params types.DepositParams, transactio
 	}
 	stripeParams.SetIdempotencyKey(params.TransactionId)
 
-	maskedRequest := stripeParams
-	stripeParamsJson, _ := json.Marshal(maskedRequest)
-	stripeParamsStr := string(stripeParamsJson)
-	transaction.RequestPayload = &stripeParamsStr
-
-	stripeParams.PaymentMethod = stripe.String(params.Token)
-
-	var paymentIntent *stripe.PaymentIntent
-	var err error
-	attempts := 3
-	sleep := 2 * time.Second
-
-	for i := 0; i < attempts; i++ {
-		paymentIntent, err = paymentintent.New(stripeParams)
-		if err == nil {
-			break
-		}
-		if stripeErr, ok := err.(*stripe.Error); ok {
-			if !isRetryable(stripeErr) {
-				break
-			}
-		} else {
-			break
+	paymentMethod := params.Token
+	if paymentMethod == "" {
+		var err error
+		paymentMethod, err = self.cardPaymentMethod(ctx, params, &transaction)
+		transaction.ProviderAttempts = httpclient.Attempts(ctx)
+		if err != nil {
+			return transaction, err
 		}
-
-		time.Sleep(sleep)
-		sleep = sleep * 2
 	}
+	stripeParams.PaymentMethod = stripe.String(paymentMethod)
+
+	stripeParamsJson, _ := json.Marshal(stripeParams)
+	stripeParamsStr := redaction.Redact(string(stripeParamsJson))
+	transaction.RequestPayload = &stripeParamsStr
+	stripeParams.Context = ctx
+
+	paymentIntent, err := self.client.PaymentIntents.New(stripeParams)
+	transaction.ProviderAttempts = httpclient.Attempts(ctx)
 	if err != nil {
-		app.App().Logger().Error("failed to create payment intent: ", err.Error())
-		var paymentError types.PaymentIntentError
-		json.Unmarshal([]byte(err.Error()), &paymentError)
-		transaction.ChargeId = paymentError.Charge
-		transaction.PaymentId = paymentError.PaymentIntent.ID
-		return transaction, &errors.ValidationError{
-			Message: paymentError.Message,
+		self.logger.FromContext(ctx).Error("failed to create payment intent: ", err.Error())
+		if !isStripeRequestError(err) {
+			return transaction, providerError(ctx, &errors.InternalServerError{
+				Message: "failed to create payment intent: " + err.Error(),
+			})
 		}
+		return transaction, providerError(ctx, stripeRequestError(err.(*stripe.Error), &transaction))
 	}
 	transaction.PaymentId = paymentIntent.ID
+	if paymentIntent.Charges != nil {
+		for _, intentCharge := range paymentIntent.Charges.Data {
+			transaction.ChargeId = intentCharge.ID
+		}
+	}
 	paymentIntentJson, _ := json.Marshal(paymentIntent)
 	paymentIntentStr := string(paymentIntentJson)
 	transaction.ResponsePayload = &paymentIntentStr
 
-	app.App().Logger().Info("payment intent created: ", paymentIntent)
+	self.logger.FromContext(ctx).Info("payment intent created: ", paymentIntent)
 
 	return transaction, nil
 }
 
-func (self *StripePaymentProvider) Withdraw(params types.WithdrawParams, transaction entities.Transaction) (entities.Transaction, error) {
-	stripe.Key = app.App().Config().GetString("payment.stripe_secret_key")
+// cardPaymentMethod creates a PaymentMethod from the card details of
+// params and returns its id. It is keyed on the transaction id like the
+// PaymentIntent, so a retried deposit reuses the PaymentMethod. A declined
+// card fails transaction.
+func (self *StripePaymentProvider) cardPaymentMethod(ctx context.Context, params types.DepositParams, transaction *entities.Transaction) (string, error) {
+	month, year, ok := cards.ParseExpiry(params.ExpirationDate)
+	if !ok {
+		return "", &errors.ValidationError{
+			Message: "invalid card expiration date",
+		}
+	}
+	methodParams := &stripe.PaymentMethodParams{
+		Type: stripe.String(string(stripe.PaymentMethodTypeCard)),
+		Card: &stripe.PaymentMethodCardParams{
+			Number:   stripe.String(params.CreditCardNumber),
+			ExpMonth: stripe.String(strconv.Itoa(month)),
+			ExpYear:  stripe.String(strconv.Itoa(year)),
+			CVC:      stripe.String(params.CVV),
+		},
+	}
+	methodParams.SetIdempotencyKey("payment-method-" + params.TransactionId)
+	methodParams.Context = ctx
+
+	paymentMethod, err := self.client.PaymentMethods.New(methodParams)
+	if err != nil {
+		self.logger.FromContext(ctx).Error("failed to create payment method: ", err.Error())
+		if !isStripeRequestError(err) {
+			return "", providerError(ctx, &errors.InternalServerError{
+				Message: "failed to create payment method: " + err.Error(),
+			})
+		}
+		return "", providerError(ctx, stripeRequestError(err.(*stripe.Error), transaction))
+	}
+	return paymentMethod.ID, nil
+}
+
+func (self *StripePaymentProvider) Withdraw(ctx context.Context, params types.WithdrawParams, transaction entities.Transaction) (entities.Transaction, error) {
+	ctx, cancel := withTimeout(ctx, self.timeout)
+	defer cancel()
+	ctx = httpclient.WithAttempts(ctx)
+
 	payoutParams := &stripe.PayoutParams{
 		Amount:      stripe.Int64(params.Amount),
 		Currency:    stripe.String(params.Currency),
@@ -85,40 +149,213 @@ func (self *StripePaymentProvider) Withdraw(params types.WithdrawParams, transac
 	}
 	payoutParams.SetIdempotencyKey(params.TransactionId)
 
-	maskedRequest := payoutParams
-	stripeParamsJson, _ := json.Marshal(maskedRequest)
-	stripeParamsStr := string(stripeParamsJson)
+	stripeParamsJson, _ := json.Marshal(payoutParams)
+	stripeParamsStr := redaction.Redact(string(stripeParamsJson))
 	transaction.RequestPayload = &stripeParamsStr
+	payoutParams.Context = ctx
 
-	payoutParams.Destination = stripe.String(params.Destination)
-
-	payout, err := payout.New(payoutParams)
+	payout, err := self.client.Payouts.New(payoutParams)
+	transaction.ProviderAttempts = httpclient.Attempts(ctx)
 
 	if err != nil {
-		app.App().Logger().Error("failed to create payout: ", err.Error())
-		var paymentError types.PaymentIntentError
-		json.Unmarshal([]byte(err.Error()), &paymentError)
-		transaction.ChargeId = paymentError.Charge
-		transaction.PaymentId = paymentError.PaymentIntent.ID
-		return transaction, &errors.ValidationError{
-			Message: paymentError.Message,
+		self.logger.FromContext(ctx).Error("failed to create payout: ", err.Error())
+		if !isStripeRequestError(err) {
+			return transaction, providerError(ctx, &errors.InternalServerError{
+				Message: "failed to create payout: " + err.Error(),
+			})
 		}
+		return transaction, providerError(ctx, stripeRequestError(err.(*stripe.Error), &transaction))
 	}
 	transaction.PaymentId = payout.ID
 	payoutJson, _ := json.Marshal(payout)
 	payoutStr := string(payoutJson)
 	transaction.ResponsePayload = &payoutStr
 
-	app.App().Logger().Info("payout created: ", payoutStr)
+	self.logger.FromContext(ctx).Info("payout created: ", payoutStr)
+
+	return transaction, nil
+}
+
+// ApplyFees reads the fee and net amount from the balance transaction of the
+// transaction's latest charge. Stripe reports them in minor units of the
+// settlement currency; they are stored in major units, like every provider's
+// fees.
+func (self *StripePaymentProvider) ApplyFees(ctx context.Context, transaction entities.Transaction) (entities.Transaction, error) {
+	if transaction.ChargeId == "" {
+		return transaction, nil
+	}
+	ctx, cancel := withTimeout(ctx, self.timeout)
+	defer cancel()
+
+	chargeParams := &stripe.ChargeParams{}
+	chargeParams.Context = ctx
+	chargeParams.AddExpand("balance_transaction")
+
+	latestCharge, err := self.client.Charges.Get(transaction.ChargeId, chargeParams)
+	if err != nil {
+		self.logger.FromContext(ctx).Error("failed to get charge balance transaction: ", err.Error())
+		return transaction, providerError(ctx, &errors.InternalServerError{
+			Message: "failed to get charge balance transaction: " + err.Error(),
+		})
+	}
+
+	balanceTransaction := latestCharge.BalanceTransaction
+	if balanceTransaction == nil {
+		return transaction, nil
+	}
+
+	settlementCurrency := string(balanceTransaction.Currency)
+	fee := money.ToMajor(float64(balanceTransaction.Fee), settlementCurrency)
+	net := money.ToMajor(float64(balanceTransaction.Net), settlementCurrency)
+	transaction.FeeAmount = &fee
+	transaction.NetAmount = &net
+	transaction.SettlementCurrency = settlementCurrency
 
 	return transaction, nil
 }
 
-func isRetryable(err *stripe.Error) bool {
-	switch err.Code {
-	case stripe.ErrorCodeRateLimit, stripe.ErrorCodeLockTimeout:
-		return true
+// FetchStatus maps the current PaymentIntent (deposits) or Payout
+// (withdrawals) status onto the transaction.
+func (self *StripePaymentProvider) FetchStatus(ctx context.Context, transaction entities.Transaction) (entities.Transaction, error) {
+	if transaction.PaymentId == "" {
+		return transaction, &errors.ValidationError{
+			Message: "transaction has no payment id",
+		}
+	}
+	ctx, cancel := withTimeout(ctx, self.timeout)
+	defer cancel()
+
+	if transaction.TransactionType == "withdrawal" {
+		stripePayout, err := self.client.Payouts.Get(transaction.PaymentId, &stripe.PayoutParams{Params: stripe.Params{Context: ctx}})
+		if err != nil {
+			self.logger.FromContext(ctx).Error("failed to get payout: ", err.Error())
+			return transaction, providerError(ctx, &errors.InternalServerError{
+				Message: "failed to get payout: " + err.Error(),
+			})
+		}
+		switch stripePayout.Status {
+		case stripe.PayoutStatusPaid:
+			transaction.Status = "succeeded"
+		case stripe.PayoutStatusFailed, stripe.PayoutStatusCanceled:
+			transaction.Status = "failed"
+		default:
+			transaction.Status = "pending"
+		}
+		return transaction, nil
+	}
+
+	paymentIntent, err := self.client.PaymentIntents.Get(transaction.PaymentId, &stripe.PaymentIntentParams{Params: stripe.Params{Context: ctx}})
+	if err != nil {
+		self.logger.FromContext(ctx).Error("failed to get payment intent: ", err.Error())
+		return transaction, providerError(ctx, &errors.InternalServerError{
+			Message: "failed to get payment intent: " + err.Error(),
+		})
+	}
+	switch paymentIntent.Status {
+	case stripe.PaymentIntentStatusSucceeded:
+		transaction.Status = "succeeded"
+		if paymentIntent.Charges != nil {
+			for _, intentCharge := range paymentIntent.Charges.Data {
+				transaction.ChargeId = intentCharge.ID
+				if intentCharge.Refunded {
+					transaction.Status = "refunded"
+				}
+			}
+		}
+	case stripe.PaymentIntentStatusCanceled, stripe.PaymentIntentStatusRequiresPaymentMethod:
+		transaction.Status = "failed"
 	default:
-		return false
+		transaction.Status = "pending"
+	}
+	return transaction, nil
+}
+
+// Refund refunds amount of a deposit, in Stripe's minor units, and adds it
+// to RefundedAmount. The idempotency key includes the amount refunded
+// before and the amount, so a retry of the same refund is answered once
+// while each further partial refund is a new refund.
+func (self *StripePaymentProvider) Refund(ctx context.Context, transaction entities.Transaction, amount float64) (entities.Transaction, error) {
+	if transaction.TransactionType != "deposit" {
+		return transaction, &errors.ValidationError{
+			Message: "only deposits can be refunded",
+		}
+	}
+	ctx, cancel := withTimeout(ctx, self.timeout)
+	defer cancel()
+
+	refundParams := &stripe.RefundParams{
+		PaymentIntent: stripe.String(transaction.PaymentId),
+		Amount:        stripe.Int64(int64(amount)),
+	}
+	refundParams.SetIdempotencyKey("refund-" + transaction.TransactionID + "-" +
+		strconv.FormatInt(int64(transaction.RefundedAmount), 10) + "-" + strconv.FormatInt(int64(amount), 10))
+	refundParams.Context = ctx
+
+	stripeRefund, err := self.client.Refunds.New(refundParams)
+	if err != nil {
+		self.logger.FromContext(ctx).Error("failed to create refund: ", err.Error())
+		return transaction, providerError(ctx, &errors.ValidationError{
+			Message: "failed to create refund: " + err.Error(),
+		})
+	}
+
+	refundJson, _ := json.Marshal(stripeRefund)
+	refundStr := string(refundJson)
+	transaction.ResponsePayload = &refundStr
+	if stripeRefund.Charge != nil {
+		transaction.ChargeId = stripeRefund.Charge.ID
+	}
+	transaction.RefundedAmount += amount
+	if int64(transaction.RefundedAmount) < int64(transaction.Amount) {
+		transaction.Status = "partially_refunded"
+	} else {
+		transaction.Status = "refunded"
+	}
+	return transaction, nil
+}
+
+// isStripeRequestError reports whether err is Stripe's answer to the request
+// itself, such as a declined card or an invalid parameter, as opposed to a
+// network error or a failure on Stripe's side.
+func isStripeRequestError(err error) bool {
+	stripeErr, ok := err.(*stripe.Error)
+	return ok && stripeErr.HTTPStatusCode < http.StatusInternalServerError
+}
+
+// stripeRequestError converts Stripe's refusal of a charge or payout. Card
+// errors are declines: the transaction fails with the normalized decline
+// code. Anything else is a request Stripe rejected.
+func stripeRequestError(stripeErr *stripe.Error, transaction *entities.Transaction) error {
+	transaction.ChargeId = stripeErr.ChargeID
+	if stripeErr.PaymentIntent != nil {
+		transaction.PaymentId = stripeErr.PaymentIntent.ID
+	}
+	if stripeErr.Type != stripe.ErrorTypeCard {
+		return &errors.ValidationError{
+			Message: stripeErr.Msg,
+		}
+	}
+
+	decline := declines.FromStripe(stripeDeclineCode(stripeErr), string(stripeErr.Code))
+	decline.Apply(transaction)
+	transaction.Status = "failed"
+	return decline.Error(stripeErr.Msg)
+}
+
+// stripeDeclineCode returns the decline_code of a card error. stripe-go
+// parses it into the CardError in Err rather than into the Error itself.
+func stripeDeclineCode(stripeErr *stripe.Error) string {
+	if cardErr, ok := stripeErr.Err.(*stripe.CardError); ok && cardErr.DeclineCode != "" {
+		return string(cardErr.DeclineCode)
 	}
+	return string(stripeErr.DeclineCode)
+}
+
+// CheckConnection reads the account balance, the cheapest authenticated call.
+func (self *StripePaymentProvider) CheckConnection(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx, self.timeout)
+	defer cancel()
+
+	_, err := self.client.Balance.Get(&stripe.BalanceParams{Params: stripe.Params{Context: ctx}})
+	return providerError(ctx, err)
 }
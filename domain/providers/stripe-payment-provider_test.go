@@ -0,0 +1,104 @@
+package providers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"payment-service/domain/entities"
+	"payment-service/domain/providers/fakeproviders"
+	"payment-service/domain/types"
+)
+
+func TestStripeRefundsArePartialUntilTheAmountIsRefunded(t *testing.T) {
+	server := fakeproviders.NewStripeServer(fakeproviders.StripeOptions{SecretKey: contractStripeKey})
+	defer server.Close()
+	provider := NewStripePaymentProvider(types.ProviderConfig{
+		Credentials:   types.MerchantCredentials{StripeSecretKey: contractStripeKey},
+		StripeBaseUrl: server.URL,
+	}, testLogger)
+
+	ctx := context.Background()
+	transaction, err := provider.Charge(ctx, types.DepositParams{TransactionId: "refund-amounts", Amount: 1000, Currency: "usd", Token: "pm_card_visa"},
+		entities.Transaction{TransactionID: "refund-amounts", TransactionType: "deposit", Amount: 1000, Currency: "usd"})
+	if err != nil {
+		t.Fatalf("Charge: %v", err)
+	}
+
+	first, err := provider.Refund(ctx, transaction, 300)
+	if err != nil {
+		t.Fatalf("first refund: %v", err)
+	}
+	// A retry of the same refund, from the same stored state, is replayed.
+	if _, err := provider.Refund(ctx, transaction, 300); err != nil {
+		t.Fatalf("retried refund: %v", err)
+	}
+	second, err := provider.Refund(ctx, first, 300)
+	if err != nil {
+		t.Fatalf("second refund of the same amount: %v", err)
+	}
+	last, err := provider.Refund(ctx, second, 400)
+	if err != nil {
+		t.Fatalf("last refund: %v", err)
+	}
+
+	for _, step := range []struct {
+		name     string
+		refunded entities.Transaction
+		amount   float64
+		status   string
+	}{
+		{"first", first, 300, "partially_refunded"},
+		{"second", second, 600, "partially_refunded"},
+		{"last", last, 1000, "refunded"},
+	} {
+		if step.refunded.RefundedAmount != step.amount || step.refunded.Status != step.status {
+			t.Errorf("after the %s refund: refunded %v and %s, want %v and %s", step.name, step.refunded.RefundedAmount, step.refunded.Status, step.amount, step.status)
+		}
+	}
+
+	charge, err := provider.client.Charges.Get(transaction.ChargeId, nil)
+	if err != nil {
+		t.Fatalf("get charge: %v", err)
+	}
+	if charge.AmountRefunded != 1000 || !charge.Refunded {
+		t.Errorf("charge refunded %d (refunded %t), want the whole 1000 once", charge.AmountRefunded, charge.Refunded)
+	}
+}
+
+func TestStripeChargesCardDetails(t *testing.T) {
+	server := fakeproviders.NewStripeServer(fakeproviders.StripeOptions{SecretKey: contractStripeKey})
+	defer server.Close()
+	server.Script("4000000000000002", fakeproviders.Scenario{Outcome: fakeproviders.Decline, DeclineCode: "card_declined"})
+	provider := NewStripePaymentProvider(types.ProviderConfig{
+		Credentials:   types.MerchantCredentials{StripeSecretKey: contractStripeKey},
+		StripeBaseUrl: server.URL,
+	}, testLogger)
+
+	tests := []struct {
+		name   string
+		number string
+		status string
+	}{
+		{"approved", "4242424242424242", ""},
+		{"declined", "4000000000000002", "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := types.DepositParams{TransactionId: "card-" + tt.name, Amount: 1000, Currency: "usd",
+				CreditCardNumber: tt.number, ExpirationDate: "2030-12", CVV: "123"}
+			transaction, err := provider.Charge(context.Background(), params,
+				entities.Transaction{TransactionID: params.TransactionId, TransactionType: "deposit", Amount: 1000, Currency: "usd"})
+			if (err != nil) != (tt.status == "failed") || transaction.Status != tt.status {
+				t.Fatalf("Charge: status %q and error %v, want status %q", transaction.Status, err, tt.status)
+			}
+			intent, ok := server.PaymentIntent(transaction.PaymentId)
+			if !ok || intent.Amount != 1000 {
+				t.Errorf("payment intent %q charged %d, want 1000", transaction.PaymentId, intent.Amount)
+			}
+			if transaction.RequestPayload == nil || strings.Contains(*transaction.RequestPayload, tt.number) {
+				t.Errorf("request payload %v holds the card number", transaction.RequestPayload)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"payment-service/app/encryption"
+	"payment-service/domain/entities"
+	"time"
+)
+
+// ApiKeyRepository stores API keys and the nonces of signed requests.
+// GormApiKeyRepository is the database implementation;
+// MemoryApiKeyRepository keeps them in memory for tests.
+type ApiKeyRepository interface {
+	SaveApiKey(ctx context.Context, apiKey entities.ApiKey) (entities.ApiKey, error)
+	// GetApiKeyByPrefix and GetApiKeyById return nil when no key matches.
+	GetApiKeyByPrefix(ctx context.Context, prefix string) (*entities.ApiKey, error)
+	GetApiKeyById(ctx context.Context, id uint) (*entities.ApiKey, error)
+	ListApiKeys(ctx context.Context, merchantId *uint) ([]entities.ApiKey, error)
+	ListApiKeysForReencryption(ctx context.Context, keyId string) ([]entities.ApiKey, error)
+	Reencrypt(ctx context.Context, apiKey entities.ApiKey) error
+	RevokeApiKey(ctx context.Context, id uint, revokedAt time.Time) error
+	TouchApiKey(ctx context.Context, id uint, usedAt time.Time, interval time.Duration) error
+	SaveNonce(ctx context.Context, apiKeyId uint, nonce string, usedAt time.Time) (bool, error)
+	DeleteNoncesBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// GormApiKeyRepository stores API keys with their signing secrets encrypted
+// and returns them decrypted.
+type GormApiKeyRepository struct {
+	db      *gorm.DB
+	keyring *encryption.Keyring
+}
+
+func NewApiKeyRepository(db *gorm.DB, keyring *encryption.Keyring) *GormApiKeyRepository {
+	return &GormApiKeyRepository{
+		db:      db,
+		keyring: keyring,
+	}
+}
+
+// SaveApiKey encrypts the signing secret before saving. It fails when a
+// secret is set and no master key is configured, since secrets must never
+// be stored in plaintext.
+func (self *GormApiKeyRepository) SaveApiKey(ctx context.Context, apiKey entities.ApiKey) (entities.ApiKey, error) {
+	encrypted := apiKey
+	if apiKey.SigningSecret != nil {
+		if !self.keyring.Enabled() {
+			return apiKey, errors.New("an encryption master key is required to store api key signing secrets")
+		}
+		if err := encryptFields(self.keyring, &encrypted.EncryptedDataKey, &encrypted.EncryptionKeyId, &encrypted.SigningSecret); err != nil {
+			return apiKey, err
+		}
+	}
+
+	res := self.db.WithContext(ctx).Save(&encrypted)
+	apiKey.ID = encrypted.ID
+	apiKey.CreatedAt = encrypted.CreatedAt
+	apiKey.UpdatedAt = encrypted.UpdatedAt
+	apiKey.EncryptedDataKey = encrypted.EncryptedDataKey
+	apiKey.EncryptionKeyId = encrypted.EncryptionKeyId
+	return apiKey, res.Error
+}
+
+func (self *GormApiKeyRepository) GetApiKeyByPrefix(ctx context.Context, prefix string) (*entities.ApiKey, error) {
+	var apiKey entities.ApiKey
+
+	res := self.db.WithContext(ctx).Model(&entities.ApiKey{}).
+		Where("prefix = ?", prefix).
+		First(&apiKey)
+
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, res.Error
+	}
+
+	if err := decryptFields(self.keyring, apiKey.EncryptedDataKey, apiKey.EncryptionKeyId, &apiKey.SigningSecret); err != nil {
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+func (self *GormApiKeyRepository) GetApiKeyById(ctx context.Context, id uint) (*entities.ApiKey, error) {
+	var apiKey entities.ApiKey
+
+	res := self.db.WithContext(ctx).Model(&entities.ApiKey{}).
+		Where("id = ?", id).
+		First(&apiKey)
+
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, res.Error
+	}
+
+	if err := decryptFields(self.keyring, apiKey.EncryptedDataKey, apiKey.EncryptionKeyId, &apiKey.SigningSecret); err != nil {
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+// ListApiKeys returns the keys of one merchant, or every key when
+// merchantId is nil, with their signing secrets left encrypted.
+func (self *GormApiKeyRepository) ListApiKeys(ctx context.Context, merchantId *uint) ([]entities.ApiKey, error) {
+	var apiKeys []entities.ApiKey
+
+	query := self.db.WithContext(ctx).Model(&entities.ApiKey{})
+	if merchantId != nil {
+		query = query.Where("merchant_id = ?", *merchantId)
+	}
+	res := query.Order("id").Find(&apiKeys)
+	return apiKeys, res.Error
+}
+
+// ListApiKeysForReencryption returns keys whose signing secret is stored
+// in plaintext or whose data key is not under the master key keyId.
+func (self *GormApiKeyRepository) ListApiKeysForReencryption(ctx context.Context, keyId string) ([]entities.ApiKey, error) {
+	var apiKeys []entities.ApiKey
+
+	res := self.db.WithContext(ctx).Model(&entities.ApiKey{}).
+		Where("signing_secret IS NOT NULL").
+		Where("encrypted_data_key IS NULL OR encryption_key_id <> ?", keyId).
+		Order("id").
+		Find(&apiKeys)
+
+	return apiKeys, res.Error
+}
+
+// Reencrypt encrypts a plaintext signing secret, or rewraps the key's data
+// key with the active master key, without touching updated_at.
+func (self *GormApiKeyRepository) Reencrypt(ctx context.Context, apiKey entities.ApiKey) error {
+	if err := encryptFields(self.keyring, &apiKey.EncryptedDataKey, &apiKey.EncryptionKeyId, &apiKey.SigningSecret); err != nil {
+		return err
+	}
+
+	return self.db.WithContext(ctx).Model(&entities.ApiKey{}).
+		Where("id = ?", apiKey.ID).
+		UpdateColumns(map[string]interface{}{
+			"signing_secret":     apiKey.SigningSecret,
+			"encrypted_data_key": apiKey.EncryptedDataKey,
+			"encryption_key_id":  apiKey.EncryptionKeyId,
+		}).Error
+}
+
+// RevokeApiKey sets revoked_at without rewriting the signing secret, so
+// keys can be revoked whether or not a master key is configured.
+func (self *GormApiKeyRepository) RevokeApiKey(ctx context.Context, id uint, revokedAt time.Time) error {
+	return self.db.WithContext(ctx).Model(&entities.ApiKey{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"revoked_at": revokedAt}).Error
+}
+
+// TouchApiKey records a use of the key. Uses within interval of the last
+// recorded one are not written, so busy keys do not update their row on
+// every request.
+func (self *GormApiKeyRepository) TouchApiKey(ctx context.Context, id uint, usedAt time.Time, interval time.Duration) error {
+	return self.db.WithContext(ctx).Model(&entities.ApiKey{}).
+		Where("id = ?", id).
+		Where("last_used_at IS NULL OR last_used_at <= ?", usedAt.Add(-interval)).
+		UpdateColumn("last_used_at", usedAt).Error
+}
+
+// SaveNonce stores a request nonce used at usedAt. It returns false when
+// the nonce was already used by the same key.
+func (self *GormApiKeyRepository) SaveNonce(ctx context.Context, apiKeyId uint, nonce string, usedAt time.Time) (bool, error) {
+	res := self.db.WithContext(ctx).Exec(
+		"INSERT INTO api_request_nonces (api_key_id, nonce, created_at) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+		apiKeyId, nonce, usedAt,
+	)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+func (self *GormApiKeyRepository) DeleteNoncesBefore(ctx context.Context, before time.Time) (int64, error) {
+	res := self.db.WithContext(ctx).Where("created_at < ?", before).Delete(&entities.ApiRequestNonce{})
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,213 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"payment-service/app/clock"
+	"payment-service/app/encryption"
+	"payment-service/domain/entities"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryApiKeyRepository keeps API keys and request nonces in memory, for
+// tests. Like GormApiKeyRepository it stores signing secrets encrypted with
+// keyring and returns them decrypted, so key rotation can be tested against
+// it. Rows are stamped with clock. It is safe for concurrent use.
+type MemoryApiKeyRepository struct {
+	mutex   sync.Mutex
+	keyring *encryption.Keyring
+	clock   clock.Clock
+	apiKeys map[uint]entities.ApiKey
+	nonces  map[uint]map[string]time.Time
+	lastId  uint
+}
+
+func NewMemoryApiKeyRepository(keyring *encryption.Keyring, clock clock.Clock) *MemoryApiKeyRepository {
+	return &MemoryApiKeyRepository{
+		keyring: keyring,
+		clock:   clock,
+		apiKeys: map[uint]entities.ApiKey{},
+		nonces:  map[uint]map[string]time.Time{},
+	}
+}
+
+func (self *MemoryApiKeyRepository) SaveApiKey(ctx context.Context, apiKey entities.ApiKey) (entities.ApiKey, error) {
+	encrypted := apiKey
+	if apiKey.SigningSecret != nil {
+		if !self.keyring.Enabled() {
+			return apiKey, errors.New("an encryption master key is required to store api key signing secrets")
+		}
+		if err := encryptFields(self.keyring, &encrypted.EncryptedDataKey, &encrypted.EncryptionKeyId, &encrypted.SigningSecret); err != nil {
+			return apiKey, err
+		}
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for id, stored := range self.apiKeys {
+		if id != encrypted.ID && stored.Prefix == encrypted.Prefix {
+			return apiKey, errors.New("duplicate api key prefix " + encrypted.Prefix)
+		}
+	}
+	now := self.clock.Now()
+	if encrypted.ID == 0 {
+		self.lastId++
+		encrypted.ID = self.lastId
+	} else if encrypted.ID > self.lastId {
+		self.lastId = encrypted.ID
+	}
+	if stored, ok := self.apiKeys[encrypted.ID]; ok {
+		encrypted.CreatedAt = stored.CreatedAt
+	} else if encrypted.CreatedAt.IsZero() {
+		encrypted.CreatedAt = now
+	}
+	encrypted.UpdatedAt = now
+	self.apiKeys[encrypted.ID] = encrypted
+
+	apiKey.ID = encrypted.ID
+	apiKey.CreatedAt = encrypted.CreatedAt
+	apiKey.UpdatedAt = encrypted.UpdatedAt
+	apiKey.EncryptedDataKey = encrypted.EncryptedDataKey
+	apiKey.EncryptionKeyId = encrypted.EncryptionKeyId
+	return apiKey, nil
+}
+
+func (self *MemoryApiKeyRepository) GetApiKeyByPrefix(ctx context.Context, prefix string) (*entities.ApiKey, error) {
+	apiKeys := self.all(func(apiKey entities.ApiKey) bool {
+		return apiKey.Prefix == prefix
+	})
+	if len(apiKeys) == 0 {
+		return nil, nil
+	}
+	return self.decrypted(apiKeys[0])
+}
+
+func (self *MemoryApiKeyRepository) GetApiKeyById(ctx context.Context, id uint) (*entities.ApiKey, error) {
+	apiKeys := self.all(func(apiKey entities.ApiKey) bool {
+		return apiKey.ID == id
+	})
+	if len(apiKeys) == 0 {
+		return nil, nil
+	}
+	return self.decrypted(apiKeys[0])
+}
+
+// ListApiKeys returns the keys of one merchant, or every key when
+// merchantId is nil, with their signing secrets left encrypted.
+func (self *MemoryApiKeyRepository) ListApiKeys(ctx context.Context, merchantId *uint) ([]entities.ApiKey, error) {
+	return self.all(func(apiKey entities.ApiKey) bool {
+		return merchantId == nil || (apiKey.MerchantID != nil && *apiKey.MerchantID == *merchantId)
+	}), nil
+}
+
+func (self *MemoryApiKeyRepository) ListApiKeysForReencryption(ctx context.Context, keyId string) ([]entities.ApiKey, error) {
+	return self.all(func(apiKey entities.ApiKey) bool {
+		return apiKey.SigningSecret != nil && (apiKey.EncryptedDataKey == nil || apiKey.EncryptionKeyId != keyId)
+	}), nil
+}
+
+func (self *MemoryApiKeyRepository) Reencrypt(ctx context.Context, apiKey entities.ApiKey) error {
+	if err := encryptFields(self.keyring, &apiKey.EncryptedDataKey, &apiKey.EncryptionKeyId, &apiKey.SigningSecret); err != nil {
+		return err
+	}
+
+	self.update(apiKey.ID, func(stored *entities.ApiKey) {
+		stored.SigningSecret = apiKey.SigningSecret
+		stored.EncryptedDataKey = apiKey.EncryptedDataKey
+		stored.EncryptionKeyId = apiKey.EncryptionKeyId
+	})
+	return nil
+}
+
+func (self *MemoryApiKeyRepository) RevokeApiKey(ctx context.Context, id uint, revokedAt time.Time) error {
+	self.update(id, func(stored *entities.ApiKey) {
+		stored.RevokedAt = &revokedAt
+		stored.UpdatedAt = self.clock.Now()
+	})
+	return nil
+}
+
+func (self *MemoryApiKeyRepository) TouchApiKey(ctx context.Context, id uint, usedAt time.Time, interval time.Duration) error {
+	self.update(id, func(stored *entities.ApiKey) {
+		if stored.LastUsedAt == nil || !stored.LastUsedAt.After(usedAt.Add(-interval)) {
+			stored.LastUsedAt = &usedAt
+		}
+	})
+	return nil
+}
+
+func (self *MemoryApiKeyRepository) SaveNonce(ctx context.Context, apiKeyId uint, nonce string, usedAt time.Time) (bool, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	nonces, ok := self.nonces[apiKeyId]
+	if !ok {
+		nonces = map[string]time.Time{}
+		self.nonces[apiKeyId] = nonces
+	}
+	if _, used := nonces[nonce]; used {
+		return false, nil
+	}
+	nonces[nonce] = usedAt
+	return true, nil
+}
+
+func (self *MemoryApiKeyRepository) DeleteNoncesBefore(ctx context.Context, before time.Time) (int64, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	var deleted int64
+	for _, nonces := range self.nonces {
+		for nonce, usedAt := range nonces {
+			if usedAt.Before(before) {
+				delete(nonces, nonce)
+				deleted++
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// Stored returns the key with id as it is stored, with its signing secret
+// encrypted.
+func (self *MemoryApiKeyRepository) Stored(id uint) (entities.ApiKey, bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	apiKey, ok := self.apiKeys[id]
+	return apiKey, ok
+}
+
+func (self *MemoryApiKeyRepository) decrypted(apiKey entities.ApiKey) (*entities.ApiKey, error) {
+	if err := decryptFields(self.keyring, apiKey.EncryptedDataKey, apiKey.EncryptionKeyId, &apiKey.SigningSecret); err != nil {
+		return nil, err
+	}
+	return &apiKey, nil
+}
+
+func (self *MemoryApiKeyRepository) update(id uint, change func(stored *entities.ApiKey)) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if stored, ok := self.apiKeys[id]; ok {
+		change(&stored)
+		self.apiKeys[id] = stored
+	}
+}
+
+// all returns the matching keys ordered by id.
+func (self *MemoryApiKeyRepository) all(matches func(apiKey entities.ApiKey) bool) []entities.ApiKey {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	apiKeys := []entities.ApiKey{}
+	for _, apiKey := range self.apiKeys {
+		if matches(apiKey) {
+			apiKeys = append(apiKeys, apiKey)
+		}
+	}
+	sort.Slice(apiKeys, func(i, j int) bool {
+		return apiKeys[i].ID < apiKeys[j].ID
+	})
+	return apiKeys
+}
@@ -0,0 +1,137 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"payment-service/app/clock"
+	"payment-service/app/encryption"
+	"payment-service/domain/entities"
+	"sort"
+	"sync"
+)
+
+// MemoryMerchantRepository keeps merchants in memory, for tests. Like
+// GormMerchantRepository it stores credentials encrypted with keyring and
+// returns them decrypted. Merchant names are unique and rows are stamped
+// with clock. It is safe for concurrent use.
+type MemoryMerchantRepository struct {
+	mutex     sync.Mutex
+	keyring   *encryption.Keyring
+	clock     clock.Clock
+	merchants map[uint]entities.Merchant
+	lastId    uint
+}
+
+func NewMemoryMerchantRepository(keyring *encryption.Keyring, clock clock.Clock) *MemoryMerchantRepository {
+	return &MemoryMerchantRepository{
+		keyring:   keyring,
+		clock:     clock,
+		merchants: map[uint]entities.Merchant{},
+	}
+}
+
+func (self *MemoryMerchantRepository) SaveMerchant(ctx context.Context, merchant entities.Merchant) (entities.Merchant, error) {
+	encrypted := merchant
+	if merchant.Credentials != nil {
+		if !self.keyring.Enabled() {
+			return merchant, errors.New("an encryption master key is required to store merchant credentials")
+		}
+		if err := encryptFields(self.keyring, &encrypted.EncryptedDataKey, &encrypted.EncryptionKeyId, &encrypted.Credentials); err != nil {
+			return merchant, err
+		}
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for id, stored := range self.merchants {
+		if id != encrypted.ID && stored.Name == encrypted.Name {
+			return merchant, errors.New("duplicate merchant name " + encrypted.Name)
+		}
+	}
+	now := self.clock.Now()
+	if encrypted.ID == 0 {
+		self.lastId++
+		encrypted.ID = self.lastId
+	} else if encrypted.ID > self.lastId {
+		self.lastId = encrypted.ID
+	}
+	if stored, ok := self.merchants[encrypted.ID]; ok {
+		encrypted.CreatedAt = stored.CreatedAt
+	} else if encrypted.CreatedAt.IsZero() {
+		encrypted.CreatedAt = now
+	}
+	encrypted.UpdatedAt = now
+	self.merchants[encrypted.ID] = encrypted
+
+	merchant.ID = encrypted.ID
+	merchant.CreatedAt = encrypted.CreatedAt
+	merchant.UpdatedAt = encrypted.UpdatedAt
+	merchant.EncryptedDataKey = encrypted.EncryptedDataKey
+	merchant.EncryptionKeyId = encrypted.EncryptionKeyId
+	return merchant, nil
+}
+
+func (self *MemoryMerchantRepository) GetMerchantById(ctx context.Context, id uint) (*entities.Merchant, error) {
+	merchant, ok := self.Stored(id)
+	if !ok {
+		return nil, nil
+	}
+	if err := decryptFields(self.keyring, merchant.EncryptedDataKey, merchant.EncryptionKeyId, &merchant.Credentials); err != nil {
+		return nil, err
+	}
+	return &merchant, nil
+}
+
+// ListMerchants returns every merchant with its credentials left encrypted.
+func (self *MemoryMerchantRepository) ListMerchants(ctx context.Context) ([]entities.Merchant, error) {
+	return self.all(func(merchant entities.Merchant) bool {
+		return true
+	}), nil
+}
+
+func (self *MemoryMerchantRepository) ListMerchantsForReencryption(ctx context.Context, keyId string) ([]entities.Merchant, error) {
+	return self.all(func(merchant entities.Merchant) bool {
+		return merchant.EncryptedDataKey != nil && merchant.EncryptionKeyId != keyId
+	}), nil
+}
+
+func (self *MemoryMerchantRepository) Reencrypt(ctx context.Context, merchant entities.Merchant) error {
+	if err := encryptFields(self.keyring, &merchant.EncryptedDataKey, &merchant.EncryptionKeyId); err != nil {
+		return err
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if stored, ok := self.merchants[merchant.ID]; ok {
+		stored.EncryptedDataKey = merchant.EncryptedDataKey
+		stored.EncryptionKeyId = merchant.EncryptionKeyId
+		self.merchants[merchant.ID] = stored
+	}
+	return nil
+}
+
+// Stored returns the merchant with id as it is stored, with its credentials
+// encrypted.
+func (self *MemoryMerchantRepository) Stored(id uint) (entities.Merchant, bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	merchant, ok := self.merchants[id]
+	return merchant, ok
+}
+
+// all returns the matching merchants ordered by id.
+func (self *MemoryMerchantRepository) all(matches func(merchant entities.Merchant) bool) []entities.Merchant {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	merchants := []entities.Merchant{}
+	for _, merchant := range self.merchants {
+		if matches(merchant) {
+			merchants = append(merchants, merchant)
+		}
+	}
+	sort.Slice(merchants, func(i, j int) bool {
+		return merchants[i].ID < merchants[j].ID
+	})
+	return merchants
+}
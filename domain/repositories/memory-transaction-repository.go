@@ -0,0 +1,194 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"payment-service/app/clock"
+	"payment-service/domain/entities"
+	"payment-service/domain/types"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// MemoryTransactionRepository keeps transactions in memory, for tests. It
+// behaves like GormTransactionRepository without encryption: payloads are
+// redacted on save, ids are assigned in order, transaction ids are unique
+// per merchant and lookups that the database would fail with
+// gorm.ErrRecordNotFound fail with it too. Rows are stamped with clock. It is
+// safe for concurrent use.
+type MemoryTransactionRepository struct {
+	mutex        sync.Mutex
+	clock        clock.Clock
+	transactions map[uint]entities.Transaction
+	lastId       uint
+}
+
+func NewMemoryTransactionRepository(clock clock.Clock) *MemoryTransactionRepository {
+	return &MemoryTransactionRepository{
+		clock:        clock,
+		transactions: map[uint]entities.Transaction{},
+	}
+}
+
+func (self *MemoryTransactionRepository) SaveTransaction(ctx context.Context, transaction entities.Transaction) (entities.Transaction, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	if transaction.TransactionID != "" {
+		for id, stored := range self.transactions {
+			if id != transaction.ID && stored.TransactionID == transaction.TransactionID && sameMerchant(stored.MerchantID, transaction.MerchantID) {
+				return transaction, fmt.Errorf("duplicate transaction id %q", transaction.TransactionID)
+			}
+		}
+	}
+
+	now := self.clock.Now()
+	if transaction.ID == 0 {
+		self.lastId++
+		transaction.ID = self.lastId
+	} else if transaction.ID > self.lastId {
+		self.lastId = transaction.ID
+	}
+	if stored, ok := self.transactions[transaction.ID]; ok {
+		transaction.CreatedAt = stored.CreatedAt
+	} else if transaction.CreatedAt.IsZero() {
+		transaction.CreatedAt = now
+	}
+	transaction.UpdatedAt = now
+	redactPayloads(&transaction)
+
+	self.transactions[transaction.ID] = transaction
+	return transaction, nil
+}
+
+func (self *MemoryTransactionRepository) GetTransactionByTransactionId(ctx context.Context, merchantId *uint, transactionId string) (*entities.Transaction, error) {
+	transaction, ok := self.first(func(transaction entities.Transaction) bool {
+		return transaction.TransactionID == transactionId && sameMerchant(transaction.MerchantID, merchantId)
+	})
+	if !ok {
+		return nil, nil
+	}
+	return &transaction, nil
+}
+
+func (self *MemoryTransactionRepository) GetTransactionByChargeId(ctx context.Context, chargeId string) (*entities.Transaction, error) {
+	transaction, ok := self.first(func(transaction entities.Transaction) bool {
+		return transaction.ChargeId == chargeId
+	})
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &transaction, nil
+}
+
+func (self *MemoryTransactionRepository) GetTransactionByPaymentId(ctx context.Context, merchantId *uint, paymentId string) (*entities.Transaction, error) {
+	transaction, ok := self.first(func(transaction entities.Transaction) bool {
+		return transaction.PaymentId == paymentId && sameMerchant(transaction.MerchantID, merchantId)
+	})
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &transaction, nil
+}
+
+func (self *MemoryTransactionRepository) FindTransaction(ctx context.Context, merchantId *uint, id string) (*entities.Transaction, error) {
+	primaryKey, err := strconv.ParseUint(id, 10, 64)
+	isPrimaryKey := err == nil
+	transaction, ok := self.first(func(transaction entities.Transaction) bool {
+		matches := transaction.TransactionID == id || transaction.PaymentId == id || transaction.ChargeId == id ||
+			(isPrimaryKey && uint64(transaction.ID) == primaryKey)
+		return matches && sameMerchant(transaction.MerchantID, merchantId)
+	})
+	if !ok {
+		return nil, nil
+	}
+	return &transaction, nil
+}
+
+func (self *MemoryTransactionRepository) ListTransactions(ctx context.Context, filter types.TransactionFilter) ([]entities.Transaction, error) {
+	transactions := self.all(func(transaction entities.Transaction) bool {
+		switch {
+		case filter.From != nil && transaction.CreatedAt.Before(*filter.From):
+		case filter.To != nil && !transaction.CreatedAt.Before(*filter.To):
+		case filter.Status != "" && transaction.Status != filter.Status:
+		case filter.GatewayName != "" && transaction.GatewayName != filter.GatewayName:
+		case filter.MerchantId != nil && (transaction.MerchantID == nil || *transaction.MerchantID != *filter.MerchantId):
+		default:
+			return true
+		}
+		return false
+	})
+	if filter.Limit > 0 && len(transactions) > filter.Limit {
+		transactions = transactions[:filter.Limit]
+	}
+	return transactions, nil
+}
+
+// ListTransactionsForReencryption returns up to limit transactions after
+// afterId that have payloads and are not recorded under keyId. Nothing is
+// encrypted in memory, so Reencrypt only redacts them.
+func (self *MemoryTransactionRepository) ListTransactionsForReencryption(ctx context.Context, keyId string, afterId uint, limit int) ([]entities.Transaction, error) {
+	transactions := self.all(func(transaction entities.Transaction) bool {
+		hasPayload := transaction.RequestPayload != nil || transaction.ResponsePayload != nil ||
+			transaction.CallbackPayload != nil || transaction.EncryptedDataKey != nil
+		return transaction.ID > afterId && transaction.EncryptionKeyId != keyId && hasPayload
+	})
+	if limit > 0 && len(transactions) > limit {
+		transactions = transactions[:limit]
+	}
+	return transactions, nil
+}
+
+func (self *MemoryTransactionRepository) Reencrypt(ctx context.Context, transaction entities.Transaction) error {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	stored, ok := self.transactions[transaction.ID]
+	if !ok {
+		return nil
+	}
+	redactPayloads(&transaction)
+	stored.RequestPayload = transaction.RequestPayload
+	stored.ResponsePayload = transaction.ResponsePayload
+	stored.CallbackPayload = transaction.CallbackPayload
+	self.transactions[stored.ID] = stored
+	return nil
+}
+
+// first returns the transaction with the lowest id that matches, like the
+// database lookups ordered by id.
+func (self *MemoryTransactionRepository) first(matches func(transaction entities.Transaction) bool) (entities.Transaction, bool) {
+	transactions := self.all(matches)
+	if len(transactions) == 0 {
+		return entities.Transaction{}, false
+	}
+	return transactions[0], true
+}
+
+// all returns the matching transactions ordered by id.
+func (self *MemoryTransactionRepository) all(matches func(transaction entities.Transaction) bool) []entities.Transaction {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	transactions := []entities.Transaction{}
+	for _, transaction := range self.transactions {
+		if matches(transaction) {
+			transactions = append(transactions, transaction)
+		}
+	}
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactions[i].ID < transactions[j].ID
+	})
+	return transactions
+}
+
+// sameMerchant reports whether two merchant ids are equal, where nil is the
+// platform.
+func sameMerchant(a *uint, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
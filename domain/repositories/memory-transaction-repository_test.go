@@ -0,0 +1,145 @@
+package repositories
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"payment-service/app/clock"
+	"payment-service/domain/entities"
+	"payment-service/domain/types"
+)
+
+func TestMemoryTransactionRepositoryConcurrentSaves(t *testing.T) {
+	repository := NewMemoryTransactionRepository(clock.System())
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			transaction, err := repository.SaveTransaction(ctx, entities.Transaction{
+				TransactionID: fmt.Sprintf("tx-%d", i),
+				Status:        "pending",
+			})
+			if err != nil {
+				t.Errorf("saving tx-%d: %v", i, err)
+				return
+			}
+			transaction.Status = "succeeded"
+			if _, err := repository.SaveTransaction(ctx, transaction); err != nil {
+				t.Errorf("updating tx-%d: %v", i, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	transactions, err := repository.ListTransactions(ctx, types.TransactionFilter{Status: "succeeded"})
+	if err != nil {
+		t.Fatalf("ListTransactions: %v", err)
+	}
+	if len(transactions) != 50 {
+		t.Fatalf("listed %d succeeded transactions, want 50", len(transactions))
+	}
+	for i, transaction := range transactions {
+		if transaction.ID != uint(i+1) {
+			t.Fatalf("transaction %d has id %d, want ids 1 to 50 in order", i, transaction.ID)
+		}
+	}
+}
+
+func TestMemoryTransactionRepositoryStampsRowsWithTheClock(t *testing.T) {
+	now := clock.NewFake(time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC))
+	repository := NewMemoryTransactionRepository(now)
+	ctx := context.Background()
+
+	created, err := repository.SaveTransaction(ctx, entities.Transaction{TransactionID: "tx-1", Status: "pending"})
+	if err != nil {
+		t.Fatalf("SaveTransaction: %v", err)
+	}
+	createdAt := now.Now()
+	if !created.CreatedAt.Equal(createdAt) || !created.UpdatedAt.Equal(createdAt) {
+		t.Errorf("created at %s and updated at %s, want both %s", created.CreatedAt, created.UpdatedAt, createdAt)
+	}
+
+	now.Advance(time.Minute)
+	created.Status = "succeeded"
+	updated, err := repository.SaveTransaction(ctx, created)
+	if err != nil {
+		t.Fatalf("SaveTransaction: %v", err)
+	}
+	if !updated.CreatedAt.Equal(createdAt) || !updated.UpdatedAt.Equal(now.Now()) {
+		t.Errorf("created at %s and updated at %s after an update, want %s and %s", updated.CreatedAt, updated.UpdatedAt, createdAt, now.Now())
+	}
+}
+
+func TestMemoryTransactionRepositoryLookups(t *testing.T) {
+	repository := NewMemoryTransactionRepository(clock.System())
+	ctx := context.Background()
+	saved, err := repository.SaveTransaction(ctx, entities.Transaction{
+		TransactionID: "tx-1",
+		PaymentId:     "pi_1",
+		ChargeId:      "ch_1",
+	})
+	if err != nil {
+		t.Fatalf("SaveTransaction: %v", err)
+	}
+
+	if _, err := repository.SaveTransaction(ctx, entities.Transaction{TransactionID: "tx-1"}); err == nil {
+		t.Errorf("saved a second transaction with transaction id tx-1")
+	}
+	merchantId := uint(7)
+	merchantTransaction, err := repository.SaveTransaction(ctx, entities.Transaction{TransactionID: "tx-1", MerchantID: &merchantId})
+	if err != nil {
+		t.Errorf("saving transaction id tx-1 for another merchant: %v", err)
+	}
+	if transaction, err := repository.GetTransactionByTransactionId(ctx, &merchantId, "tx-1"); err != nil || transaction == nil || transaction.ID != merchantTransaction.ID {
+		t.Errorf("GetTransactionByTransactionId of merchant 7 = %v, %v, want transaction %d", transaction, err, merchantTransaction.ID)
+	}
+	if transaction, err := repository.GetTransactionByTransactionId(ctx, nil, "tx-1"); err != nil || transaction == nil || transaction.ID != saved.ID {
+		t.Errorf("GetTransactionByTransactionId of the platform = %v, %v, want transaction %d", transaction, err, saved.ID)
+	}
+
+	for _, id := range []string{"tx-1", "pi_1", "ch_1", fmt.Sprint(saved.ID)} {
+		transaction, err := repository.FindTransaction(ctx, nil, id)
+		if err != nil || transaction == nil || transaction.ID != saved.ID {
+			t.Errorf("FindTransaction(%q) = %v, %v, want transaction %d", id, transaction, err, saved.ID)
+		}
+	}
+	if transaction, err := repository.GetTransactionByPaymentId(ctx, nil, "pi_1"); err != nil || transaction.ID != saved.ID {
+		t.Errorf("GetTransactionByPaymentId of the platform = %v, %v, want transaction %d", transaction, err, saved.ID)
+	}
+
+	// Platform and merchant lookups only see their own transactions.
+	otherMerchantId := uint(8)
+	for _, merchantId := range []*uint{&merchantId, &otherMerchantId} {
+		if transaction, err := repository.FindTransaction(ctx, merchantId, "pi_1"); transaction != nil || err != nil {
+			t.Errorf("FindTransaction of merchant %d found the platform transaction: %v, %v", *merchantId, transaction, err)
+		}
+		if _, err := repository.GetTransactionByPaymentId(ctx, merchantId, "pi_1"); !stderrors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("GetTransactionByPaymentId of merchant %d error %v, want record not found", *merchantId, err)
+		}
+	}
+	if transaction, err := repository.FindTransaction(ctx, &merchantId, fmt.Sprint(merchantTransaction.ID)); err != nil || transaction == nil || transaction.ID != merchantTransaction.ID {
+		t.Errorf("FindTransaction of merchant 7 = %v, %v, want transaction %d", transaction, err, merchantTransaction.ID)
+	}
+	if transaction, err := repository.FindTransaction(ctx, &otherMerchantId, fmt.Sprint(merchantTransaction.ID)); transaction != nil || err != nil {
+		t.Errorf("FindTransaction of merchant 8 found merchant 7's transaction: %v, %v", transaction, err)
+	}
+	if transaction, err := repository.FindTransaction(ctx, nil, fmt.Sprint(merchantTransaction.ID)); transaction != nil || err != nil {
+		t.Errorf("FindTransaction of the platform found merchant 7's transaction: %v, %v", transaction, err)
+	}
+
+	if transaction, err := repository.GetTransactionByTransactionId(ctx, nil, "tx-missing"); transaction != nil || err != nil {
+		t.Errorf("GetTransactionByTransactionId of a missing id = %v, %v, want nil, nil", transaction, err)
+	}
+	if _, err := repository.GetTransactionByPaymentId(ctx, nil, "pi_missing"); !stderrors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetTransactionByPaymentId of a missing id error %v, want record not found", err)
+	}
+}
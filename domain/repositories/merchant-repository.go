@@ -0,0 +1,115 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"payment-service/app/encryption"
+	"payment-service/domain/entities"
+)
+
+// MerchantRepository stores merchants. GormMerchantRepository is the
+// database implementation; MemoryMerchantRepository keeps merchants in
+// memory for tests.
+type MerchantRepository interface {
+	SaveMerchant(ctx context.Context, merchant entities.Merchant) (entities.Merchant, error)
+	// GetMerchantById returns nil when no merchant has the id.
+	GetMerchantById(ctx context.Context, id uint) (*entities.Merchant, error)
+	ListMerchants(ctx context.Context) ([]entities.Merchant, error)
+	ListMerchantsForReencryption(ctx context.Context, keyId string) ([]entities.Merchant, error)
+	Reencrypt(ctx context.Context, merchant entities.Merchant) error
+}
+
+// GormMerchantRepository stores merchants with their credentials encrypted
+// and returns them decrypted.
+type GormMerchantRepository struct {
+	db      *gorm.DB
+	keyring *encryption.Keyring
+}
+
+func NewMerchantRepository(db *gorm.DB, keyring *encryption.Keyring) *GormMerchantRepository {
+	return &GormMerchantRepository{
+		db:      db,
+		keyring: keyring,
+	}
+}
+
+// SaveMerchant encrypts the credentials before saving. It fails when
+// credentials are set and no master key is configured, since they must
+// never be stored in plaintext.
+func (self *GormMerchantRepository) SaveMerchant(ctx context.Context, merchant entities.Merchant) (entities.Merchant, error) {
+	encrypted := merchant
+	if merchant.Credentials != nil {
+		if !self.keyring.Enabled() {
+			return merchant, errors.New("an encryption master key is required to store merchant credentials")
+		}
+		if err := encryptFields(self.keyring, &encrypted.EncryptedDataKey, &encrypted.EncryptionKeyId, &encrypted.Credentials); err != nil {
+			return merchant, err
+		}
+	}
+
+	res := self.db.WithContext(ctx).Save(&encrypted)
+	merchant.ID = encrypted.ID
+	merchant.CreatedAt = encrypted.CreatedAt
+	merchant.UpdatedAt = encrypted.UpdatedAt
+	merchant.EncryptedDataKey = encrypted.EncryptedDataKey
+	merchant.EncryptionKeyId = encrypted.EncryptionKeyId
+	return merchant, res.Error
+}
+
+func (self *GormMerchantRepository) GetMerchantById(ctx context.Context, id uint) (*entities.Merchant, error) {
+	var merchant entities.Merchant
+
+	res := self.db.WithContext(ctx).Model(&entities.Merchant{}).
+		Where("id = ?", id).
+		First(&merchant)
+
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, res.Error
+	}
+
+	if err := decryptFields(self.keyring, merchant.EncryptedDataKey, merchant.EncryptionKeyId, &merchant.Credentials); err != nil {
+		return nil, err
+	}
+	return &merchant, nil
+}
+
+// ListMerchants returns every merchant with its credentials left encrypted;
+// use GetMerchantById to read them.
+func (self *GormMerchantRepository) ListMerchants(ctx context.Context) ([]entities.Merchant, error) {
+	var merchants []entities.Merchant
+	res := self.db.WithContext(ctx).Model(&entities.Merchant{}).Order("id").Find(&merchants)
+	return merchants, res.Error
+}
+
+// ListMerchantsForReencryption returns merchants whose data key is not
+// under the master key keyId.
+func (self *GormMerchantRepository) ListMerchantsForReencryption(ctx context.Context, keyId string) ([]entities.Merchant, error) {
+	var merchants []entities.Merchant
+
+	res := self.db.WithContext(ctx).Model(&entities.Merchant{}).
+		Where("encrypted_data_key IS NOT NULL").
+		Where("encryption_key_id <> ?", keyId).
+		Order("id").
+		Find(&merchants)
+
+	return merchants, res.Error
+}
+
+// Reencrypt rewraps a merchant's data key with the active master key
+// without touching updated_at.
+func (self *GormMerchantRepository) Reencrypt(ctx context.Context, merchant entities.Merchant) error {
+	if err := encryptFields(self.keyring, &merchant.EncryptedDataKey, &merchant.EncryptionKeyId); err != nil {
+		return err
+	}
+
+	return self.db.WithContext(ctx).Model(&entities.Merchant{}).
+		Where("id = ?", merchant.ID).
+		UpdateColumns(map[string]interface{}{
+			"encrypted_data_key": merchant.EncryptedDataKey,
+			"encryption_key_id":  merchant.EncryptionKeyId,
+		}).Error
+}
@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"payment-service/domain/types"
+	"time"
+)
+
+// RateLimitRepository keeps token buckets in Postgres so limits are shared
+// across replicas. Refill and take happen in a single statement.
+type RateLimitRepository struct {
+	db *gorm.DB
+}
+
+func NewRateLimitRepository(db *gorm.DB) *RateLimitRepository {
+	return &RateLimitRepository{
+		db: db,
+	}
+}
+
+const takeTokenQuery = `
+INSERT INTO rate_limit_buckets AS bucket (bucket_key, tokens, updated_at)
+VALUES (@key, CAST(@burst AS DOUBLE PRECISION) - 1, CAST(@now AS TIMESTAMPTZ))
+ON CONFLICT (bucket_key) DO UPDATE SET
+	tokens = LEAST(CAST(@burst AS DOUBLE PRECISION), bucket.tokens + EXTRACT(EPOCH FROM (CAST(@now AS TIMESTAMPTZ) - bucket.updated_at)) * CAST(@rate AS DOUBLE PRECISION)) - 1,
+	updated_at = CAST(@now AS TIMESTAMPTZ)
+WHERE LEAST(CAST(@burst AS DOUBLE PRECISION), bucket.tokens + EXTRACT(EPOCH FROM (CAST(@now AS TIMESTAMPTZ) - bucket.updated_at)) * CAST(@rate AS DOUBLE PRECISION)) >= 1
+RETURNING tokens`
+
+const peekTokensQuery = `
+SELECT LEAST(CAST(@burst AS DOUBLE PRECISION), tokens + EXTRACT(EPOCH FROM (CAST(@now AS TIMESTAMPTZ) - updated_at)) * CAST(@rate AS DOUBLE PRECISION))
+FROM rate_limit_buckets
+WHERE bucket_key = @key`
+
+func (self *RateLimitRepository) Take(ctx context.Context, key string, limit types.RateLimit, now time.Time) (types.RateLimitBucket, error) {
+	args := map[string]interface{}{
+		"key":   key,
+		"burst": float64(limit.Burst),
+		"rate":  limit.TokensPerSecond(),
+		"now":   now.UTC(),
+	}
+
+	var tokens []float64
+	if err := self.db.WithContext(ctx).Raw(takeTokenQuery, args).Scan(&tokens).Error; err != nil {
+		return types.RateLimitBucket{}, err
+	}
+	if len(tokens) == 1 {
+		return types.RateLimitBucket{Tokens: tokens[0], Allowed: true}, nil
+	}
+
+	// The conditional update skipped the row: the bucket is empty.
+	if err := self.db.WithContext(ctx).Raw(peekTokensQuery, args).Scan(&tokens).Error; err != nil {
+		return types.RateLimitBucket{}, err
+	}
+	bucket := types.RateLimitBucket{}
+	if len(tokens) == 1 {
+		bucket.Tokens = tokens[0]
+	}
+	return bucket, nil
+}
+
+func (self *RateLimitRepository) DeleteBucketsBefore(ctx context.Context, before time.Time) (int64, error) {
+	res := self.db.WithContext(ctx).Exec("DELETE FROM rate_limit_buckets WHERE updated_at < ?", before.UTC())
+	return res.RowsAffected, res.Error
+}
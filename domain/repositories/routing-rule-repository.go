@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"payment-service/domain/entities"
+)
+
+type RoutingRuleRepository struct {
+	db *gorm.DB
+}
+
+func NewRoutingRuleRepository(db *gorm.DB) *RoutingRuleRepository {
+	return &RoutingRuleRepository{
+		db: db,
+	}
+}
+
+func (self *RoutingRuleRepository) SaveRoutingRule(ctx context.Context, rule entities.RoutingRule) (entities.RoutingRule, error) {
+	res := self.db.WithContext(ctx).Save(&rule)
+	return rule, res.Error
+}
+
+func (self *RoutingRuleRepository) GetRoutingRuleById(ctx context.Context, id uint) (*entities.RoutingRule, error) {
+	var rule entities.RoutingRule
+
+	res := self.db.WithContext(ctx).Model(&entities.RoutingRule{}).
+		Where("id = ?", id).
+		First(&rule)
+
+	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, res.Error
+	}
+
+	return &rule, nil
+}
+
+// ListRoutingRules returns every rule in evaluation order.
+func (self *RoutingRuleRepository) ListRoutingRules(ctx context.Context) ([]entities.RoutingRule, error) {
+	var rules []entities.RoutingRule
+	res := self.db.WithContext(ctx).Model(&entities.RoutingRule{}).
+		Order("priority, merchant_id NULLS LAST, id").
+		Find(&rules)
+	return rules, res.Error
+}
+
+// ListEnabledRoutingRules returns the enabled rules that apply to merchantId
+// in evaluation order: by priority, with the merchant's own rules before
+// global rules of the same priority.
+func (self *RoutingRuleRepository) ListEnabledRoutingRules(ctx context.Context, merchantId *uint) ([]entities.RoutingRule, error) {
+	var rules []entities.RoutingRule
+
+	query := self.db.WithContext(ctx).Model(&entities.RoutingRule{}).
+		Where("enabled")
+	if merchantId == nil {
+		query = query.Where("merchant_id IS NULL")
+	} else {
+		query = query.Where("merchant_id IS NULL OR merchant_id = ?", *merchantId)
+	}
+
+	res := query.Order("priority, merchant_id NULLS LAST, id").Find(&rules)
+	return rules, res.Error
+}
+
+func (self *RoutingRuleRepository) DeleteRoutingRule(ctx context.Context, id uint) (bool, error) {
+	res := self.db.WithContext(ctx).Delete(&entities.RoutingRule{}, id)
+	return res.RowsAffected > 0, res.Error
+}
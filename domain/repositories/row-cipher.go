@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"payment-service/app/encryption"
+	"payment-service/app/redaction"
+	"payment-service/domain/entities"
+)
+
+// encryptPayloads returns a copy of transaction whose payload columns are
+// encrypted with the row's data key. Without a configured master key the
+// transaction is returned unchanged.
+func encryptPayloads(keyring *encryption.Keyring, transaction entities.Transaction) (entities.Transaction, error) {
+	if !keyring.Enabled() {
+		return transaction, nil
+	}
+
+	err := encryptFields(keyring, &transaction.EncryptedDataKey, &transaction.EncryptionKeyId,
+		&transaction.RequestPayload, &transaction.ResponsePayload, &transaction.CallbackPayload)
+	return transaction, err
+}
+
+// decryptPayloads decrypts the payload columns in place. Plaintext values
+// from rows saved before encryption was enabled are left as they are.
+func decryptPayloads(keyring *encryption.Keyring, transaction *entities.Transaction) error {
+	return decryptFields(keyring, transaction.EncryptedDataKey, transaction.EncryptionKeyId,
+		&transaction.RequestPayload, &transaction.ResponsePayload, &transaction.CallbackPayload)
+}
+
+// redactPayloads masks card data and secrets in the plaintext payload
+// columns, so nothing sensitive is persisted whatever the provider stored.
+func redactPayloads(transaction *entities.Transaction) {
+	for _, payload := range []**string{&transaction.RequestPayload, &transaction.ResponsePayload, &transaction.CallbackPayload} {
+		if *payload == nil || encryption.IsEncrypted(**payload) {
+			continue
+		}
+		redacted := redaction.Redact(**payload)
+		*payload = &redacted
+	}
+}
+
+// encryptFields encrypts fields in place with a row's data key. A row keeps
+// its data key across saves; a new one is created for rows without one, and
+// the data key is rewrapped when it is not under the active master key.
+// Values that are already encrypted are left alone.
+func encryptFields(keyring *encryption.Keyring, encryptedDataKey **string, encryptionKeyId *string, fields ...**string) error {
+	var dataKey []byte
+	var err error
+	if *encryptedDataKey != nil {
+		dataKey, err = keyring.UnwrapDataKey(*encryptionKeyId, **encryptedDataKey)
+		if err != nil {
+			return err
+		}
+		if *encryptionKeyId != keyring.ActiveKeyId() {
+			wrapped, keyId, err := keyring.WrapDataKey(dataKey)
+			if err != nil {
+				return err
+			}
+			*encryptedDataKey = &wrapped
+			*encryptionKeyId = keyId
+		}
+	} else {
+		var wrapped string
+		dataKey, wrapped, *encryptionKeyId, err = keyring.NewDataKey()
+		if err != nil {
+			return err
+		}
+		*encryptedDataKey = &wrapped
+	}
+
+	for _, field := range fields {
+		if *field == nil || encryption.IsEncrypted(**field) {
+			continue
+		}
+		encrypted, err := encryption.Encrypt(dataKey, **field)
+		if err != nil {
+			return err
+		}
+		*field = &encrypted
+	}
+	return nil
+}
+
+// decryptFields decrypts fields in place. Rows without a data key were never
+// encrypted and are left as they are.
+func decryptFields(keyring *encryption.Keyring, encryptedDataKey *string, encryptionKeyId string, fields ...**string) error {
+	if encryptedDataKey == nil {
+		return nil
+	}
+
+	dataKey, err := keyring.UnwrapDataKey(encryptionKeyId, *encryptedDataKey)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		if *field == nil {
+			continue
+		}
+		decrypted, err := encryption.Decrypt(dataKey, **field)
+		if err != nil {
+			return err
+		}
+		*field = &decrypted
+	}
+	return nil
+}
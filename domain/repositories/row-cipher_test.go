@@ -0,0 +1,134 @@
+package repositories
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"payment-service/app/encryption"
+)
+
+// testKeyring returns a keyring with a master key derived from each id,
+// the first one active.
+func testKeyring(t *testing.T, keyIds ...string) *encryption.Keyring {
+	t.Helper()
+	keys := map[string][]byte{}
+	for _, keyId := range keyIds {
+		key := sha256.Sum256([]byte(keyId))
+		keys[keyId] = key[:]
+	}
+	keyring, err := encryption.NewKeyring(keys, keyIds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+func stringPointer(value string) *string {
+	return &value
+}
+
+func TestRowCipherRoundTrip(t *testing.T) {
+	keyring := testKeyring(t, "2026-01")
+	credentials, secret := stringPointer(`{"secretKey":"sk_live_1"}`), stringPointer("whsec_1")
+	var missing *string
+	var encryptedDataKey *string
+	var keyId string
+
+	if err := encryptFields(keyring, &encryptedDataKey, &keyId, &credentials, &secret, &missing); err != nil {
+		t.Fatalf("encryptFields: %v", err)
+	}
+	if encryptedDataKey == nil || keyId != "2026-01" {
+		t.Fatalf("data key wrapped with %q, want a data key under 2026-01", keyId)
+	}
+	if !encryption.IsEncrypted(*credentials) || !encryption.IsEncrypted(*secret) || missing != nil {
+		t.Fatalf("fields after encryptFields: %q, %q, %v", *credentials, *secret, missing)
+	}
+
+	// Saving the row again keeps its data key and leaves encrypted values alone.
+	dataKey, encrypted := *encryptedDataKey, *credentials
+	if err := encryptFields(keyring, &encryptedDataKey, &keyId, &credentials); err != nil {
+		t.Fatalf("encryptFields on an encrypted row: %v", err)
+	}
+	if *encryptedDataKey != dataKey || *credentials != encrypted {
+		t.Error("encrypting an encrypted row changed its data key or values")
+	}
+
+	if err := decryptFields(keyring, encryptedDataKey, keyId, &credentials, &secret, &missing); err != nil {
+		t.Fatalf("decryptFields: %v", err)
+	}
+	if *credentials != `{"secretKey":"sk_live_1"}` || *secret != "whsec_1" || missing != nil {
+		t.Errorf("fields after decryptFields: %q, %q, %v", *credentials, *secret, missing)
+	}
+}
+
+func TestRowCipherRewrapsUnderTheActiveKey(t *testing.T) {
+	credentials := stringPointer(`{"secretKey":"sk_live_1"}`)
+	var encryptedDataKey *string
+	var keyId string
+	if err := encryptFields(testKeyring(t, "2026-01"), &encryptedDataKey, &keyId, &credentials); err != nil {
+		t.Fatalf("encryptFields: %v", err)
+	}
+	encrypted := *credentials
+
+	rotated := testKeyring(t, "2026-02", "2026-01")
+	if err := encryptFields(rotated, &encryptedDataKey, &keyId, &credentials); err != nil {
+		t.Fatalf("encryptFields after rotation: %v", err)
+	}
+	if keyId != "2026-02" || *credentials != encrypted {
+		t.Fatalf("after rotation the data key is under %q and the value changed %t, want 2026-02 and the value kept", keyId, *credentials != encrypted)
+	}
+
+	// Only the new master key is needed to read the row now.
+	if err := decryptFields(testKeyring(t, "2026-02"), encryptedDataKey, keyId, &credentials); err != nil {
+		t.Fatalf("decryptFields with only the new master key: %v", err)
+	}
+	if *credentials != `{"secretKey":"sk_live_1"}` {
+		t.Errorf("decrypted %q", *credentials)
+	}
+}
+
+func TestRowCipherRejectsTamperedRows(t *testing.T) {
+	keyring := testKeyring(t, "2026-01", "2026-02")
+	credentials := stringPointer(`{"secretKey":"sk_live_1"}`)
+	var encryptedDataKey *string
+	var keyId string
+	if err := encryptFields(keyring, &encryptedDataKey, &keyId, &credentials); err != nil {
+		t.Fatalf("encryptFields: %v", err)
+	}
+	encrypted := *credentials
+	// Tamper with a character in the middle: the last ones may only carry
+	// base64 padding bits.
+	middle := len(encrypted) / 2
+	replacement := "A"
+	if encrypted[middle] == 'A' {
+		replacement = "B"
+	}
+
+	tests := []struct {
+		name             string
+		encryptedDataKey string
+		keyId            string
+		value            string
+	}{
+		{"tampered value", *encryptedDataKey, keyId, encrypted[:middle] + replacement + encrypted[middle+1:]},
+		{"data key claimed under another master key", *encryptedDataKey, "2026-02", encrypted},
+		{"unknown master key", *encryptedDataKey, "2025-12", encrypted},
+		{"tampered data key", strings.Repeat("A", 8) + (*encryptedDataKey)[8:], keyId, encrypted},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value := stringPointer(test.value)
+			if err := decryptFields(keyring, &test.encryptedDataKey, test.keyId, &value); err == nil {
+				t.Errorf("decryptFields succeeded with %q", *value)
+			}
+		})
+	}
+}
+
+func TestRowCipherLeavesUnencryptedRowsAlone(t *testing.T) {
+	payload := stringPointer(`{"amount":1000}`)
+	if err := decryptFields(testKeyring(t, "2026-01"), nil, "", &payload); err != nil || *payload != `{"amount":1000}` {
+		t.Errorf("decryptFields on a row without a data key = %q, %v", *payload, err)
+	}
+}
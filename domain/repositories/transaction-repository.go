@@ -1,60 +1,76 @@
 package repositories
 
 import (
+	"context"
 	"errors"
 	"gorm.io/gorm"
-	"payment-service/app"
+	"payment-service/app/encryption"
 	"payment-service/domain/entities"
+	"payment-service/domain/types"
+	"strconv"
 )
 
-type TransactionRepository struct {
-	db *gorm.DB
+// TransactionRepository stores transactions and looks them up by their
+// identifiers. GormTransactionRepository is the database implementation;
+// MemoryTransactionRepository keeps transactions in memory for tests.
+type TransactionRepository interface {
+	SaveTransaction(ctx context.Context, transaction entities.Transaction) (entities.Transaction, error)
+	// GetTransactionByTransactionId returns nil when the merchant has no
+	// transaction with the client transaction id. Transaction ids are unique
+	// per merchant; a nil merchantId is the platform.
+	GetTransactionByTransactionId(ctx context.Context, merchantId *uint, transactionId string) (*entities.Transaction, error)
+	GetTransactionByChargeId(ctx context.Context, chargeId string) (*entities.Transaction, error)
+	// GetTransactionByPaymentId only finds transactions of the merchant; a nil
+	// merchantId is the platform.
+	GetTransactionByPaymentId(ctx context.Context, merchantId *uint, paymentId string) (*entities.Transaction, error)
+	// FindTransaction returns nil when the merchant has no transaction with
+	// the identifier; a nil merchantId is the platform.
+	FindTransaction(ctx context.Context, merchantId *uint, id string) (*entities.Transaction, error)
+	ListTransactions(ctx context.Context, filter types.TransactionFilter) ([]entities.Transaction, error)
+	ListTransactionsForReencryption(ctx context.Context, keyId string, afterId uint, limit int) ([]entities.Transaction, error)
+	Reencrypt(ctx context.Context, transaction entities.Transaction) error
 }
 
-func NewTransactionRepository() *TransactionRepository {
-	db, _ := app.App().GetPgDbConnectionByName("postgres")
-	return &TransactionRepository{
-		db: db,
-	}
-}
-
-func (self TransactionRepository) BeginTx() *gorm.DB {
-	tx := self.db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-	return tx
+// GormTransactionRepository stores transactions with their payload columns
+// encrypted (see encryptPayloads) and returns them decrypted. Queries run
+// with the caller's context, so they are cancelled with it and traced as its
+// children.
+type GormTransactionRepository struct {
+	db      *gorm.DB
+	keyring *encryption.Keyring
 }
 
-func (self TransactionRepository) CommitTx(tx *gorm.DB) *gorm.DB {
-	return tx.Commit()
-}
-
-func (self TransactionRepository) RollbackTx(tx *gorm.DB) *gorm.DB {
-	return tx.Rollback()
+func NewTransactionRepository(db *gorm.DB, keyring *encryption.Keyring) *GormTransactionRepository {
+	return &GormTransactionRepository{
+		db:      db,
+		keyring: keyring,
+	}
 }
 
-func (self *TransactionRepository) SaveTransaction(transaction entities.Transaction, tx *gorm.DB) (entities.Transaction, error) {
-	db := self.db
-	if tx != nil {
-		db = tx
+func (self *GormTransactionRepository) SaveTransaction(ctx context.Context, transaction entities.Transaction) (entities.Transaction, error) {
+	db := self.db.WithContext(ctx)
+	redactPayloads(&transaction)
+	encrypted, err := encryptPayloads(self.keyring, transaction)
+	if err != nil {
+		return transaction, err
 	}
-	res := db.Save(&transaction)
+
+	res := db.Save(&encrypted)
+	transaction.ID = encrypted.ID
+	transaction.CreatedAt = encrypted.CreatedAt
+	transaction.UpdatedAt = encrypted.UpdatedAt
+	transaction.EncryptedDataKey = encrypted.EncryptedDataKey
+	transaction.EncryptionKeyId = encrypted.EncryptionKeyId
 	return transaction, res.Error
 }
 
-func (self *TransactionRepository) GetTransactionByTransactionId(transactionId string, tx *gorm.DB) (*entities.Transaction, error) {
-	db := self.db
-	if tx != nil {
-		db = tx
-	}
+func (self *GormTransactionRepository) GetTransactionByTransactionId(ctx context.Context, merchantId *uint, transactionId string) (*entities.Transaction, error) {
+	db := self.db.WithContext(ctx)
 	var transaction entities.Transaction
 
-	res := db.Model(&entities.Transaction{}).
-		Where("transaction_id = ?", transactionId).
-		First(&transaction)
+	query := db.Model(&entities.Transaction{}).
+		Where("transaction_id = ?", transactionId)
+	res := whereMerchant(query, merchantId).First(&transaction)
 
 	if res.Error != nil {
 		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
@@ -63,14 +79,23 @@ func (self *TransactionRepository) GetTransactionByTransactionId(transactionId s
 		return nil, res.Error
 	}
 
-	return &transaction, res.Error
+	if err := decryptPayloads(self.keyring, &transaction); err != nil {
+		return nil, err
+	}
+	return &transaction, nil
 }
 
-func (self *TransactionRepository) GetTransactionByChargeId(chargeId string, tx *gorm.DB) (*entities.Transaction, error) {
-	db := self.db
-	if tx != nil {
-		db = tx
+// whereMerchant limits query to transactions of the merchant, or to
+// platform transactions when merchantId is nil.
+func whereMerchant(query *gorm.DB, merchantId *uint) *gorm.DB {
+	if merchantId == nil {
+		return query.Where("merchant_id IS NULL")
 	}
+	return query.Where("merchant_id = ?", *merchantId)
+}
+
+func (self *GormTransactionRepository) GetTransactionByChargeId(ctx context.Context, chargeId string) (*entities.Transaction, error) {
+	db := self.db.WithContext(ctx)
 	var transaction entities.Transaction
 
 	res := db.Model(&entities.Transaction{}).
@@ -81,23 +106,130 @@ func (self *TransactionRepository) GetTransactionByChargeId(chargeId string, tx
 		return nil, res.Error
 	}
 
+	if err := decryptPayloads(self.keyring, &transaction); err != nil {
+		return nil, err
+	}
 	return &transaction, nil
 }
 
-func (self *TransactionRepository) GetTransactionByPaymentId(chargeId string, tx *gorm.DB) (*entities.Transaction, error) {
-	db := self.db
-	if tx != nil {
-		db = tx
+func (self *GormTransactionRepository) GetTransactionByPaymentId(ctx context.Context, merchantId *uint, paymentId string) (*entities.Transaction, error) {
+	db := self.db.WithContext(ctx)
+	var transaction entities.Transaction
+
+	query := db.Model(&entities.Transaction{}).
+		Where("payment_id = ?", paymentId)
+	res := whereMerchant(query, merchantId).First(&transaction)
+
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	if err := decryptPayloads(self.keyring, &transaction); err != nil {
+		return nil, err
 	}
+	return &transaction, nil
+}
+
+// FindTransaction looks a transaction up by any of its identifiers: the
+// numeric primary key, the client transaction id, the payment id or the
+// charge id.
+func (self *GormTransactionRepository) FindTransaction(ctx context.Context, merchantId *uint, id string) (*entities.Transaction, error) {
+	db := self.db.WithContext(ctx)
 	var transaction entities.Transaction
 
-	res := db.Model(&entities.Transaction{}).
-		Where("payment_id = ?", chargeId).
-		First(&transaction)
+	matches := db.Where("transaction_id = ? OR payment_id = ? OR charge_id = ?", id, id, id)
+	if primaryKey, err := strconv.ParseUint(id, 10, 64); err == nil {
+		matches = matches.Or("id = ?", primaryKey)
+	}
+	query := db.Model(&entities.Transaction{}).Where(matches)
 
+	res := whereMerchant(query, merchantId).Order("id").First(&transaction)
 	if res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
 		return nil, res.Error
 	}
 
+	if err := decryptPayloads(self.keyring, &transaction); err != nil {
+		return nil, err
+	}
 	return &transaction, nil
 }
+
+func (self *GormTransactionRepository) ListTransactions(ctx context.Context, filter types.TransactionFilter) ([]entities.Transaction, error) {
+	db := self.db.WithContext(ctx)
+	var transactions []entities.Transaction
+
+	query := db.Model(&entities.Transaction{})
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.GatewayName != "" {
+		query = query.Where("gateway_name = ?", filter.GatewayName)
+	}
+	if filter.MerchantId != nil {
+		query = query.Where("merchant_id = ?", *filter.MerchantId)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	res := query.Order("id").Find(&transactions)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	for i := range transactions {
+		if err := decryptPayloads(self.keyring, &transactions[i]); err != nil {
+			return nil, err
+		}
+	}
+	return transactions, nil
+}
+
+// ListTransactionsForReencryption returns up to limit rows after afterId that
+// have payloads or a data key not yet under the master key keyId. Payloads
+// are returned as stored.
+func (self *GormTransactionRepository) ListTransactionsForReencryption(ctx context.Context, keyId string, afterId uint, limit int) ([]entities.Transaction, error) {
+	var transactions []entities.Transaction
+
+	res := self.db.WithContext(ctx).Model(&entities.Transaction{}).
+		Where("id > ?", afterId).
+		Where("encryption_key_id IS NULL OR encryption_key_id <> ?", keyId).
+		Where("request_payload IS NOT NULL OR response_payload IS NOT NULL OR callback_payload IS NOT NULL OR encrypted_data_key IS NOT NULL").
+		Order("id").
+		Limit(limit).
+		Find(&transactions)
+
+	return transactions, res.Error
+}
+
+// Reencrypt moves a stored row under the active master key, redacting and
+// encrypting any plaintext payloads, without touching updated_at.
+func (self *GormTransactionRepository) Reencrypt(ctx context.Context, transaction entities.Transaction) error {
+	if err := decryptPayloads(self.keyring, &transaction); err != nil {
+		return err
+	}
+	redactPayloads(&transaction)
+	encrypted, err := encryptPayloads(self.keyring, transaction)
+	if err != nil {
+		return err
+	}
+
+	return self.db.WithContext(ctx).Model(&entities.Transaction{}).
+		Where("id = ?", encrypted.ID).
+		UpdateColumns(map[string]interface{}{
+			"request_payload":    encrypted.RequestPayload,
+			"response_payload":   encrypted.ResponsePayload,
+			"callback_payload":   encrypted.CallbackPayload,
+			"encrypted_data_key": encrypted.EncryptedDataKey,
+			"encryption_key_id":  encrypted.EncryptionKeyId,
+		}).Error
+}
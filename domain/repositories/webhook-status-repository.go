@@ -0,0 +1,36 @@
+package repositories
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"payment-service/domain/entities"
+	"time"
+)
+
+type WebhookStatusRepository struct {
+	db *gorm.DB
+}
+
+func NewWebhookStatusRepository(db *gorm.DB) *WebhookStatusRepository {
+	return &WebhookStatusRepository{
+		db: db,
+	}
+}
+
+const recordWebhookQuery = `
+INSERT INTO webhook_statuses (provider, last_event_type, last_succeeded_at)
+VALUES (?, ?, ?)
+ON CONFLICT (provider) DO UPDATE SET
+	last_event_type = EXCLUDED.last_event_type,
+	last_succeeded_at = EXCLUDED.last_succeeded_at
+WHERE webhook_statuses.last_succeeded_at < EXCLUDED.last_succeeded_at`
+
+func (self *WebhookStatusRepository) RecordSuccess(ctx context.Context, provider string, eventType string, at time.Time) error {
+	return self.db.WithContext(ctx).Exec(recordWebhookQuery, provider, eventType, at.UTC()).Error
+}
+
+func (self *WebhookStatusRepository) ListWebhookStatuses(ctx context.Context) ([]entities.WebhookStatus, error) {
+	var statuses []entities.WebhookStatus
+	err := self.db.WithContext(ctx).Order("provider").Find(&statuses).Error
+	return statuses, err
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/spf13/viper"
+	"net/http"
+	"payment-service/app/logger"
+	"time"
+)
+
+// AlertService raises operational alerts that need a human to look at them.
+// Alerts are always logged and, when alerts.webhook_url is configured, posted
+// as JSON to that URL (Slack-compatible "text" field).
+type AlertService struct {
+	Logger     *logger.Logger
+	webhookUrl string
+}
+
+func NewAlertService(config *viper.Viper, log *logger.Logger) *AlertService {
+	return &AlertService{
+		Logger:     log,
+		webhookUrl: config.GetString("alerts.webhook_url"),
+	}
+}
+
+func (self *AlertService) Raise(title string, fields map[string]interface{}) {
+	self.Logger.Errorf("ALERT %s: %v", title, fields)
+
+	if self.webhookUrl == "" {
+		return
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"text":   title,
+		"fields": fields,
+	})
+	if err != nil {
+		self.Logger.Error("failed to marshal alert: ", err.Error())
+		return
+	}
+
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	resp, err := httpClient.Post(self.webhookUrl, "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		self.Logger.Error("failed to send alert: ", err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		self.Logger.Error("alert webhook responded with status: ", resp.StatusCode)
+	}
+}
@@ -0,0 +1,312 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"github.com/spf13/viper"
+	"payment-service/app/clock"
+	"payment-service/app/encryption"
+	"payment-service/app/logger"
+	"payment-service/domain/entities"
+	"payment-service/domain/metrics"
+	"payment-service/domain/repositories"
+	"payment-service/domain/types"
+	"payment-service/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	apiKeyPrefix              = "psk"
+	defaultSignatureTolerance = 5 * time.Minute
+	// apiKeyTouchInterval is how stale last_used_at may get before a
+	// request updates it.
+	apiKeyTouchInterval = time.Minute
+)
+
+type ApiKeyService struct {
+	ApiKeyRepository repositories.ApiKeyRepository
+	MerchantService  *MerchantService
+	Config           *viper.Viper
+	Keyring          *encryption.Keyring
+	Logger           *logger.Logger
+	Clock            clock.Clock
+}
+
+func NewApiKeyService(apiKeyRepository repositories.ApiKeyRepository, merchantService *MerchantService, config *viper.Viper, keyring *encryption.Keyring, log *logger.Logger, clock clock.Clock) *ApiKeyService {
+	return &ApiKeyService{
+		ApiKeyRepository: apiKeyRepository,
+		MerchantService:  merchantService,
+		Config:           config,
+		Keyring:          keyring,
+		Logger:           log,
+		Clock:            clock,
+	}
+}
+
+// CreateApiKey generates a key of the form psk_<prefix>_<secret>. With
+// requireSignature the key also gets an HMAC signing secret and unsigned
+// requests made with it are rejected; the secret is stored encrypted, so
+// this needs a master key. A key with a merchantId acts for that merchant
+// only.
+func (self *ApiKeyService) CreateApiKey(ctx context.Context, name string, scopes []string, requireSignature bool, merchantId *uint) (*types.CreatedApiKey, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, &errors.ValidationError{
+			Message: "api key name is required",
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, &errors.ValidationError{
+			Message: "at least one scope is required",
+		}
+	}
+	for _, scope := range scopes {
+		if !isApiKeyScope(scope) {
+			return nil, &errors.ValidationError{
+				Message: "unknown scope: " + scope,
+			}
+		}
+	}
+
+	if requireSignature && !self.Keyring.Enabled() {
+		return nil, &errors.ValidationError{
+			Message: "an encryption master key must be configured to create keys that require signatures",
+		}
+	}
+
+	if merchantId != nil {
+		if _, err := self.MerchantService.GetActiveMerchant(ctx, *merchantId); err != nil {
+			return nil, err
+		}
+	}
+
+	prefix := randomHex(4)
+	key := apiKeyPrefix + "_" + prefix + "_" + randomHex(24)
+	apiKey := entities.ApiKey{
+		Name:             name,
+		Prefix:           prefix,
+		KeyHash:          hashApiKey(key),
+		Scopes:           strings.Join(scopes, ","),
+		RequireSignature: requireSignature,
+		MerchantID:       merchantId,
+	}
+
+	created := &types.CreatedApiKey{Key: key}
+	if requireSignature {
+		signingSecret := randomHex(32)
+		apiKey.SigningSecret = &signingSecret
+		created.SigningSecret = signingSecret
+	}
+
+	apiKey, err := self.ApiKeyRepository.SaveApiKey(ctx, apiKey)
+	if err != nil {
+		return nil, &errors.InternalServerError{
+			Message: err.Error(),
+		}
+	}
+	created.ApiKey = apiKey
+
+	self.Logger.Info("api key created: ", apiKey.Name, " ", apiKey.Prefix)
+	return created, nil
+}
+
+// ListApiKeys returns the keys of one merchant, or every key when
+// merchantId is nil.
+func (self *ApiKeyService) ListApiKeys(ctx context.Context, merchantId *uint) ([]entities.ApiKey, error) {
+	apiKeys, err := self.ApiKeyRepository.ListApiKeys(ctx, merchantId)
+	if err != nil {
+		return nil, &errors.InternalServerError{
+			Message: err.Error(),
+		}
+	}
+	return apiKeys, nil
+}
+
+// RevokeApiKey revokes a key. With a merchantId, keys of other merchants
+// are treated as not found.
+func (self *ApiKeyService) RevokeApiKey(ctx context.Context, merchantId *uint, id uint) (*entities.ApiKey, error) {
+	apiKey, err := self.ApiKeyRepository.GetApiKeyById(ctx, id)
+	if err != nil {
+		return nil, &errors.InternalServerError{
+			Message: err.Error(),
+		}
+	}
+	if apiKey == nil {
+		return nil, nil
+	}
+	if merchantId != nil && (apiKey.MerchantID == nil || *apiKey.MerchantID != *merchantId) {
+		return nil, nil
+	}
+
+	if apiKey.RevokedAt == nil {
+		revokedAt := self.Clock.Now().UTC()
+		apiKey.RevokedAt = &revokedAt
+		if err := self.ApiKeyRepository.RevokeApiKey(ctx, apiKey.ID, revokedAt); err != nil {
+			return nil, &errors.InternalServerError{
+				Message: err.Error(),
+			}
+		}
+		self.Logger.Info("api key revoked: ", apiKey.Name, " ", apiKey.Prefix)
+	}
+	return apiKey, nil
+}
+
+// Authenticate resolves a raw key to its active ApiKey. It returns a
+// ValidationError for unknown, malformed or revoked keys. last_used_at is
+// updated at most once per apiKeyTouchInterval.
+func (self *ApiKeyService) Authenticate(ctx context.Context, key string) (*entities.ApiKey, error) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0] != apiKeyPrefix {
+		return nil, &errors.ValidationError{
+			Message: "invalid api key",
+		}
+	}
+
+	apiKey, err := self.ApiKeyRepository.GetApiKeyByPrefix(ctx, parts[1])
+	if err != nil {
+		return nil, &errors.InternalServerError{
+			Message: err.Error(),
+		}
+	}
+	if apiKey == nil || subtle.ConstantTimeCompare([]byte(apiKey.KeyHash), []byte(hashApiKey(key))) != 1 {
+		return nil, &errors.ValidationError{
+			Message: "invalid api key",
+		}
+	}
+	if apiKey.RevokedAt != nil {
+		return nil, &errors.ValidationError{
+			Message: "api key has been revoked",
+		}
+	}
+
+	now := self.Clock.Now().UTC()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyTouchInterval {
+		if err := self.ApiKeyRepository.TouchApiKey(ctx, apiKey.ID, now, apiKeyTouchInterval); err != nil {
+			self.Logger.Error("failed to update api key last use: ", err.Error())
+		}
+	}
+	return apiKey, nil
+}
+
+// VerifySignature checks an HMAC-SHA256 request signature over
+// "<timestamp>\n<nonce>\n<METHOD>\n<path>\n<body>" using the key's signing
+// secret. The timestamp must be within auth.signature_tolerance of now and
+// the nonce must not have been used before by the same key.
+func (self *ApiKeyService) VerifySignature(ctx context.Context, apiKey entities.ApiKey, signature types.RequestSignature) error {
+	if apiKey.SigningSecret == nil {
+		return &errors.ValidationError{
+			Message: "api key has no signing secret",
+		}
+	}
+	if signature.Timestamp == "" || signature.Nonce == "" || signature.Signature == "" {
+		return &errors.ValidationError{
+			Message: "request signature is required",
+		}
+	}
+	if len(signature.Nonce) > 64 {
+		return &errors.ValidationError{
+			Message: "request nonce is too long",
+		}
+	}
+
+	timestamp, err := strconv.ParseInt(signature.Timestamp, 10, 64)
+	if err != nil {
+		return &errors.ValidationError{
+			Message: "invalid request timestamp",
+		}
+	}
+	skew := self.Clock.Now().Sub(time.Unix(timestamp, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > self.signatureTolerance() {
+		return &errors.ValidationError{
+			Message: "request timestamp is outside the allowed window",
+		}
+	}
+
+	mac := hmac.New(sha256.New, []byte(*apiKey.SigningSecret))
+	mac.Write([]byte(signature.Timestamp + "\n" + signature.Nonce + "\n" + strings.ToUpper(signature.Method) + "\n" + signature.Path + "\n"))
+	mac.Write(signature.Body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature.Signature))) {
+		return &errors.ValidationError{
+			Message: "invalid request signature",
+		}
+	}
+
+	saved, err := self.ApiKeyRepository.SaveNonce(ctx, apiKey.ID, signature.Nonce, self.Clock.Now().UTC())
+	if err != nil {
+		return &errors.InternalServerError{
+			Message: err.Error(),
+		}
+	}
+	if !saved {
+		return &errors.ValidationError{
+			Message: "request nonce has already been used",
+		}
+	}
+	return nil
+}
+
+// PurgeNonces deletes nonces older than the signature window; requests that
+// old are rejected by their timestamp anyway.
+func (self *ApiKeyService) PurgeNonces(ctx context.Context) (int64, error) {
+	return self.ApiKeyRepository.DeleteNoncesBefore(ctx, self.Clock.Now().Add(-2*self.signatureTolerance()))
+}
+
+// RunNoncePurge is a background worker that purges expired nonces every
+// minute until ctx is cancelled.
+func (self *ApiKeyService) RunNoncePurge(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			purged, err := self.PurgeNonces(ctx)
+			metrics.JobRun("api-nonce-purge", start, map[string]int64{"deleted": purged}, err)
+			if err != nil {
+				self.Logger.Error("failed to purge request nonces: ", err.Error())
+			}
+		}
+	}
+}
+
+func (self *ApiKeyService) signatureTolerance() time.Duration {
+	tolerance := self.Config.GetDuration("auth.signature_tolerance")
+	if tolerance <= 0 {
+		return defaultSignatureTolerance
+	}
+	return tolerance
+}
+
+func isApiKeyScope(scope string) bool {
+	for _, known := range entities.ApiKeyScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+func hashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(size int) string {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,289 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"payment-service/app/clock"
+	"payment-service/app/encryption"
+	"payment-service/domain/entities"
+	"payment-service/domain/repositories"
+	"payment-service/domain/types"
+	"payment-service/errors"
+)
+
+// testKeyring returns a keyring with a master key derived from each id,
+// the first one active.
+func testKeyring(t *testing.T, keyIds ...string) *encryption.Keyring {
+	t.Helper()
+	keys := map[string][]byte{}
+	for _, keyId := range keyIds {
+		key := sha256.Sum256([]byte(keyId))
+		keys[keyId] = key[:]
+	}
+	activeKeyId := ""
+	if len(keyIds) > 0 {
+		activeKeyId = keyIds[0]
+	}
+	keyring, err := encryption.NewKeyring(keys, activeKeyId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+type apiKeyFixture struct {
+	service          *ApiKeyService
+	apiKeys          *repositories.MemoryApiKeyRepository
+	clock            *clock.Fake
+	activeMerchant   entities.Merchant
+	disabledMerchant entities.Merchant
+}
+
+func newApiKeyFixture(t *testing.T, keyring *encryption.Keyring) *apiKeyFixture {
+	t.Helper()
+	now := clock.NewFake(time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC))
+	config := viper.New()
+	merchants := repositories.NewMemoryMerchantRepository(keyring, now)
+	active, err := merchants.SaveMerchant(context.Background(), entities.Merchant{Name: "active"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	disabledAt := now.Now().Add(-time.Hour)
+	disabled, err := merchants.SaveMerchant(context.Background(), entities.Merchant{Name: "disabled", DisabledAt: &disabledAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apiKeys := repositories.NewMemoryApiKeyRepository(keyring, now)
+	merchantService := NewMerchantService(merchants, config, keyring, testLogger, now)
+	return &apiKeyFixture{
+		service:          NewApiKeyService(apiKeys, merchantService, config, keyring, testLogger, now),
+		apiKeys:          apiKeys,
+		clock:            now,
+		activeMerchant:   active,
+		disabledMerchant: disabled,
+	}
+}
+
+func (self *apiKeyFixture) create(t *testing.T, scopes []string, requireSignature bool, merchantId *uint) *types.CreatedApiKey {
+	t.Helper()
+	created, err := self.service.CreateApiKey(context.Background(), "test", scopes, requireSignature, merchantId)
+	if err != nil {
+		t.Fatalf("CreateApiKey: %v", err)
+	}
+	return created
+}
+
+// signRequest signs a request the way clients are documented to.
+func signRequest(secret string, signature types.RequestSignature) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signature.Timestamp + "\n" + signature.Nonce + "\n" + signature.Method + "\n" + signature.Path + "\n"))
+	mac.Write(signature.Body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestCreateApiKeyScopesToMerchant(t *testing.T) {
+	fixture := newApiKeyFixture(t, testKeyring(t, "2026-01"))
+	unknownMerchant := uint(99)
+	tests := []struct {
+		name       string
+		scopes     []string
+		merchantId *uint
+		wantError  string
+	}{
+		{"platform key", []string{entities.ScopeAdmin}, nil, ""},
+		{"key of an active merchant", []string{entities.ScopeDeposit, entities.ScopeRead}, &fixture.activeMerchant.ID, ""},
+		{"key of a disabled merchant", []string{entities.ScopeDeposit}, &fixture.disabledMerchant.ID, "merchant not found or disabled"},
+		{"key of an unknown merchant", []string{entities.ScopeDeposit}, &unknownMerchant, "merchant not found or disabled"},
+		{"unknown scope", []string{"payouts"}, nil, "unknown scope: payouts"},
+		{"no scope", nil, nil, "at least one scope is required"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			created, err := fixture.service.CreateApiKey(context.Background(), test.name, test.scopes, false, test.merchantId)
+			if test.wantError != "" {
+				if _, ok := err.(*errors.ValidationError); !ok || err.Error() != test.wantError {
+					t.Fatalf("CreateApiKey returned %v, want validation error %q", err, test.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateApiKey: %v", err)
+			}
+			stored, _ := fixture.apiKeys.GetApiKeyById(context.Background(), created.ApiKey.ID)
+			if stored == nil || (stored.MerchantID == nil) != (test.merchantId == nil) ||
+				(stored.MerchantID != nil && *stored.MerchantID != *test.merchantId) {
+				t.Errorf("stored key %+v, want merchant %v", stored, test.merchantId)
+			}
+			if stored != nil && stored.KeyHash == created.Key {
+				t.Error("the key is stored in plaintext")
+			}
+		})
+	}
+}
+
+func TestCreateApiKeyRequiringSignatureNeedsMasterKey(t *testing.T) {
+	fixture := newApiKeyFixture(t, testKeyring(t))
+	_, err := fixture.service.CreateApiKey(context.Background(), "signed", []string{entities.ScopeRead}, true, nil)
+	if _, ok := err.(*errors.ValidationError); !ok {
+		t.Fatalf("CreateApiKey without a master key returned %v, want a validation error", err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	fixture := newApiKeyFixture(t, testKeyring(t, "2026-01"))
+	valid := fixture.create(t, []string{entities.ScopeRead}, false, nil)
+	revoked := fixture.create(t, []string{entities.ScopeRead}, false, nil)
+	if _, err := fixture.service.RevokeApiKey(context.Background(), nil, revoked.ApiKey.ID); err != nil {
+		t.Fatalf("RevokeApiKey: %v", err)
+	}
+	prefix := strings.Split(valid.Key, "_")[1]
+
+	tests := []struct {
+		name      string
+		key       string
+		wantError string
+	}{
+		{"valid key", valid.Key, ""},
+		{"revoked key", revoked.Key, "api key has been revoked"},
+		{"wrong secret", apiKeyPrefix + "_" + prefix + "_" + strings.Repeat("0", 48), "invalid api key"},
+		{"unknown prefix", apiKeyPrefix + "_00000000_" + strings.Repeat("0", 48), "invalid api key"},
+		{"malformed key", "not-a-key", "invalid api key"},
+		{"no key", "", "invalid api key"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			apiKey, err := fixture.service.Authenticate(context.Background(), test.key)
+			if test.wantError != "" {
+				if _, ok := err.(*errors.ValidationError); !ok || err.Error() != test.wantError {
+					t.Fatalf("Authenticate returned %v, want validation error %q", err, test.wantError)
+				}
+				return
+			}
+			if err != nil || apiKey == nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateTouchesKeysAtMostOncePerInterval(t *testing.T) {
+	fixture := newApiKeyFixture(t, testKeyring(t, "2026-01"))
+	created := fixture.create(t, []string{entities.ScopeRead}, false, nil)
+	first := fixture.clock.Now().UTC()
+
+	for _, step := range []struct {
+		advance  time.Duration
+		lastUsed time.Time
+	}{
+		{0, first},
+		{apiKeyTouchInterval / 2, first},
+		{apiKeyTouchInterval / 2, first.Add(apiKeyTouchInterval)},
+	} {
+		fixture.clock.Advance(step.advance)
+		if _, err := fixture.service.Authenticate(context.Background(), created.Key); err != nil {
+			t.Fatalf("Authenticate: %v", err)
+		}
+		stored, _ := fixture.apiKeys.Stored(created.ApiKey.ID)
+		if stored.LastUsedAt == nil || !stored.LastUsedAt.Equal(step.lastUsed) {
+			t.Errorf("at %s last used at %v, want %s", fixture.clock.Now(), stored.LastUsedAt, step.lastUsed)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	fixture := newApiKeyFixture(t, testKeyring(t, "2026-01"))
+	created := fixture.create(t, []string{entities.ScopeDeposit}, true, nil)
+	apiKey, err := fixture.apiKeys.GetApiKeyById(context.Background(), created.ApiKey.ID)
+	if err != nil || apiKey == nil {
+		t.Fatalf("GetApiKeyById: %v", err)
+	}
+	unsigned := fixture.create(t, []string{entities.ScopeDeposit}, false, nil)
+
+	now := fixture.clock.Now()
+	signed := func(nonce string, at time.Time, secret string) types.RequestSignature {
+		signature := types.RequestSignature{
+			Timestamp: strconv.FormatInt(at.Unix(), 10),
+			Nonce:     nonce,
+			Method:    "POST",
+			Path:      "/api/v1/deposit",
+			Body:      []byte(`{"amount":1000}`),
+		}
+		signature.Signature = signRequest(secret, signature)
+		return signature
+	}
+	tampered := signed("tampered", now, created.SigningSecret)
+	tampered.Body = []byte(`{"amount":9000}`)
+	lowercaseMethod := signed("lowercase", now, created.SigningSecret)
+	lowercaseMethod.Method = "post"
+
+	tests := []struct {
+		name      string
+		apiKey    entities.ApiKey
+		signature types.RequestSignature
+		wantError string
+	}{
+		{"valid signature", *apiKey, signed("n-1", now, created.SigningSecret), ""},
+		{"method in any case", *apiKey, lowercaseMethod, ""},
+		{"replayed nonce", *apiKey, signed("n-1", now.Add(time.Second), created.SigningSecret), "request nonce has already been used"},
+		{"signed with another secret", *apiKey, signed("n-2", now, "another secret"), "invalid request signature"},
+		{"tampered body", *apiKey, tampered, "invalid request signature"},
+		{"timestamp at the edge of the window", *apiKey, signed("n-3", now.Add(-defaultSignatureTolerance), created.SigningSecret), ""},
+		{"timestamp too old", *apiKey, signed("n-4", now.Add(-defaultSignatureTolerance-time.Second), created.SigningSecret), "request timestamp is outside the allowed window"},
+		{"timestamp in the future", *apiKey, signed("n-5", now.Add(defaultSignatureTolerance+time.Second), created.SigningSecret), "request timestamp is outside the allowed window"},
+		{"invalid timestamp", *apiKey, types.RequestSignature{Timestamp: "yesterday", Nonce: "n-6", Signature: "00"}, "invalid request timestamp"},
+		{"missing nonce", *apiKey, signed("", now, created.SigningSecret), "request signature is required"},
+		{"nonce too long", *apiKey, signed(strings.Repeat("n", 65), now, created.SigningSecret), "request nonce is too long"},
+		{"key without signing secret", unsigned.ApiKey, signed("n-7", now, created.SigningSecret), "api key has no signing secret"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := fixture.service.VerifySignature(context.Background(), test.apiKey, test.signature)
+			if test.wantError == "" {
+				if err != nil {
+					t.Fatalf("VerifySignature: %v", err)
+				}
+				return
+			}
+			if _, ok := err.(*errors.ValidationError); !ok || err.Error() != test.wantError {
+				t.Fatalf("VerifySignature returned %v, want validation error %q", err, test.wantError)
+			}
+		})
+	}
+}
+
+func TestPurgedNoncesAreOutsideTheWindow(t *testing.T) {
+	fixture := newApiKeyFixture(t, testKeyring(t, "2026-01"))
+	created := fixture.create(t, []string{entities.ScopeDeposit}, true, nil)
+	apiKey, _ := fixture.apiKeys.GetApiKeyById(context.Background(), created.ApiKey.ID)
+
+	signature := types.RequestSignature{
+		Timestamp: strconv.FormatInt(fixture.clock.Now().Unix(), 10),
+		Nonce:     "purged",
+		Method:    "GET",
+		Path:      "/api/v1/transactions",
+	}
+	signature.Signature = signRequest(created.SigningSecret, signature)
+	if err := fixture.service.VerifySignature(context.Background(), *apiKey, signature); err != nil {
+		t.Fatalf("VerifySignature: %v", err)
+	}
+
+	fixture.clock.Advance(2*defaultSignatureTolerance + time.Second)
+	purged, err := fixture.service.PurgeNonces(context.Background())
+	if err != nil || purged != 1 {
+		t.Fatalf("PurgeNonces purged %d (%v), want 1", purged, err)
+	}
+	// Once its nonce is purged, the request is refused by its timestamp.
+	if err := fixture.service.VerifySignature(context.Background(), *apiKey, signature); err == nil || err.Error() != "request timestamp is outside the allowed window" {
+		t.Errorf("replay after the purge returned %v, want the timestamp refused", err)
+	}
+}
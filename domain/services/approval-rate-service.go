@@ -0,0 +1,105 @@
+package services
+
+import (
+	"github.com/spf13/viper"
+	"payment-service/domain/entities"
+	"payment-service/domain/metrics"
+	"sync"
+)
+
+const (
+	defaultApprovalRateWindow     = 100
+	defaultApprovalRateMinSamples = 20
+)
+
+type approvalWindow struct {
+	outcomes []bool
+	next     int
+}
+
+// ApprovalRateService observes the share of charges and payouts each
+// provider approves, over its last routing.approval_rate_window final
+// outcomes. Pending results are not counted. Every service routing or
+// recording calls must share the same ApprovalRateService.
+type ApprovalRateService struct {
+	Config *viper.Viper
+	// mutex guards providers, the last outcomes per provider.
+	mutex     sync.Mutex
+	providers map[string]*approvalWindow
+}
+
+func NewApprovalRateService(config *viper.Viper) *ApprovalRateService {
+	return &ApprovalRateService{
+		Config:    config,
+		providers: map[string]*approvalWindow{},
+	}
+}
+
+// Record counts the outcome of a provider call: approved when the
+// transaction succeeded, declined when the provider declined or rejected
+// it. Errors on the provider's side say nothing about approvals and are
+// left to the circuit breaker.
+func (self *ApprovalRateService) Record(provider string, transaction entities.Transaction, err error) {
+	var approved bool
+	switch metrics.ErrorClass(transaction, err) {
+	case metrics.ErrorClassNone:
+		if transaction.Status != "succeeded" {
+			return
+		}
+		approved = true
+	case metrics.ErrorClassDeclined, metrics.ErrorClassRejected:
+		approved = false
+	default:
+		return
+	}
+
+	size := self.Config.GetInt("routing.approval_rate_window")
+	if size <= 0 {
+		size = defaultApprovalRateWindow
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	window, ok := self.providers[provider]
+	if !ok {
+		window = &approvalWindow{}
+		self.providers[provider] = window
+	}
+	if len(window.outcomes) < size {
+		window.outcomes = append(window.outcomes, approved)
+	} else {
+		window.outcomes[window.next%len(window.outcomes)] = approved
+		window.next = (window.next + 1) % len(window.outcomes)
+	}
+	metrics.ApprovalRate(provider, window.rate())
+}
+
+// Rate returns the observed approval rate of provider, or false until
+// routing.approval_rate_min_samples outcomes were seen.
+func (self *ApprovalRateService) Rate(provider string) (float64, bool) {
+	minSamples := self.Config.GetInt("routing.approval_rate_min_samples")
+	if minSamples <= 0 {
+		minSamples = defaultApprovalRateMinSamples
+	}
+
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	window, ok := self.providers[provider]
+	if !ok || len(window.outcomes) < minSamples {
+		return 0, false
+	}
+	return window.rate(), true
+}
+
+func (self *approvalWindow) rate() float64 {
+	if len(self.outcomes) == 0 {
+		return 0
+	}
+	approved := 0
+	for _, outcome := range self.outcomes {
+		if outcome {
+			approved++
+		}
+	}
+	return float64(approved) / float64(len(self.outcomes))
+}
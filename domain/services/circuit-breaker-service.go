@@ -0,0 +1,81 @@
+package services
+
+import (
+	"github.com/spf13/viper"
+	"payment-service/app/circuitbreaker"
+	"payment-service/app/logger"
+	"payment-service/domain/entities"
+	"payment-service/domain/metrics"
+	"sync"
+	"time"
+)
+
+// CircuitBreakerService keeps a circuit breaker per provider around the
+// Charge and Withdraw calls. Breakers are per provider, not per merchant:
+// an outage affects every merchant using the provider. Every service calling
+// providers must share the same CircuitBreakerService, so all requests see
+// the same state for a provider.
+type CircuitBreakerService struct {
+	Config *viper.Viper
+	Logger *logger.Logger
+	// mutex guards breakers.
+	mutex    sync.Mutex
+	breakers map[string]*circuitbreaker.Breaker
+}
+
+func NewCircuitBreakerService(config *viper.Viper, log *logger.Logger) *CircuitBreakerService {
+	return &CircuitBreakerService{
+		Config:   config,
+		Logger:   log,
+		breakers: map[string]*circuitbreaker.Breaker{},
+	}
+}
+
+// Breaker returns the breaker of provider, created with the
+// circuit_breaker.* settings on first use.
+func (self *CircuitBreakerService) Breaker(provider string) *circuitbreaker.Breaker {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	breaker, ok := self.breakers[provider]
+	if !ok {
+		breaker = circuitbreaker.New(provider, self.settings(), func(name string, from circuitbreaker.State, to circuitbreaker.State) {
+			self.Logger.With("provider", name).Warnf("circuit breaker %s -> %s", from, to)
+			metrics.CircuitState(name, string(to), true)
+		})
+		self.breakers[provider] = breaker
+		metrics.CircuitState(provider, string(circuitbreaker.StateClosed), false)
+	}
+	return breaker
+}
+
+// State returns the breaker state of provider.
+func (self *CircuitBreakerService) State(provider string) circuitbreaker.State {
+	return self.Breaker(provider).State()
+}
+
+// Record reports a provider call started at start. Declines and rejected
+// requests are answers from a healthy provider; timeouts, network and
+// internal errors count as failures, and every call counts towards the
+// slow call rate.
+func (self *CircuitBreakerService) Record(provider string, start time.Time, transaction entities.Transaction, err error) {
+	var failed bool
+	switch metrics.ErrorClass(transaction, err) {
+	case metrics.ErrorClassTimeout, metrics.ErrorClassNetwork, metrics.ErrorClassInternal, metrics.ErrorClassUnknown:
+		failed = true
+	}
+	self.Breaker(provider).Record(failed, time.Since(start))
+}
+
+func (self *CircuitBreakerService) settings() circuitbreaker.Settings {
+	config := self.Config
+	return circuitbreaker.Settings{
+		Window:           config.GetInt("circuit_breaker.window"),
+		MinimumCalls:     config.GetInt("circuit_breaker.minimum_calls"),
+		FailureRate:      config.GetFloat64("circuit_breaker.failure_rate"),
+		SlowCallDuration: config.GetDuration("circuit_breaker.slow_call_duration"),
+		SlowCallRate:     config.GetFloat64("circuit_breaker.slow_call_rate"),
+		CoolDown:         config.GetDuration("circuit_breaker.cool_down"),
+		HalfOpenCalls:    config.GetInt("circuit_breaker.half_open_calls"),
+	}
+}
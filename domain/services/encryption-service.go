@@ -0,0 +1,158 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"payment-service/app/encryption"
+	"payment-service/app/logger"
+	"payment-service/domain/metrics"
+	"payment-service/domain/repositories"
+	"payment-service/domain/types"
+	"payment-service/errors"
+)
+
+const (
+	defaultReencryptBatchSize = 100
+	defaultReencryptInterval  = time.Hour
+)
+
+// EncryptionService moves stored transaction payloads, merchant credentials
+// and API key signing secrets under the active master key after a key
+// rotation, and encrypts transactions and signing secrets written before
+// encryption was enabled.
+type EncryptionService struct {
+	TransactionRepository repositories.TransactionRepository
+	MerchantRepository    repositories.MerchantRepository
+	ApiKeyRepository      repositories.ApiKeyRepository
+	Keyring               *encryption.Keyring
+	Config                *viper.Viper
+	Logger                *logger.Logger
+}
+
+func NewEncryptionService(transactionRepository repositories.TransactionRepository, merchantRepository repositories.MerchantRepository, apiKeyRepository repositories.ApiKeyRepository, keyring *encryption.Keyring, config *viper.Viper, log *logger.Logger) *EncryptionService {
+	return &EncryptionService{
+		TransactionRepository: transactionRepository,
+		MerchantRepository:    merchantRepository,
+		ApiKeyRepository:      apiKeyRepository,
+		Keyring:               keyring,
+		Config:                config,
+		Logger:                log,
+	}
+}
+
+// Reencrypt rewraps every merchant and API key and walks every transaction
+// not under the active master key, in batches of batchSize. Rows that fail
+// are reported and skipped.
+func (self *EncryptionService) Reencrypt(ctx context.Context, batchSize int, dryRun bool) (types.ReencryptionReport, error) {
+	keyring := self.Keyring
+	report := types.ReencryptionReport{
+		DryRun:      dryRun,
+		ActiveKeyId: keyring.ActiveKeyId(),
+	}
+	if !keyring.Enabled() {
+		return report, &errors.ValidationError{Message: "No encryption master key configured"}
+	}
+	if batchSize <= 0 {
+		batchSize = defaultReencryptBatchSize
+	}
+
+	merchants, err := self.MerchantRepository.ListMerchantsForReencryption(ctx, report.ActiveKeyId)
+	if err != nil {
+		return report, err
+	}
+	for _, merchant := range merchants {
+		report.Checked++
+		if dryRun {
+			continue
+		}
+		if err := self.MerchantRepository.Reencrypt(ctx, merchant); err != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, fmt.Sprintf("merchant %s: %s", merchant.Name, err.Error()))
+			continue
+		}
+		report.Reencrypted++
+	}
+
+	apiKeys, err := self.ApiKeyRepository.ListApiKeysForReencryption(ctx, report.ActiveKeyId)
+	if err != nil {
+		return report, err
+	}
+	for _, apiKey := range apiKeys {
+		report.Checked++
+		if dryRun {
+			continue
+		}
+		if err := self.ApiKeyRepository.Reencrypt(ctx, apiKey); err != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, fmt.Sprintf("api key %s: %s", apiKey.Prefix, err.Error()))
+			continue
+		}
+		report.Reencrypted++
+	}
+
+	var lastId uint
+	for {
+		transactions, err := self.TransactionRepository.ListTransactionsForReencryption(ctx, report.ActiveKeyId, lastId, batchSize)
+		if err != nil {
+			return report, err
+		}
+		if len(transactions) == 0 {
+			break
+		}
+
+		for _, transaction := range transactions {
+			lastId = transaction.ID
+			report.Checked++
+			if dryRun {
+				continue
+			}
+			if err := self.TransactionRepository.Reencrypt(ctx, transaction); err != nil {
+				report.Failed++
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %s", transaction.TransactionID, err.Error()))
+				continue
+			}
+			report.Reencrypted++
+		}
+	}
+
+	self.Logger.Infof("re-encryption checked %d rows, %d re-encrypted, %d failed", report.Checked, report.Reencrypted, report.Failed)
+	return report, nil
+}
+
+// RunReencryption is a background worker that re-encrypts stale rows every
+// encryption.reencrypt_interval until ctx is cancelled. It is idle when no
+// master key is configured.
+func (self *EncryptionService) RunReencryption(ctx context.Context) {
+	if !self.Keyring.Enabled() {
+		return
+	}
+
+	interval := self.Config.GetDuration("encryption.reencrypt_interval")
+	if interval <= 0 {
+		interval = defaultReencryptInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			report, err := self.Reencrypt(ctx, defaultReencryptBatchSize, false)
+			metrics.JobRun("payload-reencryption", start, map[string]int64{
+				"checked":     int64(report.Checked),
+				"reencrypted": int64(report.Reencrypted),
+				"failed":      int64(report.Failed),
+			}, err)
+			if err != nil {
+				self.Logger.Error("failed to re-encrypt transactions: ", err.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"payment-service/app/clock"
+	"payment-service/domain/entities"
+	"payment-service/domain/repositories"
+)
+
+func TestReencryptMovesRowsUnderTheRotatedKey(t *testing.T) {
+	ctx := context.Background()
+	now := clock.NewFake(time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC))
+	keyring := testKeyring(t, "2026-01")
+	merchants := repositories.NewMemoryMerchantRepository(keyring, now)
+	apiKeys := repositories.NewMemoryApiKeyRepository(keyring, now)
+	service := NewEncryptionService(repositories.NewMemoryTransactionRepository(now), merchants, apiKeys, keyring, viper.New(), testLogger)
+
+	credentials, signingSecret := `{"secretKey":"sk_live_1"}`, "whsec_1"
+	merchant, err := merchants.SaveMerchant(ctx, entities.Merchant{Name: "acme", Credentials: &credentials})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKey, err := apiKeys.SaveApiKey(ctx, entities.ApiKey{Prefix: "psk_1", SigningSecret: &signingSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apiKeys.SaveApiKey(ctx, entities.ApiKey{Prefix: "psk_2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if report, err := service.Reencrypt(ctx, 10, false); err != nil || report.Checked != 0 {
+		t.Fatalf("before rotation Reencrypt checked %d rows, %v, want none", report.Checked, err)
+	}
+
+	// Restart with 2026-02 active, keeping 2026-01 to read the existing rows.
+	*keyring = *testKeyring(t, "2026-02", "2026-01")
+
+	report, err := service.Reencrypt(ctx, 10, true)
+	if err != nil || report.Checked != 2 || report.Reencrypted != 0 || report.ActiveKeyId != "2026-02" {
+		t.Fatalf("dry run = %+v, %v, want 2 rows checked and none re-encrypted under 2026-02", report, err)
+	}
+	if stored, _ := merchants.Stored(merchant.ID); stored.EncryptionKeyId != "2026-01" {
+		t.Fatalf("dry run moved the merchant under %q", stored.EncryptionKeyId)
+	}
+
+	report, err = service.Reencrypt(ctx, 10, false)
+	if err != nil || report.Checked != 2 || report.Reencrypted != 2 || report.Failed != 0 {
+		t.Fatalf("Reencrypt = %+v, %v, want 2 rows re-encrypted", report, err)
+	}
+	storedMerchant, _ := merchants.Stored(merchant.ID)
+	storedApiKey, _ := apiKeys.Stored(apiKey.ID)
+	if storedMerchant.EncryptionKeyId != "2026-02" || storedApiKey.EncryptionKeyId != "2026-02" {
+		t.Fatalf("rows are under %q and %q, want 2026-02", storedMerchant.EncryptionKeyId, storedApiKey.EncryptionKeyId)
+	}
+
+	// Once the old master key is retired the rows are still readable.
+	*keyring = *testKeyring(t, "2026-02")
+	readMerchant, err := merchants.GetMerchantById(ctx, merchant.ID)
+	if err != nil || *readMerchant.Credentials != credentials {
+		t.Errorf("merchant credentials after retiring 2026-01: %v", err)
+	}
+	readApiKey, err := apiKeys.GetApiKeyById(ctx, apiKey.ID)
+	if err != nil || *readApiKey.SigningSecret != signingSecret {
+		t.Errorf("api key signing secret after retiring 2026-01: %v", err)
+	}
+
+	if report, err := service.Reencrypt(ctx, 10, false); err != nil || report.Checked != 0 {
+		t.Errorf("second run checked %d rows, %v, want none", report.Checked, err)
+	}
+}
+
+func TestReencryptNeedsAMasterKey(t *testing.T) {
+	now := clock.System()
+	keyring := testKeyring(t)
+	service := NewEncryptionService(repositories.NewMemoryTransactionRepository(now), repositories.NewMemoryMerchantRepository(keyring, now),
+		repositories.NewMemoryApiKeyRepository(keyring, now), keyring, viper.New(), testLogger)
+	if _, err := service.Reencrypt(context.Background(), 10, false); err == nil {
+		t.Error("Reencrypt without a master key succeeded")
+	}
+}
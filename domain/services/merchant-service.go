@@ -0,0 +1,312 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"payment-service/app/clock"
+	"payment-service/app/encryption"
+	"payment-service/app/httpclient"
+	"payment-service/app/logger"
+	"payment-service/domain/entities"
+	"payment-service/domain/providers"
+	"payment-service/domain/repositories"
+	"payment-service/domain/types"
+	"payment-service/errors"
+	"payment-service/interfaces"
+)
+
+// MerchantService manages merchants and resolves the provider configuration
+// a request acts with. A nil merchant stands for the platform itself, which
+// uses the global payment.* configuration. Providers are created with
+// ProviderFactory, which tests replace with fakes.
+type MerchantService struct {
+	MerchantRepository repositories.MerchantRepository
+	ProviderFactory    ProviderFactory
+	Config             *viper.Viper
+	Keyring            *encryption.Keyring
+	Logger             *logger.Logger
+	Clock              clock.Clock
+}
+
+// ProviderFactory creates the named provider acting with config, like
+// providers.NewPaymentProviderByName.
+type ProviderFactory func(name string, config types.ProviderConfig) (interfaces.IPaymentProvider, error)
+
+func NewMerchantService(merchantRepository repositories.MerchantRepository, config *viper.Viper, keyring *encryption.Keyring, log *logger.Logger, clock clock.Clock) *MerchantService {
+	return &MerchantService{
+		MerchantRepository: merchantRepository,
+		ProviderFactory: func(name string, config types.ProviderConfig) (interfaces.IPaymentProvider, error) {
+			return providers.NewPaymentProviderByName(name, config, log)
+		},
+		Config:  config,
+		Keyring: keyring,
+		Logger:  log,
+		Clock:   clock,
+	}
+}
+
+func (self *MerchantService) CreateMerchant(ctx context.Context, params types.MerchantParams) (*entities.Merchant, error) {
+	if strings.TrimSpace(params.Name) == "" {
+		return nil, &errors.ValidationError{
+			Message: "merchant name is required",
+		}
+	}
+
+	merchant := entities.Merchant{Name: params.Name}
+	if err := applyMerchantParams(&merchant, params); err != nil {
+		return nil, err
+	}
+	return self.saveMerchant(ctx, merchant, "merchant created: ")
+}
+
+// UpdateMerchant changes the fields set in params. Non-empty credentials
+// replace the stored ones field by field.
+func (self *MerchantService) UpdateMerchant(ctx context.Context, id uint, params types.MerchantParams) (*entities.Merchant, error) {
+	merchant, err := self.GetMerchant(ctx, id)
+	if err != nil || merchant == nil {
+		return merchant, err
+	}
+
+	if strings.TrimSpace(params.Name) != "" {
+		merchant.Name = params.Name
+	}
+	if err := applyMerchantParams(merchant, params); err != nil {
+		return nil, err
+	}
+	return self.saveMerchant(ctx, *merchant, "merchant updated: ")
+}
+
+// SetMerchantDisabled disables or re-enables a merchant. API keys of a
+// disabled merchant are rejected and its webhooks are ignored.
+func (self *MerchantService) SetMerchantDisabled(ctx context.Context, id uint, disabled bool) (*entities.Merchant, error) {
+	merchant, err := self.GetMerchant(ctx, id)
+	if err != nil || merchant == nil {
+		return merchant, err
+	}
+
+	if !disabled {
+		merchant.DisabledAt = nil
+		return self.saveMerchant(ctx, *merchant, "merchant enabled: ")
+	}
+	if merchant.DisabledAt == nil {
+		disabledAt := self.Clock.Now().UTC()
+		merchant.DisabledAt = &disabledAt
+	}
+	return self.saveMerchant(ctx, *merchant, "merchant disabled: ")
+}
+
+// GetMerchant returns the merchant with its decrypted credentials, or nil
+// when it does not exist.
+func (self *MerchantService) GetMerchant(ctx context.Context, id uint) (*entities.Merchant, error) {
+	merchant, err := self.MerchantRepository.GetMerchantById(ctx, id)
+	if err != nil {
+		return nil, &errors.InternalServerError{
+			Message: err.Error(),
+		}
+	}
+	return merchant, nil
+}
+
+// GetActiveMerchant is GetMerchant for request handling: a missing or
+// disabled merchant is a validation error.
+func (self *MerchantService) GetActiveMerchant(ctx context.Context, id uint) (*entities.Merchant, error) {
+	merchant, err := self.GetMerchant(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if merchant == nil || merchant.DisabledAt != nil {
+		return nil, &errors.ValidationError{
+			Message: "merchant not found or disabled",
+		}
+	}
+	return merchant, nil
+}
+
+func (self *MerchantService) ListMerchants(ctx context.Context) ([]entities.Merchant, error) {
+	merchants, err := self.MerchantRepository.ListMerchants(ctx)
+	if err != nil {
+		return nil, &errors.InternalServerError{
+			Message: err.Error(),
+		}
+	}
+	return merchants, nil
+}
+
+// ProviderConfig returns the credentials and settings to act with for
+// merchant. Unset fee settings fall back to the global configuration;
+// credentials never do. Provider timeouts, retry policies and currencies
+// are global.
+func (self *MerchantService) ProviderConfig(merchant *entities.Merchant) (types.ProviderConfig, error) {
+	config := self.Config
+	providerConfig := types.ProviderConfig{
+		AuthorizeFeePercent:         config.GetFloat64("payment.authorize_fee_percent"),
+		AuthorizeFeeFixed:           config.GetFloat64("payment.authorize_fee_fixed"),
+		AuthorizeSettlementCurrency: config.GetString("payment.authorize_settlement_currency"),
+		StripeTimeout:               config.GetDuration("payment.stripe_timeout"),
+		AuthorizeTimeout:            config.GetDuration("payment.authorize_timeout"),
+		StripeRetry:                 retryPolicy(config, "stripe"),
+		AuthorizeRetry:              retryPolicy(config, "authorize"),
+		StripeCurrencies:            currencyList(config.GetString("payment.stripe_currencies")),
+		AuthorizeCurrencies:         currencyList(config.GetString("payment.authorize_currencies")),
+		StripeCardDeposits:          config.GetBool("payment.stripe_card_deposits"),
+		StripeBaseUrl:               config.GetString("payment.stripe_base_url"),
+		AuthorizeBaseUrl:            config.GetString("payment.authorize_base_url"),
+	}
+	// Stripe says in this header whether a failed request may be retried.
+	providerConfig.StripeRetry.ShouldRetryHeader = "Stripe-Should-Retry"
+
+	if merchant == nil {
+		providerConfig.Credentials = types.MerchantCredentials{
+			StripeSecretKey:              config.GetString("payment.stripe_secret_key"),
+			StripeEndpointSecret:         config.GetString("payment.stripe_endpoint_secret"),
+			AuthorizeLoginId:             config.GetString("payment.authorize_login_id"),
+			AuthorizeTransactionKey:      config.GetString("payment.authorize_transaction_key"),
+			AuthorizeWebhookSignatureKey: config.GetString("payment.authorize_net_webhook_signature_key"),
+		}
+		return providerConfig, nil
+	}
+
+	providerConfig.MerchantId = &merchant.ID
+	if merchant.Credentials != nil {
+		if err := json.Unmarshal([]byte(*merchant.Credentials), &providerConfig.Credentials); err != nil {
+			return providerConfig, &errors.InternalServerError{
+				Message: "failed to read merchant credentials: " + err.Error(),
+			}
+		}
+	}
+	if merchant.AuthorizeFeePercent != nil {
+		providerConfig.AuthorizeFeePercent = *merchant.AuthorizeFeePercent
+	}
+	if merchant.AuthorizeFeeFixed != nil {
+		providerConfig.AuthorizeFeeFixed = *merchant.AuthorizeFeeFixed
+	}
+	if merchant.AuthorizeSettlementCurrency != "" {
+		providerConfig.AuthorizeSettlementCurrency = merchant.AuthorizeSettlementCurrency
+	}
+	return providerConfig, nil
+}
+
+// PaymentProvider returns the named provider acting for merchant.
+func (self *MerchantService) PaymentProvider(merchant *entities.Merchant, name string) (interfaces.IPaymentProvider, error) {
+	config, err := self.ProviderConfig(merchant)
+	if err != nil {
+		return nil, err
+	}
+	return self.ProviderFactory(name, config)
+}
+
+// TransactionMerchant returns the merchant a stored transaction belongs to,
+// or nil for platform transactions.
+func (self *MerchantService) TransactionMerchant(ctx context.Context, transaction entities.Transaction) (*entities.Merchant, error) {
+	if transaction.MerchantID == nil {
+		return nil, nil
+	}
+	merchant, err := self.GetMerchant(ctx, *transaction.MerchantID)
+	if err != nil {
+		return nil, err
+	}
+	if merchant == nil {
+		return nil, &errors.InternalServerError{
+			Message: "merchant of transaction " + transaction.TransactionID + " not found",
+		}
+	}
+	return merchant, nil
+}
+
+// TransactionProvider returns the provider that processed a stored
+// transaction, acting for the transaction's merchant.
+func (self *MerchantService) TransactionProvider(ctx context.Context, transaction entities.Transaction) (interfaces.IPaymentProvider, error) {
+	merchant, err := self.TransactionMerchant(ctx, transaction)
+	if err != nil {
+		return nil, err
+	}
+	return self.PaymentProvider(merchant, transaction.GatewayName)
+}
+
+func (self *MerchantService) saveMerchant(ctx context.Context, merchant entities.Merchant, logMessage string) (*entities.Merchant, error) {
+	if merchant.Credentials != nil && !self.Keyring.Enabled() {
+		return nil, &errors.ValidationError{
+			Message: "an encryption master key must be configured to store merchant credentials",
+		}
+	}
+
+	merchant, err := self.MerchantRepository.SaveMerchant(ctx, merchant)
+	if err != nil {
+		return nil, &errors.InternalServerError{
+			Message: err.Error(),
+		}
+	}
+
+	self.Logger.Info(logMessage, merchant.Name)
+	return &merchant, nil
+}
+
+func applyMerchantParams(merchant *entities.Merchant, params types.MerchantParams) error {
+	if params.Credentials != nil {
+		var credentials types.MerchantCredentials
+		if merchant.Credentials != nil {
+			if err := json.Unmarshal([]byte(*merchant.Credentials), &credentials); err != nil {
+				return &errors.InternalServerError{
+					Message: "failed to read merchant credentials: " + err.Error(),
+				}
+			}
+		}
+		mergeCredentials(&credentials, *params.Credentials)
+
+		credentialsJson, _ := json.Marshal(credentials)
+		credentialsStr := string(credentialsJson)
+		merchant.Credentials = &credentialsStr
+	}
+	if params.AuthorizeFeePercent != nil {
+		merchant.AuthorizeFeePercent = params.AuthorizeFeePercent
+	}
+	if params.AuthorizeFeeFixed != nil {
+		merchant.AuthorizeFeeFixed = params.AuthorizeFeeFixed
+	}
+	if params.AuthorizeSettlementCurrency != nil {
+		merchant.AuthorizeSettlementCurrency = strings.ToUpper(*params.AuthorizeSettlementCurrency)
+	}
+	return nil
+}
+
+func mergeCredentials(credentials *types.MerchantCredentials, update types.MerchantCredentials) {
+	for _, field := range []struct {
+		target *string
+		value  string
+	}{
+		{&credentials.StripeSecretKey, update.StripeSecretKey},
+		{&credentials.StripeEndpointSecret, update.StripeEndpointSecret},
+		{&credentials.AuthorizeLoginId, update.AuthorizeLoginId},
+		{&credentials.AuthorizeTransactionKey, update.AuthorizeTransactionKey},
+		{&credentials.AuthorizeWebhookSignatureKey, update.AuthorizeWebhookSignatureKey},
+	} {
+		if field.value != "" {
+			*field.target = field.value
+		}
+	}
+}
+
+// retryPolicy reads payment.<provider>_retry_* from the configuration.
+// Unset values fall back to httpclient.DefaultRetryPolicy.
+func retryPolicy(config *viper.Viper, provider string) httpclient.RetryPolicy {
+	return httpclient.RetryPolicy{
+		MaxAttempts: config.GetInt("payment." + provider + "_retry_max_attempts"),
+		BaseDelay:   config.GetDuration("payment." + provider + "_retry_base_delay"),
+		MaxDelay:    config.GetDuration("payment." + provider + "_retry_max_delay"),
+	}
+}
+
+// currencyList splits a comma separated list of currency codes.
+func currencyList(value string) []string {
+	var currencies []string
+	for _, currency := range strings.Split(value, ",") {
+		if currency = strings.TrimSpace(currency); currency != "" {
+			currencies = append(currencies, strings.ToUpper(currency))
+		}
+	}
+	return currencies
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"payment-service/app/logger"
+	"payment-service/domain/entities"
+	"payment-service/domain/metrics"
+	"payment-service/domain/types"
+	"payment-service/errors"
+	"payment-service/interfaces"
+	"payment-service/requests"
+	"strconv"
+	"time"
+
+	"github.com/stripe/stripe-go"
+)
+
+// OperationsService backs operational tooling such as paymentctl. Every
+// mutating operation takes a dryRun flag that reports what would change
+// without calling the provider's write APIs or saving.
+type OperationsService struct {
+	PaymentService *PaymentService
+	Logger         *logger.Logger
+}
+
+func NewOperationsService(paymentService *PaymentService, log *logger.Logger) *OperationsService {
+	return &OperationsService{
+		PaymentService: paymentService,
+		Logger:         log,
+	}
+}
+
+// FindTransaction returns the merchant's transaction with the identifier,
+// where a nil merchantId is the platform.
+func (self *OperationsService) FindTransaction(ctx context.Context, merchantId *uint, id string) (*entities.Transaction, error) {
+	transaction, err := self.PaymentService.TransactionRepository.FindTransaction(ctx, merchantId, id)
+	if err != nil {
+		return nil, &errors.InternalServerError{
+			Message: err.Error(),
+		}
+	}
+	if transaction == nil {
+		return nil, &errors.NotFoundError{
+			Message: "Transaction not found: " + id,
+		}
+	}
+	return transaction, nil
+}
+
+func (self *OperationsService) ListTransactions(ctx context.Context, filter types.TransactionFilter) ([]entities.Transaction, error) {
+	transactions, err := self.PaymentService.TransactionRepository.ListTransactions(ctx, filter)
+	if err != nil {
+		return nil, &errors.InternalServerError{
+			Message: err.Error(),
+		}
+	}
+	return transactions, nil
+}
+
+// HeldStatuses are statuses a resync keeps even when the provider reports
+// another one, unless it is forced: a mismatch is held for review, and
+// Stripe keeps reporting a refunded deposit's PaymentIntent as succeeded.
+var HeldStatuses = map[string]bool{
+	"mismatch":           true,
+	"refunded":           true,
+	"partially_refunded": true,
+}
+
+// ResyncTransaction fetches the provider's view of the transaction and
+// stores the resulting status unless dryRun is set. A transaction in one of
+// the HeldStatuses is only moved when force is set.
+func (self *OperationsService) ResyncTransaction(ctx context.Context, transaction entities.Transaction, force bool, dryRun bool) (types.ResyncResult, error) {
+	result := types.ResyncResult{
+		TransactionId:  transaction.TransactionID,
+		GatewayName:    transaction.GatewayName,
+		PaymentId:      transaction.PaymentId,
+		PreviousStatus: transaction.Status,
+		Status:         transaction.Status,
+	}
+
+	provider, err := self.PaymentService.MerchantService.TransactionProvider(ctx, transaction)
+	if err != nil {
+		return result, err
+	}
+	statusProvider, ok := provider.(interfaces.IStatusProvider)
+	if !ok {
+		return result, &errors.ValidationError{
+			Message: "provider " + transaction.GatewayName + " does not support status lookups",
+		}
+	}
+
+	synced, err := statusProvider.FetchStatus(ctx, transaction)
+	if err != nil {
+		return result, err
+	}
+	result.ProviderStatus = synced.Status
+	if HeldStatuses[transaction.Status] && !force {
+		result.Held = synced.Status != transaction.Status
+		return result, nil
+	}
+	result.Status = synced.Status
+	result.Changed = synced.Status != transaction.Status || synced.ChargeId != transaction.ChargeId
+	if !result.Changed || dryRun {
+		return result, nil
+	}
+
+	if synced.Status == "succeeded" && synced.FeeAmount == nil {
+		synced = self.PaymentService.applyFees(ctx, provider, synced)
+	}
+	if _, err := self.PaymentService.TransactionRepository.SaveTransaction(ctx, synced); err != nil {
+		return result, &errors.InternalServerError{
+			Message: "failed to save resynced transaction: " + err.Error(),
+		}
+	}
+	result.Applied = true
+	metrics.RecordTransaction(synced)
+	self.Logger.Infof("transaction %s resynced from %s to %s", transaction.TransactionID, result.PreviousStatus, result.Status)
+	return result, nil
+}
+
+// RefundTransaction refunds a succeeded or partially refunded deposit.
+// amount <= 0 refunds what is left of the transaction amount; refunds never
+// add up to more than the amount.
+func (self *OperationsService) RefundTransaction(ctx context.Context, transaction entities.Transaction, amount float64, dryRun bool) (types.RefundResult, error) {
+	remaining := math.Round((transaction.Amount-transaction.RefundedAmount)*100) / 100
+	if amount <= 0 {
+		amount = remaining
+	}
+	result := types.RefundResult{
+		TransactionId:  transaction.TransactionID,
+		GatewayName:    transaction.GatewayName,
+		Amount:         amount,
+		PreviousStatus: transaction.Status,
+		Status:         transaction.Status,
+	}
+
+	if transaction.Status != "succeeded" && transaction.Status != "partially_refunded" {
+		return result, &errors.ConflictError{
+			Message: "only succeeded and partially refunded transactions can be refunded, status is " + transaction.Status,
+		}
+	}
+	if amount > remaining {
+		return result, &errors.ValidationError{
+			Message: "refund amount exceeds the amount left to refund",
+		}
+	}
+
+	provider, err := self.PaymentService.MerchantService.TransactionProvider(ctx, transaction)
+	if err != nil {
+		return result, err
+	}
+	refundProvider, ok := provider.(interfaces.IRefundProvider)
+	if !ok {
+		return result, &errors.ValidationError{
+			Message: "provider " + transaction.GatewayName + " does not support refunds",
+		}
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	refunded, err := refundProvider.Refund(ctx, transaction, amount)
+	if err != nil {
+		return result, err
+	}
+	if _, err := self.PaymentService.TransactionRepository.SaveTransaction(ctx, refunded); err != nil {
+		return result, &errors.InternalServerError{
+			Message: "refund succeeded but the transaction could not be saved: " + err.Error(),
+		}
+	}
+	result.Status = refunded.Status
+	result.Applied = true
+	metrics.RecordTransaction(refunded)
+	self.Logger.Infof("transaction %s refunded %.2f", transaction.TransactionID, amount)
+	return result, nil
+}
+
+// ReplayWebhook feeds a stored webhook body back through the regular event
+// handlers, skipping signature verification. The event is handled for the
+// merchant with merchantId, as if it had reached that merchant's webhook
+// endpoint; a nil merchantId is the platform. In dry-run mode it only
+// returns the transaction the event refers to.
+func (self *OperationsService) ReplayWebhook(ctx context.Context, provider string, merchantId *uint, payload []byte, dryRun bool) (*entities.Transaction, error) {
+	switch provider {
+	case "stripe":
+		var event stripe.Event
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, &errors.ValidationError{
+				Message: "invalid stripe event: " + err.Error(),
+			}
+		}
+		var object struct {
+			ID            string `json:"id"`
+			PaymentIntent string `json:"payment_intent"`
+		}
+		if event.Data != nil {
+			json.Unmarshal(event.Data.Raw, &object)
+		}
+		paymentId := object.ID
+		if event.Type == "charge.refunded" {
+			paymentId = object.PaymentIntent
+		}
+		transaction, err := self.FindTransaction(ctx, merchantId, paymentId)
+		if err != nil || dryRun {
+			return transaction, err
+		}
+		merchant, err := self.PaymentService.MerchantService.TransactionMerchant(ctx, *transaction)
+		if err != nil {
+			return transaction, err
+		}
+		if err := self.PaymentService.HandleStripeEvents(ctx, merchant, event); err != nil {
+			return transaction, err
+		}
+		return self.FindTransaction(ctx, merchantId, paymentId)
+	case "authorize":
+		var event requests.WebhookEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, &errors.ValidationError{
+				Message: "invalid authorize event: " + err.Error(),
+			}
+		}
+		transaction, err := self.FindTransaction(ctx, merchantId, event.Payload.ID)
+		if err != nil || dryRun {
+			return transaction, err
+		}
+		merchant, err := self.PaymentService.MerchantService.TransactionMerchant(ctx, *transaction)
+		if err != nil {
+			return transaction, err
+		}
+		if err := self.PaymentService.HandleAuthorizeEvents(ctx, merchant, event); err != nil {
+			return transaction, err
+		}
+		return self.FindTransaction(ctx, merchantId, event.Payload.ID)
+	default:
+		return nil, &errors.ValidationError{
+			Message: "Invalid provider",
+		}
+	}
+}
+
+var transactionCsvHeader = []string{
+	"id", "merchant_id", "transaction_id", "transaction_type", "gateway_name", "status",
+	"amount", "currency", "fee_amount", "net_amount", "settlement_currency",
+	"payment_id", "charge_id", "created_at", "updated_at",
+}
+
+// WriteTransactionsCsv writes transactions as CSV with a header row.
+func WriteTransactionsCsv(w io.Writer, transactions []entities.Transaction) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(transactionCsvHeader); err != nil {
+		return err
+	}
+
+	for _, transaction := range transactions {
+		err := writer.Write([]string{
+			strconv.FormatUint(uint64(transaction.ID), 10),
+			formatOptionalId(transaction.MerchantID),
+			transaction.TransactionID,
+			transaction.TransactionType,
+			transaction.GatewayName,
+			transaction.Status,
+			strconv.FormatFloat(transaction.Amount, 'f', 2, 64),
+			transaction.Currency,
+			formatOptionalAmount(transaction.FeeAmount),
+			formatOptionalAmount(transaction.NetAmount),
+			transaction.SettlementCurrency,
+			transaction.PaymentId,
+			transaction.ChargeId,
+			transaction.CreatedAt.UTC().Format(time.RFC3339),
+			transaction.UpdatedAt.UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func formatOptionalId(id *uint) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*id), 10)
+}
+
+func formatOptionalAmount(amount *float64) string {
+	if amount == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*amount, 'f', 2, 64)
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"payment-service/domain/entities"
+	"payment-service/errors"
+)
+
+func TestRefundTransaction(t *testing.T) {
+	deposit := entities.Transaction{
+		TransactionID:   "refund-dep",
+		TransactionType: "deposit",
+		Amount:          1000,
+		Currency:        "usd",
+		Status:          "succeeded",
+		PaymentId:       "pi_1",
+		GatewayName:     "stripe",
+	}
+	partiallyRefunded := deposit
+	partiallyRefunded.Status = "partially_refunded"
+	partiallyRefunded.RefundedAmount = 300
+	refunded := deposit
+	refunded.Status = "refunded"
+	refunded.RefundedAmount = 1000
+
+	tests := []struct {
+		name         string
+		stored       entities.Transaction
+		amount       float64
+		wantErr      error
+		wantStatus   string
+		wantRefunded float64
+	}{
+		{"partial refund", deposit, 300, nil, "partially_refunded", 300},
+		{"full refund by default", deposit, 0, nil, "refunded", 1000},
+		{"second partial refund", partiallyRefunded, 300, nil, "partially_refunded", 600},
+		{"rest of a partial refund by default", partiallyRefunded, 0, nil, "refunded", 1000},
+		{"more than is left", partiallyRefunded, 800, &errors.ValidationError{}, "partially_refunded", 300},
+		{"refunded transaction", refunded, 100, &errors.ConflictError{}, "refunded", 1000},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fixture := newPaymentServiceFixture(map[string]*fakeProvider{"stripe": approvingProvider()})
+			stored := fixture.save(t, test.stored)
+			operations := NewOperationsService(fixture.service, testLogger)
+
+			_, err := operations.RefundTransaction(context.Background(), stored, test.amount, false)
+			if (err == nil) != (test.wantErr == nil) || (err != nil && errors.MapErrorToCode(err) != errors.MapErrorToCode(test.wantErr)) {
+				t.Fatalf("RefundTransaction error %v, want %T", err, test.wantErr)
+			}
+
+			after := fixture.stored(t, test.stored.TransactionID)
+			if after.Status != test.wantStatus || after.RefundedAmount != test.wantRefunded {
+				t.Errorf("stored %s with %v refunded, want %s with %v", after.Status, after.RefundedAmount, test.wantStatus, test.wantRefunded)
+			}
+		})
+	}
+}
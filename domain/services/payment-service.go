@@ -1,46 +1,72 @@
 package services
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha512"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"github.com/stripe/stripe-go"
-	"github.com/stripe/stripe-go/refund"
+	"math"
 	"net/http"
-	"payment-service/app"
+	"payment-service/app/logger"
+	"payment-service/app/tracing"
+	"payment-service/domain/declines"
 	"payment-service/domain/entities"
+	"payment-service/domain/metrics"
+	"payment-service/domain/providers"
 	"payment-service/domain/repositories"
 	"payment-service/domain/types"
 	"payment-service/errors"
 	"payment-service/interfaces"
 	"payment-service/requests"
 	"strings"
+	"time"
 )
 
+// PaymentService processes payments for a merchant, or for the platform
+// when the merchant is nil. Providers are created per call with the
+// merchant's credentials; deposits and withdrawals are routed to one by
+// RoutingService, which is recorded on the transaction.
 type PaymentService struct {
-	PaymentProvider       interfaces.IPaymentProvider
-	TransactionRepository *repositories.TransactionRepository
+	TransactionRepository repositories.TransactionRepository
+	MerchantService       *MerchantService
+	AlertService          *AlertService
+	RoutingService        *RoutingService
+	CircuitBreakerService *CircuitBreakerService
+	ApprovalRateService   *ApprovalRateService
+	Logger                *logger.Logger
 }
 
-func NewPaymentService() *PaymentService {
+func NewPaymentService(transactionRepository repositories.TransactionRepository, merchantService *MerchantService, alertService *AlertService, routingService *RoutingService, circuitBreakerService *CircuitBreakerService, approvalRateService *ApprovalRateService, log *logger.Logger) *PaymentService {
 	return &PaymentService{
-		TransactionRepository: repositories.NewTransactionRepository(),
+		TransactionRepository: transactionRepository,
+		MerchantService:       merchantService,
+		AlertService:          alertService,
+		RoutingService:        routingService,
+		CircuitBreakerService: circuitBreakerService,
+		ApprovalRateService:   approvalRateService,
+		Logger:                log,
 	}
 }
 
-func (self *PaymentService) SetPaymentProvider(provider interfaces.IPaymentProvider) {
-	self.PaymentProvider = provider
+func (self *PaymentService) Deposit(ctx context.Context, merchant *entities.Merchant, params types.DepositParams) (*entities.Transaction, error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.Deposit", tracing.WithAttributes(
+		tracing.String("payment.provider", params.Provider),
+		tracing.String("payment.transaction_id", params.TransactionId),
+	))
+	defer span.End()
+
+	ctx = logger.ContextWith(ctx, logger.FieldTransactionId, params.TransactionId, logger.FieldProvider, params.Provider)
+	transaction, err := self.deposit(ctx, merchant, params)
+	span.RecordError(err)
+	return transaction, err
 }
 
-func (self *PaymentService) Deposit(params types.DepositParams) (*entities.Transaction, error) {
-	if self.PaymentProvider == nil {
-		return nil, &errors.ValidationError{
-			Message: "Payment provider is not set",
-		}
-	}
-
-	existingTransaction, err := self.TransactionRepository.GetTransactionByTransactionId(params.TransactionId, nil)
+func (self *PaymentService) deposit(ctx context.Context, merchant *entities.Merchant, params types.DepositParams) (*entities.Transaction, error) {
+	log := self.Logger.FromContext(ctx)
+	existingTransaction, err := self.TransactionRepository.GetTransactionByTransactionId(ctx, merchantId(merchant), params.TransactionId)
 	if err != nil {
 		return nil, &errors.InternalServerError{
 			Message: err.Error(),
@@ -48,50 +74,98 @@ func (self *PaymentService) Deposit(params types.DepositParams) (*entities.Trans
 	}
 
 	if existingTransaction != nil {
-		app.App().Logger().Error("transaction already exists: ", params.TransactionId)
-		return nil, &errors.ValidationError{
+		log.Error("transaction already exists: ", params.TransactionId)
+		return nil, &errors.ConflictError{
 			Message: "Transaction already exists",
 		}
 	}
 
-	transaction, err := self.TransactionRepository.SaveTransaction(entities.Transaction{
+	decision, provider, err := self.RoutingService.Route(ctx, merchant, types.RoutingRequest{
+		Operation:  providers.OperationDeposit,
+		Provider:   params.Provider,
+		Method:     params.Method(),
+		Currency:   params.Currency,
+		Amount:     params.Amount,
+		CardNumber: params.CreditCardNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if decision.Provider != params.Provider {
+		params.Provider = decision.Provider
+		ctx = logger.ContextWith(ctx, logger.FieldProvider, decision.Provider)
+		log = self.Logger.FromContext(ctx)
+		tracing.SpanFromContext(ctx).SetAttributes(tracing.String("payment.provider", decision.Provider))
+	}
+	// Transactions hold amounts in the unit of their provider, which for a
+	// card deposit sent to Stripe is not the unit of the request.
+	params.Amount = providers.ProviderAmount(params.Provider, providers.OperationDeposit, params.Method(), params.Amount, params.Currency)
+	decisionJson, _ := json.Marshal(decision)
+	decisionStr := string(decisionJson)
+
+	transaction, err := self.TransactionRepository.SaveTransaction(ctx, entities.Transaction{
 		Amount:          params.Amount,
 		Currency:        params.Currency,
 		TransactionID:   params.TransactionId,
 		Status:          "pending",
 		TransactionType: "deposit",
 		GatewayName:     params.Provider,
-	}, nil)
+		MerchantID:      merchantId(merchant),
+		TraceParent:     tracing.Traceparent(tracing.SpanContextFromContext(ctx)),
+		RoutingDecision: &decisionStr,
+	})
 
 	if err != nil {
-		app.App().Logger().Error("failed to save transaction in initial state: ", err.Error())
+		self.CircuitBreakerService.Breaker(params.Provider).Release()
+		log.Error("failed to save transaction in initial state: ", err.Error())
 		return &transaction, &errors.InternalServerError{
 			Message: err.Error(),
 		}
 	}
 
-	transaction, err = self.PaymentProvider.Charge(params, transaction)
-	_, txErr := self.TransactionRepository.SaveTransaction(transaction, nil)
+	_, providerSpan := tracing.Start(ctx, params.Provider+".Charge", tracing.WithKind(tracing.SpanKindClient))
+	start := time.Now()
+	transaction, err = provider.Charge(ctx, params, transaction)
+	metrics.ObserveProviderCall(params.Provider, "charge", start, transaction, err)
+	self.CircuitBreakerService.Record(params.Provider, start, transaction, err)
+	self.ApprovalRateService.Record(params.Provider, transaction, err)
+	endProviderSpan(providerSpan, transaction, err)
+	// The provider may have moved money, so its outcome is stored even if
+	// the caller has gone away in the meantime.
+	ctx = context.WithoutCancel(ctx)
+	if err == nil && transaction.Status == "succeeded" {
+		transaction = self.applyFees(ctx, provider, transaction)
+	}
+	_, txErr := self.TransactionRepository.SaveTransaction(ctx, transaction)
 	if txErr != nil {
-		app.App().Logger().Error("failed to save transaction after payment failed: ", txErr.Error())
+		log.Error("failed to save transaction after payment failed: ", txErr.Error())
 		return nil, &errors.InternalServerError{
 			Message: txErr.Error(),
 		}
 	}
+	metrics.RecordTransaction(transaction)
 	if err != nil {
 		return nil, err
 	}
 	return &transaction, nil
 }
 
-func (self *PaymentService) Withdraw(params types.WithdrawParams) (*entities.Transaction, error) {
-	if self.PaymentProvider == nil {
-		return nil, &errors.ValidationError{
-			Message: "Payment provider is not set",
-		}
-	}
+func (self *PaymentService) Withdraw(ctx context.Context, merchant *entities.Merchant, params types.WithdrawParams) (*entities.Transaction, error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.Withdraw", tracing.WithAttributes(
+		tracing.String("payment.provider", params.Provider),
+		tracing.String("payment.transaction_id", params.TransactionId),
+	))
+	defer span.End()
+
+	ctx = logger.ContextWith(ctx, logger.FieldTransactionId, params.TransactionId, logger.FieldProvider, params.Provider)
+	transaction, err := self.withdraw(ctx, merchant, params)
+	span.RecordError(err)
+	return transaction, err
+}
 
-	existingTransaction, err := self.TransactionRepository.GetTransactionByTransactionId(params.TransactionId, nil)
+func (self *PaymentService) withdraw(ctx context.Context, merchant *entities.Merchant, params types.WithdrawParams) (*entities.Transaction, error) {
+	log := self.Logger.FromContext(ctx)
+	existingTransaction, err := self.TransactionRepository.GetTransactionByTransactionId(ctx, merchantId(merchant), params.TransactionId)
 	if err != nil {
 		return nil, &errors.InternalServerError{
 			Message: err.Error(),
@@ -99,75 +173,134 @@ func (self *PaymentService) Withdraw(params types.WithdrawParams) (*entities.Tra
 	}
 
 	if existingTransaction != nil {
-		app.App().Logger().Error("transaction already exists: ", params.TransactionId)
-		return nil, &errors.ValidationError{
+		log.Error("transaction already exists: ", params.TransactionId)
+		return nil, &errors.ConflictError{
 			Message: "Transaction already exists",
 		}
 	}
 
-	transaction, err := self.TransactionRepository.SaveTransaction(entities.Transaction{
+	decision, provider, err := self.RoutingService.Route(ctx, merchant, types.RoutingRequest{
+		Operation:  providers.OperationWithdraw,
+		Provider:   params.Provider,
+		Method:     params.Method(),
+		Currency:   params.Currency,
+		Amount:     float64(params.Amount),
+		CardNumber: params.CreditCardNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if decision.Provider != params.Provider {
+		params.Provider = decision.Provider
+		ctx = logger.ContextWith(ctx, logger.FieldProvider, decision.Provider)
+		log = self.Logger.FromContext(ctx)
+		tracing.SpanFromContext(ctx).SetAttributes(tracing.String("payment.provider", decision.Provider))
+	}
+	decisionJson, _ := json.Marshal(decision)
+	decisionStr := string(decisionJson)
+
+	transaction, err := self.TransactionRepository.SaveTransaction(ctx, entities.Transaction{
 		Amount:          float64(params.Amount),
 		Currency:        params.Currency,
 		TransactionID:   params.TransactionId,
 		Status:          "pending",
 		TransactionType: "withdrawal",
 		GatewayName:     params.Provider,
-	}, nil)
+		MerchantID:      merchantId(merchant),
+		TraceParent:     tracing.Traceparent(tracing.SpanContextFromContext(ctx)),
+		RoutingDecision: &decisionStr,
+	})
 
 	if err != nil {
-		app.App().Logger().Error("failed to save transaction in initial state: ", err.Error())
+		self.CircuitBreakerService.Breaker(params.Provider).Release()
+		log.Error("failed to save transaction in initial state: ", err.Error())
 		return &transaction, &errors.InternalServerError{
 			Message: err.Error(),
 		}
 	}
 
-	transaction, err = self.PaymentProvider.Withdraw(params, transaction)
-	_, txErr := self.TransactionRepository.SaveTransaction(transaction, nil)
+	_, providerSpan := tracing.Start(ctx, params.Provider+".Withdraw", tracing.WithKind(tracing.SpanKindClient))
+	start := time.Now()
+	transaction, err = provider.Withdraw(ctx, params, transaction)
+	metrics.ObserveProviderCall(params.Provider, "withdraw", start, transaction, err)
+	self.CircuitBreakerService.Record(params.Provider, start, transaction, err)
+	self.ApprovalRateService.Record(params.Provider, transaction, err)
+	endProviderSpan(providerSpan, transaction, err)
+	// The provider may have moved money, so its outcome is stored even if
+	// the caller has gone away in the meantime.
+	ctx = context.WithoutCancel(ctx)
+	_, txErr := self.TransactionRepository.SaveTransaction(ctx, transaction)
 	if txErr != nil {
-		app.App().Logger().Error("failed to save transaction after payout failed: ", txErr.Error())
+		log.Error("failed to save transaction after payout failed: ", txErr.Error())
 		return nil, &errors.InternalServerError{
 			Message: txErr.Error(),
 		}
 	}
+	metrics.RecordTransaction(transaction)
 	if err != nil {
 		return nil, err
 	}
 	return &transaction, nil
 }
 
-func (self *PaymentService) HandleStripeEvents(event stripe.Event) error {
+// HandleStripeEvents applies a verified Stripe event to the merchant's
+// transaction it refers to. Its span links to the trace of the request that
+// created the transaction.
+func (self *PaymentService) HandleStripeEvents(ctx context.Context, merchant *entities.Merchant, event stripe.Event) error {
+	ctx, span := tracing.Start(ctx, "PaymentService.HandleStripeEvent", tracing.WithKind(tracing.SpanKindConsumer), tracing.WithAttributes(
+		tracing.String("webhook.provider", "stripe"),
+		tracing.String("webhook.event_type", event.Type),
+	))
+	defer span.End()
+
+	ctx = logger.ContextWith(ctx, logger.FieldProvider, "stripe")
+	err := self.handleStripeEvent(ctx, merchant, event)
+	span.RecordError(err)
+	return err
+}
+
+func (self *PaymentService) handleStripeEvent(ctx context.Context, merchant *entities.Merchant, event stripe.Event) error {
+	log := self.Logger.FromContext(ctx)
 	switch event.Type {
 	case "payment_intent.succeeded":
 		var paymentIntent stripe.PaymentIntent
 		json.Unmarshal(event.Data.Raw, &paymentIntent)
 
-		app.App().Logger().Info("New Payment Intent succeeded , Payment id ", paymentIntent.ID)
+		log.Info("New Payment Intent succeeded , Payment id ", paymentIntent.ID)
 
-		transaction, err := self.TransactionRepository.GetTransactionByPaymentId(paymentIntent.ID, nil)
+		transaction, err := self.getWebhookTransaction(ctx, merchant, paymentIntent.ID)
 		if err != nil {
-			app.App().Logger().Error("failed to get transaction by payment id: ", err.Error())
+			log.Error("failed to get transaction by payment id: ", err.Error())
 			return err
 		}
+
+		confirmation := webhookConfirmation{
+			TransactionType: "deposit",
+			Amount:          float64(paymentIntent.Amount),
+			Currency:        paymentIntent.Currency,
+		}
+		if reason := confirmation.mismatch(*transaction); reason != "" {
+			return self.flagMismatch(ctx, *transaction, reason, event.Data.Raw)
+		}
 		transaction.Status = "succeeded"
 
 		var latestCharge types.CustomPaymentIntent
 		json.Unmarshal(event.Data.Raw, &latestCharge)
 		transaction.ChargeId = latestCharge.LatestCharge
+		stripeProvider, _ := self.MerchantService.PaymentProvider(merchant, "stripe")
+		*transaction = self.applyFees(ctx, stripeProvider, *transaction)
 
 		responsePayloadStr := ""
 		transaction.ResponsePayload = &responsePayloadStr
 
-		_, err = self.TransactionRepository.SaveTransaction(*transaction, nil)
+		_, err = self.TransactionRepository.SaveTransaction(ctx, *transaction)
 		if err != nil {
-			app.App().Logger().Error("failed to save transaction after payment intent Success: ", err.Error())
+			log.Error("failed to save transaction after payment intent Success: ", err.Error())
 
 			// If saving the transaction fails, attempt to refund the payment
-			refundParams := &stripe.RefundParams{
-				Charge: stripe.String(latestCharge.LatestCharge),
-			}
-			_, refundErr := refund.New(refundParams)
+			refundErr := self.refundUnsaved(ctx, stripeProvider, *transaction)
 			if refundErr != nil {
-				app.App().Logger().Error("failed to refund the charge: ", refundErr.Error())
+				log.Error("failed to refund the charge: ", refundErr.Error())
 				return &errors.InternalServerError{
 					Message: "Failed to save transaction and refund charge: " + err.Error() + " and " + refundErr.Error(),
 				}
@@ -178,149 +311,368 @@ func (self *PaymentService) HandleStripeEvents(event stripe.Event) error {
 			}
 		}
 
-		app.App().Logger().Info("Payment Succeeded, Payment id", paymentIntent.ID)
+		metrics.RecordTransaction(*transaction)
+		log.Info("Payment Succeeded, Payment id", paymentIntent.ID)
 		return nil
 	case "payment_intent.payment_failed":
 		var paymentIntent stripe.PaymentIntent
 		json.Unmarshal(event.Data.Raw, &paymentIntent)
-		app.App().Logger().Info("New Payment Failed succeeded , Payment id", paymentIntent.ID)
-		transaction, err := self.TransactionRepository.GetTransactionByPaymentId(paymentIntent.ID, nil)
+		log.Info("New Payment Failed succeeded , Payment id", paymentIntent.ID)
+		transaction, err := self.getWebhookTransaction(ctx, merchant, paymentIntent.ID)
 		if err != nil {
-			app.App().Logger().Error("failed to get transaction by payment id: ", err.Error())
+			log.Error("failed to get transaction by payment id: ", err.Error())
 			return err
 		}
+		// A card error already failed the transaction when it was created.
+		alreadyFailed := transaction.Status == "failed"
 		transaction.Status = "failed"
+		if paymentIntent.LastPaymentError != nil && transaction.DeclineCode == "" {
+			declines.FromStripe(string(paymentIntent.LastPaymentError.DeclineCode), string(paymentIntent.LastPaymentError.Code)).Apply(transaction)
+		}
 		responsePayloadStr := string(event.Data.Raw)
 		transaction.ResponsePayload = &responsePayloadStr
-		_, err = self.TransactionRepository.SaveTransaction(*transaction, nil)
+		_, err = self.TransactionRepository.SaveTransaction(ctx, *transaction)
 		if err != nil {
-			app.App().Logger().Error("failed to save transaction after payment intent Success: ", err.Error())
+			log.Error("failed to save transaction after payment intent Success: ", err.Error())
 			return &errors.InternalServerError{
 				Message: err.Error(),
 			}
 		}
-		app.App().Logger().Info("Payment Failed, Payment id", paymentIntent.ID)
+		if !alreadyFailed {
+			metrics.RecordTransaction(*transaction)
+		}
+		log.Info("Payment Failed, Payment id", paymentIntent.ID)
 		return nil
 	case "charge.refunded":
 		var charge stripe.Charge
 		json.Unmarshal(event.Data.Raw, &charge)
-		app.App().Logger().Info("New Charge refunded , Payment id ", charge.PaymentIntent)
+		log.Info("New Charge refunded , Payment id ", charge.PaymentIntent)
 
-		transaction, err := self.TransactionRepository.GetTransactionByPaymentId(charge.PaymentIntent, nil)
+		transaction, err := self.getWebhookTransaction(ctx, merchant, charge.PaymentIntent)
 		if err != nil {
-			app.App().Logger().Error("failed to get transaction by payment id: ", err.Error())
+			log.Error("failed to get transaction by payment id: ", err.Error())
 			return err
 		}
-		transaction.Status = "refunded"
+		confirmation := webhookConfirmation{
+			TransactionType: "deposit",
+			Amount:          float64(charge.Amount),
+			Currency:        string(charge.Currency),
+		}
+		if reason := confirmation.mismatch(*transaction); reason != "" {
+			return self.flagMismatch(ctx, *transaction, reason, event.Data.Raw)
+		}
+		// The event is sent for partial refunds too; the charge says how
+		// much of it has been refunded so far.
+		transaction.RefundedAmount = float64(charge.AmountRefunded)
+		if charge.Refunded || transaction.RefundedAmount >= transaction.Amount {
+			transaction.Status = "refunded"
+		} else {
+			transaction.Status = "partially_refunded"
+		}
 		transaction.ChargeId = charge.ID
 		responsePayloadStr := string(event.Data.Raw)
 		transaction.ResponsePayload = &responsePayloadStr
 
-		_, err = self.TransactionRepository.SaveTransaction(*transaction, nil)
+		_, err = self.TransactionRepository.SaveTransaction(ctx, *transaction)
 		if err != nil {
 			return &errors.InternalServerError{
 				Message: "Failed to save refunded transaction" + err.Error(),
 			}
 		}
 
-		app.App().Logger().Info("Charge Refunded, Payment id", charge.PaymentIntent)
+		metrics.RecordTransaction(*transaction)
+		log.Info("Charge Refunded, Payment id", charge.PaymentIntent)
 		return nil
 	case "payout.paid":
 		var payout stripe.Payout
 		json.Unmarshal(event.Data.Raw, &payout)
-		app.App().Logger().Info("New Payout created , Payout id ", payout.ID)
+		log.Info("New Payout created , Payout id ", payout.ID)
 
-		transaction, err := self.TransactionRepository.GetTransactionByPaymentId(payout.ID, nil)
+		transaction, err := self.getWebhookTransaction(ctx, merchant, payout.ID)
 		if err != nil {
-			app.App().Logger().Error("failed to get transaction by payout id: ", err.Error())
+			log.Error("failed to get transaction by payout id: ", err.Error())
 			return err
 		}
+
+		confirmation := webhookConfirmation{
+			TransactionType: "withdrawal",
+			Amount:          float64(payout.Amount),
+			Currency:        string(payout.Currency),
+		}
+		if reason := confirmation.mismatch(*transaction); reason != "" {
+			return self.flagMismatch(ctx, *transaction, reason, event.Data.Raw)
+		}
 		transaction.Status = "succeeded"
 		responsePayloadStr := string(event.Data.Raw)
 		transaction.ResponsePayload = &responsePayloadStr
 
-		_, err = self.TransactionRepository.SaveTransaction(*transaction, nil)
+		_, err = self.TransactionRepository.SaveTransaction(ctx, *transaction)
 		if err != nil {
 			return &errors.InternalServerError{
 				Message: "Failed to save refunded transaction" + err.Error(),
 			}
 		}
 
-		app.App().Logger().Info("Payout Paid", payout.ID)
+		metrics.RecordTransaction(*transaction)
+		log.Info("Payout Paid", payout.ID)
 		return nil
 	case "payout.failed":
 		var payout stripe.Payout
 		json.Unmarshal(event.Data.Raw, &payout)
-		app.App().Logger().Info("New Payout failed , Payout id ", payout.ID)
+		log.Info("New Payout failed , Payout id ", payout.ID)
 
-		transaction, err := self.TransactionRepository.GetTransactionByPaymentId(payout.ID, nil)
+		transaction, err := self.getWebhookTransaction(ctx, merchant, payout.ID)
 		if err != nil {
-			app.App().Logger().Error("failed to get transaction by payout id: ", err.Error())
+			log.Error("failed to get transaction by payout id: ", err.Error())
 			return err
 		}
 		transaction.Status = "failed"
+		if payout.FailureCode != "" {
+			declines.FromStripePayout(string(payout.FailureCode)).Apply(transaction)
+		}
 		responsePayloadStr := string(event.Data.Raw)
 		transaction.ResponsePayload = &responsePayloadStr
 
-		_, err = self.TransactionRepository.SaveTransaction(*transaction, nil)
+		_, err = self.TransactionRepository.SaveTransaction(ctx, *transaction)
 		if err != nil {
 			return &errors.InternalServerError{
 				Message: "Failed to save refunded transaction" + err.Error(),
 			}
 		}
 
-		app.App().Logger().Info("Payout Failed", payout.ID)
+		metrics.RecordTransaction(*transaction)
+		log.Info("Payout Failed", payout.ID)
 		return nil
 	default:
-		app.App().Logger().Info("Unhandled event type: ", event.Type)
+		log.Info("Unhandled event type: ", event.Type)
 	}
 	return nil
 }
 
-func (self *PaymentService) HandleAuthorizeEvents(event requests.WebhookEvent) error {
+// HandleAuthorizeEvents applies a verified Authorize.Net event to the
+// merchant's transaction it refers to, like HandleStripeEvents.
+func (self *PaymentService) HandleAuthorizeEvents(ctx context.Context, merchant *entities.Merchant, event requests.WebhookEvent) error {
+	ctx, span := tracing.Start(ctx, "PaymentService.HandleAuthorizeEvent", tracing.WithKind(tracing.SpanKindConsumer), tracing.WithAttributes(
+		tracing.String("webhook.provider", "authorize"),
+		tracing.String("webhook.event_type", event.EventType),
+	))
+	defer span.End()
+
+	ctx = logger.ContextWith(ctx, logger.FieldProvider, "authorize")
+	err := self.handleAuthorizeEvent(ctx, merchant, event)
+	span.RecordError(err)
+	return err
+}
+
+func (self *PaymentService) handleAuthorizeEvent(ctx context.Context, merchant *entities.Merchant, event requests.WebhookEvent) error {
+	log := self.Logger.FromContext(ctx)
+	rawEvent, _ := json.Marshal(event)
+
 	switch event.EventType {
 	case "net.authorize.payment.authcapture.created":
 
-		app.App().Logger().Info("New net.authorize.payment.authcapture.created ")
+		log.Info("New net.authorize.payment.authcapture.created ")
 
-		transaction, err := self.TransactionRepository.GetTransactionByPaymentId(event.Payload.ID, nil)
+		transaction, err := self.getWebhookTransaction(ctx, merchant, event.Payload.ID)
 		if err != nil {
-			app.App().Logger().Error("failed to get transaction by payment id: ", err.Error())
+			log.Error("failed to get transaction by payment id: ", err.Error())
 			return err
 		}
+
+		// Authorize.Net webhooks do not carry the currency, only the amount.
+		confirmation := webhookConfirmation{
+			TransactionType: "deposit",
+			Amount:          event.Payload.AuthAmount,
+		}
+		if reason := confirmation.mismatch(*transaction); reason != "" {
+			return self.flagMismatch(ctx, *transaction, reason, rawEvent)
+		}
 		transaction.Status = "succeeded"
-		_, err = self.TransactionRepository.SaveTransaction(*transaction, nil)
+		if transaction.FeeAmount == nil {
+			authorizeProvider, _ := self.MerchantService.PaymentProvider(merchant, "authorize")
+			*transaction = self.applyFees(ctx, authorizeProvider, *transaction)
+		}
+		_, err = self.TransactionRepository.SaveTransaction(ctx, *transaction)
+		if err == nil {
+			metrics.RecordTransaction(*transaction)
+		}
 
-		app.App().Logger().Info("Payment Succeeded, Payment id", event.Payload.ID)
+		log.Info("Payment Succeeded, Payment id", event.Payload.ID)
 		return nil
 	case "net.authorize.payment.refund.created":
 
-		app.App().Logger().Info("net.authorize.payment.refund.created ")
+		log.Info("net.authorize.payment.refund.created ")
 
-		transaction, err := self.TransactionRepository.GetTransactionByPaymentId(event.Payload.ID, nil)
+		transaction, err := self.getWebhookTransaction(ctx, merchant, event.Payload.ID)
 		if err != nil {
-			app.App().Logger().Error("failed to get transaction by payment id: ", err.Error())
+			log.Error("failed to get transaction by payment id: ", err.Error())
 			return err
 		}
+
+		confirmation := webhookConfirmation{
+			TransactionType: "withdrawal",
+			Amount:          event.Payload.AuthAmount,
+		}
+		if reason := confirmation.mismatch(*transaction); reason != "" {
+			return self.flagMismatch(ctx, *transaction, reason, rawEvent)
+		}
 		transaction.Status = "succeeded"
-		_, err = self.TransactionRepository.SaveTransaction(*transaction, nil)
+		_, err = self.TransactionRepository.SaveTransaction(ctx, *transaction)
+		if err == nil {
+			metrics.RecordTransaction(*transaction)
+		}
 
-		app.App().Logger().Info("Refund Succeeded, Payment id", event.Payload.ID)
+		log.Info("Refund Succeeded, Payment id", event.Payload.ID)
 		return nil
 	default:
-		app.App().Logger().Info("Unhandled event type: ", event.EventType)
+		log.Info("Unhandled event type: ", event.EventType)
 	}
 	return nil
 }
 
-func (self *PaymentService) VerifyAuthorizeSignature(r *http.Request, payload []byte) bool {
+// GetTransaction returns the merchant's transaction with the given client
+// transaction id, or nil when it has none. Transaction ids are unique per
+// merchant, so platform callers (nil merchant) look up platform
+// transactions.
+func (self *PaymentService) GetTransaction(ctx context.Context, merchant *entities.Merchant, transactionId string) (*entities.Transaction, error) {
+	transaction, err := self.TransactionRepository.GetTransactionByTransactionId(ctx, merchantId(merchant), transactionId)
+	if err != nil {
+		return nil, &errors.InternalServerError{
+			Message: err.Error(),
+		}
+	}
+	return transaction, nil
+}
+
+// getWebhookTransaction looks up the transaction a webhook refers to. A
+// webhook may only touch transactions of the merchant whose endpoint
+// received it; platform endpoints only touch platform transactions, so the
+// transactions of other merchants are not found.
+func (self *PaymentService) getWebhookTransaction(ctx context.Context, merchant *entities.Merchant, paymentId string) (*entities.Transaction, error) {
+	transaction, err := self.TransactionRepository.GetTransactionByPaymentId(ctx, merchantId(merchant), paymentId)
+	if err != nil {
+		return nil, err
+	}
+	span := tracing.SpanFromContext(ctx)
+	span.SetAttributes(tracing.String("payment.transaction_id", transaction.TransactionID))
+	if origin, ok := tracing.ParseTraceparent(transaction.TraceParent); ok {
+		span.AddLink(tracing.Link{
+			SpanContext: origin,
+			Attributes:  []tracing.Attribute{tracing.String("link.type", "originating_transaction")},
+		})
+	}
+	return transaction, nil
+}
+
+// endProviderSpan records the outcome of a provider call on its span.
+func endProviderSpan(span *tracing.Span, transaction entities.Transaction, err error) {
+	span.SetAttributes(
+		tracing.String("payment.status", transaction.Status),
+		tracing.String("payment.error_class", metrics.ErrorClass(transaction, err)),
+	)
+	span.RecordError(err)
+	span.End()
+}
+
+// refundUnsaved refunds a Stripe payment whose success could not be stored.
+func (self *PaymentService) refundUnsaved(ctx context.Context, provider interfaces.IPaymentProvider, transaction entities.Transaction) error {
+	refundProvider, ok := provider.(interfaces.IRefundProvider)
+	if !ok {
+		return fmt.Errorf("stripe is not configured")
+	}
+	_, err := refundProvider.Refund(ctx, transaction, transaction.Amount)
+	return err
+}
+
+// webhookConfirmation is what a provider webhook claims about a transaction
+// it confirms. An empty Currency skips the currency check for providers that
+// do not send one.
+type webhookConfirmation struct {
+	TransactionType string
+	Amount          float64
+	Currency        string
+}
+
+// mismatch returns a description of the first field that differs from the
+// stored transaction, or an empty string when the webhook matches.
+func (self webhookConfirmation) mismatch(transaction entities.Transaction) string {
+	if transaction.TransactionType != self.TransactionType {
+		return "transaction type " + transaction.TransactionType + " does not match " + self.TransactionType
+	}
+	if math.Abs(transaction.Amount-self.Amount) >= 0.005 {
+		return fmt.Sprintf("amount %.2f does not match %.2f", transaction.Amount, self.Amount)
+	}
+	if self.Currency != "" && !strings.EqualFold(transaction.Currency, self.Currency) {
+		return "currency " + transaction.Currency + " does not match " + self.Currency
+	}
+	return ""
+}
+
+// flagMismatch moves a transaction to the mismatch review state instead of
+// accepting the webhook, and raises an alert. The webhook is still
+// acknowledged so the provider does not keep retrying it.
+func (self *PaymentService) flagMismatch(ctx context.Context, transaction entities.Transaction, reason string, callbackPayload []byte) error {
+	log := self.Logger.FromContext(ctx).With(logger.FieldTransactionId, transaction.TransactionID)
+	log.Error("webhook does not match transaction ", transaction.TransactionID, ": ", reason)
+
+	transaction.Status = "mismatch"
+	callbackPayloadStr := string(callbackPayload)
+	transaction.CallbackPayload = &callbackPayloadStr
+
+	_, err := self.TransactionRepository.SaveTransaction(ctx, transaction)
+	if err != nil {
+		log.Error("failed to save mismatched transaction: ", err.Error())
+		return &errors.InternalServerError{
+			Message: "Failed to save mismatched transaction: " + err.Error(),
+		}
+	}
+	metrics.RecordTransaction(transaction)
+
+	self.AlertService.Raise("Webhook does not match stored transaction", map[string]interface{}{
+		"transactionId": transaction.TransactionID,
+		"paymentId":     transaction.PaymentId,
+		"gateway":       transaction.GatewayName,
+		"reason":        reason,
+	})
+	return nil
+}
+
+func merchantId(merchant *entities.Merchant) *uint {
+	if merchant == nil {
+		return nil
+	}
+	return &merchant.ID
+}
+
+// applyFees records the fee and net amount reported by the provider, in major
+// units of the settlement currency. A failure to fetch fees is logged and
+// never fails the payment itself.
+func (self *PaymentService) applyFees(ctx context.Context, provider interfaces.IPaymentProvider, transaction entities.Transaction) entities.Transaction {
+	feeProvider, ok := provider.(interfaces.IFeeProvider)
+	if !ok {
+		return transaction
+	}
+
+	transactionWithFees, err := feeProvider.ApplyFees(ctx, transaction)
+	if err != nil {
+		self.Logger.Error("failed to apply transaction fees: ", err.Error())
+		return transaction
+	}
+	return transactionWithFees
+}
+
+func (self *PaymentService) VerifyAuthorizeSignature(merchant *entities.Merchant, r *http.Request, payload []byte) bool {
 	signatureHeader := r.Header.Get("x-anet-signature")
 	if signatureHeader == "" {
 		return false
 	}
 
 	// Your webhook signature key from Authorize.Net
-	webhookSignatureKey := app.App().Config().GetString("payment.authorize_net_webhook_signature_key")
+	config, err := self.MerchantService.ProviderConfig(merchant)
+	if err != nil || config.Credentials.AuthorizeWebhookSignatureKey == "" {
+		return false
+	}
+	webhookSignatureKey := config.Credentials.AuthorizeWebhookSignatureKey
 
 	// Create HMAC with SHA512
 	h := hmac.New(sha512.New, []byte(webhookSignatureKey))
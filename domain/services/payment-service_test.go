@@ -0,0 +1,762 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stripe/stripe-go"
+
+	"payment-service/app/clock"
+	"payment-service/app/logger"
+	"payment-service/domain/declines"
+	"payment-service/domain/entities"
+	"payment-service/domain/repositories"
+	"payment-service/domain/types"
+	"payment-service/errors"
+	"payment-service/interfaces"
+	"payment-service/requests"
+)
+
+// testLogger only reports errors, to keep the output of failing tests
+// readable.
+var testLogger = logger.NewLogger(&logger.Debug{
+	Enabled: true,
+	Level:   "error",
+	Format:  logger.LogFormatConsole,
+})
+
+// fakeProvider answers provider calls from its charge and withdraw
+// functions and records them. It reports a fixed fee like the real
+// providers do after a succeeded charge.
+type fakeProvider struct {
+	mutex     sync.Mutex
+	charge    func(params types.DepositParams, transaction entities.Transaction) (entities.Transaction, error)
+	withdraw  func(params types.WithdrawParams, transaction entities.Transaction) (entities.Transaction, error)
+	fee       float64
+	charges   int
+	withdraws int
+	refunds   int
+}
+
+func (self *fakeProvider) Charge(ctx context.Context, params types.DepositParams, transaction entities.Transaction) (entities.Transaction, error) {
+	self.mutex.Lock()
+	self.charges++
+	self.mutex.Unlock()
+	return self.charge(params, transaction)
+}
+
+func (self *fakeProvider) Withdraw(ctx context.Context, params types.WithdrawParams, transaction entities.Transaction) (entities.Transaction, error) {
+	self.mutex.Lock()
+	self.withdraws++
+	self.mutex.Unlock()
+	return self.withdraw(params, transaction)
+}
+
+func (self *fakeProvider) ApplyFees(ctx context.Context, transaction entities.Transaction) (entities.Transaction, error) {
+	fee := self.fee
+	net := transaction.Amount - fee
+	transaction.FeeAmount = &fee
+	transaction.NetAmount = &net
+	return transaction, nil
+}
+
+func (self *fakeProvider) Refund(ctx context.Context, transaction entities.Transaction, amount float64) (entities.Transaction, error) {
+	self.mutex.Lock()
+	self.refunds++
+	self.mutex.Unlock()
+	transaction.RefundedAmount += amount
+	transaction.Status = "partially_refunded"
+	if transaction.RefundedAmount >= transaction.Amount {
+		transaction.Status = "refunded"
+	}
+	return transaction, nil
+}
+
+var _ interfaces.IPaymentProvider = (*fakeProvider)(nil)
+var _ interfaces.IFeeProvider = (*fakeProvider)(nil)
+var _ interfaces.IRefundProvider = (*fakeProvider)(nil)
+
+// approvingProvider succeeds every charge and leaves every payout pending
+// under a new payment id.
+func approvingProvider() *fakeProvider {
+	return &fakeProvider{
+		fee: 30,
+		charge: func(params types.DepositParams, transaction entities.Transaction) (entities.Transaction, error) {
+			transaction.Status = "succeeded"
+			transaction.PaymentId = "pi_" + params.TransactionId
+			return transaction, nil
+		},
+		withdraw: func(params types.WithdrawParams, transaction entities.Transaction) (entities.Transaction, error) {
+			transaction.Status = "pending"
+			transaction.PaymentId = "po_" + params.TransactionId
+			return transaction, nil
+		},
+	}
+}
+
+type paymentServiceFixture struct {
+	service      *PaymentService
+	transactions *repositories.MemoryTransactionRepository
+	providers    map[string]*fakeProvider
+}
+
+// newPaymentServiceFixture returns a PaymentService on an in-memory
+// repository whose providers are the given fakes. Circuit breakers and
+// approval rates belong to the fixture, so tests do not affect each other.
+func newPaymentServiceFixture(providers map[string]*fakeProvider) *paymentServiceFixture {
+	config := viper.New()
+	now := clock.NewFake(time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC))
+
+	merchantService := NewMerchantService(nil, config, nil, testLogger, now)
+	merchantService.ProviderFactory = func(name string, config types.ProviderConfig) (interfaces.IPaymentProvider, error) {
+		provider, ok := providers[name]
+		if !ok {
+			return nil, &errors.ValidationError{
+				Message: "Invalid provider",
+			}
+		}
+		return provider, nil
+	}
+	circuitBreakerService := NewCircuitBreakerService(config, testLogger)
+	approvalRateService := NewApprovalRateService(config)
+	routingService := NewRoutingService(merchantService, circuitBreakerService, approvalRateService, nil, config, testLogger, now)
+	transactions := repositories.NewMemoryTransactionRepository(now)
+	return &paymentServiceFixture{
+		service: NewPaymentService(
+			transactions,
+			merchantService,
+			NewAlertService(config, testLogger),
+			routingService,
+			circuitBreakerService,
+			approvalRateService,
+			testLogger,
+		),
+		transactions: transactions,
+		providers:    providers,
+	}
+}
+
+func (self *paymentServiceFixture) save(t *testing.T, transaction entities.Transaction) entities.Transaction {
+	t.Helper()
+	saved, err := self.transactions.SaveTransaction(context.Background(), transaction)
+	if err != nil {
+		t.Fatalf("saving transaction: %v", err)
+	}
+	return saved
+}
+
+// stored returns the transaction with the client transaction id, whichever
+// merchant it belongs to.
+func (self *paymentServiceFixture) stored(t *testing.T, transactionId string) entities.Transaction {
+	t.Helper()
+	transactions, err := self.transactions.ListTransactions(context.Background(), types.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("listing transactions: %v", err)
+	}
+	for _, transaction := range transactions {
+		if transaction.TransactionID == transactionId {
+			return transaction
+		}
+	}
+	t.Fatalf("transaction %s not stored", transactionId)
+	return entities.Transaction{}
+}
+
+func merchantWithId(id uint) *entities.Merchant {
+	return &entities.Merchant{ID: id, Name: fmt.Sprintf("merchant %d", id)}
+}
+
+func stripeEvent(t *testing.T, eventType string, object interface{}) stripe.Event {
+	t.Helper()
+	raw, err := json.Marshal(object)
+	if err != nil {
+		t.Fatalf("marshalling event object: %v", err)
+	}
+	return stripe.Event{Type: eventType, Data: &stripe.EventData{Raw: raw}}
+}
+
+func TestDepositStoresSucceededChargeWithFees(t *testing.T) {
+	fixture := newPaymentServiceFixture(map[string]*fakeProvider{"deposit-ok": approvingProvider()})
+	merchant := merchantWithId(7)
+
+	transaction, err := fixture.service.Deposit(context.Background(), merchant, types.DepositParams{
+		Amount:        1000,
+		Currency:      "usd",
+		Token:         "pm_card_visa",
+		TransactionId: "dep-1",
+		Provider:      "deposit-ok",
+	})
+	if err != nil {
+		t.Fatalf("Deposit: %v", err)
+	}
+	if transaction.Status != "succeeded" || transaction.PaymentId != "pi_dep-1" {
+		t.Errorf("returned transaction %+v, want succeeded with payment id pi_dep-1", transaction)
+	}
+
+	stored := fixture.stored(t, "dep-1")
+	if stored.Status != "succeeded" || stored.TransactionType != "deposit" || stored.GatewayName != "deposit-ok" {
+		t.Errorf("stored transaction %+v, want a succeeded deposit through deposit-ok", stored)
+	}
+	if stored.MerchantID == nil || *stored.MerchantID != merchant.ID {
+		t.Errorf("stored merchant id %v, want %d", stored.MerchantID, merchant.ID)
+	}
+	if stored.FeeAmount == nil || *stored.FeeAmount != 30 || stored.NetAmount == nil || *stored.NetAmount != 970 {
+		t.Errorf("stored fee %v and net %v, want 30 and 970", stored.FeeAmount, stored.NetAmount)
+	}
+
+	var decision types.RoutingDecision
+	if stored.RoutingDecision == nil || json.Unmarshal([]byte(*stored.RoutingDecision), &decision) != nil {
+		t.Fatalf("stored routing decision %v is not a routing decision", stored.RoutingDecision)
+	}
+	if decision.Mode != types.RoutingModePinned || decision.Provider != "deposit-ok" {
+		t.Errorf("routing decision %+v, want pinned to deposit-ok", decision)
+	}
+}
+
+func TestDepositRejectsDuplicateTransactionId(t *testing.T) {
+	provider := approvingProvider()
+	fixture := newPaymentServiceFixture(map[string]*fakeProvider{"deposit-dup": provider})
+	fixture.save(t, entities.Transaction{
+		TransactionID:   "dep-dup",
+		TransactionType: "deposit",
+		Amount:          1000,
+		Currency:        "usd",
+		Status:          "succeeded",
+	})
+
+	_, err := fixture.service.Deposit(context.Background(), nil, types.DepositParams{
+		Amount:        1000,
+		Currency:      "usd",
+		Token:         "pm_card_visa",
+		TransactionId: "dep-dup",
+		Provider:      "deposit-dup",
+	})
+	var conflict *errors.ConflictError
+	if !stderrors.As(err, &conflict) {
+		t.Fatalf("Deposit error %v, want a conflict", err)
+	}
+	if provider.charges != 0 {
+		t.Errorf("provider charged %d times, want none", provider.charges)
+	}
+}
+
+func TestDepositAllowsTransactionIdOfAnotherMerchant(t *testing.T) {
+	provider := approvingProvider()
+	fixture := newPaymentServiceFixture(map[string]*fakeProvider{"deposit-ok": provider})
+	fixture.save(t, entities.Transaction{
+		TransactionID:   "dep-shared",
+		TransactionType: "deposit",
+		Amount:          1000,
+		Currency:        "usd",
+		Status:          "succeeded",
+		MerchantID:      &merchantWithId(1).ID,
+	})
+
+	transaction, err := fixture.service.Deposit(context.Background(), merchantWithId(2), types.DepositParams{
+		Amount:        1000,
+		Currency:      "usd",
+		Token:         "pm_card_visa",
+		TransactionId: "dep-shared",
+		Provider:      "deposit-ok",
+	})
+	if err != nil {
+		t.Fatalf("Deposit: %v", err)
+	}
+	if transaction.MerchantID == nil || *transaction.MerchantID != 2 || provider.charges != 1 {
+		t.Errorf("deposit of merchant %v charged %d times, want merchant 2 charged once", transaction.MerchantID, provider.charges)
+	}
+
+	found, err := fixture.service.GetTransaction(context.Background(), merchantWithId(1), "dep-shared")
+	if err != nil || found == nil || found.MerchantID == nil || *found.MerchantID != 1 {
+		t.Errorf("GetTransaction of merchant 1 = %v, %v, want its own transaction", found, err)
+	}
+	if found, _ := fixture.service.GetTransaction(context.Background(), nil, "dep-shared"); found != nil {
+		t.Errorf("GetTransaction of the platform found merchant %v's transaction", found.MerchantID)
+	}
+}
+
+func TestDepositStoresDecline(t *testing.T) {
+	decline := declines.FromStripe("insufficient_funds", "card_declined")
+	fixture := newPaymentServiceFixture(map[string]*fakeProvider{"deposit-decline": {
+		charge: func(params types.DepositParams, transaction entities.Transaction) (entities.Transaction, error) {
+			transaction.Status = "failed"
+			transaction.PaymentId = "pi_declined"
+			decline.Apply(&transaction)
+			return transaction, decline.Error("Your card has insufficient funds.")
+		},
+	}})
+
+	transaction, err := fixture.service.Deposit(context.Background(), nil, types.DepositParams{
+		Amount:        1000,
+		Currency:      "usd",
+		Token:         "pm_card_chargeDeclinedInsufficientFunds",
+		TransactionId: "dep-declined",
+		Provider:      "deposit-decline",
+	})
+	var declined *errors.ProviderDeclinedError
+	if !stderrors.As(err, &declined) || declined.DeclineCode != string(declines.CodeInsufficientFunds) {
+		t.Fatalf("Deposit error %v, want an insufficient_funds decline", err)
+	}
+	if transaction != nil {
+		t.Errorf("Deposit returned %+v with its error", transaction)
+	}
+
+	stored := fixture.stored(t, "dep-declined")
+	if stored.Status != "failed" || stored.DeclineCode != string(declines.CodeInsufficientFunds) || stored.FeeAmount != nil {
+		t.Errorf("stored transaction %+v, want failed with insufficient_funds and no fee", stored)
+	}
+}
+
+func TestDepositRejectsUnknownProvider(t *testing.T) {
+	fixture := newPaymentServiceFixture(map[string]*fakeProvider{})
+
+	_, err := fixture.service.Deposit(context.Background(), nil, types.DepositParams{
+		Amount:        1000,
+		Currency:      "usd",
+		Token:         "pm_card_visa",
+		TransactionId: "dep-unknown",
+		Provider:      "deposit-unknown",
+	})
+	var validation *errors.ValidationError
+	if !stderrors.As(err, &validation) {
+		t.Fatalf("Deposit error %v, want a validation error", err)
+	}
+	if transaction, _ := fixture.transactions.GetTransactionByTransactionId(context.Background(), nil, "dep-unknown"); transaction != nil {
+		t.Errorf("stored %+v for a request that was never routed", transaction)
+	}
+}
+
+func TestWithdrawStoresPendingPayout(t *testing.T) {
+	fixture := newPaymentServiceFixture(map[string]*fakeProvider{"withdraw-ok": approvingProvider()})
+
+	transaction, err := fixture.service.Withdraw(context.Background(), nil, types.WithdrawParams{
+		Amount:        2500,
+		Currency:      "usd",
+		Destination:   "ba_123",
+		TransactionId: "wd-1",
+		Provider:      "withdraw-ok",
+	})
+	if err != nil {
+		t.Fatalf("Withdraw: %v", err)
+	}
+	if transaction.PaymentId != "po_wd-1" {
+		t.Errorf("returned payment id %q, want po_wd-1", transaction.PaymentId)
+	}
+
+	stored := fixture.stored(t, "wd-1")
+	if stored.Status != "pending" || stored.TransactionType != "withdrawal" || stored.Amount != 2500 || stored.MerchantID != nil {
+		t.Errorf("stored transaction %+v, want a pending platform withdrawal of 2500", stored)
+	}
+	if fixture.providers["withdraw-ok"].withdraws != 1 {
+		t.Errorf("provider paid out %d times, want once", fixture.providers["withdraw-ok"].withdraws)
+	}
+}
+
+func TestWithdrawRejectsDuplicateTransactionId(t *testing.T) {
+	provider := approvingProvider()
+	fixture := newPaymentServiceFixture(map[string]*fakeProvider{"withdraw-dup": provider})
+	fixture.save(t, entities.Transaction{
+		TransactionID:   "wd-dup",
+		TransactionType: "withdrawal",
+		Amount:          2500,
+		Currency:        "usd",
+		Status:          "pending",
+	})
+
+	_, err := fixture.service.Withdraw(context.Background(), nil, types.WithdrawParams{
+		Amount:        2500,
+		Currency:      "usd",
+		Destination:   "ba_123",
+		TransactionId: "wd-dup",
+		Provider:      "withdraw-dup",
+	})
+	var conflict *errors.ConflictError
+	if !stderrors.As(err, &conflict) {
+		t.Fatalf("Withdraw error %v, want a conflict", err)
+	}
+	if provider.withdraws != 0 {
+		t.Errorf("provider paid out %d times, want none", provider.withdraws)
+	}
+}
+
+func TestWithdrawStoresProviderError(t *testing.T) {
+	fixture := newPaymentServiceFixture(map[string]*fakeProvider{"withdraw-timeout": {
+		withdraw: func(params types.WithdrawParams, transaction entities.Transaction) (entities.Transaction, error) {
+			transaction.Status = "failed"
+			return transaction, &errors.TimeoutError{Message: "payout timed out"}
+		},
+	}})
+
+	_, err := fixture.service.Withdraw(context.Background(), nil, types.WithdrawParams{
+		Amount:        2500,
+		Currency:      "usd",
+		Destination:   "ba_123",
+		TransactionId: "wd-timeout",
+		Provider:      "withdraw-timeout",
+	})
+	var timeout *errors.TimeoutError
+	if !stderrors.As(err, &timeout) {
+		t.Fatalf("Withdraw error %v, want a timeout", err)
+	}
+	if stored := fixture.stored(t, "wd-timeout"); stored.Status != "failed" {
+		t.Errorf("stored status %q, want failed", stored.Status)
+	}
+}
+
+func TestHandleStripeEvents(t *testing.T) {
+	merchant := merchantWithId(3)
+	deposit := entities.Transaction{
+		TransactionID:   "stripe-dep",
+		TransactionType: "deposit",
+		Amount:          1000,
+		Currency:        "usd",
+		Status:          "pending",
+		PaymentId:       "pi_1",
+		GatewayName:     "stripe",
+		MerchantID:      &merchant.ID,
+	}
+	payout := entities.Transaction{
+		TransactionID:   "stripe-wd",
+		TransactionType: "withdrawal",
+		Amount:          2500,
+		Currency:        "usd",
+		Status:          "pending",
+		PaymentId:       "po_1",
+		GatewayName:     "stripe",
+		MerchantID:      &merchant.ID,
+	}
+
+	tests := []struct {
+		name          string
+		stored        entities.Transaction
+		merchant      *entities.Merchant
+		event         func(t *testing.T) stripe.Event
+		wantErr       bool
+		wantStatus    string
+		wantDecline   declines.Code
+		wantChargeId  string
+		wantFeeAmount float64
+	}{
+		{
+			name:     "payment intent succeeded",
+			stored:   deposit,
+			merchant: merchant,
+			event: func(t *testing.T) stripe.Event {
+				return stripeEvent(t, "payment_intent.succeeded", map[string]interface{}{
+					"id": "pi_1", "amount": 1000, "currency": "usd", "latest_charge": "ch_1",
+				})
+			},
+			wantStatus:    "succeeded",
+			wantChargeId:  "ch_1",
+			wantFeeAmount: 30,
+		},
+		{
+			name:     "payment intent succeeded for another amount",
+			stored:   deposit,
+			merchant: merchant,
+			event: func(t *testing.T) stripe.Event {
+				return stripeEvent(t, "payment_intent.succeeded", map[string]interface{}{
+					"id": "pi_1", "amount": 100, "currency": "usd", "latest_charge": "ch_1",
+				})
+			},
+			wantStatus: "mismatch",
+		},
+		{
+			name:     "payment intent failed",
+			stored:   deposit,
+			merchant: merchant,
+			event: func(t *testing.T) stripe.Event {
+				return stripeEvent(t, "payment_intent.payment_failed", map[string]interface{}{
+					"id": "pi_1", "amount": 1000, "currency": "usd",
+					"last_payment_error": map[string]interface{}{"type": "card_error", "code": "card_declined", "decline_code": "insufficient_funds"},
+				})
+			},
+			wantStatus:  "failed",
+			wantDecline: declines.CodeInsufficientFunds,
+		},
+		{
+			name:     "charge refunded",
+			stored:   deposit,
+			merchant: merchant,
+			event: func(t *testing.T) stripe.Event {
+				return stripeEvent(t, "charge.refunded", map[string]interface{}{
+					"id": "ch_1", "payment_intent": "pi_1", "amount": 1000, "currency": "usd", "amount_refunded": 1000, "refunded": true,
+				})
+			},
+			wantStatus:   "refunded",
+			wantChargeId: "ch_1",
+		},
+		{
+			name:     "charge partially refunded",
+			stored:   deposit,
+			merchant: merchant,
+			event: func(t *testing.T) stripe.Event {
+				return stripeEvent(t, "charge.refunded", map[string]interface{}{
+					"id": "ch_1", "payment_intent": "pi_1", "amount": 1000, "currency": "usd", "amount_refunded": 300, "refunded": false,
+				})
+			},
+			wantStatus:   "partially_refunded",
+			wantChargeId: "ch_1",
+		},
+		{
+			name:     "charge refunded for another amount",
+			stored:   deposit,
+			merchant: merchant,
+			event: func(t *testing.T) stripe.Event {
+				return stripeEvent(t, "charge.refunded", map[string]interface{}{
+					"id": "ch_1", "payment_intent": "pi_1", "amount": 5000, "currency": "usd", "amount_refunded": 5000, "refunded": true,
+				})
+			},
+			wantStatus: "mismatch",
+		},
+		{
+			name:     "charge refunded for a payout",
+			stored:   payout,
+			merchant: merchant,
+			event: func(t *testing.T) stripe.Event {
+				return stripeEvent(t, "charge.refunded", map[string]interface{}{
+					"id": "ch_1", "payment_intent": "po_1", "amount": 2500, "currency": "usd", "amount_refunded": 2500, "refunded": true,
+				})
+			},
+			wantStatus: "mismatch",
+		},
+		{
+			name:     "charge refunded for another merchant's transaction",
+			stored:   deposit,
+			merchant: merchantWithId(4),
+			event: func(t *testing.T) stripe.Event {
+				return stripeEvent(t, "charge.refunded", map[string]interface{}{
+					"id": "ch_1", "payment_intent": "pi_1", "amount": 1000, "currency": "usd", "amount_refunded": 1000, "refunded": true,
+				})
+			},
+			wantErr:    true,
+			wantStatus: "pending",
+		},
+		{
+			name:     "payout paid",
+			stored:   payout,
+			merchant: merchant,
+			event: func(t *testing.T) stripe.Event {
+				return stripeEvent(t, "payout.paid", map[string]interface{}{
+					"id": "po_1", "amount": 2500, "currency": "usd",
+				})
+			},
+			wantStatus: "succeeded",
+		},
+		{
+			name:     "payout failed",
+			stored:   payout,
+			merchant: merchant,
+			event: func(t *testing.T) stripe.Event {
+				return stripeEvent(t, "payout.failed", map[string]interface{}{
+					"id": "po_1", "amount": 2500, "currency": "usd", "failure_code": "account_closed",
+				})
+			},
+			wantStatus:  "failed",
+			wantDecline: declines.CodeInvalidAccount,
+		},
+		{
+			name:     "event for another merchant's transaction",
+			stored:   deposit,
+			merchant: merchantWithId(4),
+			event: func(t *testing.T) stripe.Event {
+				return stripeEvent(t, "payment_intent.succeeded", map[string]interface{}{
+					"id": "pi_1", "amount": 1000, "currency": "usd",
+				})
+			},
+			wantErr:    true,
+			wantStatus: "pending",
+		},
+		{
+			name:     "event for an unknown payment",
+			stored:   deposit,
+			merchant: merchant,
+			event: func(t *testing.T) stripe.Event {
+				return stripeEvent(t, "payment_intent.succeeded", map[string]interface{}{
+					"id": "pi_unknown", "amount": 1000, "currency": "usd",
+				})
+			},
+			wantErr:    true,
+			wantStatus: "pending",
+		},
+		{
+			name:     "unhandled event",
+			stored:   deposit,
+			merchant: merchant,
+			event: func(t *testing.T) stripe.Event {
+				return stripeEvent(t, "customer.created", map[string]interface{}{"id": "cus_1"})
+			},
+			wantStatus: "pending",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fixture := newPaymentServiceFixture(map[string]*fakeProvider{"stripe": approvingProvider()})
+			fixture.save(t, test.stored)
+
+			err := fixture.service.HandleStripeEvents(context.Background(), test.merchant, test.event(t))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("HandleStripeEvents error %v, want error %v", err, test.wantErr)
+			}
+
+			stored := fixture.stored(t, test.stored.TransactionID)
+			if stored.Status != test.wantStatus {
+				t.Errorf("stored status %q, want %q", stored.Status, test.wantStatus)
+			}
+			if stored.DeclineCode != string(test.wantDecline) {
+				t.Errorf("stored decline code %q, want %q", stored.DeclineCode, test.wantDecline)
+			}
+			if stored.ChargeId != test.wantChargeId {
+				t.Errorf("stored charge id %q, want %q", stored.ChargeId, test.wantChargeId)
+			}
+			if test.wantFeeAmount != 0 && (stored.FeeAmount == nil || *stored.FeeAmount != test.wantFeeAmount) {
+				t.Errorf("stored fee %v, want %v", stored.FeeAmount, test.wantFeeAmount)
+			}
+		})
+	}
+}
+
+func TestHandleStripeEventsKeepsDeclineFromCharge(t *testing.T) {
+	fixture := newPaymentServiceFixture(map[string]*fakeProvider{"stripe": approvingProvider()})
+	transaction := entities.Transaction{
+		TransactionID:   "stripe-declined",
+		TransactionType: "deposit",
+		Amount:          1000,
+		Currency:        "usd",
+		Status:          "failed",
+		PaymentId:       "pi_declined",
+		GatewayName:     "stripe",
+	}
+	declines.FromStripe("expired_card", "expired_card").Apply(&transaction)
+	fixture.save(t, transaction)
+
+	err := fixture.service.HandleStripeEvents(context.Background(), nil, stripeEvent(t, "payment_intent.payment_failed", map[string]interface{}{
+		"id": "pi_declined", "amount": 1000, "currency": "usd",
+		"last_payment_error": map[string]interface{}{"type": "card_error", "code": "card_declined", "decline_code": "generic_decline"},
+	}))
+	if err != nil {
+		t.Fatalf("HandleStripeEvents: %v", err)
+	}
+	if stored := fixture.stored(t, "stripe-declined"); stored.DeclineCode != string(declines.CodeExpiredCard) {
+		t.Errorf("stored decline code %q, want the one from the charge, %q", stored.DeclineCode, declines.CodeExpiredCard)
+	}
+}
+
+func TestHandleAuthorizeEvents(t *testing.T) {
+	deposit := entities.Transaction{
+		TransactionID:   "authorize-dep",
+		TransactionType: "deposit",
+		Amount:          10,
+		Currency:        "usd",
+		Status:          "pending",
+		PaymentId:       "60001",
+		GatewayName:     "authorize",
+	}
+	refund := entities.Transaction{
+		TransactionID:   "authorize-wd",
+		TransactionType: "withdrawal",
+		Amount:          25,
+		Currency:        "usd",
+		Status:          "pending",
+		PaymentId:       "60002",
+		GatewayName:     "authorize",
+	}
+
+	tests := []struct {
+		name       string
+		stored     entities.Transaction
+		merchant   *entities.Merchant
+		event      requests.WebhookEvent
+		wantErr    bool
+		wantStatus string
+		wantFee    bool
+	}{
+		{
+			name:   "auth capture created",
+			stored: deposit,
+			event: requests.WebhookEvent{
+				EventType: "net.authorize.payment.authcapture.created",
+				Payload:   requests.Payload{ID: "60001", AuthAmount: 10},
+			},
+			wantStatus: "succeeded",
+			wantFee:    true,
+		},
+		{
+			name:   "auth capture created for another amount",
+			stored: deposit,
+			event: requests.WebhookEvent{
+				EventType: "net.authorize.payment.authcapture.created",
+				Payload:   requests.Payload{ID: "60001", AuthAmount: 12.5},
+			},
+			wantStatus: "mismatch",
+		},
+		{
+			name:   "refund created",
+			stored: refund,
+			event: requests.WebhookEvent{
+				EventType: "net.authorize.payment.refund.created",
+				Payload:   requests.Payload{ID: "60002", AuthAmount: 25},
+			},
+			wantStatus: "succeeded",
+		},
+		{
+			name:   "refund created for a deposit",
+			stored: deposit,
+			event: requests.WebhookEvent{
+				EventType: "net.authorize.payment.refund.created",
+				Payload:   requests.Payload{ID: "60001", AuthAmount: 10},
+			},
+			wantStatus: "mismatch",
+		},
+		{
+			name:     "event for another merchant's transaction",
+			stored:   deposit,
+			merchant: merchantWithId(5),
+			event: requests.WebhookEvent{
+				EventType: "net.authorize.payment.authcapture.created",
+				Payload:   requests.Payload{ID: "60001", AuthAmount: 10},
+			},
+			wantErr:    true,
+			wantStatus: "pending",
+		},
+		{
+			name:   "unhandled event",
+			stored: deposit,
+			event: requests.WebhookEvent{
+				EventType: "net.authorize.payment.void.created",
+				Payload:   requests.Payload{ID: "60001"},
+			},
+			wantStatus: "pending",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fixture := newPaymentServiceFixture(map[string]*fakeProvider{"authorize": approvingProvider()})
+			fixture.save(t, test.stored)
+
+			err := fixture.service.HandleAuthorizeEvents(context.Background(), test.merchant, test.event)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("HandleAuthorizeEvents error %v, want error %v", err, test.wantErr)
+			}
+
+			stored := fixture.stored(t, test.stored.TransactionID)
+			if stored.Status != test.wantStatus {
+				t.Errorf("stored status %q, want %q", stored.Status, test.wantStatus)
+			}
+			if (stored.FeeAmount != nil) != test.wantFee {
+				t.Errorf("stored fee %v, want fee %v", stored.FeeAmount, test.wantFee)
+			}
+			if test.wantStatus == "mismatch" && stored.CallbackPayload == nil {
+				t.Errorf("mismatched transaction stored without the callback payload")
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stripe/stripe-go/webhook"
+
+	"payment-service/app/clock"
+	"payment-service/domain/entities"
+	"payment-service/domain/providers/fakeproviders"
+	"payment-service/domain/repositories"
+	"payment-service/domain/types"
+	"payment-service/errors"
+	"payment-service/requests"
+)
+
+const (
+	integrationStripeKey        = "sk_test_fake"
+	integrationStripeSecret     = "whsec_fake"
+	integrationAuthorizeLogin   = "fake-login"
+	integrationAuthorizeKey     = "fake-transaction-key"
+	integrationAuthorizeSignKey = "fake-signature-key"
+)
+
+// integrationFixture runs a PaymentService with the real providers against
+// the fake Stripe and Authorize.Net servers. Their webhooks go to an
+// endpoint that verifies signatures like PaymentController does and hands
+// the events to the service.
+type integrationFixture struct {
+	service      *PaymentService
+	transactions *repositories.MemoryTransactionRepository
+	stripe       *fakeproviders.StripeServer
+	authorize    *fakeproviders.AuthorizeServer
+}
+
+func newIntegrationFixture(t *testing.T, settings map[string]string) *integrationFixture {
+	fixture := &integrationFixture{}
+	hooks := httptest.NewUnstartedServer(fixture.webhookHandler())
+	hooks.Start()
+	t.Cleanup(hooks.Close)
+
+	fixture.stripe = fakeproviders.NewStripeServer(fakeproviders.StripeOptions{
+		SecretKey:     integrationStripeKey,
+		WebhookUrl:    hooks.URL + "/stripe",
+		WebhookSecret: integrationStripeSecret,
+	})
+	t.Cleanup(fixture.stripe.Close)
+	fixture.authorize = fakeproviders.NewAuthorizeServer(fakeproviders.AuthorizeOptions{
+		LoginId:             integrationAuthorizeLogin,
+		TransactionKey:      integrationAuthorizeKey,
+		WebhookUrl:          hooks.URL + "/authorize",
+		WebhookSignatureKey: integrationAuthorizeSignKey,
+	})
+	t.Cleanup(fixture.authorize.Close)
+
+	config := viper.New()
+	config.Set("payment.stripe_secret_key", integrationStripeKey)
+	config.Set("payment.stripe_endpoint_secret", integrationStripeSecret)
+	config.Set("payment.stripe_base_url", fixture.stripe.URL)
+	config.Set("payment.stripe_retry_base_delay", "10ms")
+	config.Set("payment.authorize_login_id", integrationAuthorizeLogin)
+	config.Set("payment.authorize_transaction_key", integrationAuthorizeKey)
+	config.Set("payment.authorize_net_webhook_signature_key", integrationAuthorizeSignKey)
+	config.Set("payment.authorize_base_url", fixture.authorize.URL)
+	config.Set("payment.authorize_fee_percent", 2.9)
+	config.Set("payment.authorize_fee_fixed", 0.30)
+	for key, value := range settings {
+		config.Set(key, value)
+	}
+
+	now := clock.NewFake(time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC))
+	merchantService := NewMerchantService(nil, config, nil, testLogger, now)
+	circuitBreakerService := NewCircuitBreakerService(config, testLogger)
+	approvalRateService := NewApprovalRateService(config)
+	fixture.transactions = repositories.NewMemoryTransactionRepository(now)
+	fixture.service = NewPaymentService(
+		fixture.transactions,
+		merchantService,
+		NewAlertService(config, testLogger),
+		NewRoutingService(merchantService, circuitBreakerService, approvalRateService, nil, config, testLogger, now),
+		circuitBreakerService,
+		approvalRateService,
+		testLogger,
+	)
+	return fixture
+}
+
+// webhookHandler is started before the service exists, so it reads the
+// service from the fixture on each request.
+func (self *integrationFixture) webhookHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stripe", func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := ioutil.ReadAll(r.Body)
+		event, err := webhook.ConstructEvent(payload, r.Header.Get("Stripe-Signature"), integrationStripeSecret)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err := self.service.HandleStripeEvents(r.Context(), nil, event); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := ioutil.ReadAll(r.Body)
+		if !self.service.VerifyAuthorizeSignature(nil, r, payload) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		var event requests.WebhookEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := self.service.HandleAuthorizeEvents(r.Context(), nil, event); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	return mux
+}
+
+func (self *integrationFixture) stored(t *testing.T, transactionId string) entities.Transaction {
+	t.Helper()
+	transaction, err := self.transactions.GetTransactionByTransactionId(context.Background(), nil, transactionId)
+	if err != nil || transaction == nil {
+		t.Fatalf("transaction %s was not stored: %v", transactionId, err)
+	}
+	return *transaction
+}
+
+func expectDelivered(t *testing.T, deliveries []fakeproviders.Delivery, events ...string) {
+	t.Helper()
+	if len(deliveries) != len(events) {
+		t.Fatalf("delivered %+v, want %v", deliveries, events)
+	}
+	for i, delivery := range deliveries {
+		if delivery.Event != events[i] || delivery.StatusCode != http.StatusOK {
+			t.Errorf("delivery %d = %+v, want %s answered with 200", i, delivery, events[i])
+		}
+	}
+}
+
+func TestIntegrationStripeDepositSettlesByWebhook(t *testing.T) {
+	fixture := newIntegrationFixture(t, nil)
+
+	transaction, err := fixture.service.Deposit(context.Background(), nil, types.DepositParams{
+		Amount:        1000,
+		Currency:      "usd",
+		Token:         "pm_card_visa",
+		TransactionId: "tx-stripe-deposit",
+		Provider:      "stripe",
+	})
+	if err != nil {
+		t.Fatalf("Deposit: %v", err)
+	}
+	if transaction.Status != "pending" || transaction.PaymentId == "" {
+		t.Fatalf("deposit is %s with payment id %q, want pending with a payment id", transaction.Status, transaction.PaymentId)
+	}
+
+	expectDelivered(t, fixture.stripe.WaitWebhooks(), "payment_intent.succeeded")
+	stored := fixture.stored(t, "tx-stripe-deposit")
+	if stored.Status != "succeeded" || stored.ChargeId == "" {
+		t.Fatalf("after the webhook the deposit is %s with charge id %q, want succeeded with a charge id", stored.Status, stored.ChargeId)
+	}
+	if stored.FeeAmount == nil || *stored.FeeAmount != 0.59 || *stored.NetAmount != 9.41 {
+		t.Errorf("fee %v and net %v, want 0.59 and 9.41", stored.FeeAmount, stored.NetAmount)
+	}
+}
+
+func TestIntegrationStripeDeclineFailsDeposit(t *testing.T) {
+	fixture := newIntegrationFixture(t, nil)
+	fixture.stripe.Script("pm_card_chargeDeclinedInsufficientFunds", fakeproviders.Scenario{
+		Outcome:     fakeproviders.Decline,
+		DeclineCode: "insufficient_funds",
+	})
+
+	_, err := fixture.service.Deposit(context.Background(), nil, types.DepositParams{
+		Amount:        1000,
+		Currency:      "usd",
+		Token:         "pm_card_chargeDeclinedInsufficientFunds",
+		TransactionId: "tx-stripe-decline",
+		Provider:      "stripe",
+	})
+	var declined *errors.ProviderDeclinedError
+	if !stderrors.As(err, &declined) {
+		t.Fatalf("Deposit error %v, want a ProviderDeclinedError", err)
+	}
+
+	expectDelivered(t, fixture.stripe.WaitWebhooks(), "payment_intent.payment_failed")
+	stored := fixture.stored(t, "tx-stripe-decline")
+	if stored.Status != "failed" || stored.DeclineCode != "insufficient_funds" {
+		t.Errorf("deposit is %s with decline code %q, want failed with insufficient_funds", stored.Status, stored.DeclineCode)
+	}
+}
+
+func TestIntegrationStripeServerErrorIsRetried(t *testing.T) {
+	fixture := newIntegrationFixture(t, nil)
+	fixture.stripe.Enqueue(fakeproviders.Scenario{Outcome: fakeproviders.Fail})
+
+	transaction, err := fixture.service.Deposit(context.Background(), nil, types.DepositParams{
+		Amount:        1000,
+		Currency:      "usd",
+		Token:         "pm_card_visa",
+		TransactionId: "tx-stripe-retry",
+		Provider:      "stripe",
+	})
+	if err != nil {
+		t.Fatalf("Deposit: %v", err)
+	}
+	if transaction.ProviderAttempts != 2 {
+		t.Errorf("made %d attempts, want 2", transaction.ProviderAttempts)
+	}
+	expectDelivered(t, fixture.stripe.WaitWebhooks(), "payment_intent.succeeded")
+}
+
+func TestIntegrationStripeLatencyTimesOut(t *testing.T) {
+	fixture := newIntegrationFixture(t, map[string]string{"payment.stripe_timeout": "100ms"})
+	fixture.stripe.Script("pm_card_visa", fakeproviders.Scenario{Outcome: fakeproviders.Approve, Delay: time.Second})
+
+	_, err := fixture.service.Deposit(context.Background(), nil, types.DepositParams{
+		Amount:        1000,
+		Currency:      "usd",
+		Token:         "pm_card_visa",
+		TransactionId: "tx-stripe-timeout",
+		Provider:      "stripe",
+	})
+	var timeout *errors.TimeoutError
+	if !stderrors.As(err, &timeout) {
+		t.Fatalf("Deposit error %v, want a TimeoutError", err)
+	}
+	if stored := fixture.stored(t, "tx-stripe-timeout"); stored.Status != "pending" {
+		t.Errorf("timed out deposit is %s, want pending", stored.Status)
+	}
+}
+
+func TestIntegrationStripePayoutSettlesByWebhook(t *testing.T) {
+	fixture := newIntegrationFixture(t, nil)
+
+	transaction, err := fixture.service.Withdraw(context.Background(), nil, types.WithdrawParams{
+		Amount:        500,
+		Currency:      "usd",
+		Destination:   "ba_fake",
+		TransactionId: "tx-stripe-payout",
+		Provider:      "stripe",
+	})
+	if err != nil {
+		t.Fatalf("Withdraw: %v", err)
+	}
+	if err := fixture.stripe.PayPayout(transaction.PaymentId); err != nil {
+		t.Fatalf("PayPayout: %v", err)
+	}
+
+	expectDelivered(t, fixture.stripe.WaitWebhooks(), "payout.created", "payout.paid")
+	if stored := fixture.stored(t, "tx-stripe-payout"); stored.Status != "succeeded" {
+		t.Errorf("paid payout is %s, want succeeded", stored.Status)
+	}
+}
+
+func TestIntegrationAuthorizeDepositSettlesByWebhook(t *testing.T) {
+	fixture := newIntegrationFixture(t, nil)
+
+	transaction, err := fixture.service.Deposit(context.Background(), nil, types.DepositParams{
+		Amount:           25.50,
+		Currency:         "USD",
+		TransactionId:    "tx-authorize-deposit",
+		Provider:         "authorize",
+		CreditCardNumber: "4111111111111111",
+		ExpirationDate:   "2030-12",
+		CVV:              "123",
+	})
+	if err != nil {
+		t.Fatalf("Deposit: %v", err)
+	}
+	if transaction.Status != "succeeded" || transaction.PaymentId == "" {
+		t.Fatalf("deposit is %s with payment id %q, want succeeded with a payment id", transaction.Status, transaction.PaymentId)
+	}
+	if transaction.FeeAmount == nil || *transaction.FeeAmount != 1.04 {
+		t.Errorf("fee %v, want 1.04", transaction.FeeAmount)
+	}
+
+	expectDelivered(t, fixture.authorize.WaitWebhooks(), "net.authorize.payment.authcapture.created")
+	if stored := fixture.stored(t, "tx-authorize-deposit"); stored.Status != "succeeded" {
+		t.Errorf("after the webhook the deposit is %s, want succeeded", stored.Status)
+	}
+}
+
+func TestIntegrationAuthorizeDeclineFailsDeposit(t *testing.T) {
+	fixture := newIntegrationFixture(t, nil)
+	fixture.authorize.Script("4000000000000002", fakeproviders.Scenario{Outcome: fakeproviders.Decline, DeclineCode: "2"})
+
+	_, err := fixture.service.Deposit(context.Background(), nil, types.DepositParams{
+		Amount:           25.50,
+		Currency:         "USD",
+		TransactionId:    "tx-authorize-decline",
+		Provider:         "authorize",
+		CreditCardNumber: "4000000000000002",
+		ExpirationDate:   "2030-12",
+		CVV:              "123",
+	})
+	var declined *errors.ProviderDeclinedError
+	if !stderrors.As(err, &declined) {
+		t.Fatalf("Deposit error %v, want a ProviderDeclinedError", err)
+	}
+
+	expectDelivered(t, fixture.authorize.WaitWebhooks())
+	stored := fixture.stored(t, "tx-authorize-decline")
+	if stored.Status != "failed" || stored.DeclineCode != "card_declined" {
+		t.Errorf("deposit is %s with decline code %q, want failed with card_declined", stored.Status, stored.DeclineCode)
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"github.com/spf13/viper"
+	"math"
+	"payment-service/app/clock"
+	"payment-service/app/logger"
+	"payment-service/domain/metrics"
+	"payment-service/domain/repositories"
+	"payment-service/domain/types"
+	"sync"
+	"time"
+)
+
+const (
+	RateLimitStoreMemory   = "memory"
+	RateLimitStorePostgres = "postgres"
+
+	rateLimitIdleTtl = time.Hour
+)
+
+// defaultRateLimits are the per route group budgets used when
+// ratelimit.<group>.per_minute and ratelimit.<group>.burst are not set.
+var defaultRateLimits = map[string]types.RateLimit{
+	"payments": {PerMinute: 60, Burst: 10},
+	"read":     {PerMinute: 300, Burst: 50},
+	"admin":    {PerMinute: 30, Burst: 10},
+	"webhooks": {PerMinute: 600, Burst: 100},
+	"clients":  {PerMinute: 600, Burst: 100},
+}
+
+type rateLimitStore interface {
+	Take(ctx context.Context, key string, limit types.RateLimit, now time.Time) (types.RateLimitBucket, error)
+	DeleteBucketsBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+// RateLimitService applies token bucket limits per client and route group.
+// Buckets live in process memory, or in Postgres when ratelimit.store is
+// "postgres" so that every replica shares the same budget.
+type RateLimitService struct {
+	Config *viper.Viper
+	Logger *logger.Logger
+	Clock  clock.Clock
+	store  rateLimitStore
+}
+
+// NewRateLimitService keeps buckets in rateLimitRepository when
+// ratelimit.store is "postgres".
+func NewRateLimitService(rateLimitRepository *repositories.RateLimitRepository, config *viper.Viper, log *logger.Logger, clock clock.Clock) *RateLimitService {
+	var store rateLimitStore = newMemoryRateLimitStore()
+	if config.GetString("ratelimit.store") == RateLimitStorePostgres {
+		store = rateLimitRepository
+	}
+	return &RateLimitService{
+		Config: config,
+		Logger: log,
+		Clock:  clock,
+		store:  store,
+	}
+}
+
+func (self *RateLimitService) Enabled() bool {
+	return !self.Config.GetBool("ratelimit.disabled")
+}
+
+func (self *RateLimitService) Limit(group string) types.RateLimit {
+	limit, ok := defaultRateLimits[group]
+	if !ok {
+		limit = defaultRateLimits["payments"]
+	}
+
+	config := self.Config
+	if perMinute := config.GetInt("ratelimit." + group + ".per_minute"); perMinute > 0 {
+		limit.PerMinute = perMinute
+	}
+	if burst := config.GetInt("ratelimit." + group + ".burst"); burst > 0 {
+		limit.Burst = burst
+	}
+	return limit
+}
+
+// Allow takes a token from the client's bucket for group. Store errors fail
+// open so an unavailable database does not block payments.
+func (self *RateLimitService) Allow(ctx context.Context, group string, client string) types.RateLimitResult {
+	limit := self.Limit(group)
+	result := types.RateLimitResult{Allowed: true, Limit: limit.Burst, Remaining: limit.Burst}
+
+	bucket, err := self.store.Take(ctx, group+":"+client, limit, self.Clock.Now())
+	if err != nil {
+		self.Logger.Error("rate limit store failed, allowing request: ", err.Error())
+		return result
+	}
+
+	rate := limit.TokensPerSecond()
+	result.Allowed = bucket.Allowed
+	result.Remaining = int(math.Max(0, math.Floor(bucket.Tokens)))
+	result.ResetAfter = secondsDuration((float64(limit.Burst) - bucket.Tokens) / rate)
+	if !bucket.Allowed {
+		result.RetryAfter = secondsDuration((1 - bucket.Tokens) / rate)
+	}
+	return result
+}
+
+// RunBucketCleanup is a background worker that drops buckets idle for an
+// hour; any bucket that old has refilled completely.
+func (self *RateLimitService) RunBucketCleanup(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			start := time.Now()
+			deleted, err := self.store.DeleteBucketsBefore(ctx, self.Clock.Now().Add(-rateLimitIdleTtl))
+			metrics.JobRun("rate-limit-cleanup", start, map[string]int64{"deleted": deleted}, err)
+			if err != nil {
+				self.Logger.Error("failed to clean up rate limit buckets: ", err.Error())
+			}
+		}
+	}
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds)) * time.Second
+}
+
+type memoryBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+type memoryRateLimitStore struct {
+	mutex   sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+func newMemoryRateLimitStore() *memoryRateLimitStore {
+	return &memoryRateLimitStore{
+		buckets: map[string]*memoryBucket{},
+	}
+}
+
+func (self *memoryRateLimitStore) Take(ctx context.Context, key string, limit types.RateLimit, now time.Time) (types.RateLimitBucket, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	burst := float64(limit.Burst)
+	bucket, ok := self.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: burst, updatedAt: now}
+		self.buckets[key] = bucket
+	}
+
+	elapsed := now.Sub(bucket.updatedAt).Seconds()
+	bucket.tokens = math.Min(burst, bucket.tokens+elapsed*limit.TokensPerSecond())
+	bucket.updatedAt = now
+
+	if bucket.tokens < 1 {
+		return types.RateLimitBucket{Tokens: bucket.tokens}, nil
+	}
+	bucket.tokens--
+	return types.RateLimitBucket{Tokens: bucket.tokens, Allowed: true}, nil
+}
+
+func (self *memoryRateLimitStore) DeleteBucketsBefore(ctx context.Context, before time.Time) (int64, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+
+	deleted := int64(0)
+	for key, bucket := range self.buckets {
+		if bucket.updatedAt.Before(before) {
+			delete(self.buckets, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"payment-service/app/logger"
+	"payment-service/domain/metrics"
+	"payment-service/domain/types"
+	"time"
+)
+
+// ReconciliationService compares stored transactions with their provider
+// state over a time window and corrects statuses that drifted, for example
+// because a webhook was never delivered.
+type ReconciliationService struct {
+	OperationsService *OperationsService
+	Logger            *logger.Logger
+}
+
+func NewReconciliationService(operationsService *OperationsService, log *logger.Logger) *ReconciliationService {
+	return &ReconciliationService{
+		OperationsService: operationsService,
+		Logger:            log,
+	}
+}
+
+// Run resyncs the transactions matching filter. Without a status filter only
+// pending transactions are checked; force moves transactions out of the
+// HeldStatuses, see OperationsService.ResyncTransaction.
+func (self *ReconciliationService) Run(ctx context.Context, filter types.TransactionFilter, force bool, dryRun bool) (types.ReconciliationReport, error) {
+	start := time.Now()
+	if filter.Status == "" {
+		filter.Status = "pending"
+	}
+	report := types.ReconciliationReport{
+		DryRun:  dryRun,
+		Results: make([]types.ResyncResult, 0),
+	}
+
+	transactions, err := self.OperationsService.ListTransactions(ctx, filter)
+	if err != nil {
+		metrics.JobRun("reconciliation", start, nil, err)
+		return report, err
+	}
+
+	for _, transaction := range transactions {
+		result, err := self.OperationsService.ResyncTransaction(ctx, transaction, force, dryRun)
+		report.Checked++
+		if err != nil {
+			result.Error = err.Error()
+			report.Failed++
+			report.Results = append(report.Results, result)
+			continue
+		}
+		switch {
+		case result.Changed:
+			report.Changed++
+			report.Results = append(report.Results, result)
+		case result.Held:
+			report.Held++
+			report.Results = append(report.Results, result)
+		}
+	}
+
+	metrics.JobRun("reconciliation", start, map[string]int64{
+		"checked": int64(report.Checked),
+		"changed": int64(report.Changed),
+		"held":    int64(report.Held),
+		"failed":  int64(report.Failed),
+	}, nil)
+	self.Logger.Infof("reconciliation checked %d transactions, %d changed, %d held, %d failed", report.Checked, report.Changed, report.Held, report.Failed)
+	return report, nil
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"payment-service/domain/types"
+)
+
+// settledStripeDeposit makes a Stripe deposit on the fake server and waits
+// until its webhook has marked it succeeded.
+func settledStripeDeposit(t *testing.T, fixture *integrationFixture, transactionId string) {
+	t.Helper()
+	_, err := fixture.service.Deposit(context.Background(), nil, types.DepositParams{
+		Amount:        1000,
+		Currency:      "usd",
+		Token:         "pm_card_visa",
+		TransactionId: transactionId,
+		Provider:      "stripe",
+	})
+	if err != nil {
+		t.Fatalf("Deposit: %v", err)
+	}
+	fixture.stripe.WaitWebhooks()
+	if stored := fixture.stored(t, transactionId); stored.Status != "succeeded" {
+		t.Fatalf("after the webhook the deposit is %s, want succeeded", stored.Status)
+	}
+}
+
+func TestResyncKeepsHeldStatuses(t *testing.T) {
+	for _, status := range []string{"mismatch", "refunded", "partially_refunded"} {
+		t.Run(status, func(t *testing.T) {
+			fixture := newIntegrationFixture(t, nil)
+			operations := NewOperationsService(fixture.service, testLogger)
+			settledStripeDeposit(t, fixture, "tx-held")
+			held := fixture.stored(t, "tx-held")
+			held.Status = status
+			if _, err := fixture.transactions.SaveTransaction(context.Background(), held); err != nil {
+				t.Fatalf("saving transaction: %v", err)
+			}
+
+			result, err := operations.ResyncTransaction(context.Background(), held, false, false)
+			if err != nil {
+				t.Fatalf("ResyncTransaction: %v", err)
+			}
+			if !result.Held || result.Changed || result.Applied || result.Status != status || result.ProviderStatus != "succeeded" {
+				t.Errorf("resync result %+v, want %s held against provider status succeeded", result, status)
+			}
+			if stored := fixture.stored(t, "tx-held"); stored.Status != status {
+				t.Fatalf("resync moved the transaction to %s, want it kept %s", stored.Status, status)
+			}
+
+			result, err = operations.ResyncTransaction(context.Background(), held, true, false)
+			if err != nil {
+				t.Fatalf("forced ResyncTransaction: %v", err)
+			}
+			if !result.Applied || fixture.stored(t, "tx-held").Status != "succeeded" {
+				t.Errorf("forced resync result %+v, want the provider status succeeded applied", result)
+			}
+		})
+	}
+}
+
+func TestReconcileChecksOnlyPendingByDefault(t *testing.T) {
+	fixture := newIntegrationFixture(t, nil)
+	operations := NewOperationsService(fixture.service, testLogger)
+	reconciliation := NewReconciliationService(operations, testLogger)
+	settledStripeDeposit(t, fixture, "tx-refunded")
+	settledStripeDeposit(t, fixture, "tx-pending")
+
+	refunded := fixture.stored(t, "tx-refunded")
+	refunded.Status = "refunded"
+	pending := fixture.stored(t, "tx-pending")
+	pending.Status = "pending"
+	if _, err := fixture.transactions.SaveTransaction(context.Background(), refunded); err != nil {
+		t.Fatalf("saving transaction: %v", err)
+	}
+	if _, err := fixture.transactions.SaveTransaction(context.Background(), pending); err != nil {
+		t.Fatalf("saving transaction: %v", err)
+	}
+
+	report, err := reconciliation.Run(context.Background(), types.TransactionFilter{}, false, false)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if report.Checked != 1 || report.Changed != 1 {
+		t.Errorf("reconciliation checked %d and changed %d, want the pending transaction only", report.Checked, report.Changed)
+	}
+	if status := fixture.stored(t, "tx-pending").Status; status != "succeeded" {
+		t.Errorf("pending transaction is %s after reconciliation, want succeeded", status)
+	}
+
+	report, err = reconciliation.Run(context.Background(), types.TransactionFilter{Status: "refunded"}, false, false)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if report.Checked != 1 || report.Held != 1 || report.Changed != 0 {
+		t.Errorf("reconciliation of refunded checked %d, held %d and changed %d, want 1, 1 and 0", report.Checked, report.Held, report.Changed)
+	}
+	if status := fixture.stored(t, "tx-refunded").Status; status != "refunded" {
+		t.Errorf("refunded transaction is %s after reconciliation, want refunded", status)
+	}
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"payment-service/app/logger"
+	"payment-service/domain/entities"
+	"payment-service/domain/providers"
+	"payment-service/domain/repositories"
+	"payment-service/domain/types"
+	"payment-service/errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RoutingRuleService manages the rules RoutingService routes by.
+type RoutingRuleService struct {
+	RoutingRuleRepository *repositories.RoutingRuleRepository
+	MerchantService       *MerchantService
+	Logger                *logger.Logger
+}
+
+func NewRoutingRuleService(routingRuleRepository *repositories.RoutingRuleRepository, merchantService *MerchantService, log *logger.Logger) *RoutingRuleService {
+	return &RoutingRuleService{
+		RoutingRuleRepository: routingRuleRepository,
+		MerchantService:       merchantService,
+		Logger:                log,
+	}
+}
+
+func (self *RoutingRuleService) ListRoutingRules(ctx context.Context) ([]entities.RoutingRule, error) {
+	rules, err := self.RoutingRuleRepository.ListRoutingRules(ctx)
+	if err != nil {
+		return nil, &errors.InternalServerError{
+			Message: err.Error(),
+		}
+	}
+	return rules, nil
+}
+
+func (self *RoutingRuleService) GetRoutingRule(ctx context.Context, id uint) (*entities.RoutingRule, error) {
+	rule, err := self.RoutingRuleRepository.GetRoutingRuleById(ctx, id)
+	if err != nil {
+		return nil, &errors.InternalServerError{
+			Message: err.Error(),
+		}
+	}
+	return rule, nil
+}
+
+func (self *RoutingRuleService) CreateRoutingRule(ctx context.Context, params types.RoutingRuleParams) (*entities.RoutingRule, error) {
+	rule := entities.RoutingRule{}
+	if err := self.applyParams(ctx, &rule, params); err != nil {
+		return nil, err
+	}
+	return self.saveRoutingRule(ctx, rule, "routing rule created: ")
+}
+
+// ReplaceRoutingRule overwrites every field of the rule with params.
+func (self *RoutingRuleService) ReplaceRoutingRule(ctx context.Context, id uint, params types.RoutingRuleParams) (*entities.RoutingRule, error) {
+	rule, err := self.GetRoutingRule(ctx, id)
+	if err != nil || rule == nil {
+		return rule, err
+	}
+	replaced := entities.RoutingRule{ID: rule.ID, CreatedAt: rule.CreatedAt}
+	if err := self.applyParams(ctx, &replaced, params); err != nil {
+		return nil, err
+	}
+	return self.saveRoutingRule(ctx, replaced, "routing rule updated: ")
+}
+
+func (self *RoutingRuleService) DeleteRoutingRule(ctx context.Context, id uint) (bool, error) {
+	deleted, err := self.RoutingRuleRepository.DeleteRoutingRule(ctx, id)
+	if err != nil {
+		return false, &errors.InternalServerError{
+			Message: err.Error(),
+		}
+	}
+	if deleted {
+		self.Logger.FromContext(ctx).Info("routing rule deleted: ", id)
+	}
+	return deleted, nil
+}
+
+func (self *RoutingRuleService) saveRoutingRule(ctx context.Context, rule entities.RoutingRule, logMessage string) (*entities.RoutingRule, error) {
+	rule, err := self.RoutingRuleRepository.SaveRoutingRule(ctx, rule)
+	if err != nil {
+		return nil, &errors.InternalServerError{
+			Message: err.Error(),
+		}
+	}
+
+	self.Logger.FromContext(ctx).Info(logMessage, rule.Name)
+	return &rule, nil
+}
+
+// applyParams checks params and copies them onto rule. Checks the request
+// validator cannot do, such as the time zone and the merchant, are made
+// here.
+func (self *RoutingRuleService) applyParams(ctx context.Context, rule *entities.RoutingRule, params types.RoutingRuleParams) error {
+	if strings.TrimSpace(params.Name) == "" {
+		return &errors.ValidationError{Message: "routing rule name is required"}
+	}
+	if params.MinAmount != nil && params.MaxAmount != nil && *params.MinAmount >= *params.MaxAmount {
+		return &errors.ValidationError{Message: "minAmount must be below maxAmount"}
+	}
+	if (params.TimeFrom == "") != (params.TimeUntil == "") {
+		return &errors.ValidationError{Message: "timeFrom and timeUntil must be set together"}
+	}
+	for _, value := range []string{params.TimeFrom, params.TimeUntil} {
+		if _, err := time.Parse("15:04", value); value != "" && err != nil {
+			return &errors.ValidationError{Message: "invalid time of day " + value + ", expected HH:MM"}
+		}
+	}
+	if params.TimeZone != "" {
+		if _, err := time.LoadLocation(params.TimeZone); err != nil {
+			return &errors.ValidationError{Message: "unknown time zone " + params.TimeZone}
+		}
+	}
+	if len(params.Targets) == 0 {
+		return &errors.ValidationError{Message: "routing rule needs at least one target"}
+	}
+	targets := make([]string, 0, len(params.Targets))
+	for _, target := range params.Targets {
+		if !contains(providers.PaymentProviderNames, target.Provider) {
+			return &errors.ValidationError{Message: "unknown provider " + target.Provider}
+		}
+		if target.Weight <= 0 {
+			target.Weight = 1
+		}
+		targets = append(targets, target.Provider+":"+strconv.Itoa(target.Weight))
+	}
+	var merchant *entities.Merchant
+	if params.MerchantId != nil {
+		var err error
+		merchant, err = self.MerchantService.GetMerchant(ctx, *params.MerchantId)
+		if err != nil {
+			return err
+		}
+		if merchant == nil {
+			return &errors.ValidationError{Message: "merchant not found"}
+		}
+	}
+	config, err := self.MerchantService.ProviderConfig(merchant)
+	if err != nil {
+		return err
+	}
+	if err := checkTargetMethods(params, config); err != nil {
+		return err
+	}
+
+	rule.Name = params.Name
+	rule.Priority = params.Priority
+	rule.Enabled = params.Enabled
+	rule.MerchantID = params.MerchantId
+	rule.Operation = params.Operation
+	rule.Currencies = strings.ToUpper(strings.Join(params.Currencies, ","))
+	rule.MinAmount = params.MinAmount
+	rule.MaxAmount = params.MaxAmount
+	rule.PaymentMethods = strings.ToLower(strings.Join(params.PaymentMethods, ","))
+	rule.CardBrands = strings.ToLower(strings.Join(params.CardBrands, ","))
+	rule.BinCountries = strings.ToUpper(strings.Join(params.BinCountries, ","))
+	rule.TimeFrom = params.TimeFrom
+	rule.TimeUntil = params.TimeUntil
+	rule.TimeZone = params.TimeZone
+	rule.MinApprovalRate = params.MinApprovalRate
+	rule.Strategy = params.Strategy
+	if rule.Strategy == "" {
+		rule.Strategy = entities.RoutingStrategyWeighted
+	}
+	rule.Targets = strings.Join(targets, ",")
+	return nil
+}
+
+// checkTargetMethods makes sure every target of params accepts every payment
+// method the rule can match, so that no target is skipped for every request
+// and a split between targets does not collapse onto one of them. Without
+// paymentMethods, a rule matches the methods any of its targets accepts,
+// or only cards when it has card conditions.
+func checkTargetMethods(params types.RoutingRuleParams, config types.ProviderConfig) error {
+	operations := []string{providers.OperationDeposit, providers.OperationWithdraw}
+	if params.Operation != "" {
+		operations = []string{params.Operation}
+	}
+	for _, operation := range operations {
+		methods := params.PaymentMethods
+		if len(methods) == 0 && (len(params.CardBrands) > 0 || len(params.BinCountries) > 0) {
+			methods = []string{types.PaymentMethodCard}
+		}
+		if len(methods) == 0 {
+			for _, target := range params.Targets {
+				for _, method := range providers.Capabilities(target.Provider, config).Methods(operation) {
+					if !contains(methods, method) {
+						methods = append(methods, method)
+					}
+				}
+			}
+		}
+		for _, target := range params.Targets {
+			accepted := providers.Capabilities(target.Provider, config).Methods(operation)
+			for _, method := range methods {
+				if !contains(accepted, method) {
+					return &errors.ValidationError{
+						Message: "provider " + target.Provider + " does not accept " + method + " " + operation + "s, set the rule's paymentMethods and operation to ones all its targets accept",
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"payment-service/app/clock"
+	"payment-service/domain/entities"
+	"payment-service/domain/types"
+	"payment-service/errors"
+
+	"github.com/spf13/viper"
+)
+
+func TestCreateRoutingRuleRejectsTargetsThatCannotTakeItsMethods(t *testing.T) {
+	stripe := entities.RoutingTarget{Provider: "stripe", Weight: 50}
+	authorize := entities.RoutingTarget{Provider: "authorize", Weight: 50}
+	tests := []struct {
+		name               string
+		params             types.RoutingRuleParams
+		stripeCardDeposits bool
+		wantError          bool
+	}{
+		{"one target without methods", types.RoutingRuleParams{Targets: []entities.RoutingTarget{stripe}}, false, false},
+		{"split without methods", types.RoutingRuleParams{Operation: "deposit", Targets: []entities.RoutingTarget{stripe, authorize}}, false, true},
+		{"split of card deposits", types.RoutingRuleParams{Operation: "deposit", PaymentMethods: []string{"card"}, Targets: []entities.RoutingTarget{stripe, authorize}}, false, true},
+		{"split of card deposits with stripe card deposits", types.RoutingRuleParams{Operation: "deposit", PaymentMethods: []string{"card"}, Targets: []entities.RoutingTarget{stripe, authorize}}, true, false},
+		{"split of card deposits and withdrawals", types.RoutingRuleParams{PaymentMethods: []string{"card"}, Targets: []entities.RoutingTarget{stripe, authorize}}, true, true},
+		{"token deposits to authorize", types.RoutingRuleParams{Operation: "deposit", PaymentMethods: []string{"token"}, Targets: []entities.RoutingTarget{authorize}}, false, true},
+		{"card brands to stripe", types.RoutingRuleParams{Operation: "deposit", CardBrands: []string{"visa"}, Targets: []entities.RoutingTarget{stripe}}, false, true},
+		{"card brands to authorize", types.RoutingRuleParams{CardBrands: []string{"visa"}, Targets: []entities.RoutingTarget{authorize}}, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("payment.stripe_card_deposits", test.stripeCardDeposits)
+			merchantService := NewMerchantService(nil, config, nil, testLogger, clock.NewFake(time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)))
+			service := NewRoutingRuleService(noRoutingRules(t), merchantService, testLogger)
+
+			params := test.params
+			params.Name = test.name
+			_, err := service.CreateRoutingRule(context.Background(), params)
+			if !test.wantError {
+				if err != nil {
+					t.Fatalf("CreateRoutingRule: %v", err)
+				}
+				return
+			}
+			if _, ok := err.(*errors.ValidationError); !ok {
+				t.Fatalf("CreateRoutingRule returned %v, want a validation error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package services
+
+import (
+	"context"
+	"github.com/spf13/viper"
+	"math/rand"
+	"payment-service/app/circuitbreaker"
+	"payment-service/app/clock"
+	"payment-service/app/logger"
+	"payment-service/domain/cards"
+	"payment-service/domain/entities"
+	"payment-service/domain/metrics"
+	"payment-service/domain/providers"
+	"payment-service/domain/repositories"
+	"payment-service/domain/types"
+	"payment-service/errors"
+	"payment-service/interfaces"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RoutingService picks the provider for a deposit or withdrawal. A request
+// that pins a provider gets that provider or fails fast while its circuit
+// breaker is open. Otherwise the routing rules are tried in order, and when
+// none of them decides, the first provider in PaymentProviderNames that is
+// configured for the merchant, accepts the payment method and currency,
+// and whose breaker lets the call through is chosen. Failover only skips
+// providers whose breaker is open: a call that failed is never repeated on
+// another provider.
+type RoutingService struct {
+	MerchantService       *MerchantService
+	CircuitBreakerService *CircuitBreakerService
+	ApprovalRateService   *ApprovalRateService
+	RoutingRuleRepository *repositories.RoutingRuleRepository
+	Config                *viper.Viper
+	Logger                *logger.Logger
+	Clock                 clock.Clock
+	// binCountries is loaded once from routing.bin_countries_file.
+	binCountriesOnce sync.Once
+	binCountryTable  cards.BinCountries
+}
+
+func NewRoutingService(merchantService *MerchantService, circuitBreakerService *CircuitBreakerService, approvalRateService *ApprovalRateService, routingRuleRepository *repositories.RoutingRuleRepository, config *viper.Viper, log *logger.Logger, clock clock.Clock) *RoutingService {
+	return &RoutingService{
+		MerchantService:       merchantService,
+		CircuitBreakerService: circuitBreakerService,
+		ApprovalRateService:   approvalRateService,
+		RoutingRuleRepository: routingRuleRepository,
+		Config:                config,
+		Logger:                log,
+		Clock:                 clock,
+	}
+}
+
+// Route returns the chosen provider and how it was chosen. The call is
+// reserved on the provider's breaker: the caller must report it with
+// CircuitBreakerService.Record, or give it back with Breaker(name).Release
+// when the call is not made.
+func (self *RoutingService) Route(ctx context.Context, merchant *entities.Merchant, request types.RoutingRequest) (types.RoutingDecision, interfaces.IPaymentProvider, error) {
+	decision := types.RoutingDecision{DecidedAt: self.Clock.Now().UTC()}
+	config, err := self.MerchantService.ProviderConfig(merchant)
+	if err != nil {
+		return decision, nil, err
+	}
+
+	if request.Provider != "" {
+		decision.Mode = types.RoutingModePinned
+		decision.Provider = request.Provider
+		provider, err := self.MerchantService.ProviderFactory(request.Provider, config)
+		if err != nil {
+			return decision, nil, err
+		}
+		if !self.CircuitBreakerService.Breaker(request.Provider).Allow() {
+			return decision, nil, &errors.ProviderUnavailableError{
+				Message: request.Provider + " is unavailable, try again later or use another provider",
+			}
+		}
+		metrics.RoutingDecision(request.Operation, decision.Mode, "", decision.Provider)
+		return decision, provider, nil
+	}
+
+	if request.Method == "" {
+		return decision, nil, &errors.ValidationError{
+			Message: "request carries no payment method",
+		}
+	}
+	if request.CardNumber != "" {
+		decision.CardBrand = string(cards.DetectBrand(request.CardNumber))
+		decision.BinCountry = self.binCountries().Country(request.CardNumber)
+	}
+
+	rules, err := self.RoutingRuleRepository.ListEnabledRoutingRules(ctx, merchantId(merchant))
+	if err != nil {
+		return decision, nil, &errors.InternalServerError{
+			Message: "failed to load routing rules: " + err.Error(),
+		}
+	}
+	for _, rule := range rules {
+		if !ruleMatches(rule, request, decision) {
+			continue
+		}
+		candidates, name := self.chooseTarget(rule, config, request)
+		if name == "" {
+			continue
+		}
+		ruleId := rule.ID
+		decision.Mode = types.RoutingModeRule
+		decision.RuleId = &ruleId
+		decision.RuleName = rule.Name
+		decision.Strategy = rule.Strategy
+		decision.Candidates = candidates
+		return self.routed(ctx, decision, name, config, request.Operation)
+	}
+
+	decision.Mode = types.RoutingModeDefault
+	for _, name := range providers.PaymentProviderNames {
+		candidate := self.candidate(name, 0)
+		switch {
+		case !providers.Supports(name, config, request.Operation, request.Method, request.Currency):
+			candidate.Skipped = types.RoutingSkipNotEligible
+		case decision.Provider != "":
+		case !self.CircuitBreakerService.Breaker(name).Allow():
+			candidate.Skipped = types.RoutingSkipCircuitOpen
+		default:
+			decision.Provider = name
+		}
+		decision.Candidates = append(decision.Candidates, candidate)
+	}
+	if decision.Provider == "" {
+		eligible := false
+		for _, candidate := range decision.Candidates {
+			if candidate.Skipped == types.RoutingSkipCircuitOpen {
+				eligible = true
+				metrics.ProviderFailover(request.Operation, candidate.Provider, "none")
+			}
+		}
+		if !eligible {
+			return decision, nil, &errors.ValidationError{
+				Message: "no provider accepts " + request.Method + " " + request.Operation + "s in " + strings.ToUpper(request.Currency),
+			}
+		}
+		return decision, nil, &errors.ProviderUnavailableError{
+			Message: "every provider for this " + request.Operation + " is unavailable, try again later",
+		}
+	}
+	return self.routed(ctx, decision, decision.Provider, config, request.Operation)
+}
+
+// routed builds the provider chosen by decision, whose breaker call is
+// already reserved, and counts providers skipped for an open breaker as
+// failovers.
+func (self *RoutingService) routed(ctx context.Context, decision types.RoutingDecision, name string, config types.ProviderConfig, operation string) (types.RoutingDecision, interfaces.IPaymentProvider, error) {
+	decision.Provider = name
+	provider, err := self.MerchantService.ProviderFactory(name, config)
+	if err != nil {
+		self.CircuitBreakerService.Breaker(name).Release()
+		return decision, nil, err
+	}
+
+	log := self.Logger.FromContext(ctx)
+	for _, candidate := range decision.Candidates {
+		if candidate.Skipped == types.RoutingSkipCircuitOpen {
+			log.Warnf("%s circuit breaker is open, routing %s to %s", candidate.Provider, operation, name)
+			metrics.ProviderFailover(operation, candidate.Provider, name)
+		}
+	}
+	metrics.RoutingDecision(operation, decision.Mode, decision.RuleName, name)
+	return decision, provider, nil
+}
+
+// chooseTarget picks a target of rule by its strategy and reserves a call
+// on its breaker. It returns every target as a candidate, and an empty name
+// when none is available.
+func (self *RoutingService) chooseTarget(rule entities.RoutingRule, config types.ProviderConfig, request types.RoutingRequest) ([]types.RoutingCandidate, string) {
+	var candidates []types.RoutingCandidate
+	var available []int
+	for _, target := range rule.TargetList() {
+		candidate := self.candidate(target.Provider, target.Weight)
+		switch {
+		case !providers.Supports(target.Provider, config, request.Operation, request.Method, request.Currency):
+			candidate.Skipped = types.RoutingSkipNotEligible
+		case rule.MinApprovalRate != nil && candidate.ApprovalRate != nil && *candidate.ApprovalRate < *rule.MinApprovalRate:
+			candidate.Skipped = types.RoutingSkipLowApprovalRate
+		case self.CircuitBreakerService.State(target.Provider) == circuitbreaker.StateOpen:
+			candidate.Skipped = types.RoutingSkipCircuitOpen
+		default:
+			available = append(available, len(candidates))
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	for len(available) > 0 {
+		pick := pickTarget(rule.Strategy, candidates, available)
+		index := available[pick]
+		if self.CircuitBreakerService.Breaker(candidates[index].Provider).Allow() {
+			return candidates, candidates[index].Provider
+		}
+		// The breaker has no half-open trial call left.
+		candidates[index].Skipped = types.RoutingSkipCircuitOpen
+		available = append(available[:pick], available[pick+1:]...)
+	}
+	return candidates, ""
+}
+
+func (self *RoutingService) candidate(provider string, weight int) types.RoutingCandidate {
+	candidate := types.RoutingCandidate{Provider: provider, Weight: weight}
+	if rate, ok := self.ApprovalRateService.Rate(provider); ok {
+		candidate.ApprovalRate = &rate
+	}
+	return candidate
+}
+
+// pickTarget returns the position in available of the chosen candidate.
+// The approval rate strategy prefers the highest observed rate, and a
+// target without enough samples over none; ties go to the earlier target.
+func pickTarget(strategy string, candidates []types.RoutingCandidate, available []int) int {
+	if strategy == entities.RoutingStrategyApprovalRate {
+		best := 0
+		for i, index := range available {
+			if betterApprovalRate(candidates[index].ApprovalRate, candidates[available[best]].ApprovalRate) {
+				best = i
+			}
+		}
+		return best
+	}
+
+	total := 0
+	for _, index := range available {
+		total += candidates[index].Weight
+	}
+	if total <= 0 {
+		return 0
+	}
+	roll := rand.Intn(total)
+	for i, index := range available {
+		roll -= candidates[index].Weight
+		if roll < 0 {
+			return i
+		}
+	}
+	return len(available) - 1
+}
+
+func betterApprovalRate(rate *float64, than *float64) bool {
+	if rate == nil || than == nil {
+		return rate != nil && than == nil
+	}
+	return *rate > *than
+}
+
+// ruleMatches reports whether every condition of rule holds for request
+// when decision was made. Rule amounts are in major units, so the request
+// amount is converted from the minor units token deposits and destination
+// withdrawals are sent in.
+func ruleMatches(rule entities.RoutingRule, request types.RoutingRequest, decision types.RoutingDecision) bool {
+	if rule.Operation != "" && rule.Operation != request.Operation {
+		return false
+	}
+	if !listMatches(rule.Currencies, request.Currency) {
+		return false
+	}
+	amount := providers.MajorAmount(request.Operation, request.Method, request.Amount, request.Currency)
+	if rule.MinAmount != nil && amount < *rule.MinAmount {
+		return false
+	}
+	if rule.MaxAmount != nil && amount >= *rule.MaxAmount {
+		return false
+	}
+	if !listMatches(rule.PaymentMethods, request.Method) {
+		return false
+	}
+	if !listMatches(rule.CardBrands, decision.CardBrand) {
+		return false
+	}
+	if !listMatches(rule.BinCountries, decision.BinCountry) {
+		return false
+	}
+	return timeMatches(rule, decision.DecidedAt)
+}
+
+// listMatches reports whether value is in the comma separated list, which
+// matches anything when empty. An empty value never matches a list.
+func listMatches(list string, value string) bool {
+	values := entities.SplitList(list)
+	if len(values) == 0 {
+		return true
+	}
+	return value != "" && contains(values, value)
+}
+
+// timeMatches reports whether now falls in the rule's daily window, which
+// wraps past midnight when TimeUntil is before TimeFrom.
+func timeMatches(rule entities.RoutingRule, now time.Time) bool {
+	if rule.TimeFrom == "" || rule.TimeUntil == "" {
+		return true
+	}
+	location := time.UTC
+	if rule.TimeZone != "" {
+		loaded, err := time.LoadLocation(rule.TimeZone)
+		if err != nil {
+			return false
+		}
+		location = loaded
+	}
+	from, fromErr := time.Parse("15:04", rule.TimeFrom)
+	until, untilErr := time.Parse("15:04", rule.TimeUntil)
+	if fromErr != nil || untilErr != nil {
+		return false
+	}
+
+	local := now.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	fromMinute := from.Hour()*60 + from.Minute()
+	untilMinute := until.Hour()*60 + until.Minute()
+	if fromMinute <= untilMinute {
+		return minute >= fromMinute && minute < untilMinute
+	}
+	return minute >= fromMinute || minute < untilMinute
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if strings.EqualFold(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *RoutingService) binCountries() cards.BinCountries {
+	self.binCountriesOnce.Do(func() {
+		path := self.Config.GetString("routing.bin_countries_file")
+		if path == "" {
+			return
+		}
+		countries, err := cards.LoadBinCountries(path)
+		if err != nil {
+			self.Logger.Error("failed to load BIN countries, rules on BIN country will not match: ", err.Error())
+			return
+		}
+		self.binCountryTable = countries
+	})
+	return self.binCountryTable
+}
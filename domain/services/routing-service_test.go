@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"payment-service/domain/entities"
+	"payment-service/domain/providers"
+	"payment-service/domain/repositories"
+	"payment-service/domain/types"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestRuleMatchesAmountInMajorUnits(t *testing.T) {
+	minAmount, maxAmount := 10.0, 100.0
+	rule := entities.RoutingRule{MinAmount: &minAmount, MaxAmount: &maxAmount}
+	tests := []struct {
+		name    string
+		request types.RoutingRequest
+		want    bool
+	}{
+		{"card deposit in dollars", types.RoutingRequest{Operation: providers.OperationDeposit, Method: types.PaymentMethodCard, Currency: "USD", Amount: 50}, true},
+		{"card deposit above the maximum", types.RoutingRequest{Operation: providers.OperationDeposit, Method: types.PaymentMethodCard, Currency: "USD", Amount: 5000}, false},
+		{"token deposit in cents", types.RoutingRequest{Operation: providers.OperationDeposit, Method: types.PaymentMethodToken, Currency: "usd", Amount: 5000}, true},
+		{"token deposit below the minimum", types.RoutingRequest{Operation: providers.OperationDeposit, Method: types.PaymentMethodToken, Currency: "usd", Amount: 50}, false},
+		{"token deposit in a zero-decimal currency", types.RoutingRequest{Operation: providers.OperationDeposit, Method: types.PaymentMethodToken, Currency: "jpy", Amount: 50}, true},
+		{"destination withdrawal in cents", types.RoutingRequest{Operation: providers.OperationWithdraw, Method: types.PaymentMethodDestination, Currency: "eur", Amount: 1000}, true},
+		{"maximum is exclusive", types.RoutingRequest{Operation: providers.OperationWithdraw, Method: types.PaymentMethodDestination, Currency: "eur", Amount: 10000}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ruleMatches(rule, test.request, types.RoutingDecision{}); got != test.want {
+				t.Errorf("ruleMatches(%+v) = %t, want %t", test.request, got, test.want)
+			}
+		})
+	}
+}
+
+// noRoutingRules returns a repository whose statements run dry, without a
+// database: it finds no rules and saves nothing.
+func noRoutingRules(t *testing.T) *repositories.RoutingRuleRepository {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=routing-rules-test"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repositories.NewRoutingRuleRepository(db)
+}
+
+func TestCardDepositsFailOverWhenTheBreakerIsOpen(t *testing.T) {
+	fixture := newPaymentServiceFixture(map[string]*fakeProvider{
+		"stripe":    approvingProvider(),
+		"authorize": approvingProvider(),
+	})
+	config := fixture.service.MerchantService.Config
+	config.Set("payment.stripe_secret_key", "sk_test")
+	config.Set("payment.authorize_login_id", "login")
+	config.Set("payment.authorize_transaction_key", "key")
+	config.Set("payment.stripe_card_deposits", true)
+	config.Set("circuit_breaker.window", 1)
+	config.Set("circuit_breaker.minimum_calls", 1)
+	fixture.service.RoutingService.RoutingRuleRepository = noRoutingRules(t)
+
+	deposit := func(transactionId string) entities.Transaction {
+		t.Helper()
+		_, err := fixture.service.Deposit(context.Background(), nil, types.DepositParams{
+			TransactionId:    transactionId,
+			Amount:           10,
+			Currency:         "USD",
+			CreditCardNumber: "4242424242424242",
+			ExpirationDate:   "2030-12",
+			CVV:              "123",
+		})
+		if err != nil {
+			t.Fatalf("Deposit(%s): %v", transactionId, err)
+		}
+		return fixture.stored(t, transactionId)
+	}
+
+	first := deposit("card-closed")
+	if first.GatewayName != "stripe" || first.Amount != 1000 {
+		t.Errorf("with the breaker closed: sent to %s for %v, want stripe for 1000 cents", first.GatewayName, first.Amount)
+	}
+
+	breaker := fixture.service.CircuitBreakerService.Breaker("stripe")
+	breaker.Allow()
+	breaker.Record(true, 0)
+
+	second := deposit("card-open")
+	if second.GatewayName != "authorize" || second.Amount != 10 {
+		t.Errorf("with the breaker open: sent to %s for %v, want authorize for 10 dollars", second.GatewayName, second.Amount)
+	}
+	if fixture.providers["stripe"].charges != 1 || fixture.providers["authorize"].charges != 1 {
+		t.Errorf("stripe charged %d times and authorize %d, want once each", fixture.providers["stripe"].charges, fixture.providers["authorize"].charges)
+	}
+	var decision types.RoutingDecision
+	if second.RoutingDecision == nil || json.Unmarshal([]byte(*second.RoutingDecision), &decision) != nil {
+		t.Fatalf("routing decision %v is not stored", second.RoutingDecision)
+	}
+	if len(decision.Candidates) == 0 || decision.Candidates[0].Provider != "stripe" || decision.Candidates[0].Skipped != "circuit_open" {
+		t.Errorf("candidates %+v, want stripe skipped as circuit_open", decision.Candidates)
+	}
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"payment-service/app/clock"
+	"payment-service/app/logger"
+	"payment-service/app/redaction"
+	"payment-service/domain/providers"
+	"payment-service/domain/repositories"
+	"payment-service/domain/types"
+	"payment-service/interfaces"
+	"sync"
+	"time"
+)
+
+const providerCheckTimeout = 5 * time.Second
+
+// StatusService reports the state of the service's dependencies for the
+// admin status endpoint.
+type StatusService struct {
+	MerchantService         *MerchantService
+	CircuitBreakerService   *CircuitBreakerService
+	WebhookStatusRepository *repositories.WebhookStatusRepository
+	Logger                  *logger.Logger
+	Clock                   clock.Clock
+}
+
+func NewStatusService(merchantService *MerchantService, circuitBreakerService *CircuitBreakerService, webhookStatusRepository *repositories.WebhookStatusRepository, log *logger.Logger, clock clock.Clock) *StatusService {
+	return &StatusService{
+		MerchantService:         merchantService,
+		CircuitBreakerService:   circuitBreakerService,
+		WebhookStatusRepository: webhookStatusRepository,
+		Logger:                  log,
+		Clock:                   clock,
+	}
+}
+
+// RecordWebhook remembers a successfully processed webhook. Failures are
+// logged only, they must never fail the webhook itself.
+func (self *StatusService) RecordWebhook(ctx context.Context, provider string, eventType string) {
+	if err := self.WebhookStatusRepository.RecordSuccess(ctx, provider, eventType, self.Clock.Now()); err != nil {
+		self.Logger.Error("failed to record webhook status: ", err.Error())
+	}
+}
+
+// ProviderStatuses checks every provider in parallel with the platform
+// credentials and adds its circuit breaker state and last successful
+// webhook. The connection check does not go through the breaker.
+func (self *StatusService) ProviderStatuses(ctx context.Context) ([]types.ProviderStatus, error) {
+	webhooks, err := self.WebhookStatusRepository.ListWebhookStatuses(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]types.ProviderStatus, len(providers.PaymentProviderNames))
+	var wait sync.WaitGroup
+	for i, name := range providers.PaymentProviderNames {
+		wait.Add(1)
+		go func(i int, name string) {
+			defer wait.Done()
+			statuses[i] = self.checkProvider(ctx, name)
+		}(i, name)
+	}
+	wait.Wait()
+
+	for i := range statuses {
+		for _, webhook := range webhooks {
+			if webhook.Provider == statuses[i].Provider {
+				lastSucceededAt := webhook.LastSucceededAt
+				statuses[i].LastWebhookAt = &lastSucceededAt
+				statuses[i].LastWebhookEventType = webhook.LastEventType
+			}
+		}
+	}
+	return statuses, nil
+}
+
+func (self *StatusService) checkProvider(ctx context.Context, name string) types.ProviderStatus {
+	status := types.ProviderStatus{
+		Provider:       name,
+		CircuitBreaker: string(self.CircuitBreakerService.State(name)),
+	}
+
+	provider, err := self.MerchantService.PaymentProvider(nil, name)
+	if err != nil {
+		status.Status = types.ProviderStatusNotConfigured
+		return status
+	}
+	healthProvider, ok := provider.(interfaces.IHealthProvider)
+	if !ok {
+		status.Status = types.ProviderStatusNotConfigured
+		status.Detail = "provider does not support connection checks"
+		return status
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, providerCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err = healthProvider.CheckConnection(ctx)
+	status.LatencyMs = time.Since(start).Milliseconds()
+	switch {
+	case err == nil:
+		status.Status = types.ProviderStatusOk
+	case ctx.Err() != nil:
+		status.Status = types.ProviderStatusTimeout
+		status.Detail = "no response within " + providerCheckTimeout.String()
+	default:
+		status.Status = types.ProviderStatusFailed
+		status.Detail = redaction.RedactText(err.Error())
+	}
+	return status
+}
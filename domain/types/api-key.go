@@ -0,0 +1,21 @@
+package types
+
+import "payment-service/domain/entities"
+
+// CreatedApiKey is returned once, when a key is created. Key and
+// SigningSecret cannot be retrieved again.
+type CreatedApiKey struct {
+	ApiKey        entities.ApiKey `json:"apiKey"`
+	Key           string          `json:"key"`
+	SigningSecret string          `json:"signingSecret,omitempty"`
+}
+
+// RequestSignature carries the signing headers of a request.
+type RequestSignature struct {
+	Timestamp string
+	Nonce     string
+	Signature string
+	Method    string
+	Path      string
+	Body      []byte
+}
@@ -0,0 +1,57 @@
+package types
+
+import (
+	"payment-service/app/httpclient"
+	"time"
+)
+
+// MerchantCredentials are the provider secrets of a merchant. They are
+// stored encrypted and never returned by the API.
+type MerchantCredentials struct {
+	StripeSecretKey              string `json:"stripeSecretKey,omitempty"`
+	StripeEndpointSecret         string `json:"stripeEndpointSecret,omitempty"`
+	AuthorizeLoginId             string `json:"authorizeLoginId,omitempty"`
+	AuthorizeTransactionKey      string `json:"authorizeTransactionKey,omitempty"`
+	AuthorizeWebhookSignatureKey string `json:"authorizeWebhookSignatureKey,omitempty"`
+}
+
+// MerchantParams creates or updates a merchant. Nil fields and empty
+// credentials are left unchanged on update.
+type MerchantParams struct {
+	Name                        string
+	Credentials                 *MerchantCredentials
+	AuthorizeFeePercent         *float64
+	AuthorizeFeeFixed           *float64
+	AuthorizeSettlementCurrency *string
+}
+
+// ProviderConfig is everything a payment provider needs to act for one
+// merchant, or for the platform when MerchantId is nil.
+type ProviderConfig struct {
+	MerchantId                  *uint
+	Credentials                 MerchantCredentials
+	AuthorizeFeePercent         float64
+	AuthorizeFeeFixed           float64
+	AuthorizeSettlementCurrency string
+	// StripeTimeout and AuthorizeTimeout bound each call to the provider;
+	// zero uses providers.DefaultProviderTimeout.
+	StripeTimeout    time.Duration
+	AuthorizeTimeout time.Duration
+	// StripeRetry and AuthorizeRetry say how failed requests to the provider
+	// are retried; zero fields use httpclient.DefaultRetryPolicy.
+	StripeRetry    httpclient.RetryPolicy
+	AuthorizeRetry httpclient.RetryPolicy
+	// StripeCurrencies and AuthorizeCurrencies restrict the currencies the
+	// provider is chosen for when a request does not pin one; empty uses the
+	// provider's default list.
+	StripeCurrencies    []string
+	AuthorizeCurrencies []string
+	// StripeCardDeposits lets Stripe take card details for deposits, which
+	// the Stripe account must be allowed to send as raw card data.
+	StripeCardDeposits bool
+	// StripeBaseUrl and AuthorizeBaseUrl point the providers at another
+	// server, such as the fakes in domain/providers/fakeproviders; empty uses
+	// Stripe's API and the Authorize.Net sandbox.
+	StripeBaseUrl    string
+	AuthorizeBaseUrl string
+}
@@ -0,0 +1,36 @@
+package types
+
+// ResyncResult describes a transaction status compared against the provider.
+// Applied is false in dry-run mode or when nothing changed. Held is true when
+// the provider reports another status but the stored one is kept, see
+// services.HeldStatuses.
+type ResyncResult struct {
+	TransactionId  string `json:"transactionId"`
+	GatewayName    string `json:"gatewayName"`
+	PaymentId      string `json:"paymentId"`
+	PreviousStatus string `json:"previousStatus"`
+	Status         string `json:"status"`
+	ProviderStatus string `json:"providerStatus,omitempty"`
+	Changed        bool   `json:"changed"`
+	Held           bool   `json:"held,omitempty"`
+	Applied        bool   `json:"applied"`
+	Error          string `json:"error,omitempty"`
+}
+
+type RefundResult struct {
+	TransactionId  string  `json:"transactionId"`
+	GatewayName    string  `json:"gatewayName"`
+	Amount         float64 `json:"amount"`
+	PreviousStatus string  `json:"previousStatus"`
+	Status         string  `json:"status"`
+	Applied        bool    `json:"applied"`
+}
+
+type ReconciliationReport struct {
+	DryRun  bool           `json:"dryRun"`
+	Checked int            `json:"checked"`
+	Changed int            `json:"changed"`
+	Held    int            `json:"held"`
+	Failed  int            `json:"failed"`
+	Results []ResyncResult `json:"results"`
+}
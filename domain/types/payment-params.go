@@ -1,7 +1,5 @@
 package types
 
-import "github.com/stripe/stripe-go"
-
 type DepositParams struct {
 	Amount           float64
 	Currency         string
@@ -26,13 +24,41 @@ type WithdrawParams struct {
 	CVV              string
 }
 
-type CustomPaymentIntent struct {
-	LatestCharge string `json:"latest_charge"`
+// Payment methods a request can carry. Providers declare which of them they
+// accept, see providers.Supports.
+const (
+	// PaymentMethodCard is a raw card number with expiry and CVV.
+	PaymentMethodCard = "card"
+	// PaymentMethodToken is a provider-side payment method id.
+	PaymentMethodToken = "token"
+	// PaymentMethodDestination is a provider-side payout destination id.
+	PaymentMethodDestination = "destination"
+)
+
+// Method returns the payment method the deposit carries; a token wins over
+// card details.
+func (self DepositParams) Method() string {
+	if self.Token != "" {
+		return PaymentMethodToken
+	}
+	if self.CreditCardNumber != "" {
+		return PaymentMethodCard
+	}
+	return ""
 }
 
-type PaymentIntentError struct {
-	Message       string               `json:"message"`
-	Code          string               `json:"code"`
-	Charge        string               `json:"charge"`
-	PaymentIntent stripe.PaymentIntent `json:"payment_intent"`
+// Method returns the payment method the withdrawal pays out to; a
+// destination wins over card details.
+func (self WithdrawParams) Method() string {
+	if self.Destination != "" {
+		return PaymentMethodDestination
+	}
+	if self.CreditCardNumber != "" {
+		return PaymentMethodCard
+	}
+	return ""
+}
+
+type CustomPaymentIntent struct {
+	LatestCharge string `json:"latest_charge"`
 }
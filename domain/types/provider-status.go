@@ -0,0 +1,24 @@
+package types
+
+import "time"
+
+// Provider status values.
+const (
+	ProviderStatusOk            = "ok"
+	ProviderStatusFailed        = "failed"
+	ProviderStatusTimeout       = "timeout"
+	ProviderStatusNotConfigured = "not_configured"
+)
+
+// ProviderStatus is a provider's reachability with the platform credentials,
+// the state of its circuit breaker and the last webhook from it that was
+// processed successfully.
+type ProviderStatus struct {
+	Provider             string     `json:"provider"`
+	Status               string     `json:"status"`
+	Detail               string     `json:"detail,omitempty"`
+	CircuitBreaker       string     `json:"circuitBreaker"`
+	LatencyMs            int64      `json:"latencyMs"`
+	LastWebhookAt        *time.Time `json:"lastWebhookAt"`
+	LastWebhookEventType string     `json:"lastWebhookEventType,omitempty"`
+}
@@ -0,0 +1,28 @@
+package types
+
+import "time"
+
+// RateLimit is a token bucket budget: PerMinute tokens are added per minute
+// up to Burst.
+type RateLimit struct {
+	PerMinute int
+	Burst     int
+}
+
+func (self RateLimit) TokensPerSecond() float64 {
+	return float64(self.PerMinute) / 60
+}
+
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	ResetAfter time.Duration
+}
+
+// RateLimitBucket is the state of a token bucket after a take.
+type RateLimitBucket struct {
+	Tokens  float64
+	Allowed bool
+}
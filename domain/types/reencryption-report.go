@@ -0,0 +1,13 @@
+package types
+
+// ReencryptionReport summarises a pass that moves stored transaction
+// payloads, merchant credentials and API key signing secrets under the
+// active master key. Counts cover all three.
+type ReencryptionReport struct {
+	DryRun      bool     `json:"dryRun"`
+	ActiveKeyId string   `json:"activeKeyId"`
+	Checked     int      `json:"checked"`
+	Reencrypted int      `json:"reencrypted"`
+	Failed      int      `json:"failed"`
+	Errors      []string `json:"errors,omitempty"`
+}
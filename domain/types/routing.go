@@ -0,0 +1,80 @@
+package types
+
+import (
+	"payment-service/domain/entities"
+	"time"
+)
+
+// Routing modes, recorded on the transaction.
+const (
+	// RoutingModePinned is a request that named its provider.
+	RoutingModePinned = "pinned"
+	// RoutingModeRule is a provider chosen by a routing rule.
+	RoutingModeRule = "rule"
+	// RoutingModeDefault is the first available provider, used when no rule
+	// matched or none of the matching rules had an available target.
+	RoutingModeDefault = "default"
+)
+
+// Reasons a routing candidate was passed over.
+const (
+	RoutingSkipNotEligible     = "not_eligible"
+	RoutingSkipCircuitOpen     = "circuit_open"
+	RoutingSkipLowApprovalRate = "low_approval_rate"
+)
+
+// RoutingRequest is what the provider of a deposit or withdrawal is chosen
+// by. Provider is empty unless the request pins one. Amount is as sent,
+// in the units of the providers accepting Method.
+type RoutingRequest struct {
+	Operation  string
+	Provider   string
+	Method     string
+	Currency   string
+	Amount     float64
+	CardNumber string
+}
+
+// RoutingDecision records how the provider of a transaction was chosen. It
+// is stored on the transaction as JSON.
+type RoutingDecision struct {
+	Mode       string             `json:"mode"`
+	Provider   string             `json:"provider"`
+	RuleId     *uint              `json:"ruleId,omitempty"`
+	RuleName   string             `json:"ruleName,omitempty"`
+	Strategy   string             `json:"strategy,omitempty"`
+	CardBrand  string             `json:"cardBrand,omitempty"`
+	BinCountry string             `json:"binCountry,omitempty"`
+	Candidates []RoutingCandidate `json:"candidates,omitempty"`
+	DecidedAt  time.Time          `json:"decidedAt"`
+}
+
+// RoutingCandidate is a provider considered for a request, with the
+// approval rate observed for it and, when it was not chosen, why.
+type RoutingCandidate struct {
+	Provider     string   `json:"provider"`
+	Weight       int      `json:"weight,omitempty"`
+	ApprovalRate *float64 `json:"approvalRate,omitempty"`
+	Skipped      string   `json:"skipped,omitempty"`
+}
+
+// RoutingRuleParams creates or replaces a routing rule.
+type RoutingRuleParams struct {
+	Name            string
+	Priority        int
+	Enabled         bool
+	MerchantId      *uint
+	Operation       string
+	Currencies      []string
+	MinAmount       *float64
+	MaxAmount       *float64
+	PaymentMethods  []string
+	CardBrands      []string
+	BinCountries    []string
+	TimeFrom        string
+	TimeUntil       string
+	TimeZone        string
+	MinApprovalRate *float64
+	Strategy        string
+	Targets         []entities.RoutingTarget
+}
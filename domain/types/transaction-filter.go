@@ -0,0 +1,13 @@
+package types
+
+import "time"
+
+// TransactionFilter narrows transaction listings. Zero values are ignored.
+type TransactionFilter struct {
+	From        *time.Time
+	To          *time.Time
+	Status      string
+	GatewayName string
+	MerchantId  *uint
+	Limit       int
+}
@@ -0,0 +1,87 @@
+package errors
+
+import "net/http"
+
+// Error codes are the stable, machine-readable "code" of a problem
+// response. Clients should branch on them rather than on the message.
+const (
+	CodeValidationFailed    = "validation_failed"
+	CodeInternalError       = "internal_error"
+	CodeProviderTimeout     = "provider_timeout"
+	CodeNotFound            = "not_found"
+	CodeConflict            = "conflict"
+	CodeProviderDeclined    = "provider_declined"
+	CodeProviderUnavailable = "provider_unavailable"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeRateLimited         = "rate_limited"
+	CodeMethodNotAllowed    = "method_not_allowed"
+)
+
+// ProblemType documents one error code, as listed on the error docs page.
+type ProblemType struct {
+	Code        string `json:"code"`
+	Title       string `json:"title"`
+	Status      int    `json:"status"`
+	Description string `json:"description"`
+}
+
+var ProblemTypes = []ProblemType{
+	{Code: CodeValidationFailed, Title: "Validation failed", Status: http.StatusBadRequest, Description: "The request body or parameters are invalid; fieldErrors lists the failing fields."},
+	{Code: CodeUnauthorized, Title: "Unauthorized", Status: http.StatusUnauthorized, Description: "The API key is missing, unknown or revoked, or a request or webhook signature is invalid."},
+	{Code: CodeProviderDeclined, Title: "Payment declined", Status: http.StatusPaymentRequired, Description: "The provider declined the payment; declineCode and retryable say why and whether to try again."},
+	{Code: CodeForbidden, Title: "Forbidden", Status: http.StatusForbidden, Description: "The API key may not perform this request, e.g. it lacks a scope or is a merchant key on a platform endpoint."},
+	{Code: CodeNotFound, Title: "Not found", Status: http.StatusNotFound, Description: "The resource does not exist or is not visible to the API key."},
+	{Code: CodeMethodNotAllowed, Title: "Method not allowed", Status: http.StatusMethodNotAllowed, Description: "The route does not accept this HTTP method."},
+	{Code: CodeConflict, Title: "Conflict", Status: http.StatusConflict, Description: "The request clashes with the current state, e.g. the transactionId is already taken or the transaction cannot be refunded."},
+	{Code: CodeRateLimited, Title: "Rate limit exceeded", Status: http.StatusTooManyRequests, Description: "The client is over its rate limit; retry after the Retry-After header."},
+	{Code: CodeInternalError, Title: "Internal error", Status: http.StatusInternalServerError, Description: "The request failed on our side or at the provider. A deposit or withdrawal that got this far keeps its transactionId, so repeating it answers conflict: look the transaction up for its outcome, or retry with a new transactionId."},
+	{Code: CodeProviderUnavailable, Title: "Provider unavailable", Status: http.StatusServiceUnavailable, Description: "No provider can take the request now because its circuit breaker is open; retry later or pick another provider."},
+	{Code: CodeProviderTimeout, Title: "Provider timeout", Status: http.StatusGatewayTimeout, Description: "The provider did not answer in time; the outcome is unknown until the transaction is looked up."},
+}
+
+// Title returns the title of the problem type of code.
+func Title(code string) string {
+	for _, problemType := range ProblemTypes {
+		if problemType.Code == code {
+			return problemType.Title
+		}
+	}
+	return http.StatusText(http.StatusInternalServerError)
+}
+
+// Description returns the description of the problem type of code.
+func Description(code string) string {
+	for _, problemType := range ProblemTypes {
+		if problemType.Code == code {
+			return problemType.Description
+		}
+	}
+	return http.StatusText(http.StatusInternalServerError)
+}
+
+// MapErrorToCode returns the error code of err.
+func MapErrorToCode(err error) string {
+	switch err.(type) {
+	case *ValidationError:
+		return CodeValidationFailed
+	case *TimeoutError:
+		return CodeProviderTimeout
+	case *NotFoundError:
+		return CodeNotFound
+	case *ConflictError:
+		return CodeConflict
+	case *ProviderDeclinedError:
+		return CodeProviderDeclined
+	case *ProviderUnavailableError:
+		return CodeProviderUnavailable
+	case *UnauthorizedError:
+		return CodeUnauthorized
+	case *ForbiddenError:
+		return CodeForbidden
+	case *RateLimitedError:
+		return CodeRateLimited
+	default:
+		return CodeInternalError
+	}
+}
@@ -2,6 +2,7 @@ package errors
 
 import (
 	"net/http"
+	"time"
 )
 
 type ValidationError struct {
@@ -12,6 +13,60 @@ type InternalServerError struct {
 	Message string
 }
 
+// TimeoutError reports that a call to an external service did not finish
+// before its deadline, or that the caller gave up waiting. Err is the context
+// error.
+type TimeoutError struct {
+	Message string
+	Err     error
+}
+
+// NotFoundError reports that the resource a request refers to does not
+// exist, or is not visible to the caller.
+type NotFoundError struct {
+	Message string
+}
+
+// ConflictError reports that a request clashes with the current state of a
+// resource, such as a transaction id that is already taken.
+type ConflictError struct {
+	Message string
+}
+
+// ProviderDeclinedError reports that the provider declined the payment.
+// DeclineCode is the normalized decline code and Retryable whether the same
+// payment may succeed later.
+type ProviderDeclinedError struct {
+	Message     string
+	DeclineCode string
+	Retryable   bool
+}
+
+// ProviderUnavailableError reports that no provider can take a call right
+// now, because its circuit breaker is open.
+type ProviderUnavailableError struct {
+	Message string
+}
+
+// UnauthorizedError reports a missing, unknown or revoked API key, or a bad
+// request or webhook signature.
+type UnauthorizedError struct {
+	Message string
+}
+
+// ForbiddenError reports an authenticated caller that may not perform the
+// request.
+type ForbiddenError struct {
+	Message string
+}
+
+// RateLimitedError reports a client over its rate limit. It may try again
+// after RetryAfter.
+type RateLimitedError struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
 func (e *ValidationError) Error() string {
 	return e.Message
 }
@@ -20,12 +75,64 @@ func (e *InternalServerError) Error() string {
 	return e.Message
 }
 
+func (e *TimeoutError) Error() string {
+	return e.Message
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Message
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+func (e *ProviderDeclinedError) Error() string {
+	return e.Message
+}
+
+func (e *ProviderUnavailableError) Error() string {
+	return e.Message
+}
+
+func (e *UnauthorizedError) Error() string {
+	return e.Message
+}
+
+func (e *ForbiddenError) Error() string {
+	return e.Message
+}
+
+func (e *RateLimitedError) Error() string {
+	return e.Message
+}
+
 func MapErrorToStatusCode(err error) int {
 	switch err.(type) {
 	case *ValidationError:
 		return http.StatusBadRequest
 	case *InternalServerError:
 		return http.StatusInternalServerError
+	case *TimeoutError:
+		return http.StatusGatewayTimeout
+	case *NotFoundError:
+		return http.StatusNotFound
+	case *ConflictError:
+		return http.StatusConflict
+	case *ProviderDeclinedError:
+		return http.StatusPaymentRequired
+	case *ProviderUnavailableError:
+		return http.StatusServiceUnavailable
+	case *UnauthorizedError:
+		return http.StatusUnauthorized
+	case *ForbiddenError:
+		return http.StatusForbidden
+	case *RateLimitedError:
+		return http.StatusTooManyRequests
 	default:
 		return http.StatusInternalServerError
 	}
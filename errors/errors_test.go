@@ -0,0 +1,55 @@
+package errors
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestErrorsMapToTheirStatusAndCode(t *testing.T) {
+	tests := []struct {
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{&ValidationError{Message: "amount is required"}, http.StatusBadRequest, CodeValidationFailed},
+		{&InternalServerError{Message: "database is down"}, http.StatusInternalServerError, CodeInternalError},
+		{&TimeoutError{Message: "stripe timed out", Err: context.DeadlineExceeded}, http.StatusGatewayTimeout, CodeProviderTimeout},
+		{&NotFoundError{Message: "transaction not found"}, http.StatusNotFound, CodeNotFound},
+		{&ConflictError{Message: "transactionId is taken"}, http.StatusConflict, CodeConflict},
+		{&ProviderDeclinedError{Message: "card declined", DeclineCode: "insufficient_funds"}, http.StatusPaymentRequired, CodeProviderDeclined},
+		{&ProviderUnavailableError{Message: "stripe is unavailable"}, http.StatusServiceUnavailable, CodeProviderUnavailable},
+		{&UnauthorizedError{Message: "unknown API key"}, http.StatusUnauthorized, CodeUnauthorized},
+		{&ForbiddenError{Message: "missing scope"}, http.StatusForbidden, CodeForbidden},
+		{&RateLimitedError{Message: "slow down", RetryAfter: time.Second}, http.StatusTooManyRequests, CodeRateLimited},
+		{fmt.Errorf("unexpected"), http.StatusInternalServerError, CodeInternalError},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%T", test.err), func(t *testing.T) {
+			if got := MapErrorToStatusCode(test.err); got != test.wantStatus {
+				t.Errorf("MapErrorToStatusCode = %d, want %d", got, test.wantStatus)
+			}
+			if got := MapErrorToCode(test.err); got != test.wantCode {
+				t.Errorf("MapErrorToCode = %q, want %q", got, test.wantCode)
+			}
+		})
+	}
+}
+
+func TestProblemTypesAreDocumented(t *testing.T) {
+	seen := map[string]bool{}
+	for _, problemType := range ProblemTypes {
+		if seen[problemType.Code] {
+			t.Errorf("%s is listed twice", problemType.Code)
+		}
+		seen[problemType.Code] = true
+		if problemType.Title == "" || problemType.Description == "" || http.StatusText(problemType.Status) == "" {
+			t.Errorf("%s has title %q, status %d and description %q", problemType.Code, problemType.Title, problemType.Status, problemType.Description)
+		}
+		if Title(problemType.Code) != problemType.Title || Description(problemType.Code) != problemType.Description {
+			t.Errorf("Title and Description of %s do not match its problem type", problemType.Code)
+		}
+	}
+}
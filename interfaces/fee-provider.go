@@ -0,0 +1,12 @@
+package interfaces
+
+import (
+	"context"
+	"payment-service/domain/entities"
+)
+
+// IFeeProvider is implemented by providers that can report the processing fee
+// and net settled amount of a succeeded transaction.
+type IFeeProvider interface {
+	ApplyFees(ctx context.Context, transaction entities.Transaction) (entities.Transaction, error)
+}
@@ -0,0 +1,9 @@
+package interfaces
+
+import "context"
+
+// IHealthProvider is implemented by providers that can verify their API is
+// reachable and accepts the configured credentials, without side effects.
+type IHealthProvider interface {
+	CheckConnection(ctx context.Context) error
+}
@@ -0,0 +1,18 @@
+package interfaces
+
+import (
+	"context"
+	"payment-service/domain/entities"
+)
+
+// IStatusProvider is implemented by providers that can look up the current
+// state of a transaction, used to resync and reconcile stored statuses.
+type IStatusProvider interface {
+	FetchStatus(ctx context.Context, transaction entities.Transaction) (entities.Transaction, error)
+}
+
+// IRefundProvider is implemented by providers that can refund a succeeded
+// deposit. amount is in the same units as entities.Transaction.Amount.
+type IRefundProvider interface {
+	Refund(ctx context.Context, transaction entities.Transaction, amount float64) (entities.Transaction, error)
+}
@@ -1,11 +1,12 @@
 package interfaces
 
 import (
+	"context"
 	"payment-service/domain/entities"
 	"payment-service/domain/types"
 )
 
 type IPaymentProvider interface {
-	Charge(params types.DepositParams, transaction entities.Transaction) (entities.Transaction, error)
-	Withdraw(params types.WithdrawParams, transaction entities.Transaction) (entities.Transaction, error)
+	Charge(ctx context.Context, params types.DepositParams, transaction entities.Transaction) (entities.Transaction, error)
+	Withdraw(ctx context.Context, params types.WithdrawParams, transaction entities.Transaction) (entities.Transaction, error)
 }
@@ -1,18 +1,32 @@
 package main
 
 import (
+	"os"
+
 	"payment-service/app"
-	"payment-service/domain/entities"
+	"payment-service/container"
 	"payment-service/routes"
 )
 
 func main() {
-	app := app.App()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
+	application := app.New()
 
-	db, _ := app.GetPgDbConnectionByName("postgres")
-	db.AutoMigrate(&entities.Transaction{})
+	if err := application.CheckMigrations(); err != nil {
+		application.Logger().Fatal(err)
+	}
 
-	defer app.Clean()
-	app.SetRoutes(routes.GetRoutes())
-	app.StartServer()
+	defer application.Clean()
+	c, err := container.New(application)
+	if err != nil {
+		application.Logger().Fatal(err)
+	}
+	application.RegisterWorker("api-nonce-purge", c.ApiKeyService.RunNoncePurge)
+	application.RegisterWorker("rate-limit-cleanup", c.RateLimitService.RunBucketCleanup)
+	application.RegisterWorker("payload-reencryption", c.EncryptionService.RunReencryption)
+	application.SetRoutes(routes.GetRoutes(c))
+	application.StartServer()
 }
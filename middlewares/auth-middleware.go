@@ -0,0 +1,153 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"net/http"
+	"payment-service/app"
+	"payment-service/app/logger"
+	"payment-service/domain/entities"
+	"payment-service/domain/services"
+	"payment-service/domain/types"
+	"payment-service/errors"
+	"strings"
+)
+
+const maxSignedBodyBytes = int64(1 << 20)
+
+type contextKey string
+
+const (
+	apiKeyContextKey   contextKey = "apiKey"
+	merchantContextKey contextKey = "merchant"
+)
+
+// AuthMiddleware authenticates requests with an API key sent as
+// "Authorization: Bearer <key>" or "X-Api-Key: <key>", and verifies the
+// optional HMAC request signature (X-Signature-Timestamp, X-Signature-Nonce,
+// X-Signature). A signature is required when the key was created with
+// RequireSignature or auth.require_signature is set, and is verified whenever
+// one is sent. Keys bound to a merchant resolve it into the request
+// context; keys of disabled merchants are rejected.
+type AuthMiddleware struct {
+	ApiKeyService   *services.ApiKeyService
+	MerchantService *services.MerchantService
+	Config          *viper.Viper
+}
+
+func NewAuthMiddleware(apiKeyService *services.ApiKeyService, merchantService *services.MerchantService, config *viper.Viper) *AuthMiddleware {
+	return &AuthMiddleware{
+		ApiKeyService:   apiKeyService,
+		MerchantService: merchantService,
+		Config:          config,
+	}
+}
+
+func (self *AuthMiddleware) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey, err := self.ApiKeyService.Authenticate(r.Context(), requestApiKey(r))
+			if err != nil {
+				authError(w, r, err)
+				return
+			}
+
+			if err := self.verifySignature(*apiKey, r); err != nil {
+				authError(w, r, err)
+				return
+			}
+
+			if !apiKey.HasScope(scope) {
+				app.WriteError(w, r, &errors.ForbiddenError{Message: "api key is missing the " + scope + " scope"})
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), apiKeyContextKey, apiKey)
+			if apiKey.MerchantID != nil {
+				merchant, err := self.MerchantService.GetActiveMerchant(r.Context(), *apiKey.MerchantID)
+				if err != nil {
+					authError(w, r, err)
+					return
+				}
+				ctx = context.WithValue(ctx, merchantContextKey, merchant)
+				ctx = logger.ContextWith(ctx, logger.FieldMerchantId, merchant.ID)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequirePlatformKey rejects API keys bound to a merchant. It must run after
+// RequireScope.
+func (self *AuthMiddleware) RequirePlatformKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if MerchantFromContext(r.Context()) != nil {
+			app.WriteError(w, r, &errors.ForbiddenError{Message: "merchant api keys cannot access this endpoint"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ApiKeyFromContext returns the API key that authenticated the request, or
+// nil for unauthenticated routes.
+func ApiKeyFromContext(ctx context.Context) *entities.ApiKey {
+	apiKey, _ := ctx.Value(apiKeyContextKey).(*entities.ApiKey)
+	return apiKey
+}
+
+// MerchantFromContext returns the merchant of the API key that authenticated
+// the request, or nil for platform keys and unauthenticated routes.
+func MerchantFromContext(ctx context.Context) *entities.Merchant {
+	merchant, _ := ctx.Value(merchantContextKey).(*entities.Merchant)
+	return merchant
+}
+
+func (self *AuthMiddleware) verifySignature(apiKey entities.ApiKey, r *http.Request) error {
+	signature := types.RequestSignature{
+		Timestamp: r.Header.Get("X-Signature-Timestamp"),
+		Nonce:     r.Header.Get("X-Signature-Nonce"),
+		Signature: r.Header.Get("X-Signature"),
+		Method:    r.Method,
+		Path:      r.URL.RequestURI(),
+	}
+
+	required := apiKey.RequireSignature || self.Config.GetBool("auth.require_signature")
+	if !required && signature.Signature == "" {
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxSignedBodyBytes))
+	if err != nil {
+		return &errors.ValidationError{
+			Message: "failed to read request body",
+		}
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	signature.Body = body
+
+	return self.ApiKeyService.VerifySignature(r.Context(), apiKey, signature)
+}
+
+func requestApiKey(r *http.Request) string {
+	if key := r.Header.Get("X-Api-Key"); key != "" {
+		return key
+	}
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "Bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	return ""
+}
+
+// authError writes a failed authentication as unauthorized, unless the key
+// could not be checked at all.
+func authError(w http.ResponseWriter, r *http.Request, err error) {
+	if _, ok := err.(*errors.InternalServerError); ok {
+		app.WriteError(w, r, err)
+		return
+	}
+	app.WriteError(w, r, &errors.UnauthorizedError{Message: err.Error()})
+}
@@ -0,0 +1,136 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"payment-service/app/clock"
+	"payment-service/app/encryption"
+	"payment-service/domain/entities"
+	"payment-service/domain/repositories"
+	"payment-service/domain/services"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	ctx := context.Background()
+	now := clock.NewFake(time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC))
+	keyring, err := encryption.NewKeyring(map[string][]byte{"2026-01": []byte(strings.Repeat("k", 32))}, "2026-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := viper.New()
+	merchants := repositories.NewMemoryMerchantRepository(keyring, now)
+	active, _ := merchants.SaveMerchant(ctx, entities.Merchant{Name: "active"})
+	disabled, _ := merchants.SaveMerchant(ctx, entities.Merchant{Name: "disabled"})
+	merchantService := services.NewMerchantService(merchants, config, keyring, testLogger, now)
+	apiKeyService := services.NewApiKeyService(repositories.NewMemoryApiKeyRepository(keyring, now), merchantService, config, keyring, testLogger, now)
+	auth := NewAuthMiddleware(apiKeyService, merchantService, config)
+
+	create := func(scopes []string, requireSignature bool, merchantId *uint) (string, string) {
+		t.Helper()
+		created, err := apiKeyService.CreateApiKey(ctx, "test", scopes, requireSignature, merchantId)
+		if err != nil {
+			t.Fatalf("CreateApiKey: %v", err)
+		}
+		return created.Key, created.SigningSecret
+	}
+	depositKey, _ := create([]string{entities.ScopeDeposit}, false, nil)
+	adminKey, _ := create([]string{entities.ScopeAdmin}, false, nil)
+	merchantKey, _ := create([]string{entities.ScopeDeposit}, false, &active.ID)
+	disabledMerchantKey, _ := create([]string{entities.ScopeDeposit}, false, &disabled.ID)
+	signedKey, signingSecret := create([]string{entities.ScopeDeposit}, true, nil)
+	revokedKey, _ := create([]string{entities.ScopeDeposit}, false, nil)
+	revoked, _ := apiKeyService.Authenticate(ctx, revokedKey)
+	if _, err := apiKeyService.RevokeApiKey(ctx, nil, revoked.ID); err != nil {
+		t.Fatalf("RevokeApiKey: %v", err)
+	}
+	disabledAt := now.Now()
+	disabled.DisabledAt = &disabledAt
+	if _, err := merchants.SaveMerchant(ctx, disabled); err != nil {
+		t.Fatalf("disabling merchant: %v", err)
+	}
+
+	// sign adds the signature headers for body, using nonce.
+	sign := func(nonce string) func(r *http.Request) {
+		return func(r *http.Request) {
+			timestamp := strconv.FormatInt(now.Now().Unix(), 10)
+			mac := hmac.New(sha256.New, []byte(signingSecret))
+			mac.Write([]byte(timestamp + "\n" + nonce + "\n" + r.Method + "\n" + r.URL.RequestURI() + "\n" + `{"amount":1000}`))
+			r.Header.Set("X-Signature-Timestamp", timestamp)
+			r.Header.Set("X-Signature-Nonce", nonce)
+			r.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+		}
+	}
+	bearer := func(key string) func(r *http.Request) {
+		return func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+	}
+
+	var seen string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = "platform"
+		if merchant := MerchantFromContext(r.Context()); merchant != nil {
+			seen = fmt.Sprintf("merchant %d", merchant.ID)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	depositRoute := auth.RequireScope(entities.ScopeDeposit)(handler)
+	platformRoute := auth.RequireScope(entities.ScopeDeposit)(auth.RequirePlatformKey(handler))
+
+	tests := []struct {
+		name      string
+		route     http.Handler
+		key       string
+		prepare   func(r *http.Request)
+		want      int
+		reachedAs string
+	}{
+		{"no key", depositRoute, "", nil, http.StatusUnauthorized, ""},
+		{"unknown key", depositRoute, "psk_00000000_" + strings.Repeat("0", 48), nil, http.StatusUnauthorized, ""},
+		{"revoked key", depositRoute, revokedKey, nil, http.StatusUnauthorized, ""},
+		{"key with the scope", depositRoute, depositKey, nil, http.StatusNoContent, "platform"},
+		{"key sent as bearer token", depositRoute, "", bearer(depositKey), http.StatusNoContent, "platform"},
+		{"admin key", depositRoute, adminKey, nil, http.StatusNoContent, "platform"},
+		{"key without the scope", auth.RequireScope(entities.ScopeRefund)(handler), depositKey, nil, http.StatusForbidden, ""},
+		{"merchant key", depositRoute, merchantKey, nil, http.StatusNoContent, fmt.Sprintf("merchant %d", active.ID)},
+		{"key of a disabled merchant", depositRoute, disabledMerchantKey, nil, http.StatusUnauthorized, ""},
+		{"merchant key on a platform route", platformRoute, merchantKey, nil, http.StatusForbidden, ""},
+		{"platform key on a platform route", platformRoute, depositKey, nil, http.StatusNoContent, "platform"},
+		{"unsigned request with a signing key", depositRoute, signedKey, nil, http.StatusUnauthorized, ""},
+		{"signed request", depositRoute, signedKey, sign("n-1"), http.StatusNoContent, "platform"},
+		{"replayed signed request", depositRoute, signedKey, sign("n-1"), http.StatusUnauthorized, ""},
+		{"signed request with a forged signature", depositRoute, signedKey, func(r *http.Request) {
+			sign("n-2")(r)
+			r.Header.Set("X-Signature", strings.Repeat("0", 64))
+		}, http.StatusUnauthorized, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			seen = ""
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/deposit", strings.NewReader(`{"amount":1000}`))
+			if test.key != "" {
+				r.Header.Set("X-Api-Key", test.key)
+			}
+			if test.prepare != nil {
+				test.prepare(r)
+			}
+			w := httptest.NewRecorder()
+			test.route.ServeHTTP(w, r)
+			if w.Code != test.want || seen != test.reachedAs {
+				t.Errorf("answered %d and reached the handler as %q, want %d and %q: %s", w.Code, seen, test.want, test.reachedAs, w.Body.String())
+			}
+		})
+	}
+}
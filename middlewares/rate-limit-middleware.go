@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+	"payment-service/app"
+	"payment-service/domain/services"
+	"payment-service/errors"
+	"strconv"
+)
+
+// RateLimitMiddleware limits requests per client within a route group. Limit
+// counts the authenticated API key, or the remote IP on routes without
+// authentication, so it must run after AuthMiddleware. LimitIp always counts
+// the remote IP and runs in front of AuthMiddleware, so requests with a
+// missing or wrong key are limited before they reach the key lookup.
+type RateLimitMiddleware struct {
+	RateLimitService *services.RateLimitService
+}
+
+func NewRateLimitMiddleware(rateLimitService *services.RateLimitService) *RateLimitMiddleware {
+	return &RateLimitMiddleware{
+		RateLimitService: rateLimitService,
+	}
+}
+
+func (self *RateLimitMiddleware) Limit(group string) func(http.Handler) http.Handler {
+	return self.limit(group, rateLimitClient)
+}
+
+func (self *RateLimitMiddleware) LimitIp(group string) func(http.Handler) http.Handler {
+	return self.limit(group, remoteIp)
+}
+
+func (self *RateLimitMiddleware) limit(group string, client func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !self.RateLimitService.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			result := self.RateLimitService.Allow(r.Context(), group, client(r))
+
+			w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(result.ResetAfter.Seconds())))
+
+			if !result.Allowed {
+				app.WriteError(w, r, &errors.RateLimitedError{
+					Message:    "Rate limit exceeded",
+					RetryAfter: result.RetryAfter,
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func rateLimitClient(r *http.Request) string {
+	if apiKey := ApiKeyFromContext(r.Context()); apiKey != nil {
+		return "key:" + apiKey.Prefix
+	}
+	return remoteIp(r)
+}
+
+func remoteIp(r *http.Request) string {
+	// app.RealIp has already replaced RemoteAddr with the client IP when the
+	// request came through a trusted proxy, and left the socket address
+	// otherwise.
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,115 @@
+package middlewares
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/spf13/viper"
+
+	"payment-service/app"
+	"payment-service/app/clock"
+	"payment-service/app/logger"
+	"payment-service/domain/services"
+)
+
+var testLogger = logger.NewLogger(&logger.Debug{Enabled: true, Level: "error", Format: logger.LogFormatConsole})
+
+func TestLimitIpIgnoresSpoofedForwardedHeaders(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies string
+		remoteAddr     string
+		forwardedFor   func(i int) string
+	}{
+		{
+			name:         "no trusted proxies",
+			remoteAddr:   "203.0.113.7:40000",
+			forwardedFor: func(i int) string { return fmt.Sprintf("198.51.100.%d", i) },
+		},
+		{
+			name:           "spoofed hops in front of a trusted proxy",
+			trustedProxies: "10.0.0.0/8",
+			remoteAddr:     "10.0.0.2:40000",
+			forwardedFor:   func(i int) string { return fmt.Sprintf("198.51.100.%d, 203.0.113.7", i) },
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := viper.New()
+			config.Set("ratelimit.clients.per_minute", 1)
+			config.Set("ratelimit.clients.burst", 2)
+			now := clock.NewFake(time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC))
+			limiter := NewRateLimitMiddleware(services.NewRateLimitService(nil, config, testLogger, now))
+			trustedProxies, err := app.ParseTrustedProxies(test.trustedProxies)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			router := chi.NewRouter()
+			router.Use(app.RealIp(trustedProxies))
+			router.Use(limiter.LimitIp("clients"))
+			router.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+
+			for i := 1; i <= 3; i++ {
+				request := httptest.NewRequest(http.MethodGet, "/", nil)
+				request.RemoteAddr = test.remoteAddr
+				request.Header.Set("X-Forwarded-For", test.forwardedFor(i))
+				request.Header.Set("X-Real-IP", test.forwardedFor(i))
+				recorder := httptest.NewRecorder()
+				router.ServeHTTP(recorder, request)
+
+				want := http.StatusOK
+				if i == 3 {
+					want = http.StatusTooManyRequests
+				}
+				if recorder.Code != want {
+					t.Errorf("request %d answered %d, want %d", i, recorder.Code, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRealIpTakesClientFromTrustedProxies(t *testing.T) {
+	trustedProxies, err := app.ParseTrustedProxies("10.0.0.0/8, 192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		realIp       string
+		want         string
+	}{
+		{"untrusted peer keeps its address", "203.0.113.7:1", "198.51.100.1", "", "203.0.113.7:1"},
+		{"trusted peer forwards the client", "192.0.2.1:1", "198.51.100.1", "", "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.2:1", "198.51.100.1, 10.0.0.9", "", "198.51.100.1"},
+		{"x-real-ip from a trusted peer", "10.0.0.2:1", "", "198.51.100.1", "198.51.100.1"},
+		{"malformed hop keeps the peer", "10.0.0.2:1", "not-an-ip", "", "10.0.0.2:1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var remoteAddr string
+			handler := app.RealIp(trustedProxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				remoteAddr = r.RemoteAddr
+			}))
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = test.remoteAddr
+			if test.forwardedFor != "" {
+				request.Header.Set("X-Forwarded-For", test.forwardedFor)
+			}
+			if test.realIp != "" {
+				request.Header.Set("X-Real-IP", test.realIp)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+			if remoteAddr != test.want {
+				t.Errorf("RemoteAddr %q, want %q", remoteAddr, test.want)
+			}
+		})
+	}
+}
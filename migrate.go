@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"payment-service/app"
+	"payment-service/app/migrator"
+)
+
+const migrateUsage = `usage: payment-service migrate <command>
+
+commands:
+  up [-steps N]     apply pending migrations (all by default)
+  down [-steps N]   roll back applied migrations (one by default)
+  status            list migrations and whether they are applied
+  create <name>     create an empty up/down migration pair`
+
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	command := args[0]
+	flags := flag.NewFlagSet("migrate "+command, flag.ContinueOnError)
+	steps := flags.Int("steps", 0, "number of migrations to apply or roll back")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	application := app.New()
+	if command == "create" {
+		if flags.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		upPath, downPath, err := migrator.Create(application.MigrationsDir(), flags.Arg(0))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(upPath)
+		fmt.Println(downPath)
+		return 0
+	}
+
+	m, err := application.Migrator()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer application.Clean()
+
+	var done []migrator.Migration
+	switch command {
+	case "up":
+		done, err = m.Up(*steps)
+	case "down":
+		done, err = m.Down(*steps)
+	case "status":
+		statuses, err := m.Status()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		out, _ := json.MarshalIndent(statuses, "", "  ")
+		fmt.Println(string(out))
+		return 0
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	for _, migration := range done {
+		fmt.Printf("%s %06d_%s\n", command, migration.Version, migration.Name)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
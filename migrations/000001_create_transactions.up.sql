@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS transactions (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_type VARCHAR(10) NOT NULL,
+    amount DECIMAL(15,2) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    transaction_id VARCHAR(255) UNIQUE,
+    charge_id VARCHAR(255),
+    payment_id VARCHAR(255),
+    gateway_name VARCHAR(255),
+    request_payload TEXT,
+    response_payload TEXT,
+    callback_payload TEXT,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    CONSTRAINT chk_transactions_transaction_type CHECK (transaction_type IN ('deposit', 'withdrawal'))
+);
@@ -0,0 +1,4 @@
+ALTER TABLE transactions
+    DROP COLUMN IF EXISTS fee_amount,
+    DROP COLUMN IF EXISTS net_amount,
+    DROP COLUMN IF EXISTS settlement_currency;
@@ -0,0 +1,4 @@
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS fee_amount DECIMAL(15,2),
+    ADD COLUMN IF NOT EXISTS net_amount DECIMAL(15,2),
+    ADD COLUMN IF NOT EXISTS settlement_currency VARCHAR(3);
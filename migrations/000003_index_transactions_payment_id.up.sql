@@ -0,0 +1,4 @@
+-- Webhooks look transactions up by the provider payment id.
+CREATE INDEX IF NOT EXISTS idx_transactions_payment_id
+    ON transactions (payment_id)
+    WHERE payment_id IS NOT NULL AND payment_id <> '';
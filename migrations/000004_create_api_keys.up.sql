@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL,
+    scopes VARCHAR(255) NOT NULL,
+    signing_secret VARCHAR(128),
+    require_signature BOOLEAN NOT NULL DEFAULT false,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_prefix ON api_keys (prefix);
+
+CREATE TABLE IF NOT EXISTS api_request_nonces (
+    api_key_id BIGINT NOT NULL REFERENCES api_keys (id) ON DELETE CASCADE,
+    nonce VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ,
+    PRIMARY KEY (api_key_id, nonce)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_request_nonces_created_at ON api_request_nonces (created_at);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_transactions_encryption_key_id;
+
+ALTER TABLE transactions
+    DROP COLUMN IF EXISTS encrypted_data_key,
+    DROP COLUMN IF EXISTS encryption_key_id;
@@ -0,0 +1,6 @@
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS encrypted_data_key TEXT,
+    ADD COLUMN IF NOT EXISTS encryption_key_id VARCHAR(64);
+
+-- The re-encryption job scans for rows not yet under the active master key.
+CREATE INDEX IF NOT EXISTS idx_transactions_encryption_key_id ON transactions (encryption_key_id);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_transactions_merchant_id;
+ALTER TABLE transactions DROP COLUMN IF EXISTS merchant_id;
+
+DROP INDEX IF EXISTS idx_api_keys_merchant_id;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS merchant_id;
+
+DROP TABLE IF EXISTS merchants;
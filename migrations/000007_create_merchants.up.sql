@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS merchants (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    credentials TEXT,
+    encrypted_data_key TEXT,
+    encryption_key_id VARCHAR(64),
+    authorize_fee_percent DECIMAL(7,4),
+    authorize_fee_fixed DECIMAL(15,2),
+    authorize_settlement_currency VARCHAR(3),
+    disabled_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_merchants_name ON merchants (name);
+
+-- Rows without a merchant belong to the platform and use the global
+-- provider configuration.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS merchant_id BIGINT REFERENCES merchants (id);
+CREATE INDEX IF NOT EXISTS idx_api_keys_merchant_id ON api_keys (merchant_id);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS merchant_id BIGINT REFERENCES merchants (id);
+CREATE INDEX IF NOT EXISTS idx_transactions_merchant_id ON transactions (merchant_id);
@@ -0,0 +1,4 @@
+-- W3C traceparent of the request that created the transaction, so webhook
+-- spans can link back to it.
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS trace_parent VARCHAR(55);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS webhook_statuses (
+    provider VARCHAR(32) PRIMARY KEY,
+    last_event_type VARCHAR(255) NOT NULL,
+    last_succeeded_at TIMESTAMPTZ NOT NULL
+);
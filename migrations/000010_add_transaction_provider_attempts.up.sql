@@ -0,0 +1,5 @@
+-- HTTP attempts the provider call that created the transaction took,
+-- including retries. Zero for transactions created before retries were
+-- counted.
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS provider_attempts INTEGER NOT NULL DEFAULT 0;
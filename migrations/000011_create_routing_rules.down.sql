@@ -0,0 +1,4 @@
+ALTER TABLE transactions
+    DROP COLUMN IF EXISTS routing_decision;
+
+DROP TABLE IF EXISTS routing_rules;
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS routing_rules (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    priority INTEGER NOT NULL DEFAULT 100,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    merchant_id BIGINT REFERENCES merchants (id),
+    operation VARCHAR(10),
+    currencies VARCHAR(255),
+    min_amount DECIMAL(15,2),
+    max_amount DECIMAL(15,2),
+    card_brands VARCHAR(255),
+    bin_countries VARCHAR(255),
+    time_from VARCHAR(5),
+    time_until VARCHAR(5),
+    time_zone VARCHAR(64),
+    min_approval_rate DECIMAL(5,4),
+    strategy VARCHAR(20) NOT NULL,
+    targets VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_routing_rules_merchant_id ON routing_rules (merchant_id);
+
+-- JSON encoded types.RoutingDecision: how the provider of the transaction
+-- was chosen.
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS routing_decision TEXT;
@@ -0,0 +1,4 @@
+ALTER TABLE transactions
+    DROP COLUMN IF EXISTS provider_decline_code,
+    DROP COLUMN IF EXISTS decline_retryable,
+    DROP COLUMN IF EXISTS decline_code;
@@ -0,0 +1,6 @@
+-- Normalized decline of a failed transaction (see package declines), whether
+-- the same payment may succeed later, and the provider's own code.
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS decline_code VARCHAR(40),
+    ADD COLUMN IF NOT EXISTS decline_retryable BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS provider_decline_code VARCHAR(64);
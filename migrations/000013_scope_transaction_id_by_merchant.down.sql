@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_transactions_merchant_transaction_id;
+ALTER TABLE transactions ADD CONSTRAINT transactions_transaction_id_key UNIQUE (transaction_id);
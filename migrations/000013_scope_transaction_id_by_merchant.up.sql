@@ -0,0 +1,7 @@
+-- Client transaction ids are unique per merchant, not globally, so one
+-- merchant can neither collide with nor probe another merchant's ids.
+-- Platform transactions (no merchant) share merchant id 0, which BIGSERIAL
+-- never assigns, so they stay unique among themselves.
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_transaction_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_merchant_transaction_id
+    ON transactions (COALESCE(merchant_id, 0), transaction_id);
@@ -0,0 +1,12 @@
+-- Fees and net amounts are stored in major units for every provider. Stripe
+-- ones used to be stored in Stripe's minor units; zero-decimal currencies
+-- have no minor unit and are left alone.
+UPDATE transactions
+SET fee_amount = fee_amount / 100,
+    net_amount = net_amount / 100
+WHERE gateway_name = 'stripe'
+  AND fee_amount IS NOT NULL
+  AND UPPER(COALESCE(NULLIF(settlement_currency, ''), currency)) NOT IN (
+    'BIF', 'CLP', 'DJF', 'GNF', 'JPY', 'KMF', 'KRW', 'MGA',
+    'PYG', 'RWF', 'UGX', 'VND', 'VUV', 'XAF', 'XOF', 'XPF'
+  );
@@ -0,0 +1,5 @@
+-- Encrypted secrets are longer than 128 characters and useless without
+-- their data key, so this fails while any signing secret is encrypted.
+ALTER TABLE api_keys ALTER COLUMN signing_secret TYPE VARCHAR(128);
+ALTER TABLE api_keys DROP COLUMN IF EXISTS encryption_key_id;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS encrypted_data_key;
@@ -0,0 +1,6 @@
+-- Signing secrets are encrypted with a per-key data key, like merchant
+-- credentials. Existing plaintext secrets are encrypted by the
+-- re-encryption worker or `paymentctl encryption rotate`.
+ALTER TABLE api_keys ALTER COLUMN signing_secret TYPE TEXT;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS encrypted_data_key TEXT;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS encryption_key_id VARCHAR(64);
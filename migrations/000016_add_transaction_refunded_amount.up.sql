@@ -0,0 +1,6 @@
+-- How much of a deposit has been refunded, in the units of amount, so a
+-- partially refunded deposit can be refunded again up to its amount. Fully
+-- refunded rows are backfilled; partial refunds made before this are not
+-- known, and the provider rejects refunds beyond what is left.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS refunded_amount DECIMAL(15,2) NOT NULL DEFAULT 0;
+UPDATE transactions SET refunded_amount = amount WHERE status = 'refunded';
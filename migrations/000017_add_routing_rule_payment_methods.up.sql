@@ -0,0 +1,3 @@
+-- Payment methods a routing rule applies to, such as "card" or "token", so
+-- a rule can split a method between the providers that all accept it.
+ALTER TABLE routing_rules ADD COLUMN IF NOT EXISTS payment_methods VARCHAR(255);
@@ -0,0 +1,8 @@
+package requests
+
+type CreateApiKeyRequest struct {
+	Name             string   `json:"name" validate:"required"`
+	Scopes           []string `json:"scopes" validate:"required,min=1,dive,oneof=deposit withdraw refund read admin"`
+	RequireSignature bool     `json:"requireSignature"`
+	MerchantId       *uint    `json:"merchantId"`
+}
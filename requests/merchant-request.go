@@ -0,0 +1,12 @@
+package requests
+
+import "payment-service/domain/types"
+
+// MerchantRequest creates a merchant or updates the fields it sets.
+type MerchantRequest struct {
+	Name                        string                     `json:"name" validate:"max=255"`
+	Credentials                 *types.MerchantCredentials `json:"credentials"`
+	AuthorizeFeePercent         *float64                   `json:"authorizeFeePercent" validate:"omitempty,gte=0,lt=100"`
+	AuthorizeFeeFixed           *float64                   `json:"authorizeFeeFixed" validate:"omitempty,gte=0"`
+	AuthorizeSettlementCurrency *string                    `json:"authorizeSettlementCurrency" validate:"omitempty,len=3"`
+}
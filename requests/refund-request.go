@@ -0,0 +1,6 @@
+package requests
+
+type RefundRequest struct {
+	Amount float64 `json:"amount" validate:"omitempty,gt=0"`
+	DryRun bool    `json:"dryRun"`
+}
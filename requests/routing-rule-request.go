@@ -0,0 +1,27 @@
+package requests
+
+import "payment-service/domain/entities"
+
+// RoutingRuleRequest creates or replaces a routing rule. Enabled defaults to
+// true and Priority to 100. MinAmount (inclusive) and MaxAmount (exclusive)
+// are in major units of the request currency, such as 10.50 USD, for every
+// payment method.
+type RoutingRuleRequest struct {
+	Name            string                   `json:"name" validate:"required,max=255"`
+	Priority        *int                     `json:"priority"`
+	Enabled         *bool                    `json:"enabled"`
+	MerchantId      *uint                    `json:"merchantId"`
+	Operation       string                   `json:"operation" validate:"omitempty,oneof=deposit withdraw"`
+	Currencies      []string                 `json:"currencies" validate:"dive,len=3"`
+	MinAmount       *float64                 `json:"minAmount" validate:"omitempty,gte=0"`
+	MaxAmount       *float64                 `json:"maxAmount" validate:"omitempty,gt=0"`
+	PaymentMethods  []string                 `json:"paymentMethods" validate:"dive,oneof=card token destination"`
+	CardBrands      []string                 `json:"cardBrands" validate:"dive,oneof=visa mastercard amex discover diners jcb unionpay maestro"`
+	BinCountries    []string                 `json:"binCountries" validate:"dive,len=2"`
+	TimeFrom        string                   `json:"timeFrom"`
+	TimeUntil       string                   `json:"timeUntil"`
+	TimeZone        string                   `json:"timeZone"`
+	MinApprovalRate *float64                 `json:"minApprovalRate" validate:"omitempty,gte=0,lte=1"`
+	Strategy        string                   `json:"strategy" validate:"omitempty,oneof=weighted approval_rate"`
+	Targets         []entities.RoutingTarget `json:"targets" validate:"required,min=1"`
+}
@@ -0,0 +1,88 @@
+package requests
+
+import (
+	"github.com/go-playground/validator/v10"
+	"payment-service/app/clock"
+	"payment-service/domain/cards"
+)
+
+// Card field rules, reported as the tag of the failing CustomFieldError.
+const (
+	tagCardNumber           = "card_number"
+	tagCardExpiry           = "card_expiry"
+	tagCardCvv              = "card_cvv"
+	tagRequiredForProvider  = "required_for_provider"
+	tagForbiddenForProvider = "forbidden_for_provider"
+)
+
+// NewValidator returns a validator with the card rules registered:
+//
+//   - card_number: a Luhn-valid number of a length allowed for its brand
+//   - card_expiry: an MMYY or YYYY-MM date that has not passed by the time
+//     of clock
+//   - card_cvv: three or four digits
+//
+// Deposit and withdraw requests are also checked against their provider:
+// authorize needs the card fields, and stripe takes a token or destination
+// instead, so raw card fields are rejected. Without a provider, card fields
+// are all-or-nothing. The CVV length is checked against the detected card
+// brand. The validator is safe for concurrent use, so one is shared by all
+// controllers.
+func NewValidator(clock clock.Clock) *validator.Validate {
+	validate := validator.New()
+	_ = validate.RegisterValidation(tagCardNumber, func(fl validator.FieldLevel) bool {
+		return cards.IsValidNumber(fl.Field().String())
+	})
+	_ = validate.RegisterValidation(tagCardExpiry, func(fl validator.FieldLevel) bool {
+		month, year, ok := cards.ParseExpiry(fl.Field().String())
+		return ok && !cards.IsExpired(month, year, clock.Now())
+	})
+	_ = validate.RegisterValidation(tagCardCvv, func(fl validator.FieldLevel) bool {
+		return cards.IsValidCvv(fl.Field().String(), cards.BrandUnknown)
+	})
+	validate.RegisterStructValidation(func(sl validator.StructLevel) {
+		request := sl.Current().Interface().(DepositRequest)
+		validateCardForProvider(sl, request.Provider, request.CreditCardNumber, request.ExpirationDate, request.CVV)
+		if request.Provider == "stripe" && request.Token == "" {
+			sl.ReportError(request.Token, "Token", "token", tagRequiredForProvider, request.Provider)
+		}
+	}, DepositRequest{})
+	validate.RegisterStructValidation(func(sl validator.StructLevel) {
+		request := sl.Current().Interface().(WithdrawRequest)
+		validateCardForProvider(sl, request.Provider, request.CreditCardNumber, request.ExpirationDate, request.CVV)
+		if request.Provider == "stripe" && request.Destination == "" {
+			sl.ReportError(request.Destination, "Destination", "destination", tagRequiredForProvider, request.Provider)
+		}
+	}, WithdrawRequest{})
+	return validate
+}
+
+func validateCardForProvider(sl validator.StructLevel, provider string, number string, expiry string, cvv string) {
+	fields := []struct {
+		value     string
+		name      string
+		fieldName string
+	}{
+		{number, "CreditCardNumber", "creditCardNumber"},
+		{expiry, "ExpirationDate", "expirationDate"},
+		{cvv, "CVV", "cvv"},
+	}
+
+	// A request without a provider may be routed to authorize, so card
+	// fields it carries are checked the same way.
+	cardRequired := provider == "authorize" || (provider == "" && (number != "" || expiry != "" || cvv != ""))
+	for _, field := range fields {
+		switch {
+		case cardRequired && field.value == "":
+			sl.ReportError(field.value, field.name, field.fieldName, tagRequiredForProvider, provider)
+		case provider == "stripe" && field.value != "":
+			sl.ReportError(field.value, field.name, field.fieldName, tagForbiddenForProvider, provider)
+		}
+	}
+
+	// card_cvv only checks the digits; the length depends on the brand.
+	brand := cards.DetectBrand(number)
+	if cardRequired && cards.IsValidNumber(number) && cards.IsValidCvv(cvv, cards.BrandUnknown) && !cards.IsValidCvv(cvv, brand) {
+		sl.ReportError(cvv, "CVV", "cvv", tagCardCvv, string(brand))
+	}
+}
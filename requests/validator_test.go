@@ -0,0 +1,120 @@
+package requests
+
+import (
+	stderrors "errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"payment-service/app/clock"
+)
+
+// fieldTags returns the failing tag of every field of err.
+func fieldTags(t *testing.T, err error) map[string]string {
+	t.Helper()
+	tags := map[string]string{}
+	if err == nil {
+		return tags
+	}
+	var validationErrors validator.ValidationErrors
+	if !stderrors.As(err, &validationErrors) {
+		t.Fatalf("validation returned %v, want ValidationErrors", err)
+	}
+	for _, fieldErr := range validationErrors {
+		tags[fieldErr.Field()] = fieldErr.Tag()
+	}
+	return tags
+}
+
+func authorizeDeposit(number string, expiry string, cvv string) DepositRequest {
+	return DepositRequest{
+		Amount:           10,
+		UserId:           "user-1",
+		Currency:         "USD",
+		TransactionId:    "tx-1",
+		Provider:         "authorize",
+		CreditCardNumber: number,
+		ExpirationDate:   expiry,
+		CVV:              cvv,
+	}
+}
+
+func TestValidatorCardExpiry(t *testing.T) {
+	endOfYear := time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC)
+	tests := []struct {
+		name   string
+		now    time.Time
+		expiry string
+		want   map[string]string
+	}{
+		{"expiring this month", endOfYear, "1225", map[string]string{}},
+		{"expiring this month as YYYY-MM", endOfYear, "2025-12", map[string]string{}},
+		{"expired last month", endOfYear, "1125", map[string]string{"ExpirationDate": tagCardExpiry}},
+		{"expired at the turn of the year", endOfYear.Add(time.Second), "1225", map[string]string{"ExpirationDate": tagCardExpiry}},
+		{"expiring next year", endOfYear.Add(time.Second), "0126", map[string]string{}},
+		{"invalid month", endOfYear, "1326", map[string]string{"ExpirationDate": tagCardExpiry}},
+		{"unsupported format", endOfYear, "12/26", map[string]string{"ExpirationDate": tagCardExpiry}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validate := NewValidator(clock.NewFake(test.now))
+			tags := fieldTags(t, validate.Struct(authorizeDeposit("4111111111111111", test.expiry, "123")))
+			if !reflect.DeepEqual(tags, test.want) {
+				t.Errorf("failing fields %v, want %v", tags, test.want)
+			}
+		})
+	}
+}
+
+func TestValidatorCardForProvider(t *testing.T) {
+	validate := NewValidator(clock.NewFake(time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)))
+	stripeDeposit := authorizeDeposit("", "", "")
+	stripeDeposit.Provider = "stripe"
+	stripeDeposit.Token = "pm_card_visa"
+	stripeWithCard := authorizeDeposit("4111111111111111", "1230", "123")
+	stripeWithCard.Provider = "stripe"
+	stripeWithCard.Token = "pm_card_visa"
+	stripeWithoutToken := stripeDeposit
+	stripeWithoutToken.Token = ""
+	unrouted := authorizeDeposit("4111111111111111", "", "")
+	unrouted.Provider = ""
+	unroutedToken := stripeDeposit
+	unroutedToken.Provider = ""
+
+	tests := []struct {
+		name    string
+		request interface{}
+		want    map[string]string
+	}{
+		{"authorize with a card", authorizeDeposit("4111111111111111", "1230", "123"), map[string]string{}},
+		{"authorize without a cvv", authorizeDeposit("4111111111111111", "1230", ""), map[string]string{"CVV": tagRequiredForProvider}},
+		{"authorize with a bad number", authorizeDeposit("4111111111111112", "1230", "123"), map[string]string{"CreditCardNumber": tagCardNumber}},
+		{"amex with a three digit cvv", authorizeDeposit("378282246310005", "1230", "123"), map[string]string{"CVV": tagCardCvv}},
+		{"amex with a four digit cvv", authorizeDeposit("378282246310005", "1230", "1234"), map[string]string{}},
+		{"visa with a four digit cvv", authorizeDeposit("4111111111111111", "1230", "1234"), map[string]string{"CVV": tagCardCvv}},
+		{"stripe with a token", stripeDeposit, map[string]string{}},
+		{"stripe with card fields", stripeWithCard, map[string]string{
+			"CreditCardNumber": tagForbiddenForProvider,
+			"ExpirationDate":   tagForbiddenForProvider,
+			"CVV":              tagForbiddenForProvider,
+		}},
+		{"stripe without a token", stripeWithoutToken, map[string]string{"Token": tagRequiredForProvider}},
+		{"no provider with part of a card", unrouted, map[string]string{
+			"ExpirationDate": tagRequiredForProvider,
+			"CVV":            tagRequiredForProvider,
+		}},
+		{"no provider with a token", unroutedToken, map[string]string{}},
+		{"stripe withdrawal without a destination", WithdrawRequest{
+			Amount: 5, UserId: "user-1", Currency: "usd", TransactionId: "tx-2", Provider: "stripe",
+		}, map[string]string{"Destination": tagRequiredForProvider}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tags := fieldTags(t, validate.Struct(test.request))
+			if !reflect.DeepEqual(tags, test.want) {
+				t.Errorf("failing fields %v, want %v", tags, test.want)
+			}
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package requests
 
+import "encoding/json"
+
 type WebhookEvent struct {
 	EventType  string  `json:"eventType"`
 	EventID    string  `json:"eventId"`
@@ -8,11 +10,14 @@ type WebhookEvent struct {
 	Payload    Payload `json:"payload"`
 }
 
+// Payload is the transaction an Authorize.Net notification is about. Its
+// responseCode is sent as a number.
 type Payload struct {
-	ID            string `json:"id"`
-	ResponseCode  string `json:"responseCode"`
-	AuthCode      string `json:"authCode"`
-	TransactionID string `json:"transId"`
-	AccountNumber string `json:"accountNumber"`
-	AccountType   string `json:"accountType"`
+	ID            string      `json:"id"`
+	ResponseCode  json.Number `json:"responseCode"`
+	AuthCode      string      `json:"authCode"`
+	AuthAmount    float64     `json:"authAmount"`
+	TransactionID string      `json:"transId"`
+	AccountNumber string      `json:"accountNumber"`
+	AccountType   string      `json:"accountType"`
 }
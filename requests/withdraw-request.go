@@ -6,8 +6,8 @@ type WithdrawRequest struct {
 	Destination      string `json:"destination"`
 	Currency         string `json:"currency" validate:"required,len=3"`
 	TransactionId    string `json:"transactionId" validate:"required"`
-	Provider         string `json:"provider" validate:"required,oneof=stripe authorize"`
-	CreditCardNumber string `json:"creditCardNumber"`
-	ExpirationDate   string `json:"expirationDate"`
-	CVV              string `json:"cvv"`
+	Provider         string `json:"provider" validate:"omitempty,oneof=stripe authorize"`
+	CreditCardNumber string `json:"creditCardNumber" validate:"omitempty,card_number"`
+	ExpirationDate   string `json:"expirationDate" validate:"omitempty,card_expiry"`
+	CVV              string `json:"cvv" validate:"omitempty,card_cvv"`
 }
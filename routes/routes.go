@@ -1,28 +1,106 @@
 package routes
 
 import (
+	"github.com/go-chi/chi"
 	httpSwagger "github.com/swaggo/http-swagger"
 	"net/http"
 	"payment-service/app"
-	"payment-service/controllers"
+	"payment-service/app/metrics"
+	"payment-service/container"
+	"payment-service/domain/entities"
+	"payment-service/errors"
 )
 
-func GetRoutes() []app.Route {
+// GetRoutes returns every route, served by the controllers and middlewares
+// of c.
+func GetRoutes(c *container.Container) []app.Route {
 	var appRoutes []app.Route
-	appRoutes = append(appRoutes, PaymentRoutes...)
+	appRoutes = append(appRoutes, PaymentRoutes(c)...)
+	appRoutes = append(appRoutes, ApiKeyRoutes(c)...)
+	appRoutes = append(appRoutes, MerchantRoutes(c)...)
+	appRoutes = append(appRoutes, RoutingRuleRoutes(c)...)
+	appRoutes = append(appRoutes, SystemRoutes(c)...)
 	return appRoutes
 }
 
-var paymentController = *controllers.NewPaymentController()
-var PaymentRoutes = []app.Route{
-	{"Post", "/api/v1/deposit", nil, paymentController.Deposit},
-	{"Post", "/api/v1/withdraw", nil, paymentController.Withdraw},
-	{"Post", "/api/v1/stripe-webhook", nil, paymentController.StripeWebhook},
-	{"Post", "/api/v1/authorize-webhook", nil, paymentController.StripeWebhook},
-	{"GET", "/swagger.json", nil, func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "./swagger.json")
-	}},
-	{"GET", "/swagger/*", nil, httpSwagger.Handler(
-		httpSwagger.URL("http://localhost:8080/swagger.json"),
-	)},
+// protected requires an API key with scope and applies the rate limit of
+// the route group to it. The "clients" limit per remote IP runs before the
+// key is looked up, so unauthenticated floods and key guessing are limited
+// too.
+func protected(c *container.Container, scope string, group string) *chi.Middlewares {
+	return &chi.Middlewares{c.RateLimitMiddleware.LimitIp("clients"), c.AuthMiddleware.RequireScope(scope), c.RateLimitMiddleware.Limit(group)}
+}
+
+// platform is protected for endpoints that merchant API keys may not use.
+func platform(c *container.Container, scope string, group string) *chi.Middlewares {
+	return &chi.Middlewares{c.RateLimitMiddleware.LimitIp("clients"), c.AuthMiddleware.RequireScope(scope), c.AuthMiddleware.RequirePlatformKey, c.RateLimitMiddleware.Limit(group)}
+}
+
+func limited(c *container.Container, group string) *chi.Middlewares {
+	return &chi.Middlewares{c.RateLimitMiddleware.Limit(group)}
+}
+
+func PaymentRoutes(c *container.Container) []app.Route {
+	paymentController := c.PaymentController
+	return []app.Route{
+		{Method: "Post", Pattern: "/api/v1/deposit", Middlewares: protected(c, entities.ScopeDeposit, "payments"), HandlerFunc: paymentController.Deposit},
+		{Method: "Post", Pattern: "/api/v1/withdraw", Middlewares: protected(c, entities.ScopeWithdraw, "payments"), HandlerFunc: paymentController.Withdraw},
+		{Method: "GET", Pattern: "/api/v1/transactions/{transactionId}", Middlewares: protected(c, entities.ScopeRead, "read"), HandlerFunc: paymentController.GetTransaction},
+		{Method: "Post", Pattern: "/api/v1/transactions/{transactionId}/refund", Middlewares: protected(c, entities.ScopeRefund, "payments"), HandlerFunc: paymentController.Refund},
+		{Method: "Post", Pattern: "/api/v1/stripe-webhook", Middlewares: limited(c, "webhooks"), HandlerFunc: paymentController.StripeWebhook},
+		{Method: "Post", Pattern: "/api/v1/authorize-webhook", Middlewares: limited(c, "webhooks"), HandlerFunc: paymentController.AuthorizeWebhook},
+		{Method: "Post", Pattern: "/api/v1/merchants/{merchantId}/stripe-webhook", Middlewares: limited(c, "webhooks"), HandlerFunc: paymentController.StripeWebhook},
+		{Method: "Post", Pattern: "/api/v1/merchants/{merchantId}/authorize-webhook", Middlewares: limited(c, "webhooks"), HandlerFunc: paymentController.AuthorizeWebhook},
+		{Method: "GET", Pattern: "/swagger.json", HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, "./swagger.json")
+		}},
+		{Method: "GET", Pattern: "/swagger/*", HandlerFunc: httpSwagger.Handler(
+			httpSwagger.URL("http://localhost:8080/swagger.json"),
+		)},
+		{Method: "GET", Pattern: "/docs/errors", HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			app.Json(w, errors.ProblemTypes, http.StatusOK)
+		}},
+	}
+}
+
+func ApiKeyRoutes(c *container.Container) []app.Route {
+	apiKeyController := c.ApiKeyController
+	return []app.Route{
+		{Method: "Post", Pattern: "/api/v1/api-keys", Middlewares: protected(c, entities.ScopeAdmin, "admin"), HandlerFunc: apiKeyController.CreateApiKey},
+		{Method: "GET", Pattern: "/api/v1/api-keys", Middlewares: protected(c, entities.ScopeAdmin, "admin"), HandlerFunc: apiKeyController.ListApiKeys},
+		{Method: "DELETE", Pattern: "/api/v1/api-keys/{id}", Middlewares: protected(c, entities.ScopeAdmin, "admin"), HandlerFunc: apiKeyController.RevokeApiKey},
+	}
+}
+
+func MerchantRoutes(c *container.Container) []app.Route {
+	merchantController := c.MerchantController
+	return []app.Route{
+		{Method: "Post", Pattern: "/api/v1/merchants", Middlewares: platform(c, entities.ScopeAdmin, "admin"), HandlerFunc: merchantController.CreateMerchant},
+		{Method: "GET", Pattern: "/api/v1/merchants", Middlewares: platform(c, entities.ScopeAdmin, "admin"), HandlerFunc: merchantController.ListMerchants},
+		{Method: "GET", Pattern: "/api/v1/merchants/{merchantId}", Middlewares: platform(c, entities.ScopeAdmin, "admin"), HandlerFunc: merchantController.GetMerchant},
+		{Method: "PATCH", Pattern: "/api/v1/merchants/{merchantId}", Middlewares: platform(c, entities.ScopeAdmin, "admin"), HandlerFunc: merchantController.UpdateMerchant},
+		{Method: "DELETE", Pattern: "/api/v1/merchants/{merchantId}", Middlewares: platform(c, entities.ScopeAdmin, "admin"), HandlerFunc: merchantController.DisableMerchant},
+		{Method: "Post", Pattern: "/api/v1/merchants/{merchantId}/enable", Middlewares: platform(c, entities.ScopeAdmin, "admin"), HandlerFunc: merchantController.EnableMerchant},
+	}
+}
+
+func RoutingRuleRoutes(c *container.Container) []app.Route {
+	routingRuleController := c.RoutingRuleController
+	return []app.Route{
+		{Method: "GET", Pattern: "/api/v1/routing-rules", Middlewares: platform(c, entities.ScopeAdmin, "admin"), HandlerFunc: routingRuleController.ListRoutingRules},
+		{Method: "Post", Pattern: "/api/v1/routing-rules", Middlewares: platform(c, entities.ScopeAdmin, "admin"), HandlerFunc: routingRuleController.CreateRoutingRule},
+		{Method: "GET", Pattern: "/api/v1/routing-rules/{ruleId}", Middlewares: platform(c, entities.ScopeAdmin, "admin"), HandlerFunc: routingRuleController.GetRoutingRule},
+		{Method: "PUT", Pattern: "/api/v1/routing-rules/{ruleId}", Middlewares: platform(c, entities.ScopeAdmin, "admin"), HandlerFunc: routingRuleController.ReplaceRoutingRule},
+		{Method: "DELETE", Pattern: "/api/v1/routing-rules/{ruleId}", Middlewares: platform(c, entities.ScopeAdmin, "admin"), HandlerFunc: routingRuleController.DeleteRoutingRule},
+	}
+}
+
+func SystemRoutes(c *container.Container) []app.Route {
+	statusController := c.StatusController
+	return []app.Route{
+		{Method: "GET", Pattern: "/healthz", HandlerFunc: statusController.Healthz},
+		{Method: "GET", Pattern: "/readyz", HandlerFunc: statusController.Readyz},
+		{Method: "GET", Pattern: "/status", Middlewares: platform(c, entities.ScopeAdmin, "admin"), HandlerFunc: statusController.Status},
+		{Method: "GET", Pattern: "/metrics", Middlewares: platform(c, entities.ScopeRead, "read"), HandlerFunc: metrics.Handler()},
+	}
 }